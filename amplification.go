@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// writeAmplificationReport measures, per table, how much of the row images
+// of its UPDATEs the change itself is. With binlog_row_image=FULL an UPDATE
+// logs the whole row twice however little of it changes: a table whose
+// updates touch a counter in a wide row writes mostly unchanged bytes, which
+// binlog_row_image=MINIMAL, or moving the hot columns to a table of their
+// own, would save.
+type writeAmplificationReport struct {
+	n      int
+	tables map[string]*tableAmplification
+	// partial counts the updates left out for lacking full row images.
+	partial int
+}
+
+type tableAmplification struct {
+	updates int
+	columns int // changed columns, over all updates
+	// changed is the bytes of the changed columns and logged those of all
+	// the columns, before and after.
+	changed, logged uint64
+	// ratio sums the changed share of the logged bytes of each update.
+	ratio float64
+	// minimal estimates the bytes binlog_row_image=MINIMAL would log: the
+	// key (see uniqueKey) before and the changed columns after. It is
+	// unknown, and noKey set, for a table without a known key.
+	minimal uint64
+	noKey   bool
+}
+
+func newWriteAmplificationReport(n int) *writeAmplificationReport {
+	return &writeAmplificationReport{n: n, tables: make(map[string]*tableAmplification)}
+}
+
+func (r *writeAmplificationReport) observe(e *replication.BinlogEvent) {
+	re, ok := e.Event.(*replication.RowsEvent)
+	if !ok || re.Table == nil || rowsEventKind(e.Header.EventType) != "UPDATE" {
+		return
+	}
+	name := tableName(re.Table)
+	for i := 0; i+1 < len(re.Rows); i += 2 {
+		before, after := markAbsent(re, i), markAbsent(re, i+1)
+		if !fullImage(before) || !fullImage(after) {
+			r.partial++
+			continue
+		}
+		t := r.tables[name]
+		if t == nil {
+			t = new(tableAmplification)
+			r.tables[name] = t
+		}
+		// A column set to or from NULL changes bytes on one side only.
+		var changed, changedAfter, logged uint64
+		for c := 0; c < len(before) && c < len(after); c++ {
+			b, a := uint64(columnBytes(re.Table, c, before[c])), uint64(columnBytes(re.Table, c, after[c]))
+			logged += b + a
+			if !reflect.DeepEqual(before[c], after[c]) {
+				t.columns++
+				changed += b + a
+				changedAfter += a
+			}
+		}
+		t.updates++
+		t.changed += changed
+		t.logged += logged
+		if logged > 0 {
+			t.ratio += float64(changed) / float64(logged)
+		}
+		key := uniqueKey(re.Table)
+		if key == nil {
+			t.noKey = true
+			continue
+		}
+		t.minimal += changedAfter
+		for _, k := range key {
+			if k < len(before) {
+				t.minimal += uint64(columnBytes(re.Table, k, before[k]))
+			}
+		}
+	}
+}
+
+// fullImage reports whether a row image carries all the columns.
+func fullImage(row []interface{}) bool {
+	for _, v := range row {
+		if isAbsent(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *writeAmplificationReport) report(w io.Writer) {
+	fmt.Fprintf(w, "=== Write amplification (top %d tables) ===\n", r.n)
+	names := make([]string, 0, len(r.tables))
+	updates := 0
+	for name, t := range r.tables {
+		names = append(names, name)
+		updates += t.updates
+	}
+	if len(names) == 0 {
+		fmt.Fprintln(w, "No UPDATEs with full row images")
+	}
+	// The worst are those whose updates change the smallest share of what
+	// they log, then those logging the most.
+	sort.Slice(names, func(i, j int) bool {
+		a, b := r.tables[names[i]], r.tables[names[j]]
+		ra, rb := a.ratio/float64(a.updates), b.ratio/float64(b.updates)
+		if ra != rb {
+			return ra < rb
+		}
+		if a.logged != b.logged {
+			return a.logged > b.logged
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > r.n {
+		names = names[:r.n]
+	}
+	noKey := false
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	if len(names) > 0 {
+		fmt.Fprintln(tw, "table\tupdates\tcolumns changed\tchanged\tlogged\tchanged share\tamplification\tMINIMAL~")
+	}
+	for _, name := range names {
+		t := r.tables[name]
+		factor := "-"
+		if t.changed > 0 {
+			factor = strconv.FormatFloat(float64(t.logged)/float64(t.changed), 'f', 1, 64) + "x"
+		}
+		minimal := "-"
+		if t.noKey {
+			noKey = true
+		} else {
+			minimal = formatByteSize(t.minimal)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%.1f\t%s\t%s\t%.1f%%\t%s\t%s\n", name, t.updates,
+			float64(t.columns)/float64(t.updates), formatByteSize(t.changed), formatByteSize(t.logged),
+			100*t.ratio/float64(t.updates), factor, minimal)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "%s with full row images in %s", plural(updates, "updated row"), plural(len(r.tables), "table"))
+	if r.partial > 0 {
+		fmt.Fprintf(w, "; %d without (binlog_row_image=MINIMAL or NOBLOB) left out", r.partial)
+	}
+	fmt.Fprintln(w)
+	if noKey {
+		fmt.Fprintln(w, "MINIMAL needs the key of the table, from binlog_row_metadata=FULL or -schemaFile")
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// annotator explains the event stream in plain English for -annotate. It
+// follows transaction boundaries so each event can be placed within its
+// transaction.
+type annotator struct {
+	tx txTracker
+	n  int
+}
+
+// appendAnnotation appends "# "-prefixed explanation lines for e to b. It
+// must see every event, in order, before the event itself is printed.
+func (a *annotator) appendAnnotation(b []byte, e *replication.BinlogEvent) []byte {
+	wasOpen := a.tx.cur != nil
+	done := a.tx.observe(e)
+
+	switch {
+	case !wasOpen && a.tx.cur != nil:
+		a.n = 1
+		b = appendNote(b, "Transaction start%s at position %d", describeGTID(a.tx.cur.GTID), a.tx.cur.Start)
+	case wasOpen && a.tx.cur != nil:
+		a.n++
+		b = appendNote(b, "%s event of %s", ordinal(a.n), describeTransaction(a.tx.cur))
+	}
+
+	switch ev := e.Event.(type) {
+	case *replication.FormatDescriptionEvent:
+		b = appendNote(b, "Format description: this file was written by MySQL %s and the header describes how to decode every later event",
+			strings.TrimRight(string(ev.ServerVersion), "\x00 "))
+	case *replication.PreviousGTIDsEvent:
+		if ev.GTIDSets == "" {
+			b = appendNote(b, "No GTIDs were executed before this file")
+		} else {
+			b = appendNote(b, "GTIDs already executed before this file: %s", ev.GTIDSets)
+		}
+	case *replication.RotateEvent:
+		b = appendNote(b, "Rotate: the binlog continues in %s at position %d", ev.NextLogName, ev.Position)
+	case *replication.GTIDEvent:
+		if ev.SequenceNumber > 0 {
+			b = appendNote(b, "Logical clock: can be applied in parallel with transactions after sequence number %d (this is %d)",
+				ev.LastCommitted, ev.SequenceNumber)
+		}
+	case *replication.QueryEvent:
+		b = a.appendQueryNote(b, ev, wasOpen)
+	case *replication.RowsQueryEvent:
+		b = appendNote(b, "The original statement that produced the rows events below")
+	case *replication.TableMapEvent:
+		b = appendNote(b, "Maps table id %d to %s (%d columns) for the rows events that follow",
+			ev.TableID, tableName(ev), ev.ColumnCount)
+	case *replication.RowsEvent:
+		b = appendRowsNote(b, e.Header.EventType, ev)
+	case *replication.XIDEvent:
+		// The commit itself is described below.
+	default:
+		if e.Header.EventType == replication.STOP_EVENT {
+			b = appendNote(b, "The server stopped or closed this binlog here")
+		}
+	}
+
+	if done != nil {
+		if !wasOpen {
+			a.n = 1
+		} else {
+			a.n++
+		}
+		b = appendNote(b, "Commit: ends %s (%d events, positions %d-%d)",
+			describeTransaction(done), a.n, done.Start, done.End)
+	}
+	return b
+}
+
+func (a *annotator) appendQueryNote(b []byte, ev *replication.QueryEvent, wasOpen bool) []byte {
+	q := strings.ToUpper(strings.TrimSpace(string(ev.Query)))
+	switch {
+	case q == "BEGIN":
+		return appendNote(b, "BEGIN: the row changes until the next COMMIT or XID belong to one transaction")
+	case q == "COMMIT":
+		return b
+	case q == "ROLLBACK":
+		return appendNote(b, "ROLLBACK: the changes of this transaction were discarded")
+	case a.tx.cur == nil && wasOpen:
+		return appendNote(b, "DDL statement in schema %s; it commits implicitly", schemaName(ev.Schema))
+	case a.tx.cur == nil:
+		return appendNote(b, "Statement outside a transaction in schema %s, committed on its own", schemaName(ev.Schema))
+	}
+	return appendNote(b, "Statement run in schema %s, took %ds", schemaName(ev.Schema), ev.ExecutionTime)
+}
+
+// appendRowsNote describes a rows event: what it changes and, for updates,
+// how many columns actually change.
+func appendRowsNote(b []byte, t replication.EventType, ev *replication.RowsEvent) []byte {
+	if ev.Table == nil {
+		return appendNote(b, "The TableMapEvent for table id %d is outside the parsed range, so these rows cannot be decoded", ev.TableID)
+	}
+	table := tableName(ev.Table)
+	switch rowsEventKind(t) {
+	case "INSERT":
+		b = appendNote(b, "This INSERT adds %s to %s", plural(len(ev.Rows), "row"), table)
+	case "DELETE":
+		b = appendNote(b, "This DELETE removes %s from %s", plural(len(ev.Rows), "row"), table)
+	case "UPDATE":
+		changed := make([]bool, ev.ColumnCount)
+		n := 0
+		for i := 0; i+1 < len(ev.Rows); i += 2 {
+			before, after := ev.Rows[i], ev.Rows[i+1]
+			for c := 0; c < len(before) && c < len(after) && c < len(changed); c++ {
+				if !changed[c] && !reflect.DeepEqual(before[c], after[c]) {
+					changed[c] = true
+					n++
+				}
+			}
+		}
+		b = appendNote(b, "This UPDATE changes %d of %d columns in %s of %s",
+			n, ev.ColumnCount, plural(len(ev.Rows)/2, "row"), table)
+	}
+	return appendAbsentNote(b, ev)
+}
+
+// appendAbsentNote notes the columns the row images of ev leave out, which
+// the dump shows as NULL.
+func appendAbsentNote(b []byte, ev *replication.RowsEvent) []byte {
+	var cols []int
+	for _, skips := range ev.SkippedColumns {
+		for _, c := range skips {
+			if !slices.Contains(cols, c) {
+				cols = append(cols, c)
+			}
+		}
+	}
+	if len(cols) == 0 {
+		return b
+	}
+	slices.Sort(cols)
+	names := columnNames(ev.Table)
+	absent := make([]string, len(cols))
+	for i, c := range cols {
+		absent[i] = columnLabel(names, c)
+	}
+	return appendNote(b, "Not in the row images (binlog_row_image=NOBLOB or MINIMAL): %s", strings.Join(absent, ", "))
+}
+
+func appendNote(b []byte, format string, args ...interface{}) []byte {
+	b = append(b, "# "...)
+	b = fmt.Appendf(b, format, args...)
+	return append(b, '\n')
+}
+
+func describeGTID(gtid string) string {
+	if gtid == "" {
+		return ""
+	}
+	return " (GTID " + gtid + ")"
+}
+
+func describeTransaction(t *transaction) string {
+	if t.GTID != "" {
+		return "GTID " + t.GTID
+	}
+	return "the transaction starting at " + strconv.FormatUint(uint64(t.Start), 10)
+}
+
+func schemaName(s []byte) string {
+	if len(s) == 0 {
+		return "(none)"
+	}
+	return string(s)
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return strconv.Itoa(n) + " " + noun + "s"
+}
+
+// ordinal renders n as 1st, 2nd, 3rd, 4th, ...
+func ordinal(n int) string {
+	suffix := "th"
+	if n%100 < 11 || n%100 > 13 {
+		switch n % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return strconv.Itoa(n) + suffix
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// anomaly is a single suspicious finding, located by log position.
+type anomaly struct {
+	pos    uint32
+	kind   string
+	detail string
+}
+
+// anomalyReport detects duplicate GTIDs, repeated XIDs and transactions that
+// never reach an XID or COMMIT. These usually mean a server crash mid-write
+// or a damaged copy of the binlog.
+type anomalyReport struct {
+	tx       txTracker
+	gtids    map[string]uint32
+	xids     map[uint64]uint32
+	findings []anomaly
+}
+
+func newAnomalyReport() *anomalyReport {
+	return &anomalyReport{
+		gtids: make(map[string]uint32),
+		xids:  make(map[uint64]uint32),
+	}
+}
+
+func (r *anomalyReport) add(pos uint32, kind, format string, args ...interface{}) {
+	r.findings = append(r.findings, anomaly{pos: pos, kind: kind, detail: fmt.Sprintf(format, args...)})
+}
+
+func (r *anomalyReport) observe(e *replication.BinlogEvent) {
+	start := e.Header.LogPos - e.Header.EventSize
+
+	switch ev := e.Event.(type) {
+	case *replication.GTIDEvent:
+		if gtid := gtidString(ev); gtid != "" {
+			if first, ok := r.gtids[gtid]; ok {
+				r.add(start, "duplicate GTID", "GTID %s at %d was already seen at %d", gtid, start, first)
+			} else {
+				r.gtids[gtid] = start
+			}
+		}
+		r.checkUnterminated(start)
+	case *replication.QueryEvent:
+		if strings.EqualFold(strings.TrimSpace(string(ev.Query)), "BEGIN") && r.tx.begun {
+			r.checkUnterminated(start)
+		}
+	case *replication.XIDEvent:
+		if first, ok := r.xids[ev.XID]; ok {
+			r.add(start, "repeated XID", "XID %d at %d was already seen at %d", ev.XID, start, first)
+		} else {
+			r.xids[ev.XID] = start
+		}
+	}
+
+	r.tx.observe(e)
+}
+
+// checkUnterminated records the open transaction, if any, as abandoned by a
+// new transaction starting at pos.
+func (r *anomalyReport) checkUnterminated(pos uint32) {
+	if cur := r.tx.cur; cur != nil {
+		r.add(cur.Start, "unterminated transaction", "transaction%s starting at %d has no XID/COMMIT before the next transaction at %d",
+			gtidSuffix(cur.GTID), cur.Start, pos)
+		r.tx.cur, r.tx.begun = nil, false
+	}
+}
+
+func (r *anomalyReport) report(w io.Writer) {
+	if cur := r.tx.cur; cur != nil {
+		r.add(cur.Start, "unterminated transaction", "transaction%s starting at %d is still open at the end of the parsed range",
+			gtidSuffix(cur.GTID), cur.Start)
+	}
+
+	fmt.Fprintln(w, "=== Anomalies ===")
+	if len(r.findings) == 0 {
+		fmt.Fprintln(w, "No anomalies found")
+	}
+	counts := make(map[string]int)
+	for _, a := range r.findings {
+		fmt.Fprintf(w, "%d  %s: %s\n", a.pos, a.kind, a.detail)
+		counts[a.kind]++
+	}
+	for _, kind := range []string{"duplicate GTID", "repeated XID", "unterminated transaction"} {
+		if counts[kind] > 0 {
+			fmt.Fprintf(w, "%s: %d\n", kind, counts[kind])
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+func gtidSuffix(gtid string) string {
+	if gtid == "" {
+		return ""
+	}
+	return " " + gtid
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// untaggedApplication keys data changes whose statement carried no
+// application tag.
+const untaggedApplication = "(untagged)"
+
+// appStats counts the write volume attributed to one application tag.
+type appStats struct {
+	events int
+	rows   int
+	bytes  uint64
+}
+
+// applicationTag extracts the application named in the comments of a
+// statement, in any of the common styles:
+//
+//	/* app=checkout */ UPDATE ...
+//	/*application:checkout,controller:orders,action:create*/   (marginalia)
+//	UPDATE ... /*app='checkout',route='%2Forders'*/            (sqlcommenter)
+//
+// keys lists the accepted tag names in order of preference, compared
+// case-insensitively.
+func applicationTag(query string, keys []string) string {
+	found := make(map[string]string)
+	for {
+		start := strings.Index(query, "/*")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(query[start+2:], "*/")
+		if end < 0 {
+			break
+		}
+		comment := query[start+2 : start+2+end]
+		query = query[start+2+end+2:]
+		for _, pair := range strings.FieldsFunc(comment, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\n' }) {
+			i := strings.IndexAny(pair, "=:")
+			if i <= 0 {
+				continue
+			}
+			key := strings.ToLower(pair[:i])
+			if _, ok := found[key]; !ok {
+				found[key] = strings.Trim(pair[i+1:], `'"`)
+			}
+		}
+	}
+	for _, k := range keys {
+		if v := found[strings.ToLower(k)]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// appTagKeys returns the keys configured by -appTags.
+func appTagKeys() []string {
+	var keys []string
+	for _, k := range strings.Split(*appTags, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// observeApplication attributes the data changes of e to the application
+// tag of the statement that made them. A Query event carries its own
+// statement; rows events belong to the preceding ROWS_QUERY event (written
+// with binlog_rows_query_log_events=ON) of the same transaction.
+func (r *statsReport) observeApplication(e *replication.BinlogEvent) {
+	switch ev := e.Event.(type) {
+	case *replication.GTIDEvent, *replication.XIDEvent:
+		r.app = ""
+		return
+	case *replication.QueryEvent:
+		q := string(ev.Query)
+		switch statementVerb(q) {
+		case "BEGIN", "COMMIT", "ROLLBACK", "":
+			r.app = ""
+			return
+		}
+		r.addApplication(applicationTag(q, r.appKeys), e)
+	case *replication.RowsQueryEvent:
+		r.app = applicationTag(string(ev.Query), r.appKeys)
+		r.addApplication(r.app, e)
+	case *replication.TableMapEvent, *replication.RowsEvent:
+		r.addApplication(r.app, e)
+	}
+}
+
+func (r *statsReport) addApplication(app string, e *replication.BinlogEvent) {
+	if app == "" {
+		app = untaggedApplication
+	} else {
+		r.appTagged = true
+	}
+	as := r.apps[app]
+	if as == nil {
+		as = new(appStats)
+		r.apps[app] = as
+	}
+	as.events++
+	as.rows += rowsAffected(e)
+	as.bytes += uint64(e.Header.EventSize)
+}
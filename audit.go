@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// auditTable returns the table of audit: -table, qualified by -db when it
+// names no database.
+func auditTable() string {
+	if *valueDB != "" && !strings.Contains(*valueTable, ".") {
+		return *valueDB + "." + *valueTable
+	}
+	return *valueTable
+}
+
+// printAudit writes the change history of h, which replayed every write to
+// its row: each committed write with its time, position and GTID, an
+// INSERT with the row it wrote, an UPDATE with the columns it changed and
+// a DELETE with the row it removed.
+func printAudit(w io.Writer, h *rowHistory) {
+	key := strings.Join(h.key, ",")
+	if len(h.writes) == 0 {
+		fmt.Fprintf(w, "%s %s: no committed change in the parsed range\n", h.table, key)
+		return
+	}
+	fmt.Fprintf(w, "%s %s: %s\n", h.table, key, plural(len(h.writes), "change"))
+	var prev []interface{}
+	for _, wr := range h.writes {
+		at := fmt.Sprintf("%s:%d", wr.file, wr.pos)
+		ts := time.Unix(int64(wr.timestamp), 0).Format(timeFormat)
+		fmt.Fprintf(w, "  %s  %-24s %s%s\n", ts, at, wr.op, gtidSuffix(wr.gtid))
+		switch {
+		case wr.note != "":
+			fmt.Fprintf(w, "    %s\n", wr.note)
+		case wr.row == nil:
+			// The row is gone; show what it was.
+			printAuditRow(w, wr, wr.before, nil)
+		case wr.op == "UPDATE" && prev != nil:
+			printAuditRow(w, wr, wr.row, prev)
+		default:
+			printAuditRow(w, wr, wr.row, nil)
+		}
+		prev = wr.row
+	}
+	if len(h.pending) > 0 {
+		fmt.Fprintf(w, "%s of a transaction with no commit in the parsed range not shown\n", plural(len(h.pending), "change"))
+	}
+}
+
+// printAuditRow writes the values of row as the dump shows them, or with
+// prev only those that differ from it, as before -> after.
+func printAuditRow(w io.Writer, wr *rowWrite, row, prev []interface{}) {
+	unsigned := wr.table.UnsignedMap()
+	lists := columnValueLists(wr.table)
+	shown := func(i int, v interface{}) string {
+		if i < len(wr.table.ColumnType) {
+			v = exactValue(wr.table, lists, i, displayTimestamp(wr.table, i, typedValue(wr.table, unsigned, i, v)))
+		}
+		return string(appendValue(nil, v))
+	}
+	for i, v := range row {
+		after := shown(i, v)
+		if prev != nil {
+			if i >= len(prev) {
+				continue
+			}
+			before := shown(i, prev[i])
+			if before == after {
+				continue
+			}
+			after = before + " -> " + after
+		}
+		fmt.Fprintf(w, "    %s: %s\n", columnLabel(wr.columns, i), after)
+	}
+}
+
+func auditCommand(startPosition int64) {
+	if *valueTable == "" || *valuePK == "" {
+		fmt.Fprintf(os.Stderr, "Error: audit requires -table and -pk\n")
+		os.Exit(1)
+	}
+	h := &rowHistory{table: auditTable(), key: strings.Split(*valuePK, ","), all: true}
+	fileStart := startPosition
+	err := parseBinlogs(newParser(true), binlogFiles, startPosition, func(file string, start int64) {
+		fileStart = start
+		h.file = filepath.Base(file)
+	}, func(e *replication.BinlogEvent) error {
+		if beforeStart(e, fileStart) {
+			return nil
+		}
+		return h.observe(e)
+	})
+	printAudit(os.Stdout, h)
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+}
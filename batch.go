@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/google/uuid"
+)
+
+// batchJob is one extraction listed in a -manifest file. All bounds are
+// optional; an event is written to Output when it passes every bound that
+// is set.
+type batchJob struct {
+	Name   string `json:"name"`
+	Output string `json:"output"`
+	// Format is "text" (the default, the latest -outputVersion) or
+	// "json", one event document per line.
+	Format string `json:"format,omitempty"`
+	// Start and Stop bound the start positions of events; Stop is
+	// exclusive.
+	Start     int64  `json:"start,omitempty"`
+	Stop      int64  `json:"stop,omitempty"`
+	StartTime string `json:"start_time,omitempty"`
+	StopTime  string `json:"stop_time,omitempty"`
+	// GTIDs keeps the events of transactions in this GTID set.
+	GTIDs string `json:"gtids,omitempty"`
+	// Tables keeps table map and rows events of matching tables, given as
+	// db.table with * wildcards. Events that name no table are dropped
+	// when Tables is set.
+	Tables []string `json:"tables,omitempty"`
+
+	gtids               *mysql.MysqlGTIDSet
+	startTime, stopTime time.Time
+	w                   *bufio.Writer
+	events              int
+}
+
+// loadManifest reads and validates a JSON array of batch jobs.
+func loadManifest(name string) ([]*batchJob, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var jobs []*batchJob
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("%s: no jobs", name)
+	}
+	for i, j := range jobs {
+		if j.Name == "" {
+			j.Name = fmt.Sprintf("job %d", i+1)
+		}
+		if err := j.compile(); err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", name, j.Name, err)
+		}
+	}
+	return jobs, nil
+}
+
+func (j *batchJob) compile() error {
+	if j.Output == "" {
+		return fmt.Errorf("no output")
+	}
+	switch j.Format {
+	case "":
+		j.Format = "text"
+	case "text", "json":
+	default:
+		return fmt.Errorf("unknown format %q", j.Format)
+	}
+	if j.Stop > 0 && j.Stop <= j.Start {
+		return fmt.Errorf("stop %d is not after start %d", j.Stop, j.Start)
+	}
+	var err error
+	if j.StartTime != "" {
+		if j.startTime, err = parseDatetime(j.StartTime); err != nil {
+			return err
+		}
+	}
+	if j.StopTime != "" {
+		if j.stopTime, err = parseDatetime(j.StopTime); err != nil {
+			return err
+		}
+	}
+	if j.GTIDs != "" {
+		set, err := mysql.ParseMysqlGTIDSet(j.GTIDs)
+		if err != nil {
+			return fmt.Errorf("invalid gtids %q: %v", j.GTIDs, err)
+		}
+		j.gtids = set.(*mysql.MysqlGTIDSet)
+	}
+	for _, t := range j.Tables {
+		if _, err := path.Match(t, ""); err != nil {
+			return fmt.Errorf("invalid table pattern %q", t)
+		}
+	}
+	return nil
+}
+
+// done reports whether no event at or after start can match j.
+func (j *batchJob) done(start uint32) bool {
+	return j.Stop > 0 && int64(start) >= j.Stop
+}
+
+func (j *batchJob) matches(e *replication.BinlogEvent, gtid *replication.GTIDEvent) bool {
+	start := int64(e.Header.LogPos - e.Header.EventSize)
+	if start < j.Start || (j.Stop > 0 && start >= j.Stop) {
+		return false
+	}
+	ts := time.Unix(int64(e.Header.Timestamp), 0)
+	if !j.startTime.IsZero() && ts.Before(j.startTime) || !j.stopTime.IsZero() && !ts.Before(j.stopTime) {
+		return false
+	}
+	if j.gtids != nil && (gtid == nil || !gtidSetContains(j.gtids, gtid)) {
+		return false
+	}
+	if len(j.Tables) > 0 {
+		table := ""
+		switch ev := e.Event.(type) {
+		case *replication.TableMapEvent:
+			table = tableName(ev)
+		case *replication.RowsEvent:
+			if ev.Table != nil {
+				table = tableName(ev.Table)
+			}
+		}
+		return table != "" && matchTable(j.Tables, table)
+	}
+	return true
+}
+
+// gtidSetContains reports whether the transaction of ev is in set.
+func gtidSetContains(set *mysql.MysqlGTIDSet, ev *replication.GTIDEvent) bool {
+	u, err := uuid.FromBytes(ev.SID)
+	if err != nil {
+		return false
+	}
+	s := set.Sets[u.String()]
+	if s == nil {
+		return false
+	}
+	for _, in := range s.Intervals {
+		if ev.GNO >= in.Start && ev.GNO < in.Stop {
+			return true
+		}
+	}
+	return false
+}
+
+// matchTable reports whether table matches any of the db.table patterns.
+func matchTable(patterns []string, table string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, table); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (j *batchJob) write(e *replication.BinlogEvent, src *eventSource) error {
+	j.events++
+	if j.Format == "json" {
+		return json.NewEncoder(j.w).Encode(src.document(e))
+	}
+	buf := getBuffer()
+	b := appendTextEvent(*buf, e, textOutputLatest)
+	_, err := j.w.Write(b)
+	putBuffer(buf, b)
+	return err
+}
+
+// runBatch executes every job in a single pass over binlogFile, starting
+// at the earliest job start and stopping once every job with a stop
+// position is past it.
+func runBatch(binlogFile string, jobs []*batchJob, out io.Writer) error {
+	start := int64(4)
+	for i, j := range jobs {
+		if i == 0 || j.Start < start {
+			start = max(j.Start, 4)
+		}
+	}
+	for _, j := range jobs {
+		f, err := os.Create(j.Output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		j.w = bufio.NewWriterSize(f, outputBufferSize)
+	}
+
+	// gtid is the GTID event of the open transaction.
+	var gtid *replication.GTIDEvent
+	var tx txTracker
+	src := newEventSource(binlogFile)
+	err := parseBinlog(newParser(true), binlogFile, start, func(e *replication.BinlogEvent) error {
+		src.observe(e)
+		if beforeStart(e, start) {
+			return nil
+		}
+		if ev, ok := e.Event.(*replication.GTIDEvent); ok {
+			gtid = ev
+		}
+		pos := e.Header.LogPos - e.Header.EventSize
+		finished := true
+		for _, j := range jobs {
+			if j.done(pos) {
+				continue
+			}
+			finished = false
+			if j.matches(e, gtid) {
+				if err := j.write(e, src); err != nil {
+					return fmt.Errorf("%s: %v", j.Output, err)
+				}
+			}
+		}
+		if finished {
+			return errStopParsing
+		}
+		if tx.observe(e) != nil {
+			gtid = nil
+		}
+		return nil
+	})
+
+	for _, j := range jobs {
+		if ferr := j.w.Flush(); ferr != nil && err == nil {
+			err = fmt.Errorf("%s: %v", j.Output, ferr)
+		}
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "job\tevents\toutput")
+	for _, j := range jobs {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", j.Name, j.events, j.Output)
+	}
+	tw.Flush()
+	return err
+}
+
+func batchCommand(int64) {
+	if *manifest == "" {
+		fmt.Fprintf(os.Stderr, "Error: batch requires -manifest <jobs file>\n")
+		os.Exit(1)
+	}
+	jobs, err := loadManifest(*manifest)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := runBatch(*binlogFile, jobs, os.Stdout); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+}
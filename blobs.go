@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// blobModes are the values of -blobMode.
+var blobModes = []string{"truncate", "hex", "base64", "skip"}
+
+// shownBlob is a BLOB or TEXT value as -blobMode shows it.
+type shownBlob string
+
+func (s shownBlob) String() string { return string(s) }
+
+// blobValue is value v of column i of table t as output shows it: with
+// -blobMode, a BLOB or TEXT value of more than -blobThreshold bytes
+// truncated to that many, followed by its size; as a hex or base64
+// expression of its bytes; or as its size alone.
+func blobValue(t *replication.TableMapEvent, i int, v interface{}) interface{} {
+	if *blobMode == "" || i >= len(t.ColumnType) || t.ColumnType[i] != mysql.MYSQL_TYPE_BLOB {
+		return v
+	}
+	var b []byte
+	switch v := v.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return v
+	}
+	if len(b) <= *blobThreshold {
+		return v
+	}
+	switch *blobMode {
+	case "truncate":
+		n := *blobThreshold
+		if _, text := v.(string); text {
+			// Cut a TEXT value between characters.
+			for n > 0 && !utf8.RuneStart(b[n]) {
+				n--
+			}
+		}
+		return shownBlob(fmt.Sprintf("%s... (%d bytes)", strconv.Quote(string(b[:n])), len(b)))
+	case "hex":
+		return shownBlob("X'" + hex.EncodeToString(b) + "'")
+	case "base64":
+		return shownBlob("FROM_BASE64('" + base64.StdEncoding.EncodeToString(b) + "')")
+	}
+	return shownBlob(fmt.Sprintf("(%d bytes, not shown)", len(b)))
+}
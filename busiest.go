@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// intervalCounter buckets events and affected rows into fixed-width time windows.
+// With -maintenance it also buckets the rows events of each table, so the
+// writes of maintenance copies can be told apart once they are known.
+type intervalCounter struct {
+	width  int64
+	events map[int64]int
+	rows   map[int64]int
+
+	tableEvents map[string]map[int64]int
+	tableRows   map[string]map[int64]int
+}
+
+func newIntervalCounter(width time.Duration) *intervalCounter {
+	return &intervalCounter{
+		width:  int64(width / time.Second),
+		events: make(map[int64]int),
+		rows:   make(map[int64]int),
+	}
+}
+
+func (c *intervalCounter) add(e *replication.BinlogEvent) {
+	bucket := int64(e.Header.Timestamp) / c.width * c.width
+	c.events[bucket]++
+	c.rows[bucket] += rowsAffected(e)
+
+	re, ok := e.Event.(*replication.RowsEvent)
+	if maintenance == nil || !ok || re.Table == nil {
+		return
+	}
+	if c.tableEvents == nil {
+		c.tableEvents = make(map[string]map[int64]int)
+		c.tableRows = make(map[string]map[int64]int)
+	}
+	name := tableName(re.Table)
+	if c.tableEvents[name] == nil {
+		c.tableEvents[name] = make(map[int64]int)
+		c.tableRows[name] = make(map[int64]int)
+	}
+	c.tableEvents[name][bucket]++
+	c.tableRows[name][bucket] += rowsAffected(e)
+}
+
+// maintenanceCounts returns the events and rows per bucket written by the
+// tables the -maintenance detector attributes to maintenance operations.
+func (c *intervalCounter) maintenanceCounts() (events, rows map[int64]int) {
+	events, rows = make(map[int64]int), make(map[int64]int)
+	for name, counts := range c.tableEvents {
+		if maintenance.operation(name) == "" {
+			continue
+		}
+		for b, v := range counts {
+			events[b] += v
+		}
+		for b, v := range c.tableRows[name] {
+			rows[b] += v
+		}
+	}
+	return events, rows
+}
+
+// organic returns counts less the maintenance counts m.
+func organic(counts, m map[int64]int) map[int64]int {
+	out := make(map[int64]int, len(counts))
+	for b, v := range counts {
+		out[b] = v - m[b]
+	}
+	return out
+}
+
+// top returns the n buckets with the highest counts, breaking ties by time.
+func (c *intervalCounter) top(counts map[int64]int, n int) []int64 {
+	buckets := make([]int64, 0, len(counts))
+	for b, v := range counts {
+		if v > 0 {
+			buckets = append(buckets, b)
+		}
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		if counts[buckets[i]] != counts[buckets[j]] {
+			return counts[buckets[i]] > counts[buckets[j]]
+		}
+		return buckets[i] < buckets[j]
+	})
+	if len(buckets) > n {
+		buckets = buckets[:n]
+	}
+	return buckets
+}
+
+// dump prints the busiest buckets. With -maintenance they are ranked by
+// organic traffic, and the maintenance share of each is shown.
+func (c *intervalCounter) dump(w io.Writer, name string, n int) {
+	var mEvents, mRows map[int64]int
+	label := ""
+	if maintenance != nil {
+		mEvents, mRows = c.maintenanceCounts()
+		label = "organic "
+	}
+	for _, metric := range []struct {
+		label  string
+		counts map[int64]int
+		m      map[int64]int
+	}{
+		{"events", c.events, mEvents},
+		{"rows affected", c.rows, mRows},
+	} {
+		fmt.Fprintf(w, "=== Busiest %s by %s%s ===\n", name, label, metric.label)
+		counts := metric.counts
+		if maintenance != nil {
+			counts = organic(counts, metric.m)
+		}
+		for _, b := range c.top(counts, n) {
+			fmt.Fprintf(w, "%s  events: %d  rows: %d",
+				time.Unix(b, 0).Format(timeFormat), c.events[b], c.rows[b])
+			if maintenance != nil {
+				fmt.Fprintf(w, "  maintenance events: %d  rows: %d", mEvents[b], mRows[b])
+			}
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// rowsAffected returns the number of rows changed by a rows event. Update
+// events carry a before and after image per row, so they count once per pair.
+func rowsAffected(e *replication.BinlogEvent) int {
+	re, ok := e.Event.(*replication.RowsEvent)
+	if !ok {
+		return 0
+	}
+	if rowsEventKind(e.Header.EventType) == "UPDATE" {
+		return len(re.Rows) / 2
+	}
+	return len(re.Rows)
+}
+
+// busiestReport tracks the busiest one-second and one-minute windows.
+type busiestReport struct {
+	n       int
+	seconds *intervalCounter
+	minutes *intervalCounter
+}
+
+func newBusiestReport(n int) *busiestReport {
+	return &busiestReport{
+		n:       n,
+		seconds: newIntervalCounter(time.Second),
+		minutes: newIntervalCounter(time.Minute),
+	}
+}
+
+func (r *busiestReport) observe(e *replication.BinlogEvent) {
+	if e.Header.Timestamp == 0 {
+		return
+	}
+	r.seconds.add(e)
+	r.minutes.add(e)
+}
+
+func (r *busiestReport) report(w io.Writer) {
+	r.seconds.dump(w, "seconds", r.n)
+	r.minutes.dump(w, "minutes", r.n)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// binlogBase is the name a server gives the binlog at name, without its
+// directory or a .gz or .zst extension.
+func binlogBase(name string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(path.Base(name), ".gz"), ".zst")
+}
+
+// binlogSequence returns the sequence number of a binlog name such as
+// mysql-bin.000042, and the name before it.
+func binlogSequence(name string) (prefix string, n int, ok bool) {
+	base := binlogBase(name)
+	dot := strings.LastIndexByte(base, '.')
+	if dot < 0 {
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(base[dot+1:])
+	return base[:dot], n, err == nil
+}
+
+// chainLink is one file of a chain check and what it found between that
+// file and the one before.
+type chainLink struct {
+	md       *fileMetadata
+	gtids    *fileGTIDs
+	problems []string
+}
+
+// checkChain checks that files follow on from each other as the server
+// wrote them: each file's ROTATE event names the next file, sequence
+// numbers leave no gap, and each file's Previous_gtids is what the files
+// before it executed. A file lost from an archive leaves a gap in the
+// sequence or in the GTIDs; a file replaced by another server's leaves
+// GTIDs that do not chain.
+func checkChain(w io.Writer, files []string) (problems int, err error) {
+	var prev *chainLink
+	for i, file := range files {
+		md, err := loadFileMetadata(file, !*noCache)
+		if md == nil {
+			return problems, err
+		}
+		link := &chainLink{md: md}
+		if err != nil {
+			link.problems = append(link.problems, err.Error())
+		}
+		if link.gtids, err = newFileGTIDs(md); err != nil {
+			return problems, err
+		}
+		if prev != nil {
+			link.problems = append(link.problems, chainProblems(prev, link)...)
+		}
+		if md.Ends == "" && i < len(files)-1 {
+			link.problems = append(link.problems, "not closed by the server: it crashed, or the copy is incomplete")
+		}
+		printChainLink(w, link)
+		problems += len(link.problems)
+		prev = link
+	}
+	if prev != nil && prev.md.Ends == "rotate" {
+		fmt.Fprintf(w, "The chain continues in %s, which is not among the files\n", prev.md.NextLog)
+	}
+	return problems, nil
+}
+
+// chainProblems compares file b with a, the file before it.
+func chainProblems(a, b *chainLink) []string {
+	var problems []string
+	aName, bName := binlogBase(a.md.Path), binlogBase(b.md.Path)
+	aPrefix, aSeq, aOK := binlogSequence(aName)
+	bPrefix, bSeq, bOK := binlogSequence(bName)
+	switch {
+	case a.md.Ends == "rotate" && a.md.NextLog != bName:
+		if nPrefix, nSeq, ok := binlogSequence(a.md.NextLog); ok && aOK && bOK && nPrefix == bPrefix && aSeq < nSeq && nSeq < bSeq {
+			problems = append(problems, fmt.Sprintf("%s rotated to %s: %s missing", aName, a.md.NextLog, missingFiles(bPrefix, nSeq, bSeq)))
+		} else {
+			problems = append(problems, fmt.Sprintf("%s rotated to %s, not to this file", aName, a.md.NextLog))
+		}
+	case aOK && bOK && aPrefix == bPrefix && bSeq > aSeq+1:
+		problems = append(problems, missingFiles(bPrefix, aSeq+1, bSeq)+" missing")
+	case aOK && bOK && (aPrefix != bPrefix || bSeq <= aSeq):
+		problems = append(problems, fmt.Sprintf("does not follow %s", aName))
+	}
+
+	// The server writes into Previous_gtids all it executed before the
+	// file, which is what it had executed at the end of the one before.
+	want, have := a.gtids.executed, b.gtids.previous
+	if want.String() == have.String() {
+		return problems
+	}
+	if lost := gtidSetMinus(want, have); lost != "" {
+		problems = append(problems, fmt.Sprintf("Previous_gtids lacks %s, executed by the end of %s: replaced, or from another server", lost, aName))
+	}
+	if gap := gtidSetMinus(have, want); gap != "" {
+		problems = append(problems, fmt.Sprintf("Previous_gtids has %s, which no file before it has: transactions in a missing file, or gtid_purged was set", gap))
+	}
+	return problems
+}
+
+// missingFiles names the files of a sequence from from up to to.
+func missingFiles(prefix string, from, to int) string {
+	name := func(n int) string { return fmt.Sprintf("%s.%06d", prefix, n) }
+	switch to - from {
+	case 1:
+		return name(from)
+	case 2:
+		return name(from) + " and " + name(from+1)
+	}
+	return fmt.Sprintf("%s to %s (%d files)", name(from), name(to-1), to-from)
+}
+
+// gtidSetMinus renders the GTIDs of a that b does not have.
+func gtidSetMinus(a, b *mysql.MysqlGTIDSet) string {
+	d := a.Clone().(*mysql.MysqlGTIDSet)
+	if err := d.Minus(*b); err != nil {
+		return ""
+	}
+	return d.String()
+}
+
+func printChainLink(w io.Writer, link *chainLink) {
+	md := link.md
+	end := "not closed"
+	switch md.Ends {
+	case "rotate":
+		end = "rotates to " + md.NextLog
+	case "stop":
+		end = "server stopped"
+	}
+	status := "ok"
+	if len(link.problems) > 0 {
+		status = "PROBLEM"
+	}
+	fmt.Fprintf(w, "%s  positions %d-%d  %s  GTIDs %s  %s\n", md.Path, md.FirstPos, md.LastPos, end,
+		gtidSetString(link.gtids.contained), status)
+	for _, p := range link.problems {
+		fmt.Fprintf(w, "  %s\n", p)
+	}
+}
+
+func checkChainCommand(int64) {
+	files, err := expandBinlogFiles(*binlogFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	problems, err := checkChain(os.Stdout, files)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	if problems > 0 {
+		fmt.Printf("%s in %s\n", plural(problems, "problem"), plural(len(files), "file"))
+		os.Exit(1)
+	}
+	fmt.Printf("Chain complete: %s\n", plural(len(files), "file"))
+}
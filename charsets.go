@@ -0,0 +1,225 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/encoding/unicode/utf32"
+)
+
+// collationCharsets are the character sets of MySQL's collations by id,
+// for those below 100; collationCharset knows the ranges above.
+var collationCharsets = map[uint64]string{
+	1: "big5", 2: "latin2", 3: "dec8", 4: "cp850", 5: "latin1", 6: "hp8", 7: "koi8r", 8: "latin1",
+	9: "latin2", 10: "swe7", 11: "ascii", 12: "ujis", 13: "sjis", 14: "cp1251", 15: "latin1",
+	16: "hebrew", 18: "tis620", 19: "euckr", 20: "latin7", 21: "latin2", 22: "koi8u", 23: "cp1251",
+	24: "gb2312", 25: "greek", 26: "cp1250", 27: "latin2", 28: "gbk", 29: "cp1257", 30: "latin5",
+	31: "latin1", 32: "armscii8", 33: "utf8mb3", 34: "cp1250", 35: "ucs2", 36: "cp866",
+	37: "keybcs2", 38: "macce", 39: "macroman", 40: "cp852", 41: "latin7", 42: "latin7",
+	43: "macce", 44: "cp1250", 45: "utf8mb4", 46: "utf8mb4", 47: "latin1", 48: "latin1",
+	49: "latin1", 50: "cp1251", 51: "cp1251", 52: "cp1251", 53: "macroman", 54: "utf16",
+	55: "utf16", 56: "utf16le", 57: "cp1256", 58: "cp1257", 59: "cp1257", 60: "utf32", 61: "utf32",
+	62: "utf16le", 63: "binary", 64: "armscii8", 65: "ascii", 66: "cp1250", 67: "cp1256",
+	68: "cp866", 69: "dec8", 70: "greek", 71: "hebrew", 72: "hp8", 73: "keybcs2", 74: "koi8r",
+	75: "koi8u", 76: "utf8mb3", 77: "latin2", 78: "latin5", 79: "latin7", 80: "cp850", 81: "cp852",
+	82: "swe7", 83: "utf8mb3", 84: "big5", 85: "euckr", 86: "gb2312", 87: "gbk", 88: "sjis",
+	89: "tis620", 90: "ucs2", 91: "ujis", 92: "geostd8", 93: "geostd8", 94: "latin1", 95: "cp932",
+	96: "cp932", 97: "eucjpms", 98: "eucjpms", 99: "cp1250",
+}
+
+// collationCharset returns the character set of collation id, or "" for
+// one go-parse does not know.
+func collationCharset(id uint64) string {
+	switch {
+	case id < 100:
+		return collationCharsets[id]
+	case id >= 101 && id <= 124:
+		return "utf16"
+	case id >= 128 && id <= 151, id == 159:
+		return "ucs2"
+	case id >= 160 && id <= 183:
+		return "utf32"
+	case id >= 192 && id <= 215, id == 223:
+		return "utf8mb3"
+	case id >= 224 && id <= 247, id >= 255 && id <= 323:
+		return "utf8mb4"
+	case id >= 248 && id <= 250:
+		return "gb18030"
+	}
+	return ""
+}
+
+// charsetEncodings decode the character sets go-parse converts to UTF-8.
+// MySQL's latin1 is Windows-1252.
+var charsetEncodings = map[string]encoding.Encoding{
+	"latin1":   charmap.Windows1252,
+	"latin2":   charmap.ISO8859_2,
+	"latin5":   charmap.ISO8859_9,
+	"latin7":   charmap.ISO8859_13,
+	"greek":    charmap.ISO8859_7,
+	"hebrew":   charmap.ISO8859_8,
+	"tis620":   charmap.Windows874,
+	"cp1250":   charmap.Windows1250,
+	"cp1251":   charmap.Windows1251,
+	"cp1256":   charmap.Windows1256,
+	"cp1257":   charmap.Windows1257,
+	"cp850":    charmap.CodePage850,
+	"cp852":    charmap.CodePage852,
+	"cp866":    charmap.CodePage866,
+	"koi8r":    charmap.KOI8R,
+	"koi8u":    charmap.KOI8U,
+	"macroman": charmap.Macintosh,
+	"big5":     traditionalchinese.Big5,
+	"gb2312":   simplifiedchinese.GBK,
+	"gbk":      simplifiedchinese.GBK,
+	"gb18030":  simplifiedchinese.GB18030,
+	"sjis":     japanese.ShiftJIS,
+	"cp932":    japanese.ShiftJIS,
+	"ujis":     japanese.EUCJP,
+	"eucjpms":  japanese.EUCJP,
+	"euckr":    korean.EUCKR,
+	"ucs2":     unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+	"utf16":    unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+	"utf16le":  unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+	"utf32":    utf32.UTF32(utf32.BigEndian, utf32.IgnoreBOM),
+}
+
+// columnCharsets returns the character set of each column of table t: for
+// a character column the one of its collation in the table map with
+// binlog_row_metadata=FULL, else the one -schemaFile gives it, else "".
+func columnCharsets(t *replication.TableMapEvent) []string {
+	charsets := make([]string, len(t.ColumnType))
+	if collations := t.CollationMap(); len(collations) > 0 {
+		for i, id := range collations {
+			charsets[i] = collationCharset(id)
+		}
+		return charsets
+	}
+	if s := schemaFor(t); s != nil {
+		for i, cs := range s.charsets {
+			charsets[i] = cs
+		}
+	}
+	return charsets
+}
+
+// charsetDecoder converts the string values of a table's columns into
+// UTF-8, by column index; a nil converter leaves the column alone.
+type charsetDecoder []func(v interface{}) interface{}
+
+// charsetDecoders caches the decoder of each table map, as a table map is
+// shared by the rows events that follow it.
+var charsetDecoders = struct {
+	sync.Mutex
+	m map[*replication.TableMapEvent]charsetDecoder
+}{m: make(map[*replication.TableMapEvent]charsetDecoder)}
+
+func charsetDecoderFor(t *replication.TableMapEvent) charsetDecoder {
+	charsetDecoders.Lock()
+	defer charsetDecoders.Unlock()
+	if d, ok := charsetDecoders.m[t]; ok {
+		return d
+	}
+	var d charsetDecoder
+	for i, cs := range columnCharsets(t) {
+		var convert func(v interface{}) interface{}
+		switch {
+		case cs == "binary":
+			if t.ColumnType[i] != mysql.MYSQL_TYPE_BLOB {
+				convert = binaryValue
+			}
+		case charsetEncodings[cs] != nil:
+			convert = decodeWith(charsetEncodings[cs])
+		}
+		if convert == nil {
+			continue
+		}
+		if d == nil {
+			d = make(charsetDecoder, len(t.ColumnType))
+		}
+		d[i] = convert
+	}
+	// Table maps repeat for every transaction; drop them all once many
+	// have been seen rather than track which are still in use.
+	if len(charsetDecoders.m) >= 4096 {
+		clear(charsetDecoders.m)
+	}
+	charsetDecoders.m[t] = d
+	return d
+}
+
+// binaryValue is a BINARY or VARBINARY value, which go-mysql decodes into a
+// string, as the bytes it is.
+func binaryValue(v interface{}) interface{} {
+	if s, ok := v.(string); ok {
+		return []byte(s)
+	}
+	return v
+}
+
+// decodeWith returns a converter of values in enc into UTF-8 strings. A
+// single-byte character set maps the bytes it leaves undefined to the code
+// points of the same value, as MySQL does for latin1; a value that is not
+// valid in a multi-byte one is left as it is.
+func decodeWith(enc encoding.Encoding) func(v interface{}) interface{} {
+	return func(v interface{}) interface{} {
+		var b []byte
+		switch v := v.(type) {
+		case string:
+			b = []byte(v)
+		case []byte:
+			b = v
+		default:
+			return v
+		}
+		if cm, ok := enc.(*charmap.Charmap); ok {
+			var s strings.Builder
+			for _, c := range b {
+				r := cm.DecodeByte(c)
+				if r == utf8.RuneError {
+					r = rune(c)
+				}
+				s.WriteRune(r)
+			}
+			return s.String()
+		}
+		s, err := enc.NewDecoder().Bytes(b)
+		if err != nil {
+			return v
+		}
+		return string(s)
+	}
+}
+
+// decodeCharsets converts the string values of a rows event from the
+// character sets of their columns into UTF-8 (see columnCharsets), and
+// BINARY and VARBINARY values into bytes, so that output and generated SQL
+// show them as the text or bytes they are. Output versions that predate it
+// turn it off (see setValueRewrites).
+func decodeCharsets(e *replication.BinlogEvent) {
+	re, ok := e.Event.(*replication.RowsEvent)
+	if !ok || !decodeStrings || re.Table == nil || len(re.Rows) == 0 {
+		return
+	}
+	d := charsetDecoderFor(re.Table)
+	if d == nil {
+		return
+	}
+	for _, row := range re.Rows {
+		for i, convert := range d {
+			if convert != nil && i < len(row) && row[i] != nil {
+				row[i] = convert(row[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"hash/maphash"
+	"io"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// hllPrecision is the number of hash bits that pick a HyperLogLog
+// register: 2^12 registers, 4KiB per column, for a standard error of about
+// 1.6%.
+const hllPrecision = 12
+
+// hyperLogLog estimates the number of distinct values added to it.
+type hyperLogLog struct {
+	registers [1 << hllPrecision]uint8
+}
+
+func (h *hyperLogLog) add(x uint64) {
+	i := x >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rank > h.registers[i] {
+		h.registers[i] = rank
+	}
+}
+
+func (h *hyperLogLog) estimate() uint64 {
+	const m = float64(len(h.registers))
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+	e := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		// Linear counting is more accurate for small cardinalities.
+		e = m * math.Log(m/float64(zeros))
+	}
+	return uint64(e + 0.5)
+}
+
+// columnProfile accumulates the statistics of one column.
+type columnProfile struct {
+	values   int
+	nulls    int
+	distinct hyperLogLog
+	numeric  int
+	min, max float64
+	strings  int
+	length   int
+}
+
+// columnStatsReport profiles the values in row images per table and
+// column: inserted rows, rows after an update and deleted rows.
+type columnStatsReport struct {
+	seed   maphash.Seed
+	tables map[string]*tableProfile
+}
+
+type tableProfile struct {
+	images  int
+	names   []string
+	columns []*columnProfile
+}
+
+func newColumnStatsReport() *columnStatsReport {
+	return &columnStatsReport{seed: maphash.MakeSeed(), tables: make(map[string]*tableProfile)}
+}
+
+func (r *columnStatsReport) observe(e *replication.BinlogEvent) {
+	re, ok := e.Event.(*replication.RowsEvent)
+	if !ok || re.Table == nil {
+		return
+	}
+	name := tableName(re.Table)
+	t := r.tables[name]
+	if t == nil {
+		t = new(tableProfile)
+		r.tables[name] = t
+	}
+	if names := columnNames(re.Table); len(names) > 0 {
+		t.names = names
+	}
+	step := 1
+	if rowsEventKind(e.Header.EventType) == "UPDATE" {
+		// Profile the after image of each before/after pair.
+		step = 2
+	}
+	for i := step - 1; i < len(re.Rows); i += step {
+		t.images++
+		for len(t.columns) < len(re.Rows[i]) {
+			t.columns = append(t.columns, new(columnProfile))
+		}
+		for j, v := range markAbsent(re, i) {
+			// A column left out of the image says nothing of its values.
+			if !isAbsent(v) {
+				r.observeValue(t.columns[j], v)
+			}
+		}
+	}
+}
+
+func (r *columnStatsReport) observeValue(c *columnProfile, v interface{}) {
+	c.values++
+	if v == nil {
+		c.nulls++
+		return
+	}
+	b := appendValue(nil, v)
+	c.distinct.add(maphash.Bytes(r.seed, b))
+
+	if f, ok := numericValue(v); ok {
+		if c.numeric == 0 || f < c.min {
+			c.min = f
+		}
+		if c.numeric == 0 || f > c.max {
+			c.max = f
+		}
+		c.numeric++
+	}
+	switch v := v.(type) {
+	case []byte:
+		c.strings++
+		c.length += len(v)
+	case string:
+		c.strings++
+		c.length += len(v)
+	}
+}
+
+// numericValue returns v as a float64 when it is a Go numeric type.
+func numericValue(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func (r *columnStatsReport) report(w io.Writer) {
+	fmt.Fprintln(w, "=== Column statistics ===")
+	names := make([]string, 0, len(r.tables))
+	for name := range r.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t := r.tables[name]
+		fmt.Fprintf(w, "%s (%s)\n", name, plural(t.images, "row image"))
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "  column\tnulls\tdistinct~\tmin\tmax\tavg length")
+		for i, c := range t.columns {
+			col := fmt.Sprintf("@%d", i+1)
+			if i < len(t.names) {
+				col = t.names[i]
+			}
+			min, max, avg := "", "", ""
+			if c.numeric > 0 {
+				min = strconv.FormatFloat(c.min, 'f', -1, 64)
+				max = strconv.FormatFloat(c.max, 'f', -1, 64)
+			}
+			if c.strings > 0 {
+				avg = strconv.FormatFloat(float64(c.length)/float64(c.strings), 'f', 1, 64)
+			}
+			fmt.Fprintf(tw, "  %s\t%.1f%%\t%d\t%s\t%s\t%s\n", col, 100*float64(c.nulls)/float64(c.values), c.distinct.estimate(), min, max, avg)
+		}
+		tw.Flush()
+	}
+}
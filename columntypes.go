@@ -0,0 +1,373 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// columnTypeName describes the type of column i of table t as far as its
+// table map tells: the binlog type with its metadata, such as the byte
+// length of a VARCHAR or the precision of a DECIMAL. Character and binary
+// types share binlog types, so VARCHAR also stands for VARBINARY and BLOB
+// for TEXT.
+func columnTypeName(t *replication.TableMapEvent, i int) string {
+	var meta uint16
+	if i < len(t.ColumnMeta) {
+		meta = t.ColumnMeta[i]
+	}
+	unsigned := ""
+	if t.UnsignedMap()[i] {
+		unsigned = " UNSIGNED"
+	}
+	switch typ := t.ColumnType[i]; typ {
+	case mysql.MYSQL_TYPE_TINY:
+		return "TINYINT" + unsigned
+	case mysql.MYSQL_TYPE_SHORT:
+		return "SMALLINT" + unsigned
+	case mysql.MYSQL_TYPE_INT24:
+		return "MEDIUMINT" + unsigned
+	case mysql.MYSQL_TYPE_LONG:
+		return "INT" + unsigned
+	case mysql.MYSQL_TYPE_LONGLONG:
+		return "BIGINT" + unsigned
+	case mysql.MYSQL_TYPE_FLOAT:
+		return "FLOAT"
+	case mysql.MYSQL_TYPE_DOUBLE:
+		return "DOUBLE"
+	case mysql.MYSQL_TYPE_NEWDECIMAL:
+		return fmt.Sprintf("DECIMAL(%d,%d)", meta>>8, meta&0xff)
+	case mysql.MYSQL_TYPE_YEAR:
+		return "YEAR"
+	case mysql.MYSQL_TYPE_DATE, mysql.MYSQL_TYPE_NEWDATE:
+		return "DATE"
+	case mysql.MYSQL_TYPE_TIME:
+		return "TIME"
+	case mysql.MYSQL_TYPE_DATETIME:
+		return "DATETIME"
+	case mysql.MYSQL_TYPE_TIMESTAMP:
+		return "TIMESTAMP"
+	case mysql.MYSQL_TYPE_TIME2:
+		return withFraction("TIME", meta)
+	case mysql.MYSQL_TYPE_DATETIME2:
+		return withFraction("DATETIME", meta)
+	case mysql.MYSQL_TYPE_TIMESTAMP2:
+		return withFraction("TIMESTAMP", meta)
+	case mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_VAR_STRING:
+		return fmt.Sprintf("VARCHAR(%d bytes)", meta)
+	case mysql.MYSQL_TYPE_STRING:
+		switch byte(meta >> 8) {
+		case mysql.MYSQL_TYPE_ENUM:
+			return "ENUM"
+		case mysql.MYSQL_TYPE_SET:
+			return "SET"
+		}
+		// The length's high bits are folded into the real type byte.
+		return fmt.Sprintf("CHAR(%d bytes)", int((meta>>4)&0x300^0x300)+int(meta&0xff))
+	case mysql.MYSQL_TYPE_BIT:
+		return fmt.Sprintf("BIT(%d)", int(meta>>8)*8+int(meta&0xff))
+	case mysql.MYSQL_TYPE_BLOB:
+		switch meta {
+		case 1:
+			return "TINYBLOB"
+		case 3:
+			return "MEDIUMBLOB"
+		case 4:
+			return "LONGBLOB"
+		}
+		return "BLOB"
+	case mysql.MYSQL_TYPE_JSON:
+		return "JSON"
+	case mysql.MYSQL_TYPE_GEOMETRY:
+		return "GEOMETRY"
+	case mysql.MYSQL_TYPE_ENUM:
+		return "ENUM"
+	case mysql.MYSQL_TYPE_SET:
+		return "SET"
+	default:
+		return fmt.Sprintf("type %d", typ)
+	}
+}
+
+func withFraction(name string, fsp uint16) string {
+	if fsp == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s(%d)", name, fsp)
+}
+
+// equalityComparable reports whether column i of table t can find a row by
+// equality with its value as go-parse writes it: not a FLOAT or DOUBLE,
+// whose value as text may not round-trip to the same number, nor a JSON or
+// spatial value, which does not compare equal to its text.
+func equalityComparable(t *replication.TableMapEvent, i int) bool {
+	switch t.ColumnType[i] {
+	case mysql.MYSQL_TYPE_FLOAT, mysql.MYSQL_TYPE_DOUBLE, mysql.MYSQL_TYPE_JSON, mysql.MYSQL_TYPE_GEOMETRY:
+		return false
+	}
+	return true
+}
+
+// columnDefinitions describes the columns of table t with all its table map
+// tells: the type, then with binlog_row_metadata=FULL the values of an ENUM
+// or SET, the collation of a character column, NOT NULL, INVISIBLE and
+// PRIMARY KEY, in the order of a CREATE TABLE.
+func columnDefinitions(t *replication.TableMapEvent) []string {
+	enums, sets := t.EnumStrValueMap(), t.SetStrValueMap()
+	collations := t.CollationMap()
+	for i, id := range t.EnumSetCollationMap() {
+		if collations == nil {
+			collations = make(map[int]uint64)
+		}
+		collations[i] = id
+	}
+	visible := t.VisibilityMap()
+	defs := make([]string, len(t.ColumnType))
+	for i := range t.ColumnType {
+		def := columnTypeName(t, i)
+		if values, ok := enums[i]; ok {
+			def += valueList(values)
+		} else if values, ok := sets[i]; ok {
+			def += valueList(values)
+		}
+		if id, ok := collations[i]; ok {
+			def += " COLLATE " + collationName(id)
+		}
+		if available, nullable := t.Nullable(i); available && !nullable {
+			def += " NOT NULL"
+		}
+		if v, ok := visible[i]; ok && !v {
+			def += " INVISIBLE"
+		}
+		if slices.Contains(t.PrimaryKey, uint64(i)) {
+			def += " PRIMARY KEY"
+		}
+		defs[i] = def
+	}
+	return defs
+}
+
+// valueList formats the values of an ENUM or SET as its definition does.
+func valueList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	}
+	return "(" + strings.Join(quoted, ",") + ")"
+}
+
+// collationNames names the collations servers commonly default to; table
+// maps give collations by id.
+var collationNames = map[uint64]string{
+	8:   "latin1_swedish_ci",
+	11:  "ascii_general_ci",
+	28:  "gbk_chinese_ci",
+	33:  "utf8mb3_general_ci",
+	45:  "utf8mb4_general_ci",
+	46:  "utf8mb4_bin",
+	47:  "latin1_bin",
+	48:  "latin1_general_ci",
+	63:  "binary",
+	65:  "ascii_bin",
+	76:  "utf8mb3_tolower_ci",
+	83:  "utf8mb3_bin",
+	192: "utf8mb3_unicode_ci",
+	224: "utf8mb4_unicode_ci",
+	246: "utf8mb4_unicode_520_ci",
+	248: "gb18030_chinese_ci",
+	255: "utf8mb4_0900_ai_ci",
+	278: "utf8mb4_0900_as_cs",
+	305: "utf8mb4_0900_as_ci",
+	309: "utf8mb4_0900_bin",
+}
+
+func collationName(id uint64) string {
+	if name, ok := collationNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("collation %d", id)
+}
+
+// typedValue is columnValue for column i of table t, whose type tells an
+// INT from a MEDIUMINT, both decoded into an int32.
+func typedValue(t *replication.TableMapEvent, unsigned map[int]bool, i int, v interface{}) interface{} {
+	if n, ok := v.(int32); ok && unsigned[i] && t.ColumnType[i] == mysql.MYSQL_TYPE_LONG {
+		return uint32(n)
+	}
+	return columnValue(v, unsigned[i])
+}
+
+// decimalString is a DECIMAL value, which go-mysql decodes into a string
+// with all the digits of its scale.
+type decimalString string
+
+func (d decimalString) String() string { return string(d) }
+
+// columnValueLists returns the values of the ENUM and SET columns of table t
+// by column index: those its table map carries with
+// binlog_row_metadata=FULL, else those -schemaFile gives it.
+func columnValueLists(t *replication.TableMapEvent) map[int][]string {
+	lists := t.EnumStrValueMap()
+	for i, values := range t.SetStrValueMap() {
+		if lists == nil {
+			lists = make(map[int][]string)
+		}
+		lists[i] = values
+	}
+	if lists != nil {
+		return lists
+	}
+	if s := schemaFor(t); s != nil {
+		return s.values
+	}
+	return nil
+}
+
+// exactValue is value v of column i of table t as the column reads it
+// rather than as it is stored: a DECIMAL as a number rather than a string,
+// and with the values of lists (see columnValueLists), an ENUM by its value
+// rather than its index and a SET by its values rather than a bitmap.
+func exactValue(t *replication.TableMapEvent, lists map[int][]string, i int, v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		if t.ColumnType[i] == mysql.MYSQL_TYPE_NEWDECIMAL {
+			return decimalString(v)
+		}
+	case int64:
+		values, ok := lists[i]
+		switch {
+		case !ok:
+		case t.IsEnumColumn(i):
+			// Index 0 is the empty string MySQL stores for an invalid
+			// value.
+			if v == 0 {
+				return ""
+			}
+			if v <= int64(len(values)) {
+				return values[v-1]
+			}
+		case t.IsSetColumn(i):
+			var set []string
+			for bit, value := range values {
+				if v&(1<<bit) != 0 {
+					set = append(set, value)
+				}
+			}
+			return strings.Join(set, ",")
+		}
+	}
+	return v
+}
+
+// jsonText is a JSON value, shown as the JSON it is rather than quoted.
+type jsonText string
+
+func (j jsonText) String() string { return string(j) }
+
+// readableJSON is value v of column i of table t as JSON: the document of a
+// JSON column rather than the string go-mysql decodes it into, and a
+// partial update as the document after it, with the update (see
+// partialJSON).
+func readableJSON(t *replication.TableMapEvent, i int, v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		if t.ColumnType[i] == mysql.MYSQL_TYPE_JSON {
+			return jsonText(v)
+		}
+	case *partialJSON:
+		return jsonText(v.describe())
+	}
+	return v
+}
+
+// formattedTime is a TIMESTAMP value in the layout of -timeFormat.
+type formattedTime string
+
+func (f formattedTime) String() string { return string(f) }
+
+// displayTimestamp is value v of column i of table t with a TIMESTAMP in
+// the layout of -timeFormat, when one is set. go-mysql already shows a
+// TIMESTAMP in the local time zone, which -tz sets.
+func displayTimestamp(t *replication.TableMapEvent, i int, v interface{}) interface{} {
+	if *timeLayout == "" || i >= len(t.ColumnType) ||
+		t.ColumnType[i] != mysql.MYSQL_TYPE_TIMESTAMP && t.ColumnType[i] != mysql.MYSQL_TYPE_TIMESTAMP2 {
+		return v
+	}
+	if tv, ok := v.(interface{ UnixMicro() int64 }); ok {
+		return formattedTime(time.UnixMicro(tv.UnixMicro()).Format(timeFormat))
+	}
+	return v
+}
+
+// columnBytes estimates the bytes value v of column i of table t takes in a
+// row image: the storage size of its type, plus the length prefix of a
+// variable-length one. A NULL takes only its bit of the null bitmap.
+func columnBytes(t *replication.TableMapEvent, i int, v interface{}) int {
+	if v == nil || isAbsent(v) {
+		return 0
+	}
+	var meta uint16
+	if i < len(t.ColumnMeta) {
+		meta = t.ColumnMeta[i]
+	}
+	length := func(prefix int) int {
+		switch v := v.(type) {
+		case []byte:
+			return prefix + len(v)
+		case string:
+			return prefix + len(v)
+		}
+		return prefix + len(fmt.Sprint(v))
+	}
+	switch t.ColumnType[i] {
+	case mysql.MYSQL_TYPE_TINY, mysql.MYSQL_TYPE_YEAR:
+		return 1
+	case mysql.MYSQL_TYPE_SHORT:
+		return 2
+	case mysql.MYSQL_TYPE_INT24, mysql.MYSQL_TYPE_DATE, mysql.MYSQL_TYPE_NEWDATE, mysql.MYSQL_TYPE_TIME:
+		return 3
+	case mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_FLOAT, mysql.MYSQL_TYPE_TIMESTAMP:
+		return 4
+	case mysql.MYSQL_TYPE_LONGLONG, mysql.MYSQL_TYPE_DOUBLE, mysql.MYSQL_TYPE_DATETIME:
+		return 8
+	case mysql.MYSQL_TYPE_TIME2:
+		return 3 + int(meta+1)/2
+	case mysql.MYSQL_TYPE_DATETIME2:
+		return 5 + int(meta+1)/2
+	case mysql.MYSQL_TYPE_TIMESTAMP2:
+		return 4 + int(meta+1)/2
+	case mysql.MYSQL_TYPE_NEWDECIMAL:
+		return decimalBytes(int(meta>>8), int(meta&0xff))
+	case mysql.MYSQL_TYPE_BIT:
+		return (int(meta>>8)*8 + int(meta&0xff) + 7) / 8
+	case mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_VAR_STRING:
+		if meta < 256 {
+			return length(1)
+		}
+		return length(2)
+	case mysql.MYSQL_TYPE_STRING:
+		switch byte(meta >> 8) {
+		case mysql.MYSQL_TYPE_ENUM, mysql.MYSQL_TYPE_SET:
+			return int(meta & 0xff)
+		}
+		if int((meta>>4)&0x300^0x300)+int(meta&0xff) < 256 {
+			return length(1)
+		}
+		return length(2)
+	case mysql.MYSQL_TYPE_BLOB, mysql.MYSQL_TYPE_JSON, mysql.MYSQL_TYPE_GEOMETRY:
+		// The metadata is the size of the length prefix.
+		return length(int(meta))
+	}
+	return length(0)
+}
+
+// decimalBytes is the size of a DECIMAL: nine digits take four bytes, fewer
+// what they need, on each side of the point.
+func decimalBytes(precision, scale int) int {
+	digits := func(n int) int { return n/9*4 + [9]int{0, 1, 1, 2, 2, 3, 3, 4, 4}[n%9] }
+	return digits(precision-scale) + digits(scale)
+}
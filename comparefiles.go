@@ -0,0 +1,293 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// fileProfile is the workload of one side of compare-files: the event mix
+// and per-table volume of its binlogs, the time they span and the size of
+// each transaction.
+type fileProfile struct {
+	spec         string
+	stats        *statsReport
+	first, last  uint32
+	transactions int
+	txRows       []int
+	txBytes      []int
+}
+
+// collectProfile reads the binlogs spec names, one file or a comma-separated
+// list or pattern as -file takes.
+func collectProfile(spec string) (*fileProfile, error) {
+	files, err := expandBinlogFiles(spec)
+	if err != nil {
+		return nil, err
+	}
+	fp := &fileProfile{spec: spec, stats: newStatsReport(true)}
+	var tx txTracker
+	rows := 0
+	err = parseBinlogs(newParser(true), files, 4, nil, func(e *replication.BinlogEvent) error {
+		fp.stats.observe(e)
+		if ts := e.Header.Timestamp; ts != 0 {
+			if fp.first == 0 || ts < fp.first {
+				fp.first = ts
+			}
+			fp.last = max(fp.last, ts)
+		}
+		rows += rowsAffected(e)
+		if done := tx.observe(e); done != nil {
+			fp.transactions++
+			fp.txRows = append(fp.txRows, rows)
+			fp.txBytes = append(fp.txBytes, int(done.End)-int(done.Start))
+			rows = 0
+		} else if tx.cur == nil {
+			rows = 0
+		}
+		return nil
+	})
+	sort.Ints(fp.txRows)
+	sort.Ints(fp.txBytes)
+	return fp, err
+}
+
+// seconds is the time the profile spans, at least one second.
+func (fp *fileProfile) seconds() float64 {
+	return math.Max(1, float64(fp.last)-float64(fp.first))
+}
+
+func (fp *fileProfile) String() string {
+	if fp.first == 0 {
+		return fp.spec
+	}
+	return fmt.Sprintf("%s, %s to %s (%s)", fp.spec, summaryTime(fp.first), summaryTime(fp.last),
+		time.Duration(fp.seconds())*time.Second)
+}
+
+// fileComparison prints the tables of compare-files and collects the
+// changes at or beyond -changeThreshold.
+type fileComparison struct {
+	significant []string
+}
+
+// change renders the change from a to b and, when it is significant, notes
+// it under what.
+func (c *fileComparison) change(what string, a, b float64) string {
+	var s string
+	switch {
+	case a == 0 && b == 0:
+		return "0%"
+	case a == 0:
+		s = "new"
+	case b == 0:
+		s = "gone"
+	default:
+		s = fmt.Sprintf("%+.1f%%", (b-a)*100/a)
+	}
+	if a == 0 || b == 0 || math.Abs(b-a)*100/a >= *changeThreshold {
+		c.significant = append(c.significant, fmt.Sprintf("%s: %s (%s to %s)", what, s, formatRate(a), formatRate(b)))
+	}
+	return s
+}
+
+func formatRate(v float64) string {
+	if v == math.Trunc(v) {
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprintf("%.2f", v)
+}
+
+// compareFiles prints how the workload of b differs from that of a: event
+// mix, per-table writes, write rates and transaction sizes. Volumes are
+// compared as rates per second so that files spanning different times
+// compare fairly. Changes of -changeThreshold percent or more are listed
+// at the end.
+func compareFiles(out io.Writer, a, b *fileProfile) error {
+	var c fileComparison
+	fmt.Fprintf(out, "A: %s\nB: %s\n\n", a, b)
+
+	types := make(map[replication.EventType]bool)
+	for t := range a.stats.events {
+		types[t] = true
+	}
+	for t := range b.stats.events {
+		types[t] = true
+	}
+	sortedTypes := make([]replication.EventType, 0, len(types))
+	for t := range types {
+		sortedTypes = append(sortedTypes, t)
+	}
+	sort.Slice(sortedTypes, func(i, j int) bool { return sortedTypes[i] < sortedTypes[j] })
+
+	fmt.Fprintln(out, "=== Event mix ===")
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "event type\tA events\tB events\tA share\tB share\trate change\t")
+	var totalA, totalB int
+	for _, t := range sortedTypes {
+		totalA += a.stats.events[t]
+		totalB += b.stats.events[t]
+	}
+	for _, t := range sortedTypes {
+		ea, eb := a.stats.events[t], b.stats.events[t]
+		ra, rb := float64(ea)/a.seconds(), float64(eb)/b.seconds()
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\t\n", eventTypeName(t), ea, eb, share(ea, totalA), share(eb, totalB),
+			c.change(eventTypeName(t)+" events/s", ra, rb))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	names := make(map[string]bool)
+	for name := range a.stats.tables {
+		names[name] = true
+	}
+	for name := range b.stats.tables {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	fmt.Fprintln(out, "\n=== Tables ===")
+	tw = tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "table\tA rows\tB rows\tA rows/s\tB rows/s\tchange\tA bytes\tB bytes\t")
+	for _, name := range sorted {
+		ta, tb := a.stats.tables[name], b.stats.tables[name]
+		if ta == nil {
+			ta = new(tableStats)
+		}
+		if tb == nil {
+			tb = new(tableStats)
+		}
+		ra, rb := float64(ta.rows)/a.seconds(), float64(tb.rows)/b.seconds()
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\t%d\t%d\t\n", name, ta.rows, tb.rows, formatRate(ra), formatRate(rb),
+			c.change(name+" rows/s", ra, rb), ta.bytes, tb.bytes)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	rowsOf := func(fp *fileProfile) (rows int, bytes uint64) {
+		for _, ts := range fp.stats.tables {
+			rows += ts.rows
+		}
+		for _, n := range fp.stats.eventBytes {
+			bytes += n
+		}
+		return rows, bytes
+	}
+	rowsA, bytesA := rowsOf(a)
+	rowsB, bytesB := rowsOf(b)
+
+	fmt.Fprintln(out, "\n=== Write rates ===")
+	tw = tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "per second\tA\tB\tchange\t")
+	for _, r := range []struct {
+		name string
+		a, b float64
+	}{
+		{"events", float64(totalA), float64(totalB)},
+		{"rows", float64(rowsA), float64(rowsB)},
+		{"bytes", float64(bytesA), float64(bytesB)},
+		{"transactions", float64(a.transactions), float64(b.transactions)},
+	} {
+		ra, rb := r.a/a.seconds(), r.b/b.seconds()
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t\n", r.name, formatRate(ra), formatRate(rb), c.change(r.name+"/s", ra, rb))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, "\n=== Transaction sizes ===")
+	tw = tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tA\tB\tchange\t")
+	for _, r := range []struct {
+		name string
+		a, b float64
+	}{
+		{"mean rows", mean(a.txRows), mean(b.txRows)},
+		{"p50 rows", float64(percentileOf(a.txRows, 50)), float64(percentileOf(b.txRows, 50))},
+		{"p99 rows", float64(percentileOf(a.txRows, 99)), float64(percentileOf(b.txRows, 99))},
+		{"max rows", float64(percentileOf(a.txRows, 100)), float64(percentileOf(b.txRows, 100))},
+		{"mean bytes", mean(a.txBytes), mean(b.txBytes)},
+		{"p99 bytes", float64(percentileOf(a.txBytes, 99)), float64(percentileOf(b.txBytes, 99))},
+		{"max bytes", float64(percentileOf(a.txBytes, 100)), float64(percentileOf(b.txBytes, 100))},
+	} {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t\n", r.name, formatRate(r.a), formatRate(r.b), c.change("transaction "+r.name, r.a, r.b))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "\n=== Significant changes (%s%% or more) ===\n", formatRate(*changeThreshold))
+	if len(c.significant) == 0 {
+		fmt.Fprintln(out, "None")
+	}
+	for _, s := range c.significant {
+		fmt.Fprintln(out, s)
+	}
+	return nil
+}
+
+// share renders n as a percentage of total.
+func share(n, total int) string {
+	if total == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.1f%%", float64(n)*100/float64(total))
+}
+
+func mean(sorted []int) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	sum := 0
+	for _, v := range sorted {
+		sum += v
+	}
+	return math.Round(float64(sum)*100/float64(len(sorted))) / 100
+}
+
+// percentileOf returns the p-th percentile of sorted by the nearest-rank
+// method, or 0 for no values.
+func percentileOf(sorted []int, p int) int {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+func compareFilesCommand(int64) {
+	if *binlogFile != "" || *indexFile != "" {
+		fmt.Fprintf(os.Stderr, "Error: compare-files takes the two binlogs as arguments, not -file or -index\n")
+		os.Exit(1)
+	}
+	if flag.NArg() != 2 {
+		fmt.Fprintf(os.Stderr, "Error: compare-files takes two binlogs: compare-files [flags] <binlog A> <binlog B>\n")
+		os.Exit(1)
+	}
+	var profiles [2]*fileProfile
+	for i, spec := range flag.Args() {
+		fp, err := collectProfile(spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		profiles[i] = fp
+	}
+	if err := compareFiles(os.Stdout, profiles[0], profiles[1]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
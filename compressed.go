@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// binlogCompression returns "gzip" or "zstd" when name is a compressed
+// archive, by its .gz or .zst extension or, for local files, by its magic
+// number, and "" for a plain binlog.
+func binlogCompression(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".gz"):
+		return "gzip"
+	case strings.HasSuffix(name, ".zst"):
+		return "zstd"
+	case isS3URL(name):
+		return ""
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	head := make([]byte, len(zstdMagic))
+	n, _ := io.ReadFull(f, head)
+	switch {
+	case bytes.HasPrefix(head[:n], gzipMagic):
+		return "gzip"
+	case bytes.HasPrefix(head[:n], zstdMagic):
+		return "zstd"
+	}
+	return ""
+}
+
+// compressedFile reads a gzip or zstd compressed binlog as if it were the
+// binlog itself, decompressing as it streams. Offsets are those of the
+// decompressed binlog. Seeking forward decompresses and discards up to the
+// offset; seeking backward starts over from the beginning, so reads that
+// go back, such as replaying table maps when starting mid-file, cost a
+// second pass over the start of the file.
+type compressedFile struct {
+	name string
+	kind string
+	raw  statBinlogSource
+	r    io.Reader
+	done func()
+	off  int64
+	size int64 // decompressed size, -1 until counted
+}
+
+func newCompressedFile(name, kind string, raw statBinlogSource) *compressedFile {
+	return &compressedFile{name: name, kind: kind, raw: raw, size: -1}
+}
+
+// decompressor returns a reader of the decompressed contents of r and the
+// function that releases it.
+func decompressor(kind string, r io.Reader) (io.Reader, func(), error) {
+	if kind == "zstd" {
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, nil, err
+		}
+		return d, d.Close, nil
+	}
+	z, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return z, func() { z.Close() }, nil
+}
+
+// rewind starts decompressing again from the beginning of the file.
+func (c *compressedFile) rewind() error {
+	c.release()
+	if _, err := c.raw.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r, done, err := decompressor(c.kind, c.raw)
+	if err != nil {
+		return fmt.Errorf("%s: %s: %v", c.name, c.kind, err)
+	}
+	c.r, c.done, c.off = r, done, 0
+	return nil
+}
+
+func (c *compressedFile) release() {
+	if c.done != nil {
+		c.done()
+		c.r, c.done = nil, nil
+	}
+}
+
+func (c *compressedFile) Read(p []byte) (int, error) {
+	if c.r == nil {
+		if err := c.rewind(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := c.r.Read(p)
+	c.off += int64(n)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("%s: %s: %v", c.name, c.kind, err)
+	}
+	return n, err
+}
+
+func (c *compressedFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += c.off
+	case io.SeekEnd:
+		size, err := c.decompressedSize()
+		if err != nil {
+			return c.off, err
+		}
+		offset += size
+	}
+	if offset < 0 {
+		return c.off, fmt.Errorf("%s: negative seek", c.name)
+	}
+	if c.r == nil || offset < c.off {
+		if err := c.rewind(); err != nil {
+			return c.off, err
+		}
+	}
+	if _, err := io.CopyN(io.Discard, c, offset-c.off); err != nil && err != io.EOF {
+		return c.off, err
+	}
+	// Past the end reads return io.EOF, as with a file.
+	c.off = offset
+	return c.off, nil
+}
+
+// ReadAt reads at off through the stream, as s3Object does, so the
+// ascending reads of a header scan decompress the file once. It moves the
+// read offset.
+func (c *compressedFile) ReadAt(p []byte, off int64) (int, error) {
+	if _, err := c.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.ReadFull(c, p)
+}
+
+func (c *compressedFile) Close() error {
+	c.release()
+	return c.raw.Close()
+}
+
+// Stat describes the compressed file with the size of the binlog in it.
+func (c *compressedFile) Stat() (os.FileInfo, error) {
+	fi, err := c.raw.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size, err := c.decompressedSize()
+	if err != nil {
+		return nil, err
+	}
+	return &binlogFileInfo{fi, size}, nil
+}
+
+// decompressedSize counts the bytes of the binlog in a separate pass, as
+// the compressed formats do not reliably record it.
+func (c *compressedFile) decompressedSize() (int64, error) {
+	if c.size >= 0 {
+		return c.size, nil
+	}
+	raw, err := openRawBinlog(c.name)
+	if err != nil {
+		return 0, err
+	}
+	defer raw.Close()
+	r, done, err := decompressor(c.kind, raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %s: %v", c.name, c.kind, err)
+	}
+	defer done()
+	if c.size, err = io.Copy(io.Discard, r); err != nil {
+		c.size = -1
+		return 0, fmt.Errorf("%s: %s: %v", c.name, c.kind, err)
+	}
+	return c.size, nil
+}
+
+// binlogFileInfo is the FileInfo of a stored file, compressed or
+// encrypted, with the size of the binlog it holds.
+type binlogFileInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (fi *binlogFileInfo) Size() int64 { return fi.size }
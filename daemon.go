@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// sdNotify sends state to the service manager as sd_notify(3) does, when
+// go-parse runs as a systemd service of Type=notify. Elsewhere
+// NOTIFY_SOCKET is unset and it does nothing.
+func sdNotify(state string) {
+	name := os.Getenv("NOTIFY_SOCKET")
+	if name == "" {
+		return
+	}
+	if name[0] == '@' {
+		// An abstract socket.
+		name = "\x00" + name[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err == nil {
+		_, err = conn.Write([]byte(state))
+		conn.Close()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: notifying the service manager: %v\n", err)
+	}
+}
+
+var readyOnce sync.Once
+
+// notifyReady tells the service manager that go-parse is up, once its flags
+// are checked and it starts reading.
+func notifyReady() {
+	readyOnce.Do(func() { sdNotify("READY=1") })
+}
+
+// reloader reloads the rules of a file flag.
+type reloader struct {
+	flag   string
+	reload func() error
+}
+
+// reloaders are run when SIGHUP sets reloadRequested.
+var (
+	reloaders       []reloader
+	reloadRequested atomic.Bool
+)
+
+// onReload registers reload to reload the rules named by flag on SIGHUP.
+// The first registration starts listening for it, so that a run without
+// rules to reload still ends on a hangup.
+func onReload(flag string, reload func() error) {
+	if len(reloaders) == 0 {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGHUP)
+		go func() {
+			for range ch {
+				reloadRequested.Store(true)
+			}
+		}()
+	}
+	reloaders = append(reloaders, reloader{flag, reload})
+}
+
+// reloadRules reloads the rules once SIGHUP asked for it. The readers call
+// it between events and while -follow waits for the server, always on the
+// goroutine that handles the events, so the rules never change in the
+// middle of one; rules that fail to load are kept as they were.
+func reloadRules() {
+	if !reloadRequested.Swap(false) {
+		return
+	}
+	sdNotify("RELOADING=1")
+	for _, r := range reloaders {
+		if err := r.reload(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: reloading %s: %v; keeping its previous rules\n", r.flag, err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Reloaded %s\n", r.flag)
+	}
+	sdNotify("READY=1")
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ChaosHour/go-parse/pkg/binlogwriter"
+)
+
+// TestResumeFromStateFile checks that a run without -offset resumes after
+// the last transaction -stateFile recorded.
+func TestResumeFromStateFile(t *testing.T) {
+	file := writeTestdataBinlog(t, "charsets")
+	state := filepath.Join(t.TempDir(), "state.json")
+	runGoParse(t, "-file", file, "-offset", "4", "-stateFile", state)
+
+	out := string(runGoParse(t, "-file", file, "-stateFile", state))
+	if !strings.Contains(out, "Resuming from the position store at "+file+":928") {
+		t.Errorf("did not resume at the end of the last transaction:\n%s", out)
+	}
+	if strings.Contains(out, "RowsEvent") || !strings.Contains(out, "StopEvent") {
+		t.Errorf("resumed run does not dump the STOP event alone:\n%s", out)
+	}
+}
+
+// TestReloadOnSIGHUP checks that go-parse tells a service manager it is
+// ready, and that SIGHUP reloads -transforms for the events that follow.
+func TestReloadOnSIGHUP(t *testing.T) {
+	dir := t.TempDir()
+	socket, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: filepath.Join(dir, "notify"), Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	notified := func(want string) {
+		t.Helper()
+		socket.SetReadDeadline(time.Now().Add(10 * time.Second))
+		buf := make([]byte, 256)
+		n, err := socket.Read(buf)
+		if err != nil {
+			t.Fatalf("waiting for %s: %v", want, err)
+		}
+		if got := string(buf[:n]); got != want {
+			t.Fatalf("notified %q, want %q", got, want)
+		}
+	}
+
+	specs := make(map[string]*binlogwriter.Spec)
+	for _, c := range testdataCases() {
+		specs[c.name] = c.spec
+	}
+	// The ddl binlog rotates to ddl.000002, written once the rules changed.
+	first := filepath.Join(dir, "ddl.000001")
+	if err := binlogwriter.WriteFile(first, specs["ddl"]); err != nil {
+		t.Fatal(err)
+	}
+	rules := filepath.Join(dir, "rules.json")
+	if err := os.WriteFile(rules, []byte(`[{"column": "testdata.texts.latin", "transform": "trim"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(os.Args[0], "-follow", "-file", first, "-offset", "4", "-transforms", rules)
+	cmd.Env = append(os.Environ(), "GO_PARSE_MAIN=1", "NOTIFY_SOCKET="+socket.LocalAddr().String())
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+	notified("READY=1")
+
+	if err := os.WriteFile(rules, []byte(`[{"column": "testdata.texts.latin", "transform": "upper"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Process.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	// Waiting for ddl.000002, it reloads at once.
+	notified("RELOADING=1")
+	notified("READY=1")
+	tmp := filepath.Join(dir, "next")
+	if err := binlogwriter.WriteFile(tmp, specs["charsets"]); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, "ddl.000002")); err != nil {
+		t.Fatal(err)
+	}
+	// The STOP event of ddl.000002 ends the run.
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("%v\n%s", err, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "Reloaded -transforms") {
+		t.Errorf("no reload reported:\n%s", stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "CAFÉ €") {
+		t.Errorf("reloaded rules not applied:\n%s", stdout.String())
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// alertID is the idempotency key of the alert rule sends for the event
+// starting at pos of file: the same event always gets the same key, so a
+// receiver can drop the copies redelivered after a restart.
+func alertID(rule, file string, pos uint32, gtid string) string {
+	id := fmt.Sprintf("%s:%s:%d", rule, filepath.Base(file), pos)
+	if gtid != "" {
+		id += ":" + gtid
+	}
+	return id
+}
+
+// deliveryLog records in the position store how far watch has delivered:
+// the end of the last transaction whose alerts, and those of every earlier
+// transaction, were all delivered. Alerts are sent concurrently, so a
+// transaction may finish parsing before its alerts are delivered; the
+// position only advances over transactions in binlog order. After a failed
+// delivery it stops advancing, so a restart resumes before the failed alert
+// and redelivers it, along with any later alerts, under the same IDs.
+//
+// mu guards the transactions and the position, and is never held while
+// the store is written: save copies the position under it and writes the
+// copy after, holding saveMu alone, which keeps the writes in order.
+// Periodic saves skip while one is in progress.
+type deliveryLog struct {
+	mu      sync.Mutex
+	store   positionStore
+	file    string
+	txs     []*deliveryTx
+	failed  bool
+	state   parseState
+	version uint64 // of state, bumped each time it advances
+	saved   uint64 // the version last written, set holding both locks
+	written time.Time
+	saveMu  sync.Mutex
+}
+
+// deliveryTx is a transaction with alerts in flight.
+type deliveryTx struct {
+	pending int
+	closed  bool
+	file    string
+	end     uint32
+	gtid    string
+}
+
+func newDeliveryLog(store positionStore, file string) *deliveryLog {
+	return &deliveryLog{store: store, file: file, state: parseState{File: file}}
+}
+
+// open starts tracking a transaction.
+func (l *deliveryLog) open() *deliveryTx {
+	tx := new(deliveryTx)
+	l.mu.Lock()
+	l.txs = append(l.txs, tx)
+	l.mu.Unlock()
+	return tx
+}
+
+// sent counts an alert of tx as in flight and returns the function to call
+// with its delivery result.
+func (l *deliveryLog) sent(tx *deliveryTx) func(error) {
+	l.mu.Lock()
+	tx.pending++
+	l.mu.Unlock()
+	return func(err error) {
+		l.mu.Lock()
+		tx.pending--
+		if err != nil {
+			l.failed = true
+		}
+		due := l.advance()
+		l.mu.Unlock()
+		if due {
+			l.saveInterval()
+		}
+	}
+}
+
+// rotate makes file the binlog of the transactions closed from now on, as
+// -follow moves on to it.
+func (l *deliveryLog) rotate(file string) {
+	l.mu.Lock()
+	l.file = file
+	l.mu.Unlock()
+}
+
+// close marks tx parsed completely, ending at end of the current file.
+func (l *deliveryLog) close(tx *deliveryTx, end uint32, gtid string) {
+	l.mu.Lock()
+	tx.closed, tx.file, tx.end, tx.gtid = true, l.file, end, gtid
+	due := l.advance()
+	l.mu.Unlock()
+	if due {
+		l.saveInterval()
+	}
+}
+
+// advance moves the position over the delivered transactions at the front,
+// and reports whether it is time to save it. Called with l.mu held.
+func (l *deliveryLog) advance() bool {
+	for !l.failed && len(l.txs) > 0 && l.txs[0].closed && l.txs[0].pending == 0 {
+		tx := l.txs[0]
+		l.txs = l.txs[1:]
+		l.state.File, l.state.Position, l.state.GTID = tx.file, tx.end, tx.gtid
+		l.version++
+	}
+	return l.version != l.saved && time.Since(l.written) >= stateFileInterval
+}
+
+// saveInterval is the save of advance, reporting its error as watch goes
+// on. It leaves the position to the next one when a save is in progress,
+// so that neither the parse nor the deliveries wait on the store.
+func (l *deliveryLog) saveInterval() {
+	if !l.saveMu.TryLock() {
+		return
+	}
+	defer l.saveMu.Unlock()
+	if err := l.save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+}
+
+// flush saves the position reached, once every alert has been delivered.
+func (l *deliveryLog) flush() error {
+	l.saveMu.Lock()
+	defer l.saveMu.Unlock()
+	return l.save()
+}
+
+// save writes the position reached, unless it was written already. It is
+// called with l.saveMu held, and copies the position under l.mu, so a save
+// never writes a position older than one an earlier save wrote.
+func (l *deliveryLog) save() error {
+	l.mu.Lock()
+	state, version := l.state, l.version
+	l.mu.Unlock()
+	if version == l.saved {
+		return nil
+	}
+	state.Updated = time.Now().UTC()
+	if err := l.store.save(&state); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.saved, l.written = version, time.Now()
+	l.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// blockingStore is a position store whose saves wait for release.
+type blockingStore struct {
+	saving  chan parseState
+	release chan struct{}
+}
+
+func (s *blockingStore) load() (*parseState, error) { return nil, nil }
+
+func (s *blockingStore) save(st *parseState) error {
+	s.saving <- *st
+	<-s.release
+	return nil
+}
+
+// TestDeliveryLogSaveUnlocked checks that a slow position store holds up
+// neither the parse nor the deliveries, and that the positions reach it in
+// order.
+func TestDeliveryLogSaveUnlocked(t *testing.T) {
+	store := &blockingStore{saving: make(chan parseState), release: make(chan struct{})}
+	l := newDeliveryLog(store, "mysql-bin.000001")
+
+	tx := l.open()
+	done := l.sent(tx)
+	// The first position is due at once, and saved by the delivery.
+	l.close(tx, 100, "")
+	go done(nil)
+	var st parseState
+	select {
+	case st = <-store.saving:
+	case <-time.After(5 * time.Second):
+		t.Fatal("position not saved")
+	}
+	if st.Position != 100 {
+		t.Fatalf("saved position %d, want 100", st.Position)
+	}
+
+	// With that save blocked, transactions still open, deliver and close.
+	finished := make(chan struct{})
+	go func() {
+		tx := l.open()
+		l.sent(tx)(nil)
+		l.close(tx, 200, "")
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("deliveries blocked by the save in progress")
+	}
+	store.release <- struct{}{}
+
+	flushed := make(chan error)
+	go func() { flushed <- l.flush() }()
+	if st = <-store.saving; st.Position != 200 {
+		t.Errorf("flushed position %d, want 200", st.Position)
+	}
+	store.release <- struct{}{}
+	if err := <-flushed; err != nil {
+		t.Fatal(err)
+	}
+	// Nothing is left to write.
+	if err := l.flush(); err != nil {
+		t.Fatal(err)
+	}
+}
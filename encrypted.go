@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+const (
+	// encryptionHeaderSize is the size of the header MySQL 8.0.14+ writes
+	// in front of an encrypted binlog. Positions in the binlog do not count
+	// it.
+	encryptionHeaderSize = 512
+
+	encryptionKeyIDField    = 1
+	encryptionPasswordField = 2
+	encryptionIVField       = 3
+)
+
+// encryptedMagic starts the header of an encrypted binlog, version 1.
+var encryptedMagic = []byte{0xfd, 'b', 'i', 'n', 1}
+
+// encryptedBinlogError returns the error for a file that failed the binlog
+// magic check because it is encrypted, or nil when it is not encrypted.
+func encryptedBinlogError(name string, magic []byte) error {
+	if !bytes.HasPrefix(magic, encryptedMagic[:4]) {
+		return nil
+	}
+	if *keyringFile == "" {
+		return fmt.Errorf("%s is an encrypted binlog; read it with -keyringFile", name)
+	}
+	return fmt.Errorf("%s is an encrypted binlog in a format go-parse cannot decrypt", name)
+}
+
+// keyring holds the keys of -keyringFile by key id, loaded once.
+var keyring struct {
+	once sync.Once
+	keys map[string][]byte
+	err  error
+}
+
+func keyringKey(id string) ([]byte, error) {
+	keyring.once.Do(func() {
+		keyring.keys, keyring.err = loadKeyring(*keyringFile)
+	})
+	if keyring.err != nil {
+		return nil, keyring.err
+	}
+	key, ok := keyring.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("-keyringFile %s has no key %s", *keyringFile, id)
+	}
+	return key, nil
+}
+
+// loadKeyring reads the keys of a keyring file, in the JSON format of
+// component_keyring_file or the binary format of the keyring_file plugin.
+func loadKeyring(path string) (map[string][]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return parseComponentKeyring(path, data)
+	}
+	return parsePluginKeyring(path, data)
+}
+
+func parseComponentKeyring(path string, data []byte) (map[string][]byte, error) {
+	var doc struct {
+		Elements []struct {
+			DataID string `json:"data_id"`
+			Data   string `json:"data"`
+		} `json:"elements"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("-keyringFile %s: %v", path, err)
+	}
+	keys := make(map[string][]byte)
+	for _, el := range doc.Elements {
+		key, err := hex.DecodeString(el.Data)
+		if err != nil {
+			return nil, fmt.Errorf("-keyringFile %s: key %s: %v", path, el.DataID, err)
+		}
+		keys[el.DataID] = key
+	}
+	return keys, nil
+}
+
+// keyringObfuscation is what the keyring_file plugin XORs key data with.
+const keyringObfuscation = "*305=Ljt0*!@$Hnm(*-9-w;:"
+
+// parsePluginKeyring reads a keyring_file plugin file: a version line, then
+// per key five 8-byte lengths (entry, key id, key type, user, key data),
+// the fields and padding to 8 bytes, then "EOF" and, in version 2.0, a
+// SHA-256 digest.
+func parsePluginKeyring(path string, data []byte) (map[string][]byte, error) {
+	bad := func(what string) error {
+		return fmt.Errorf("-keyringFile %s is not a keyring file: %s", path, what)
+	}
+	const v1, v2 = "Keyring file version:1.0", "Keyring file version:2.0"
+	switch {
+	case bytes.HasPrefix(data, []byte(v2)) && len(data) >= len(v2)+3+sha256.Size:
+		data = data[len(v2) : len(data)-sha256.Size]
+	case bytes.HasPrefix(data, []byte(v1)):
+		data = data[len(v1):]
+	default:
+		return nil, bad("unknown version")
+	}
+	if !bytes.HasSuffix(data, []byte("EOF")) {
+		return nil, bad("no EOF marker")
+	}
+	data = data[:len(data)-3]
+
+	keys := make(map[string][]byte)
+	for len(data) > 0 {
+		if len(data) < 40 {
+			return nil, bad("truncated key entry")
+		}
+		var n [5]uint64
+		for i := range n {
+			n[i] = binary.LittleEndian.Uint64(data[8*i:])
+		}
+		size, idLen, typeLen, userLen, keyLen := n[0], n[1], n[2], n[3], n[4]
+		if size < 40+idLen+typeLen+userLen+keyLen || size > uint64(len(data)) {
+			return nil, bad("bad key entry size")
+		}
+		fields := data[40:size]
+		id := string(fields[:idLen])
+		key := append([]byte(nil), fields[idLen+typeLen+userLen:idLen+typeLen+userLen+keyLen]...)
+		for i := range key {
+			key[i] ^= keyringObfuscation[i%len(keyringObfuscation)]
+		}
+		keys[id] = key
+		data = data[size:]
+	}
+	return keys, nil
+}
+
+// encryptedFile reads a MySQL 8 encrypted binlog as the binlog it holds.
+// The file password in the header is decrypted with the replication
+// master key from the keyring; the events are AES-256-CTR encrypted with a
+// key and IV derived from that password, so any offset can be read
+// without reading what comes before.
+type encryptedFile struct {
+	raw    statBinlogSource
+	block  cipher.Block
+	iv     []byte
+	off    int64
+	stream cipher.Stream // keystream at off, nil after a seek
+}
+
+// decryptBinlog returns f unchanged when it is not encrypted, and a reader
+// of the binlog it holds when it is.
+func decryptBinlog(name string, f statBinlogSource) (statBinlogSource, error) {
+	header := make([]byte, encryptionHeaderSize)
+	n, err := f.ReadAt(header, 0)
+	if _, serr := f.Seek(0, io.SeekStart); serr != nil {
+		return nil, serr
+	}
+	if !bytes.HasPrefix(header[:n], encryptedMagic[:4]) {
+		return f, nil
+	}
+	if n < encryptionHeaderSize {
+		return nil, fmt.Errorf("%s: truncated encryption header: %v", name, err)
+	}
+	if header[4] != encryptedMagic[4] {
+		return nil, fmt.Errorf("%s: unsupported binlog encryption version %d", name, header[4])
+	}
+
+	var keyID string
+	var password, iv []byte
+	rest := header[len(encryptedMagic):]
+	take := func(n int) []byte {
+		if n > len(rest) {
+			return nil
+		}
+		b := rest[:n]
+		rest = rest[n:]
+		return b
+	}
+	for len(rest) > 0 && rest[0] != 0 {
+		field := take(1)[0]
+		switch field {
+		case encryptionKeyIDField:
+			if n := take(1); n != nil {
+				keyID = string(take(int(n[0])))
+			}
+		case encryptionPasswordField:
+			password = take(32)
+		case encryptionIVField:
+			iv = take(aes.BlockSize)
+		default:
+			return nil, fmt.Errorf("%s: unknown encryption header field %d", name, field)
+		}
+	}
+	if keyID == "" || password == nil || iv == nil {
+		return nil, fmt.Errorf("%s: incomplete encryption header", name)
+	}
+
+	masterKey, err := keyringKey(keyID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	mk, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s: key %s: %v", name, keyID, err)
+	}
+	filePassword := make([]byte, len(password))
+	cipher.NewCBCDecrypter(mk, iv).CryptBlocks(filePassword, password)
+
+	// As EVP_BytesToKey with SHA-512, no salt and one round.
+	sum := sha512.Sum512(filePassword)
+	block, _ := aes.NewCipher(sum[:32])
+	e := &encryptedFile{raw: f, block: block, iv: sum[32 : 32+aes.BlockSize]}
+
+	magic := make([]byte, len(replication.BinLogFileHeader))
+	if _, err := e.ReadAt(magic, 0); err != nil || !bytes.Equal(magic, replication.BinLogFileHeader) {
+		return nil, fmt.Errorf("%s: decrypting with key %s does not give a binlog; is it the right keyring?", name, keyID)
+	}
+	if _, err := e.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// keystream returns the keystream positioned at binlog offset off.
+func (e *encryptedFile) keystream(off int64) cipher.Stream {
+	ctr := new([aes.BlockSize]byte)
+	copy(ctr[:], e.iv)
+	// The counter is the IV plus the block number, big-endian.
+	carry := uint64(off / aes.BlockSize)
+	for i := aes.BlockSize - 1; i >= 0 && carry > 0; i-- {
+		sum := uint64(ctr[i]) + carry&0xff
+		ctr[i] = byte(sum)
+		carry = carry>>8 + sum>>8
+	}
+	s := cipher.NewCTR(e.block, ctr[:])
+	skip := make([]byte, off%aes.BlockSize)
+	s.XORKeyStream(skip, skip)
+	return s
+}
+
+func (e *encryptedFile) Read(p []byte) (int, error) {
+	if e.stream == nil {
+		if _, err := e.raw.Seek(e.off+encryptionHeaderSize, io.SeekStart); err != nil {
+			return 0, err
+		}
+		e.stream = e.keystream(e.off)
+	}
+	n, err := e.raw.Read(p)
+	e.stream.XORKeyStream(p[:n], p[:n])
+	e.off += int64(n)
+	return n, err
+}
+
+func (e *encryptedFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += e.off
+	case io.SeekEnd:
+		fi, err := e.Stat()
+		if err != nil {
+			return e.off, err
+		}
+		offset += fi.Size()
+	}
+	if offset < 0 {
+		return e.off, fmt.Errorf("negative seek")
+	}
+	if offset != e.off {
+		e.off, e.stream = offset, nil
+	}
+	return e.off, nil
+}
+
+func (e *encryptedFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := e.raw.ReadAt(p, off+encryptionHeaderSize)
+	e.keystream(off).XORKeyStream(p[:n], p[:n])
+	// The read may have moved a streaming source.
+	e.stream = nil
+	return n, err
+}
+
+func (e *encryptedFile) Close() error {
+	return e.raw.Close()
+}
+
+// Stat describes the file with the size of the binlog in it.
+func (e *encryptedFile) Stat() (os.FileInfo, error) {
+	fi, err := e.raw.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &binlogFileInfo{fi, fi.Size() - encryptionHeaderSize}, nil
+}
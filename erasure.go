@@ -0,0 +1,390 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// erasureChange is one change to an audited row.
+type erasureChange struct {
+	op        string
+	note      string
+	timestamp uint32
+	file      string
+	pos       uint32
+	gtid      string
+	erases    bool
+}
+
+// erasureRow is an audited row: a row of -table with the key -pk, or a row
+// of a tenant, identified by its key columns.
+type erasureRow struct {
+	subject string // the tenant, or the table and key of -pk
+	table   string
+	key     string
+	changes []*erasureChange
+}
+
+// erasureAudit checks that every audited row's history ends with its
+// erasure, a DELETE or an UPDATE clearing the -piiColumns, before the
+// cutoff.
+type erasureAudit struct {
+	cutoff time.Time
+
+	// -table and -pk, or the tenant columns and -tenants.
+	table    string
+	pk       []string
+	columns  map[string]string
+	tenants  []string
+	subjects map[string]bool
+
+	pii        []string // column or db.table.column
+	anonymized *regexp.Regexp
+
+	tx    txTracker
+	file  string
+	rows  map[string]*erasureRow
+	order []*erasureRow
+	files fileSummary
+}
+
+func newErasureAudit() (*erasureAudit, error) {
+	a := &erasureAudit{rows: make(map[string]*erasureRow)}
+	switch {
+	case *eraseBy == "":
+		return nil, fmt.Errorf("erasure-audit requires -eraseBy")
+	case *valuePK != "" && *tenantColumn != "":
+		return nil, fmt.Errorf("erasure-audit audits a row by -table and -pk, or tenants by -tenantColumn and -tenants, not both")
+	case *valuePK != "":
+		if *valueTable == "" {
+			return nil, fmt.Errorf("erasure-audit -pk requires -table")
+		}
+		a.table, a.pk = *valueTable, strings.Split(*valuePK, ",")
+	case *tenantColumn != "":
+		if *tenantIDs == "" {
+			return nil, fmt.Errorf("erasure-audit -tenantColumn requires -tenants")
+		}
+		var err error
+		if a.columns, err = parseTableColumns(*tenantColumn, "-tenantColumn"); err != nil {
+			return nil, err
+		}
+		a.subjects = make(map[string]bool)
+		for _, t := range strings.Split(*tenantIDs, ",") {
+			t = strings.TrimSpace(t)
+			if !a.subjects[t] {
+				a.subjects[t] = true
+				a.tenants = append(a.tenants, t)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("erasure-audit requires -table and -pk, or -tenantColumn and -tenants")
+	}
+	var err error
+	if a.cutoff, err = parseDatetime(*eraseBy); err != nil {
+		return nil, err
+	}
+	if *piiColumns != "" {
+		for _, c := range strings.Split(*piiColumns, ",") {
+			a.pii = append(a.pii, strings.TrimSpace(c))
+		}
+	}
+	if *anonymizedPattern != "" {
+		if a.anonymized, err = regexp.Compile(*anonymizedPattern); err != nil {
+			return nil, fmt.Errorf("invalid -anonymizedPattern: %v", err)
+		}
+	}
+	return a, nil
+}
+
+// keyOf renders the key column values of row.
+func keyOf(t *replication.TableMapEvent, row []interface{}) string {
+	unsigned := t.UnsignedMap()
+	var key []string
+	for _, c := range keyColumns(t) {
+		if c < len(row) {
+			key = append(key, fmt.Sprint(jsonValue(columnValue(row[c], unsigned[c]))))
+		}
+	}
+	return strings.Join(key, ",")
+}
+
+// piiIndexes returns the -piiColumns of t.
+func (a *erasureAudit) piiIndexes(t *replication.TableMapEvent) ([]int, error) {
+	table := tableName(t)
+	var cols []int
+	for _, c := range a.pii {
+		if dot := strings.LastIndexByte(c, '.'); dot >= 0 {
+			if c[:dot] != table {
+				continue
+			}
+			i, err := columnIndex(t, c[dot+1:])
+			if err != nil {
+				return nil, err
+			}
+			cols = append(cols, i)
+			continue
+		}
+		if i, err := columnIndex(t, c); err == nil {
+			cols = append(cols, i)
+		} else if len(columnNames(t)) == 0 {
+			return nil, err
+		}
+	}
+	return cols, nil
+}
+
+// anonymizes reports whether the after image of an UPDATE clears every
+// -piiColumns column of t: sets it to NULL, empty or a value matching
+// -anonymizedPattern. A table without such columns is never anonymized.
+func (a *erasureAudit) anonymizes(t *replication.TableMapEvent, after []interface{}) (bool, error) {
+	cols, err := a.piiIndexes(t)
+	if err != nil || len(cols) == 0 {
+		return false, err
+	}
+	for _, c := range cols {
+		if c < len(after) && isAbsent(after[c]) {
+			// In neither image, so not changed by the update.
+			return false, nil
+		}
+		if c >= len(after) || after[c] == nil {
+			continue
+		}
+		v := fmt.Sprint(jsonValue(after[c]))
+		if v != "" && (a.anonymized == nil || !a.anonymized.MatchString(v)) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// record adds a change to the row of subject.
+func (a *erasureAudit) record(e *replication.BinlogEvent, subject string, t *replication.TableMapEvent, key string, c *erasureChange) {
+	id := subject + "\x00" + tableName(t) + "\x00" + key
+	r := a.rows[id]
+	if r == nil {
+		r = &erasureRow{subject: subject, table: tableName(t), key: key}
+		a.rows[id] = r
+		a.order = append(a.order, r)
+	}
+	c.timestamp = e.Header.Timestamp
+	c.file = a.file
+	c.pos = e.Header.LogPos - e.Header.EventSize
+	c.gtid = a.tx.gtid()
+	r.changes = append(r.changes, c)
+}
+
+func (a *erasureAudit) observe(e *replication.BinlogEvent) error {
+	re, ok := e.Event.(*replication.RowsEvent)
+	if !ok || re.Table == nil {
+		return nil
+	}
+	t := re.Table
+	table := tableName(t)
+	tenantCol := -1
+	if a.columns != nil {
+		col, ok := a.columns[table]
+		if !ok {
+			return nil
+		}
+		var err error
+		if tenantCol, err = columnIndex(t, col); err != nil {
+			return err
+		}
+	} else if table != a.table {
+		return nil
+	}
+	// subjectOf returns the subject a row image belongs to, or "" if it is
+	// not audited.
+	subjectOf := func(row []interface{}) string {
+		if tenantCol >= 0 {
+			if tenant := tenantOf(t, row, tenantCol); a.subjects[tenant] {
+				return tenant
+			}
+			return ""
+		}
+		if keyOf(t, row) == strings.Join(a.pk, ",") {
+			return table + " " + strings.Join(a.pk, ",")
+		}
+		return ""
+	}
+
+	op := rowsEventKind(e.Header.EventType)
+	if op != "UPDATE" {
+		for _, row := range re.Rows {
+			if s := subjectOf(row); s != "" {
+				a.record(e, s, t, keyOf(t, row), &erasureChange{op: op, erases: op == "DELETE"})
+			}
+		}
+		return nil
+	}
+	for r := 0; r+1 < len(re.Rows); r += 2 {
+		before := markAbsent(re, r)
+		after := carryUnchanged(before, markAbsent(re, r+1))
+		from, to := subjectOf(before), subjectOf(after)
+		fromKey, toKey := keyOf(t, before), keyOf(t, after)
+		if from != "" && from == to && fromKey == toKey {
+			erases, err := a.anonymizes(t, after)
+			if err != nil {
+				return err
+			}
+			c := &erasureChange{op: op, erases: erases}
+			if erases {
+				c.note = "anonymizing"
+			}
+			a.record(e, from, t, fromKey, c)
+			continue
+		}
+		// The row left its old key or tenant and arrived under the new
+		// one. Leaving a tenant erases its data from the tenant; a row of
+		// -pk whose key changed still holds it, under a key not audited.
+		if from != "" {
+			note := "key changed to " + toKey
+			if tenantCol >= 0 && from != to {
+				note = "moved to tenant " + tenantOf(t, after, tenantCol)
+			}
+			a.record(e, from, t, fromKey, &erasureChange{op: op, note: note, erases: tenantCol >= 0})
+		}
+		if to != "" {
+			note := "key changed from " + fromKey
+			if tenantCol >= 0 && from != to {
+				note = "moved from tenant " + tenantOf(t, before, tenantCol)
+			}
+			a.record(e, to, t, toKey, &erasureChange{op: op, note: note})
+		}
+	}
+	return nil
+}
+
+// status returns the verdict on r and whether it passes.
+func (a *erasureAudit) status(r *erasureRow) (string, bool) {
+	last := r.changes[len(r.changes)-1]
+	at := time.Unix(int64(last.timestamp), 0)
+	switch {
+	case !last.erases:
+		return "NOT ERASED: the last change is not an erasure", false
+	case !at.Before(a.cutoff):
+		return "ERASED LATE: erased after " + a.cutoff.Format(timeFormat), false
+	}
+	return "ERASED", true
+}
+
+// report writes the evidence report and returns the number of subjects or
+// rows that fail.
+func (a *erasureAudit) report(w io.Writer) int {
+	fmt.Fprintln(w, "=== Erasure audit ===")
+	if a.columns != nil {
+		fmt.Fprintf(w, "Subjects: tenants %s of %s\n", strings.Join(a.tenants, ", "), *tenantColumn)
+	} else {
+		fmt.Fprintf(w, "Subject: %s row %s\n", a.table, strings.Join(a.pk, ","))
+	}
+	fmt.Fprintf(w, "Erase by: %s\n", a.cutoff.Format(timeFormat))
+	if len(a.pii) > 0 {
+		fmt.Fprintf(w, "Anonymizing UPDATEs clear: %s\n", strings.Join(a.pii, ", "))
+	}
+	fmt.Fprintln(w)
+	a.files.report(w)
+
+	var last uint32
+	for _, c := range a.files.files {
+		last = max(last, c.last)
+	}
+	if last != 0 && time.Unix(int64(last), 0).Before(a.cutoff) {
+		fmt.Fprintf(w, "Note: the binlogs end at %s, before the cutoff; later changes are not covered\n", summaryTime(last))
+	}
+
+	subjects := a.tenants
+	if a.columns == nil {
+		subjects = []string{a.table + " " + strings.Join(a.pk, ",")}
+	}
+	bySubject := make(map[string][]*erasureRow)
+	for _, r := range a.order {
+		bySubject[r.subject] = append(bySubject[r.subject], r)
+	}
+	failed, passed := 0, 0
+	for _, s := range subjects {
+		fmt.Fprintln(w)
+		if a.columns != nil {
+			fmt.Fprintf(w, "=== Tenant %s ===\n", s)
+		} else {
+			fmt.Fprintf(w, "=== Row %s ===\n", s)
+		}
+		rows := bySubject[s]
+		if len(rows) == 0 {
+			fmt.Fprintln(w, "NO EVIDENCE: no change found in the binlogs")
+			failed++
+			continue
+		}
+		sort.SliceStable(rows, func(i, j int) bool {
+			if rows[i].table != rows[j].table {
+				return rows[i].table < rows[j].table
+			}
+			return rows[i].key < rows[j].key
+		})
+		for _, r := range rows {
+			verdict, ok := a.status(r)
+			if ok {
+				passed++
+			} else {
+				failed++
+			}
+			fmt.Fprintf(w, "%s key %s: %s\n", r.table, r.key, verdict)
+			for _, c := range r.changes {
+				line := fmt.Sprintf("  %s  %-6s  %s:%d", summaryTime(c.timestamp), c.op, c.file, c.pos)
+				if c.gtid != "" {
+					line += "  GTID " + c.gtid
+				}
+				if c.note != "" {
+					line += "  (" + c.note + ")"
+				}
+				fmt.Fprintln(w, line)
+			}
+		}
+	}
+	fmt.Fprintln(w)
+	if failed == 0 {
+		fmt.Fprintf(w, "Result: PASS, %s erased before %s\n", plural(passed, "row"), a.cutoff.Format(timeFormat))
+	} else {
+		fmt.Fprintf(w, "Result: FAIL, %d not erased in time or without evidence, %s erased before %s\n", failed, plural(passed, "row"), a.cutoff.Format(timeFormat))
+	}
+	return failed
+}
+
+func erasureAuditCommand(startPosition int64) {
+	a, err := newErasureAudit()
+	if err == nil && (eventFilter != nil || transactionFilter != nil || eventTimes.bounded()) {
+		err = fmt.Errorf("erasure-audit reads every change to the rows; drop the table, GTID and time filters")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fileStart := startPosition
+	err = parseBinlogs(newParser(true), binlogFiles, startPosition, func(file string, start int64) {
+		fileStart = start
+		a.file = filepath.Base(file)
+		a.files.next(file)
+	}, func(e *replication.BinlogEvent) error {
+		// The tracker sees every event to know each row's GTID.
+		a.tx.observe(e)
+		if beforeStart(e, fileStart) {
+			return nil
+		}
+		a.files.observe(e)
+		return a.observe(e)
+	})
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	if a.report(os.Stdout) > 0 {
+		os.Exit(1)
+	}
+}
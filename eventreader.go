@@ -0,0 +1,462 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/klauspost/compress/zstd"
+)
+
+// maxEventSize bounds the size of a single event. MySQL cannot write events
+// larger than max_allowed_packet, whose ceiling is 1GiB; anything bigger is a
+// corrupt length, and trusting it would allocate whatever the header says.
+const maxEventSize = 1 << 30
+
+// errStopParsing can be returned by an event callback to end parseBinlog
+// early without an error.
+var errStopParsing = errors.New("stop parsing")
+
+// eventReader frames and decodes events one at a time. Unlike
+// BinlogParser.ParseReader it validates event lengths, column counts and
+// column bitmaps before handing an event to the decoder, and turns any panic
+// in the decoder into an error, so a corrupt file fails with the position of
+// the bad event instead of crashing.
+type eventReader struct {
+	p      *replication.BinlogParser
+	name   string
+	pos    int64
+	format *replication.FormatDescriptionEvent
+	header []byte
+	// tables are the table maps read, by table id, with which
+	// -maxRowsPerEvent counts the row images of rows events before they
+	// are decoded; nil without it.
+	tables map[uint64]*replication.TableMapEvent
+}
+
+func newEventReader(p *replication.BinlogParser, name string) *eventReader {
+	er := &eventReader{p: p, name: name, pos: 4, header: make([]byte, replication.EventHeaderSize)}
+	if *maxRowsPerEvent > 0 {
+		er.tables = make(map[uint64]*replication.TableMapEvent)
+	}
+	return er
+}
+
+func (er *eventReader) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s: event at position %d: %s", er.name, er.pos, fmt.Sprintf(format, args...))
+}
+
+// next reads and decodes the event at er.pos from r. It returns io.EOF at
+// a clean end of input.
+func (er *eventReader) next(r io.Reader) (*replication.BinlogEvent, error) {
+	if n, err := io.ReadFull(r, er.header); err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, er.errorf("truncated event header: got %d of %d bytes", n, replication.EventHeaderSize)
+	}
+	h := new(replication.EventHeader)
+	if err := h.Decode(er.header); err != nil {
+		return nil, er.errorf("%v", err)
+	}
+	if h.EventSize < replication.EventHeaderSize+er.checksumLength(h.EventType) {
+		return nil, er.errorf("%s size %d is smaller than its header", h.EventType, h.EventSize)
+	}
+	if h.EventSize > maxEventSize {
+		return nil, er.errorf("%s size %d exceeds the %d byte maximum", h.EventType, h.EventSize, maxEventSize)
+	}
+
+	data := make([]byte, h.EventSize)
+	copy(data, er.header)
+	if n, err := io.ReadFull(r, data[replication.EventHeaderSize:]); err != nil {
+		return nil, er.errorf("truncated %s: got %d of %d bytes", h.EventType, n+replication.EventHeaderSize, h.EventSize)
+	}
+
+	body := data[replication.EventHeaderSize : len(data)-int(er.checksumLength(h.EventType))]
+	if err := er.checkBounds(h.EventType, body); err != nil {
+		return nil, er.errorf("malformed %s: %v", h.EventType, err)
+	}
+	if err := er.checkRowImages(h.EventType, body); err != nil {
+		return nil, er.errorf("%s: %v", h.EventType, err)
+	}
+
+	e, err := er.decode(data)
+	if err != nil {
+		// go-mysql's EventError repeats the header and the whole body.
+		var ee *replication.EventError
+		if errors.As(err, &ee) {
+			err = errors.New(ee.Err)
+		}
+		return nil, er.errorf("decode %s: %v", h.EventType, err)
+	}
+	switch ev := e.Event.(type) {
+	case *replication.FormatDescriptionEvent:
+		er.format = ev
+	case *replication.TableMapEvent:
+		if er.tables != nil {
+			er.tables[ev.TableID] = ev
+		}
+	}
+	if shardNames != nil {
+		shardNames.normalize(e)
+	}
+	decodeCharsets(e)
+	expandPartialJSON(e)
+	transformValues(e)
+	er.pos += int64(h.EventSize)
+	return e, nil
+}
+
+// decode runs the go-mysql decoder, converting a panic on malformed input
+// into an error.
+func (er *eventReader) decode(data []byte) (e *replication.BinlogEvent, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+	return er.p.Parse(data)
+}
+
+func (er *eventReader) checksumLength(t replication.EventType) uint32 {
+	if t != replication.FORMAT_DESCRIPTION_EVENT && er.format != nil &&
+		er.format.ChecksumAlgorithm == replication.BINLOG_CHECKSUM_ALG_CRC32 {
+		return replication.BinlogChecksumLength
+	}
+	return 0
+}
+
+// tableIDSize mirrors go-mysql: table ids are 4 bytes when the event type's
+// post-header is 6 bytes long, and 6 bytes otherwise.
+func (er *eventReader) tableIDSize(t replication.EventType) int {
+	if er.format != nil && int(t) <= len(er.format.EventTypeHeaderLengths) && er.format.EventTypeHeaderLengths[t-1] == 6 {
+		return 4
+	}
+	return 6
+}
+
+// checkBounds verifies the parts of an event body that the decoder trusts
+// blindly: the fixed FORMAT_DESCRIPTION layout, and the column counts and
+// column bitmaps of table map and rows events.
+func (er *eventReader) checkBounds(t replication.EventType, body []byte) error {
+	switch t {
+	case replication.FORMAT_DESCRIPTION_EVENT:
+		// version, server version, create timestamp, header length
+		if len(body) < 2+50+4+1 {
+			return fmt.Errorf("body of %d bytes is too short", len(body))
+		}
+	case replication.TABLE_MAP_EVENT:
+		return er.checkTableMap(body)
+	}
+	if bitmaps, v2 := rowsLayout(t); bitmaps > 0 {
+		return er.checkRows(t, body, bitmaps, v2)
+	}
+	return nil
+}
+
+// rowsLayout returns the number of column bitmaps of the rows events of
+// type t, one or two for an update, and whether they are version 2 events
+// with extra data; zero bitmaps for other events.
+func rowsLayout(t replication.EventType) (int, bool) {
+	switch t {
+	case replication.WRITE_ROWS_EVENTv1, replication.DELETE_ROWS_EVENTv1:
+		return 1, false
+	case replication.UPDATE_ROWS_EVENTv1:
+		return 2, false
+	case replication.WRITE_ROWS_EVENTv2, replication.DELETE_ROWS_EVENTv2:
+		return 1, true
+	case replication.UPDATE_ROWS_EVENTv2, replication.PARTIAL_UPDATE_ROWS_EVENT:
+		return 2, true
+	}
+	return 0, false
+}
+
+func (er *eventReader) checkTableMap(body []byte) error {
+	pos := er.tableIDSize(replication.TABLE_MAP_EVENT) + 2
+	for _, what := range []string{"schema", "table"} {
+		if pos >= len(body) {
+			return fmt.Errorf("truncated before the %s name", what)
+		}
+		pos += 1 + int(body[pos]) + 1
+	}
+	count, n, ok := lengthEncodedInt(body, pos)
+	if !ok {
+		return fmt.Errorf("truncated before the column count")
+	}
+	if err := checkColumnCount(count); err != nil {
+		return err
+	}
+	if count > uint64(len(body)-pos-n) {
+		return fmt.Errorf("%d column types do not fit in %d bytes", count, len(body)-pos-n)
+	}
+	return nil
+}
+
+func (er *eventReader) checkRows(t replication.EventType, body []byte, bitmaps int, v2 bool) error {
+	pos := er.tableIDSize(t) + 2
+	if v2 {
+		if pos+2 > len(body) {
+			return fmt.Errorf("truncated before the extra data length")
+		}
+		extra := int(binary.LittleEndian.Uint16(body[pos:]))
+		if extra < 2 || pos+extra > len(body) {
+			return fmt.Errorf("extra data length %d out of range", extra)
+		}
+		pos += extra
+	}
+	count, n, ok := lengthEncodedInt(body, pos)
+	if !ok {
+		return fmt.Errorf("truncated before the column count")
+	}
+	if err := checkColumnCount(count); err != nil {
+		return err
+	}
+	if need := uint64(bitmaps) * ((count + 7) / 8); need > uint64(len(body)-pos-n) {
+		return fmt.Errorf("truncated column bitmap: need %d bytes, have %d", need, len(body)-pos-n)
+	}
+	return nil
+}
+
+// checkRowImages applies -maxRowsPerEvent to a rows event, or to the
+// rows events of a transaction payload, before they are decoded, counting
+// their row images by the sizes of the values the table map gives them.
+// Events it cannot count are left to the decoder to reject.
+func (er *eventReader) checkRowImages(t replication.EventType, body []byte) error {
+	if er.tables == nil {
+		return nil
+	}
+	if t == replication.TRANSACTION_PAYLOAD_EVENT {
+		return er.checkPayloadRowImages(body)
+	}
+	if n, ok := er.rowImages(t, body, *maxRowsPerEvent+1); ok && n > *maxRowsPerEvent {
+		return fmt.Errorf("more than %d row images exceed -maxRowsPerEvent", *maxRowsPerEvent)
+	}
+	return nil
+}
+
+// rowImages counts the row images of a rows event of type t with body, up
+// to limit, by the table map of its table. It reports false for an event
+// it cannot count: of a table not read, or whose images do not fill it.
+func (er *eventReader) rowImages(t replication.EventType, body []byte, limit int) (int, bool) {
+	bitmaps, v2 := rowsLayout(t)
+	if bitmaps == 0 {
+		return 0, false
+	}
+	idSize := er.tableIDSize(t)
+	pos := idSize + 2
+	if v2 {
+		pos += int(binary.LittleEndian.Uint16(body[pos:]))
+	}
+	count, n, _ := lengthEncodedInt(body, pos)
+	pos += n
+	table := er.tables[mysql.FixedLengthInt(body[:idSize])]
+	if table == nil || uint64(len(table.ColumnType)) != count || len(table.ColumnMeta) != len(table.ColumnType) {
+		return 0, false
+	}
+	size := int(count+7) / 8
+	columns := [2][]byte{body[pos : pos+size], body[pos+size : pos+bitmaps*size]}
+	pos += bitmaps * size
+	images := 0
+	for ; pos < len(body) && images < limit; images++ {
+		after := bitmaps == 2 && images%2 == 1
+		n, err := rowImageSize(table, columns[images%bitmaps], body[pos:], after && t == replication.PARTIAL_UPDATE_ROWS_EVENT)
+		if err != nil || pos+n > len(body) {
+			return 0, false
+		}
+		pos += n
+	}
+	return images, images == limit || pos == len(body)
+}
+
+// rowImageSize returns the bytes the row image at the start of data takes,
+// with the columns of table set in the columns bitmap. A partial image,
+// the after image of a PARTIAL_UPDATE_ROWS_EVENT, starts with its value
+// options.
+func rowImageSize(table *replication.TableMapEvent, columns, data []byte, partial bool) (int, error) {
+	short := errors.New("row image too short")
+	pos := 0
+	if partial {
+		options, n, ok := lengthEncodedInt(data, pos)
+		if !ok {
+			return 0, short
+		}
+		pos += n
+		if options&1 != 0 {
+			pos += int(table.JsonColumnCount()+7) / 8
+		}
+	}
+	present := 0
+	for i := range table.ColumnType {
+		if bitSet(columns, i) {
+			present++
+		}
+	}
+	if pos+(present+7)/8 > len(data) {
+		return 0, short
+	}
+	nulls := data[pos : pos+(present+7)/8]
+	pos += (present + 7) / 8
+	column := 0
+	for i, typ := range table.ColumnType {
+		if !bitSet(columns, i) {
+			continue
+		}
+		column++
+		if bitSet(nulls, column-1) {
+			continue
+		}
+		n, err := rawColumnSize(typ, table.ColumnMeta[i], data[pos:])
+		if err != nil {
+			return 0, err
+		}
+		pos += n
+	}
+	return pos, nil
+}
+
+// checkPayloadRowImages applies -maxRowsPerEvent to the rows events of a
+// TRANSACTION_PAYLOAD_EVENT: it decompresses the payload and checks the
+// events in it as next checks those of the file, keeping their table maps.
+func (er *eventReader) checkPayloadRowImages(body []byte) error {
+	// Fields of a type and a length byte each, up to an end mark, then
+	// the payload.
+	compression := uint64(replication.ZSTD)
+	pos := 0
+	for pos < len(body) && body[pos] != replication.OTW_PAYLOAD_HEADER_END_MARK {
+		if pos+2 > len(body) || pos+2+int(body[pos+1]) > len(body) {
+			return nil
+		}
+		if body[pos] == replication.OTW_PAYLOAD_COMPRESSION_TYPE_FIELD {
+			compression = mysql.FixedLengthInt(body[pos+2 : pos+2+int(body[pos+1])])
+		}
+		pos += 2 + int(body[pos+1])
+	}
+	if pos >= len(body) || compression != replication.ZSTD {
+		return nil
+	}
+	d, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil
+	}
+	defer d.Close()
+	payload, err := d.DecodeAll(body[pos+1:], nil)
+	if err != nil {
+		return nil
+	}
+	for len(payload) >= replication.EventHeaderSize {
+		t := replication.EventType(payload[4])
+		size := binary.LittleEndian.Uint32(payload[9:])
+		if size < replication.EventHeaderSize || uint64(size) > uint64(len(payload)) {
+			return nil
+		}
+		inner := payload[replication.EventHeaderSize:size]
+		payload = payload[size:]
+		if er.checkBounds(t, inner) != nil {
+			return nil
+		}
+		if t == replication.TABLE_MAP_EVENT {
+			// The table id is left out of the body, as TableMapEvent.Decode
+			// reads it with the size go-mysql sets it on its parser.
+			idSize := er.tableIDSize(t)
+			table := new(replication.TableMapEvent)
+			if err := decodeTableMap(table, inner[idSize:]); err != nil {
+				return nil
+			}
+			table.TableID = mysql.FixedLengthInt(inner[:idSize])
+			er.tables[table.TableID] = table
+			continue
+		}
+		if err := er.checkRowImages(t, inner); err != nil {
+			return fmt.Errorf("%s in the payload: %v", t, err)
+		}
+	}
+	return nil
+}
+
+// decodeTableMap decodes a table map into t, converting a panic on
+// malformed input into an error.
+func decodeTableMap(t *replication.TableMapEvent, data []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return t.Decode(data)
+}
+
+func checkColumnCount(count uint64) error {
+	if *maxColumns > 0 && count > uint64(*maxColumns) {
+		return fmt.Errorf("column count %d exceeds -maxColumns %d", count, *maxColumns)
+	}
+	return nil
+}
+
+// lengthEncodedInt decodes the MySQL length-encoded integer at b[pos:],
+// reporting false instead of panicking when b is too short.
+func lengthEncodedInt(b []byte, pos int) (uint64, int, bool) {
+	if pos >= len(b) {
+		return 0, 0, false
+	}
+	size := 1
+	switch b[pos] {
+	case 0xfc:
+		size = 3
+	case 0xfd:
+		size = 4
+	case 0xfe:
+		size = 9
+	case 0xfb, 0xff:
+		return 0, 0, false
+	}
+	if pos+size > len(b) {
+		return 0, 0, false
+	}
+	if size == 1 {
+		return uint64(b[pos]), 1, true
+	}
+	var v uint64
+	for i := size - 1; i >= 1; i-- {
+		v = v<<8 | uint64(b[pos+i])
+	}
+	return v, size, true
+}
+
+// inPayload reports whether h is the header of an event expanded from a
+// TRANSACTION_PAYLOAD_EVENT. Such events have no place of their own in the
+// file: they carry the end position of their payload and a zero size, so
+// byte counts stay those of the file.
+func inPayload(h *replication.EventHeader) bool {
+	return h.EventSize == 0
+}
+
+// withPayloadEvents wraps onEvent so that after a TRANSACTION_PAYLOAD_EVENT
+// of binlog_transaction_compression, it is called with each event go-mysql
+// decompressed from the payload, as if the transaction had been written
+// uncompressed.
+func withPayloadEvents(onEvent replication.OnEventFunc) replication.OnEventFunc {
+	return func(e *replication.BinlogEvent) error {
+		if err := onEvent(e); err != nil {
+			return err
+		}
+		p, ok := e.Event.(*replication.TransactionPayloadEvent)
+		if !ok {
+			return nil
+		}
+		for _, inner := range p.Events {
+			inner.Header.LogPos = e.Header.LogPos
+			inner.Header.EventSize = 0
+			if shardNames != nil {
+				shardNames.normalize(inner)
+			}
+			decodeCharsets(inner)
+			expandPartialJSON(inner)
+			transformValues(inner)
+			if err := onEvent(inner); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
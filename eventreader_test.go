@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/klauspost/compress/zstd"
+)
+
+// rowsEventSample is a rows event of the corpus, with its table map, both
+// without checksum, and the row images go-mysql decoded from it.
+type rowsEventSample struct {
+	t               replication.EventType
+	tableMap, event []byte
+	images          int
+}
+
+// corpusRowsEvents returns the rows events of the gen-testdata cases, with
+// the format description of their binlog.
+func corpusRowsEvents(t *testing.T) map[*replication.FormatDescriptionEvent][]rowsEventSample {
+	t.Helper()
+	samples := make(map[*replication.FormatDescriptionEvent][]rowsEventSample)
+	for _, c := range testdataCases() {
+		var format *replication.FormatDescriptionEvent
+		tableMaps := make(map[uint64][]byte)
+		err := parseBinlog(newParser(true), writeTestdataBinlog(t, c.name), 4, func(e *replication.BinlogEvent) error {
+			raw := e.RawData
+			if format != nil && format.ChecksumAlgorithm == replication.BINLOG_CHECKSUM_ALG_CRC32 {
+				raw = raw[:len(raw)-replication.BinlogChecksumLength]
+			}
+			switch ev := e.Event.(type) {
+			case *replication.FormatDescriptionEvent:
+				format = ev
+			case *replication.TableMapEvent:
+				tableMaps[ev.TableID] = raw
+			case *replication.RowsEvent:
+				samples[format] = append(samples[format], rowsEventSample{
+					t:        e.Header.EventType,
+					tableMap: tableMaps[ev.TableID],
+					event:    raw,
+					images:   len(ev.Rows),
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+	}
+	return samples
+}
+
+// newTestEventReader returns an event reader of a binlog with format that
+// has read tableMap, with -maxRowsPerEvent set to max until the test
+// ends.
+func newTestEventReader(t *testing.T, format *replication.FormatDescriptionEvent, tableMap []byte, max int) *eventReader {
+	t.Helper()
+	saved := *maxRowsPerEvent
+	t.Cleanup(func() { *maxRowsPerEvent = saved })
+	*maxRowsPerEvent = max
+	er := newEventReader(newParser(false), "test")
+	er.format = format
+	if tableMap != nil {
+		table := new(replication.TableMapEvent)
+		idSize := er.tableIDSize(replication.TABLE_MAP_EVENT)
+		if err := decodeTableMap(table, tableMap[replication.EventHeaderSize+idSize:]); err != nil {
+			t.Fatal(err)
+		}
+		table.TableID = mysql.FixedLengthInt(tableMap[replication.EventHeaderSize:][:idSize])
+		er.tables[table.TableID] = table
+	}
+	return er
+}
+
+func TestRowImages(t *testing.T) {
+	for format, samples := range corpusRowsEvents(t) {
+		for _, s := range samples {
+			er := newTestEventReader(t, format, s.tableMap, 1)
+			body := s.event[replication.EventHeaderSize:]
+			if n, ok := er.rowImages(s.t, body, 1000); !ok || n != s.images {
+				t.Errorf("%s: counted %d row images (%v), go-mysql decoded %d", s.t, n, ok, s.images)
+			}
+			if err := newTestEventReader(t, format, s.tableMap, s.images).checkRowImages(s.t, body); err != nil {
+				t.Errorf("%s of %d row images rejected at that limit: %v", s.t, s.images, err)
+			}
+			if s.images == 1 {
+				continue
+			}
+			if err := newTestEventReader(t, format, s.tableMap, s.images-1).checkRowImages(s.t, body); err == nil {
+				t.Errorf("%s of %d row images passed a limit of %d", s.t, s.images, s.images-1)
+			}
+		}
+	}
+}
+
+func TestCheckPayloadRowImages(t *testing.T) {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer enc.Close()
+	for format, samples := range corpusRowsEvents(t) {
+		for _, s := range samples {
+			// A transaction payload holding the table map and the rows
+			// event, which carry no checksum in it.
+			var payload []byte
+			for _, e := range [][]byte{s.tableMap, s.event} {
+				e = append([]byte(nil), e...)
+				binary.LittleEndian.PutUint32(e[9:], uint32(len(e)))
+				payload = append(payload, e...)
+			}
+			body := []byte{
+				replication.OTW_PAYLOAD_COMPRESSION_TYPE_FIELD, 1, replication.ZSTD,
+				replication.OTW_PAYLOAD_HEADER_END_MARK,
+			}
+			body = enc.EncodeAll(payload, body)
+			if err := newTestEventReader(t, format, nil, s.images).checkRowImages(replication.TRANSACTION_PAYLOAD_EVENT, body); err != nil {
+				t.Errorf("payload with %s of %d row images rejected at that limit: %v", s.t, s.images, err)
+			}
+			if s.images == 1 {
+				continue
+			}
+			if err := newTestEventReader(t, format, nil, s.images-1).checkRowImages(replication.TRANSACTION_PAYLOAD_EVENT, body); err == nil {
+				t.Errorf("payload with %s of %d row images passed a limit of %d", s.t, s.images, s.images-1)
+			}
+		}
+	}
+}
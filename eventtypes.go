@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// Event types written by servers newer than go-mysql knows about.
+const (
+	// gtidTaggedLogEvent is the GTID event MySQL 8.3+ writes for
+	// transactions with a tagged GTID (uuid:tag:gno).
+	gtidTaggedLogEvent replication.EventType = 42
+)
+
+// eventHandling is how go-parse presents an event type.
+type eventHandling int
+
+const (
+	// handledDecoded events are decoded field by field.
+	handledDecoded eventHandling = iota
+	// handledDescribed events are not decoded by go-mysql but go-parse
+	// decodes and describes them itself.
+	handledDescribed
+	// handledPassthrough events are known but not decoded; their bodies are
+	// shown as raw bytes, labeled with what they are.
+	handledPassthrough
+)
+
+func (h eventHandling) String() string {
+	switch h {
+	case handledDecoded:
+		return "decoded"
+	case handledDescribed:
+		return "described"
+	}
+	return "passthrough"
+}
+
+// eventSupport is one row of the compatibility matrix.
+type eventSupport struct {
+	name     string
+	since    string // first server version writing the event
+	handling eventHandling
+	note     string
+}
+
+// eventTypeSupport is go-parse's compatibility matrix: every binlog event
+// type it knows, the server that introduced it, and how it is handled.
+// Event types missing here are reported as unknown. Add new server event
+// types here first, as passthrough until they are decoded.
+var eventTypeSupport = map[replication.EventType]eventSupport{
+	replication.START_EVENT_V3:                          {"StartEventV3", "MySQL 3.23", handledPassthrough, "pre-5.0 file header"},
+	replication.QUERY_EVENT:                             {"QueryEvent", "MySQL 3.23", handledDecoded, ""},
+	replication.STOP_EVENT:                              {"StopEvent", "MySQL 3.23", handledDescribed, ""},
+	replication.ROTATE_EVENT:                            {"RotateEvent", "MySQL 3.23", handledDecoded, ""},
+	replication.INTVAR_EVENT:                            {"IntVarEvent", "MySQL 3.23", handledDecoded, ""},
+	replication.LOAD_EVENT:                              {"LoadEvent", "MySQL 3.23", handledPassthrough, "removed in MySQL 5.0"},
+	replication.SLAVE_EVENT:                             {"SlaveEvent", "MySQL 3.23", handledPassthrough, "never written"},
+	replication.CREATE_FILE_EVENT:                       {"CreateFileEvent", "MySQL 4.0", handledPassthrough, "removed in MySQL 5.0"},
+	replication.APPEND_BLOCK_EVENT:                      {"AppendBlockEvent", "MySQL 4.0", handledDescribed, "LOAD DATA file contents"},
+	replication.EXEC_LOAD_EVENT:                         {"ExecLoadEvent", "MySQL 4.0", handledPassthrough, "removed in MySQL 5.0"},
+	replication.DELETE_FILE_EVENT:                       {"DeleteFileEvent", "MySQL 4.0", handledPassthrough, "LOAD DATA cleanup"},
+	replication.NEW_LOAD_EVENT:                          {"NewLoadEvent", "MySQL 4.0", handledPassthrough, "removed in MySQL 5.0"},
+	replication.RAND_EVENT:                              {"RandEvent", "MySQL 4.1", handledPassthrough, "RAND() seeds for statement-based replication"},
+	replication.USER_VAR_EVENT:                          {"UserVarEvent", "MySQL 4.1", handledPassthrough, "user variables for statement-based replication"},
+	replication.FORMAT_DESCRIPTION_EVENT:                {"FormatDescriptionEvent", "MySQL 5.0", handledDecoded, ""},
+	replication.XID_EVENT:                               {"XIDEvent", "MySQL 5.0", handledDecoded, ""},
+	replication.BEGIN_LOAD_QUERY_EVENT:                  {"BeginLoadQueryEvent", "MySQL 5.0", handledDecoded, ""},
+	replication.EXECUTE_LOAD_QUERY_EVENT:                {"ExecuteLoadQueryEvent", "MySQL 5.0", handledDecoded, ""},
+	replication.TABLE_MAP_EVENT:                         {"TableMapEvent", "MySQL 5.1", handledDecoded, ""},
+	replication.WRITE_ROWS_EVENTv0:                      {"WriteRowsEventV0", "MySQL 5.1.0", handledDecoded, ""},
+	replication.UPDATE_ROWS_EVENTv0:                     {"UpdateRowsEventV0", "MySQL 5.1.0", handledDecoded, ""},
+	replication.DELETE_ROWS_EVENTv0:                     {"DeleteRowsEventV0", "MySQL 5.1.0", handledDecoded, ""},
+	replication.WRITE_ROWS_EVENTv1:                      {"WriteRowsEventV1", "MySQL 5.1.16", handledDecoded, ""},
+	replication.UPDATE_ROWS_EVENTv1:                     {"UpdateRowsEventV1", "MySQL 5.1.16", handledDecoded, ""},
+	replication.DELETE_ROWS_EVENTv1:                     {"DeleteRowsEventV1", "MySQL 5.1.16", handledDecoded, ""},
+	replication.INCIDENT_EVENT:                          {"IncidentEvent", "MySQL 5.1", handledPassthrough, "the source lost events; replicas stop here"},
+	replication.HEARTBEAT_EVENT:                         {"HeartbeatEvent", "MySQL 5.5", handledDescribed, ""},
+	replication.IGNORABLE_EVENT:                         {"IgnorableEvent", "MySQL 5.6", handledPassthrough, "safe to skip"},
+	replication.ROWS_QUERY_EVENT:                        {"RowsQueryEvent", "MySQL 5.6", handledDecoded, ""},
+	replication.WRITE_ROWS_EVENTv2:                      {"WriteRowsEventV2", "MySQL 5.6", handledDecoded, ""},
+	replication.UPDATE_ROWS_EVENTv2:                     {"UpdateRowsEventV2", "MySQL 5.6", handledDecoded, ""},
+	replication.DELETE_ROWS_EVENTv2:                     {"DeleteRowsEventV2", "MySQL 5.6", handledDecoded, ""},
+	replication.GTID_EVENT:                              {"GTIDEvent", "MySQL 5.6", handledDecoded, ""},
+	replication.ANONYMOUS_GTID_EVENT:                    {"AnonymousGTIDEvent", "MySQL 5.6", handledDecoded, ""},
+	replication.PREVIOUS_GTIDS_EVENT:                    {"PreviousGTIDsEvent", "MySQL 5.6", handledDecoded, ""},
+	replication.TRANSACTION_CONTEXT_EVENT:               {"TransactionContextEvent", "MySQL 5.7", handledPassthrough, "group replication certification data"},
+	replication.VIEW_CHANGE_EVENT:                       {"ViewChangeEvent", "MySQL 5.7", handledPassthrough, "group replication membership change"},
+	replication.XA_PREPARE_LOG_EVENT:                    {"XAPrepareLogEvent", "MySQL 5.7", handledPassthrough, "XA PREPARE of an XA transaction"},
+	replication.PARTIAL_UPDATE_ROWS_EVENT:               {"PartialUpdateRowsEvent", "MySQL 8.0", handledDecoded, ""},
+	replication.TRANSACTION_PAYLOAD_EVENT:               {"TransactionPayloadEvent", "MySQL 8.0.20", handledDecoded, "binlog_transaction_compression; the events it holds follow it"},
+	replication.HEARTBEAT_LOG_EVENT_V2:                  {"HeartbeatLogEventV2", "MySQL 8.0.26", handledDescribed, ""},
+	gtidTaggedLogEvent:                                  {"GtidTaggedLogEvent", "MySQL 8.3", handledPassthrough, "GTID of a transaction with a tagged GTID; starts a transaction"},
+	replication.MARIADB_ANNOTATE_ROWS_EVENT:             {"MariadbAnnotateRowsEvent", "MariaDB 5.3", handledDecoded, ""},
+	replication.MARIADB_BINLOG_CHECKPOINT_EVENT:         {"MariadbBinLogCheckPointEvent", "MariaDB 10.0", handledDecoded, ""},
+	replication.MARIADB_GTID_EVENT:                      {"MariadbGTIDEvent", "MariaDB 10.0", handledDecoded, ""},
+	replication.MARIADB_GTID_LIST_EVENT:                 {"MariadbGTIDListEvent", "MariaDB 10.0", handledDecoded, ""},
+	replication.MARIADB_START_ENCRYPTION_EVENT:          {"MariadbStartEncryptionEvent", "MariaDB 10.1", handledPassthrough, "the rest of the file is encrypted"},
+	replication.MARIADB_QUERY_COMPRESSED_EVENT:          {"MariadbQueryCompressedEvent", "MariaDB 10.2", handledDecoded, ""},
+	replication.MARIADB_WRITE_ROWS_COMPRESSED_EVENT_V1:  {"MariadbWriteRowsCompressedEventV1", "MariaDB 10.2", handledDecoded, ""},
+	replication.MARIADB_UPDATE_ROWS_COMPRESSED_EVENT_V1: {"MariadbUpdateRowsCompressedEventV1", "MariaDB 10.2", handledDecoded, ""},
+	replication.MARIADB_DELETE_ROWS_COMPRESSED_EVENT_V1: {"MariadbDeleteRowsCompressedEventV1", "MariaDB 10.2", handledDecoded, ""},
+}
+
+// eventTypeName names t, including the types go-mysql does not know.
+func eventTypeName(t replication.EventType) string {
+	if s, ok := eventTypeSupport[t]; ok {
+		return s.name
+	}
+	return t.String()
+}
+
+// printEventTypes writes the compatibility matrix.
+func printEventTypes(w io.Writer) {
+	types := make([]replication.EventType, 0, len(eventTypeSupport))
+	for t := range eventTypeSupport {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "code\tevent\tsince\thandling\tnote")
+	for _, t := range types {
+		s := eventTypeSupport[t]
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", t, s.name, s.since, s.handling, s.note)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// explainedEvent is one event of the transaction explain-position shows,
+// rendered when it is read.
+type explainedEvent struct {
+	start, end uint32
+	timestamp  uint32
+	name       string
+	table      string
+	kind       string // INSERT, UPDATE or DELETE for rows events
+	rows       int
+	sql        []byte
+}
+
+// positionExplanation is what explain-position found at a position.
+type positionExplanation struct {
+	pos int64
+	// events are those of the transaction holding the event at pos, or
+	// that event alone when it is outside any transaction; target is its
+	// index.
+	events []explainedEvent
+	target int
+	// inside is set when pos falls within the event rather than at its
+	// start.
+	inside bool
+	// endOf is the event that ends at pos, when another starts there.
+	endOf *explainedEvent
+	tx    *transaction
+	gtid  string
+	// open is set when the transaction has no commit in the file.
+	open bool
+}
+
+// explainEvent renders e for explain-position.
+func explainEvent(e *replication.BinlogEvent) explainedEvent {
+	x := explainedEvent{
+		start:     e.Header.LogPos - e.Header.EventSize,
+		end:       e.Header.LogPos,
+		timestamp: e.Header.Timestamp,
+		name:      eventTypeName(e.Header.EventType),
+	}
+	switch ev := e.Event.(type) {
+	case *replication.QueryEvent:
+		if len(ev.Schema) > 0 && !strings.EqualFold(string(ev.Query), "BEGIN") {
+			x.sql = append(x.sql, "USE "...)
+			x.sql = append(x.sql, quoteIdent(string(ev.Schema))...)
+			x.sql = append(x.sql, ";\n"...)
+		}
+		x.sql = append(x.sql, ev.Query...)
+		x.sql = append(x.sql, ";\n"...)
+	case *replication.XIDEvent:
+		x.sql = append(x.sql, "COMMIT;\n"...)
+	case *replication.TableMapEvent:
+		x.table = tableName(ev)
+	case *replication.RowsEvent:
+		if ev.Table == nil {
+			break
+		}
+		x.table = tableName(ev.Table)
+		x.kind = rowsEventKind(e.Header.EventType)
+		x.rows = rowsAffected(e)
+		x.sql = appendRowsSQL(nil, x.kind, ev)
+	}
+	return x
+}
+
+// appendRowsSQL appends statements making the changes of rows event re.
+// Without column names (see columnNames), columns are written @1, @2 and so
+// on as mysqlbinlog does, and the statements only describe the change.
+func appendRowsSQL(b []byte, kind string, re *replication.RowsEvent) []byte {
+	t := re.Table
+	names := columnNames(t)
+	if len(names) != int(t.ColumnCount) && kind != "INSERT" {
+		b = append(b, "-- no column names (binlog_row_metadata=MINIMAL, and not in -schemaFile): @N is column N\n"...)
+	}
+	unsigned := t.UnsignedMap()
+	table := quoteIdent(string(t.Schema)) + "." + quoteIdent(string(t.Table))
+	step := 1
+	if kind == "UPDATE" {
+		step = 2
+	}
+	for r := 0; r+step <= len(re.Rows); r += step {
+		row := markAbsent(re, r)
+		switch kind {
+		case "INSERT":
+			b = appendInsert(b, t, row)
+		case "DELETE":
+			b = append(b, "DELETE FROM "...)
+			b = append(b, table...)
+			b = appendRowWhere(b, t, row)
+			b = append(b, ";\n"...)
+		case "UPDATE":
+			after := carryUnchanged(row, markAbsent(re, r+1))
+			b = append(b, "UPDATE "...)
+			b = append(b, table...)
+			b = append(b, " SET "...)
+			n := 0
+			for i, v := range after {
+				if isAbsent(v) {
+					continue
+				}
+				if n > 0 {
+					b = append(b, ", "...)
+				}
+				n++
+				b = append(b, sqlColumn(names, i)...)
+				b = append(b, " = "...)
+				b = appendSQLLiteral(b, columnValue(v, unsigned[i]))
+			}
+			b = appendRowWhere(b, t, row)
+			b = append(b, ";\n"...)
+		}
+	}
+	return b
+}
+
+// sqlColumn is column i as SQL: its quoted name, or @i+1 without names.
+func sqlColumn(names []string, i int) string {
+	if i < len(names) {
+		return quoteIdent(names[i])
+	}
+	return columnLabel(names, i)
+}
+
+// appendRowWhere appends a WHERE clause finding row of table t by its key
+// (see uniqueKey) or, for a table without one, by every column the image
+// carries that compares by equality, limited to one row: rows alike in all
+// those columns are as good as the same to the statement.
+func appendRowWhere(b []byte, t *replication.TableMapEvent, row []interface{}) []byte {
+	names := columnNames(t)
+	unsigned := t.UnsignedMap()
+	cols := uniqueKey(t)
+	limit := cols == nil
+	if limit {
+		for i := range row {
+			if equalityComparable(t, i) {
+				cols = append(cols, i)
+			}
+		}
+	}
+	b = append(b, " WHERE "...)
+	n := 0
+	for _, c := range cols {
+		if c >= len(row) || isAbsent(row[c]) {
+			continue
+		}
+		if n > 0 {
+			b = append(b, " AND "...)
+		}
+		n++
+		b = append(b, sqlColumn(names, c)...)
+		// <=> also matches NULL.
+		b = append(b, " <=> "...)
+		b = appendSQLLiteral(b, columnValue(row[c], unsigned[c]))
+	}
+	if limit {
+		b = append(b, " LIMIT 1"...)
+	}
+	return b
+}
+
+// explainPosition reads binlogFile up to the event at pos and on to the end
+// of its transaction. pos may be an event's start, as -listPositions and
+// SHOW BINLOG EVENTS give it, its end, the end_log_pos of replication
+// errors, or fall within it.
+func explainPosition(binlogFile string, pos int64) (*positionExplanation, error) {
+	x := &positionExplanation{pos: pos, target: -1}
+	var tx txTracker
+	// last is a copy: resetting events reuses their array.
+	var last *explainedEvent
+	err := parseBinlog(newParser(true), binlogFile, 4, func(e *replication.BinlogEvent) error {
+		if tx.cur == nil && x.target < 0 {
+			x.events = x.events[:0]
+		}
+		ev := explainEvent(e)
+		x.events = append(x.events, ev)
+		done := tx.observe(e)
+		// Events of a compressed payload share its position.
+		if x.target < 0 && !inPayload(e.Header) {
+			switch {
+			case int64(ev.start) == pos:
+				x.target = len(x.events) - 1
+				if last != nil && int64(last.end) == pos {
+					x.endOf = last
+				}
+			case int64(ev.start) < pos && pos < int64(ev.end):
+				x.target, x.inside = len(x.events)-1, true
+			}
+			if x.target >= 0 && x.gtid == "" {
+				x.gtid = tx.gtid()
+			}
+		}
+		if !inPayload(e.Header) {
+			last = &ev
+		}
+		if x.target < 0 {
+			return nil
+		}
+		if done != nil {
+			x.tx = done
+			return errStopParsing
+		}
+		if tx.cur == nil {
+			// Outside a transaction: the event stands alone.
+			x.events = x.events[x.target : x.target+1]
+			x.target = 0
+			return errStopParsing
+		}
+		return nil
+	})
+	if err == errStopParsing {
+		err = nil
+	}
+	if x.target < 0 && last != nil && int64(last.end) == pos {
+		// The end of the file: the last event ends there.
+		x.events, x.target = []explainedEvent{*last}, 0
+		x.endOf = nil
+		x.inside = true
+	}
+	if x.target < 0 {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s has no event at position %d", binlogFile, pos)
+	}
+	x.open = x.tx == nil && len(x.events) > 1
+	return x, err
+}
+
+func (x *positionExplanation) print(w io.Writer) {
+	ev := x.events[x.target]
+	at := "the start of"
+	switch {
+	case x.inside && int64(ev.end) == x.pos:
+		at = "the end of"
+	case x.inside:
+		at = "inside"
+	}
+	fmt.Fprintf(w, "Position %d: %s %s at %d-%d, %s\n", x.pos, at, ev.name, ev.start, ev.end,
+		time.Unix(int64(ev.timestamp), 0).Format(timeFormat))
+	if x.endOf != nil {
+		fmt.Fprintf(w, "  and the end (end_log_pos) of %s at %d-%d\n", x.endOf.name, x.endOf.start, x.endOf.end)
+	}
+	if ev.table != "" {
+		fmt.Fprintf(w, "Table: %s", ev.table)
+		if ev.kind != "" {
+			fmt.Fprintf(w, ", %s %s", ev.kind, plural(ev.rows, "row"))
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(x.events) > 1 {
+		gtid := x.gtid
+		if gtid == "" {
+			gtid = "none (anonymous)"
+		}
+		end := "no commit in the file"
+		if x.tx != nil {
+			end = fmt.Sprint(x.tx.End)
+		}
+		fmt.Fprintf(w, "\nTransaction: GTID %s, positions %d-%s, %s\n", gtid, x.events[0].start, end,
+			time.Unix(int64(x.events[0].timestamp), 0).Format(timeFormat))
+		tables := make(map[string][3]int)
+		var order []string
+		for i, e := range x.events {
+			mark := " "
+			if i == x.target {
+				mark = ">"
+			}
+			detail := e.table
+			if e.kind != "" {
+				detail += fmt.Sprintf(" %s %s", e.kind, plural(e.rows, "row"))
+				counts, seen := tables[e.table]
+				if !seen {
+					order = append(order, e.table)
+				}
+				counts[strings.Index("INSERT UPDATE DELETE", e.kind)/7] += e.rows
+				tables[e.table] = counts
+			}
+			fmt.Fprintf(w, "%s %-8d %-24s %s\n", mark, e.start, e.name, detail)
+		}
+		for _, t := range order {
+			c := tables[t]
+			fmt.Fprintf(w, "Rows of %s: %d inserted, %d updated, %d deleted\n", t, c[0], c[1], c[2])
+		}
+	} else {
+		fmt.Fprintln(w, "\nNot in a transaction")
+	}
+
+	var sql []byte
+	for _, e := range x.events {
+		sql = append(sql, e.sql...)
+	}
+	if len(sql) > 0 {
+		fmt.Fprintln(w, "\nSQL:")
+		w.Write(sql)
+	}
+	if x.open {
+		fmt.Fprintln(w, "-- no commit in the file")
+	}
+}
+
+func explainPositionCommand(int64) {
+	if *explainPos < 4 {
+		fmt.Fprintf(os.Stderr, "Error: explain-position requires -pos, the position to explain\n")
+		os.Exit(1)
+	}
+	x, err := explainPosition(*binlogFile, *explainPos)
+	if x != nil {
+		x.print(os.Stdout)
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+}
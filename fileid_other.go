@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// fileIdentity falls back to the base name where inodes are unavailable.
+func fileIdentity(fi os.FileInfo) string {
+	return fi.Name()
+}
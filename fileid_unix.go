@@ -0,0 +1,18 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fileIdentity identifies a file by device and inode, so a cache entry
+// survives renames but not replacement of the file.
+func fileIdentity(fi os.FileInfo) string {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return fmt.Sprintf("%d-%d", st.Dev, st.Ino)
+	}
+	return fi.Name()
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// fileRange is the entry of one binlog in a -fileManifest: the bounds of
+// what the file holds, enough to tell whether a run can need it without
+// reading it.
+type fileRange struct {
+	File           string `json:"file"`
+	Size           int64  `json:"size"`
+	ModTime        int64  `json:"mod_time"`
+	FirstTimestamp uint32 `json:"first_timestamp"`
+	LastTimestamp  uint32 `json:"last_timestamp"`
+	FirstPos       uint32 `json:"first_pos"`
+	LastPos        uint32 `json:"last_pos"`
+	FirstGTID      string `json:"first_gtid,omitempty"`
+	LastGTID       string `json:"last_gtid,omitempty"`
+	GTIDSet        string `json:"gtid_set,omitempty"`
+	// Anonymous counts the transactions without a GTID.
+	Anonymous int `json:"anonymous_transactions"`
+}
+
+func newFileRange(md *fileMetadata) fileRange {
+	r := fileRange{
+		File:           md.Path,
+		Size:           md.Size,
+		ModTime:        md.ModTime,
+		FirstTimestamp: md.FirstTimestamp,
+		LastTimestamp:  md.LastTimestamp,
+		FirstPos:       md.FirstPos,
+		LastPos:        md.LastPos,
+		GTIDSet:        md.GTIDSet,
+	}
+	for _, t := range md.Transactions {
+		if t.GTID == "" {
+			r.Anonymous++
+			continue
+		}
+		if r.FirstGTID == "" {
+			r.FirstGTID = t.GTID
+		}
+		r.LastGTID = t.GTID
+	}
+	return r
+}
+
+// readFileManifest returns the entries of the manifest at path by file. A
+// missing manifest has none.
+func readFileManifest(path string) (map[string]fileRange, error) {
+	ranges := make(map[string]fileRange)
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ranges, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var r fileRange
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil || r.File == "" {
+			return nil, fmt.Errorf("%s:%d: not a file manifest entry", path, line)
+		}
+		ranges[r.File] = r
+	}
+	return ranges, sc.Err()
+}
+
+// writeFileManifest replaces the manifest at path with ranges, one JSON
+// line per file in file order.
+func writeFileManifest(path string, ranges map[string]fileRange) error {
+	names := make([]string, 0, len(ranges))
+	for name := range ranges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, name := range names {
+		if err = enc.Encode(ranges[name]); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// fileRanges returns the manifest entries of files, scanning the files
+// that have no entry or whose size or modification time changed since it
+// was written, and rewrites the manifest when any did.
+func fileRanges(path string, files []string) ([]fileRange, error) {
+	ranges, err := readFileManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	changed := false
+	out := make([]fileRange, len(files))
+	for i, file := range files {
+		fi, err := statBinlog(file)
+		if err != nil {
+			return nil, err
+		}
+		r, ok := ranges[file]
+		if !ok || r.Size != fi.Size() || r.ModTime != fi.ModTime().Unix() {
+			md, err := loadFileMetadata(file, !*noCache)
+			if err != nil {
+				return nil, err
+			}
+			r = newFileRange(md)
+			ranges[file] = r
+			changed = true
+		}
+		out[i] = r
+	}
+	if changed {
+		if err := writeFileManifest(path, ranges); err != nil {
+			return nil, fmt.Errorf("write -fileManifest: %v", err)
+		}
+	}
+	return out, nil
+}
+
+// pruneBinlogFiles drops from files those that, by their -fileManifest
+// entries, hold nothing the run's time range and GTID filter let through.
+// A file whose first event is at or after -stopDatetime ends the run, as
+// reading it would, so it goes with every file after it. A first file
+// read from a start position past its header is always kept, so the
+// position still applies to it.
+func pruneBinlogFiles(files []string, startPosition int64) ([]string, error) {
+	ranges, err := fileRanges(*fileManifest, files)
+	if err != nil {
+		return nil, err
+	}
+	kept := make([]string, 0, len(files))
+	for i, r := range ranges {
+		if i == 0 && startPosition > 4 {
+			kept = append(kept, files[i])
+			continue
+		}
+		if r.FirstTimestamp != 0 && !eventTimes.stop.IsZero() && !time.Unix(int64(r.FirstTimestamp), 0).Before(eventTimes.stop) {
+			break
+		}
+		if r.outside() {
+			continue
+		}
+		kept = append(kept, files[i])
+	}
+	if len(kept) < len(files) {
+		fmt.Fprintf(os.Stderr, "Skipping %d of %d files outside the requested range per %s\n", len(files)-len(kept), len(files), *fileManifest)
+	}
+	return kept, nil
+}
+
+// outside reports whether no transaction of the file can be in the run:
+// it ended before -startDatetime, it has no GTID of -includeGTIDs, or
+// every transaction it has is in -excludeGTIDs.
+func (r fileRange) outside() bool {
+	if r.LastTimestamp != 0 && !eventTimes.start.IsZero() && time.Unix(int64(r.LastTimestamp), 0).Before(eventTimes.start) {
+		return true
+	}
+	f := transactionFilter
+	if f == nil {
+		return false
+	}
+	set, err := mysql.ParseMysqlGTIDSet(r.GTIDSet)
+	if err != nil {
+		return false
+	}
+	have := set.(*mysql.MysqlGTIDSet)
+	if f.include != nil && !gtidSetsOverlap(have, f.include) {
+		return true
+	}
+	return f.exclude != nil && len(have.Sets) > 0 && r.Anonymous == 0 && f.exclude.Contain(have)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// binlogFiles are the files named by -file, in the order they are read.
+var binlogFiles []string
+
+// expandBinlogFiles splits -file into its comma-separated entries and
+// expands the entries that are globs, each in name order, which for binlogs
+// is the order they were written. Entries that are not globs are kept as
+// given, to be checked for existence by the caller.
+func expandBinlogFiles(spec string) ([]string, error) {
+	var files []string
+	for _, entry := range splitPatterns(spec) {
+		if !strings.ContainsAny(entry, "*?[") {
+			files = append(files, entry)
+			continue
+		}
+		glob := filepath.Glob
+		if isS3URL(entry) {
+			glob = globS3Objects
+		}
+		matches, err := glob(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file pattern %q", entry)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no binlog file matches %s", entry)
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// readBinlogIndex returns the binlogs listed in a server's index file
+// (mysql-bin.index), in order. Relative entries, such as the
+// ./mysql-bin.000001 a server writes, are relative to the index file's
+// directory.
+func readBinlogIndex(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(filepath.Dir(path), line)
+		} else if _, err := os.Stat(line); err != nil {
+			// An index copied from another host: look beside it.
+			line = filepath.Join(filepath.Dir(path), filepath.Base(line))
+		}
+		files = append(files, line)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s lists no binlog files", path)
+	}
+	return files, nil
+}
+
+// parseBinlogs parses files in sequence with the one parser p, so the table
+// maps it knows and the callers' state carry from file to file. offset
+// applies to the first file; the others are read from their start. begin,
+// if not nil, is called before each file with its name and start position.
+// An errStopParsing from onEvent ends the whole run. With -dsn the events
+// come from the server instead, from files[0]. With -follow, a
+// rotation at the end of the last file continues into the file it names.
+func parseBinlogs(p *replication.BinlogParser, files []string, offset int64, begin func(file string, start int64), onEvent replication.OnEventFunc) error {
+	notifyReady()
+	if *dsn != "" {
+		return streamBinlog(p, files[0], offset, begin, onEvent)
+	}
+	for i := 0; i < len(files); i++ {
+		file := files[i]
+		start := offset
+		if i > 0 {
+			start = 4
+		}
+		if begin != nil {
+			begin(file, start)
+		}
+		stopped := false
+		rotated := ""
+		err := parseBinlog(p, file, start, func(e *replication.BinlogEvent) error {
+			if ev, ok := e.Event.(*replication.RotateEvent); ok && e.Header.LogPos != 0 {
+				rotated = string(ev.NextLogName)
+			}
+			err := onEvent(e)
+			if err == errStopParsing {
+				stopped = true
+			}
+			return err
+		})
+		if err != nil || stopped {
+			return err
+		}
+		if *follow && rotated != "" && i == len(files)-1 {
+			next := filepath.Join(filepath.Dir(file), filepath.Base(rotated))
+			if !waitForFile(next) {
+				return nil
+			}
+			files = append(files, next)
+		}
+	}
+	return nil
+}
+
+// fileSummary counts the events of each file of a multi-file run for the
+// per-file summary.
+type fileSummary struct {
+	files []*fileCount
+}
+
+type fileCount struct {
+	name        string
+	events      int
+	bytes       uint64
+	first, last uint32
+}
+
+// next starts counting the events of file.
+func (s *fileSummary) next(file string) {
+	s.files = append(s.files, &fileCount{name: file})
+}
+
+func (s *fileSummary) observe(e *replication.BinlogEvent) {
+	if len(s.files) == 0 {
+		return
+	}
+	c := s.files[len(s.files)-1]
+	c.events++
+	c.bytes += uint64(e.Header.EventSize)
+	if ts := e.Header.Timestamp; ts != 0 {
+		if c.first == 0 || ts < c.first {
+			c.first = ts
+		}
+		if ts > c.last {
+			c.last = ts
+		}
+	}
+}
+
+func (s *fileSummary) report(w io.Writer) {
+	fmt.Fprintln(w, "=== Files ===")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "file\tevents\tbytes\tfirst event\tlast event")
+	var total fileCount
+	for _, c := range s.files {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\n", c.name, c.events, c.bytes, summaryTime(c.first), summaryTime(c.last))
+		total.events += c.events
+		total.bytes += c.bytes
+		if c.first != 0 && (total.first == 0 || c.first < total.first) {
+			total.first = c.first
+		}
+		total.last = max(total.last, c.last)
+	}
+	fmt.Fprintf(tw, "total (%s)\t%d\t%d\t%s\t%s\n", plural(len(s.files), "file"), total.events, total.bytes, summaryTime(total.first), summaryTime(total.last))
+	tw.Flush()
+}
+
+func summaryTime(ts uint32) string {
+	if ts == 0 {
+		return "-"
+	}
+	return time.Unix(int64(ts), 0).Format(timeFormat)
+}
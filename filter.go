@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// objectFilter keeps or drops events by the database and table they act on,
+// from -includeDB, -excludeDB, -includeTable and -excludeTable. Events
+// that name no object, such as GTID, XID and BEGIN/COMMIT events, are always
+// kept so transactions stay framed.
+type objectFilter struct {
+	includeDB, excludeDB       []string
+	includeTable, excludeTable []string
+}
+
+// eventFilter is the filter of the run, nil when no filter flag is set.
+var eventFilter *objectFilter
+
+// newObjectFilter returns the filter set by the command line, or nil when
+// no filter flag is set.
+func newObjectFilter() (*objectFilter, error) {
+	f := &objectFilter{
+		includeDB:    splitPatterns(*includeDB),
+		excludeDB:    splitPatterns(*excludeDB),
+		includeTable: tablePatterns(*includeTable),
+		excludeTable: tablePatterns(*excludeTable),
+	}
+	if len(f.includeDB)+len(f.excludeDB)+len(f.includeTable)+len(f.excludeTable) == 0 {
+		return nil, nil
+	}
+	for _, list := range [][]string{f.includeDB, f.excludeDB, f.includeTable, f.excludeTable} {
+		for _, p := range list {
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, fmt.Errorf("invalid filter pattern %q", p)
+			}
+		}
+	}
+	return f, nil
+}
+
+func splitPatterns(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// tablePatterns splits a table filter; a pattern without a database
+// matches the table in any database.
+func tablePatterns(s string) []string {
+	out := splitPatterns(s)
+	for i, p := range out {
+		if !strings.Contains(p, ".") {
+			out[i] = "*." + p
+		}
+	}
+	return out
+}
+
+// eventObject returns the database and db.table an event acts on. Table
+// map and rows events name both. DDL statements name their target; other
+// statements, including statement-based DML, only their default database.
+func eventObject(e *replication.BinlogEvent) (db, table string) {
+	switch ev := e.Event.(type) {
+	case *replication.TableMapEvent:
+		return string(ev.Schema), tableName(ev)
+	case *replication.RowsEvent:
+		if ev.Table != nil {
+			return string(ev.Table.Schema), tableName(ev.Table)
+		}
+	case *replication.QueryEvent:
+		q, schema := string(ev.Query), string(ev.Schema)
+		switch statementVerb(q) {
+		case "BEGIN", "COMMIT", "ROLLBACK", "XA", "SAVEPOINT":
+			return "", ""
+		case "CREATE", "ALTER", "DROP", "TRUNCATE", "RENAME":
+			switch object, name := statementTarget(q, schema); object {
+			case "DATABASE", "SCHEMA":
+				return name, ""
+			case "TABLE", "VIEW":
+				if d, _, ok := strings.Cut(name, "."); ok {
+					return d, name
+				}
+			}
+		}
+		return schema, ""
+	}
+	return "", ""
+}
+
+// keep reports whether e passes the filter.
+func (f *objectFilter) keep(e *replication.BinlogEvent) bool {
+	db, table := eventObject(e)
+	if db == "" && table == "" {
+		return true
+	}
+	if len(f.includeDB) > 0 && !matchTable(f.includeDB, db) || matchTable(f.excludeDB, db) {
+		return false
+	}
+	if len(f.includeTable) > 0 && (table == "" || !matchTable(f.includeTable, table)) {
+		return false
+	}
+	return table == "" || !matchTable(f.excludeTable, table)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/google/uuid"
+)
+
+// parseGTID parses a single GTID, uuid:number, into the form gtidString
+// gives transactions.
+func parseGTID(s string) (string, error) {
+	sid, gno, ok := strings.Cut(strings.TrimSpace(s), ":")
+	u, err := uuid.Parse(sid)
+	if !ok || err != nil {
+		return "", fmt.Errorf("invalid GTID %q: want uuid:number", s)
+	}
+	n, err := strconv.ParseInt(gno, 10, 64)
+	if err != nil || n < 1 {
+		return "", fmt.Errorf("invalid GTID %q: want uuid:number", s)
+	}
+	return fmt.Sprintf("%s:%d", u, n), nil
+}
+
+// locateGTID prints where the transaction of -findGTID is in files,
+// with the coordinates to point a replica at it or past it. It looks in the
+// transaction index of the metadata cache.
+func locateGTID(files []string) {
+	gtid, err := parseGTID(*findGTID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -findGTID: %v\n", err)
+		os.Exit(1)
+	}
+	set, _ := mysql.ParseMysqlGTIDSet(gtid)
+	var before string
+	for _, file := range files {
+		md, err := loadFileMetadata(file, !*noCache)
+		if md == nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		for _, t := range md.Transactions {
+			if t.GTID != gtid {
+				continue
+			}
+			name := binlogBase(file)
+			fmt.Printf("%s: %s, positions %d-%d, %s\n", gtid, file, t.Start, t.End, time.Unix(int64(t.Timestamp), 0).Format(timeFormat))
+			fmt.Printf("To replay it:  CHANGE MASTER TO MASTER_LOG_FILE='%s', MASTER_LOG_POS=%d;\n", name, t.Start)
+			fmt.Printf("To skip it:    CHANGE MASTER TO MASTER_LOG_FILE='%s', MASTER_LOG_POS=%d;\n", name, t.End)
+			return
+		}
+		if err != nil {
+			// The transaction may be past the damage.
+			fmt.Println(err.Error())
+		}
+		if before == "" {
+			if prev, err := mysql.ParseMysqlGTIDSet(md.PreviousGTIDs); err == nil && prev.Contain(set) {
+				before = file
+			}
+		}
+	}
+	if before != "" {
+		fmt.Printf("%s is not in the files: it was executed before %s (in its Previous_gtids)\n", gtid, before)
+	} else {
+		fmt.Printf("%s is not in the files\n", gtid)
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// timeMatch is an event found by -findTime.
+type timeMatch struct {
+	file   string
+	offset int64
+	header replication.EventHeader
+}
+
+// firstEventTime returns the timestamp of the first event of file, the
+// time the server created it, reading one event header.
+func firstEventTime(file string) (uint32, error) {
+	var ts uint32
+	err := scanHeaders(file, 4, func(h *replication.EventHeader, _ int64) error {
+		ts = h.Timestamp
+		return errStopParsing
+	})
+	if err == errStopParsing {
+		err = nil
+	}
+	return ts, err
+}
+
+// findTime finds in files the first event at or after t, and the first
+// transaction to start at or after it. The files are in order, so a binary
+// search over their first event times picks the file to start in. Within
+// it the event headers are read one after another up to t, a linear scan:
+// events vary in size and their timestamps are not strictly increasing, so
+// there are no positions to search.
+func findTime(files []string, t time.Time) (event, tx *timeMatch, err error) {
+	var searchErr error
+	i := sort.Search(len(files), func(i int) bool {
+		ts, err := firstEventTime(files[i])
+		if err != nil && searchErr == nil {
+			searchErr = err
+		}
+		return ts != 0 && !time.Unix(int64(ts), 0).Before(t)
+	})
+	if searchErr != nil {
+		return nil, nil, searchErr
+	}
+	// The file before the first that starts at or after t may have events
+	// at or after it.
+	for _, file := range files[max(i-1, 0):] {
+		err := scanHeaders(file, 4, func(h *replication.EventHeader, offset int64) error {
+			if h.Timestamp == 0 || time.Unix(int64(h.Timestamp), 0).Before(t) {
+				return nil
+			}
+			if event == nil {
+				event = &timeMatch{file, offset, *h}
+			}
+			if h.EventType == replication.GTID_EVENT || h.EventType == replication.ANONYMOUS_GTID_EVENT {
+				tx = &timeMatch{file, offset, *h}
+				return errStopParsing
+			}
+			return nil
+		})
+		if err == errStopParsing {
+			break
+		}
+		if err != nil {
+			return event, tx, err
+		}
+	}
+	return event, tx, nil
+}
+
+func printFindTime(files []string) {
+	t, err := parseDatetime(*findTimeAt)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -findTime: %v\n", err)
+		os.Exit(1)
+	}
+	event, tx, err := findTime(files, t)
+	if event == nil && err == nil {
+		fmt.Printf("No event at or after %s\n", t.Format(timeFormat))
+		os.Exit(1)
+	}
+	if event != nil {
+		fmt.Printf("First event at or after %s: %s position %d, %s at %s\n", t.Format(timeFormat), event.file, event.offset,
+			event.header.EventType, time.Unix(int64(event.header.Timestamp), 0).Format(timeFormat))
+	}
+	if tx != nil {
+		fmt.Printf("First transaction starting at or after it: %s position %d, at %s\n", tx.file, tx.offset,
+			time.Unix(int64(tx.header.Timestamp), 0).Format(timeFormat))
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// fingerprintTopTables is how many tables the fingerprint lists.
+const fingerprintTopTables = 5
+
+// fingerprintDocument is a compact description of the workload in a
+// binlog, meant for clustering and comparing files from many servers.
+// Ratios and shares are fractions of the rows changed, rounded to three
+// decimals.
+type fingerprintDocument struct {
+	FormatVersion        int                `json:"format_version"`
+	Type                 string             `json:"type"`
+	File                 string             `json:"file"`
+	ServerVersion        string             `json:"server_version,omitempty"`
+	Transactions         int                `json:"transactions"`
+	AvgTransactionBytes  float64            `json:"avg_transaction_bytes"`
+	AvgTransactionEvents float64            `json:"avg_transaction_events"`
+	AvgTransactionRows   float64            `json:"avg_transaction_rows"`
+	Rows                 int                `json:"rows"`
+	InsertRatio          float64            `json:"insert_ratio"`
+	UpdateRatio          float64            `json:"update_ratio"`
+	DeleteRatio          float64            `json:"delete_ratio"`
+	StatementDML         int                `json:"statement_dml"`
+	DDL                  int                `json:"ddl"`
+	TopTables            []fingerprintTable `json:"top_tables"`
+}
+
+type fingerprintTable struct {
+	Table string  `json:"table"`
+	Share float64 `json:"share"`
+}
+
+// fingerprintReport builds a fingerprintDocument. It needs decoded row
+// images.
+type fingerprintReport struct {
+	file          string
+	serverVersion string
+	tx            txTracker
+	txEvents      int // events of the transaction in progress
+	transactions  int
+	txBytes       uint64
+	txEventsTotal int
+	rows          map[string]int // by INSERT, UPDATE, DELETE
+	tableRows     map[string]int
+	statementDML  int
+	ddl           int
+}
+
+func newFingerprintReport(file string) *fingerprintReport {
+	return &fingerprintReport{
+		file:      file,
+		rows:      make(map[string]int),
+		tableRows: make(map[string]int),
+	}
+}
+
+func (r *fingerprintReport) observe(e *replication.BinlogEvent) {
+	switch ev := e.Event.(type) {
+	case *replication.FormatDescriptionEvent:
+		r.serverVersion = strings.TrimRight(string(ev.ServerVersion), "\x00 ")
+	case *replication.RowsEvent:
+		n := rowsAffected(e)
+		r.rows[rowsEventKind(e.Header.EventType)] += n
+		if ev.Table != nil {
+			r.tableRows[tableName(ev.Table)] += n
+		}
+	case *replication.QueryEvent:
+		switch statementVerb(string(ev.Query)) {
+		case "INSERT", "UPDATE", "DELETE", "REPLACE":
+			r.statementDML++
+		case "CREATE", "ALTER", "DROP", "TRUNCATE", "RENAME":
+			r.ddl++
+		}
+	}
+
+	open := r.tx.cur != nil
+	done := r.tx.observe(e)
+	if open || r.tx.cur != nil || done != nil {
+		r.txEvents++
+	}
+	if done != nil {
+		r.transactions++
+		r.txBytes += uint64(done.End - done.Start)
+		r.txEventsTotal += r.txEvents
+		r.txEvents = 0
+	}
+}
+
+// ratio returns n/total rounded to three decimals, or 0 when total is 0.
+func ratio(n, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(n/total*1000) / 1000
+}
+
+func (r *fingerprintReport) document() *fingerprintDocument {
+	rows := r.rows["INSERT"] + r.rows["UPDATE"] + r.rows["DELETE"]
+	tx := float64(r.transactions)
+	doc := &fingerprintDocument{
+		FormatVersion:        jsonVersion,
+		Type:                 "fingerprint",
+		File:                 r.file,
+		ServerVersion:        r.serverVersion,
+		Transactions:         r.transactions,
+		AvgTransactionBytes:  ratio(float64(r.txBytes), tx),
+		AvgTransactionEvents: ratio(float64(r.txEventsTotal), tx),
+		AvgTransactionRows:   ratio(float64(rows), tx),
+		Rows:                 rows,
+		InsertRatio:          ratio(float64(r.rows["INSERT"]), float64(rows)),
+		UpdateRatio:          ratio(float64(r.rows["UPDATE"]), float64(rows)),
+		DeleteRatio:          ratio(float64(r.rows["DELETE"]), float64(rows)),
+		StatementDML:         r.statementDML,
+		DDL:                  r.ddl,
+		TopTables:            []fingerprintTable{},
+	}
+
+	tables := make([]string, 0, len(r.tableRows))
+	for t := range r.tableRows {
+		tables = append(tables, t)
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		if r.tableRows[tables[i]] != r.tableRows[tables[j]] {
+			return r.tableRows[tables[i]] > r.tableRows[tables[j]]
+		}
+		return tables[i] < tables[j]
+	})
+	if len(tables) > fingerprintTopTables {
+		tables = tables[:fingerprintTopTables]
+	}
+	for _, t := range tables {
+		doc.TopTables = append(doc.TopTables, fingerprintTable{Table: t, Share: ratio(float64(r.tableRows[t]), float64(rows))})
+	}
+	return doc
+}
+
+// report writes the fingerprint as a single line of JSON, so the
+// fingerprints of many files can be collected with one per line.
+func (r *fingerprintReport) report(w io.Writer) {
+	json.NewEncoder(w).Encode(r.document())
+}
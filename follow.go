@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// followInterval is how long -follow waits before reading again at the end
+// of a file.
+const followInterval = 250 * time.Millisecond
+
+// followReader reads a binlog the server is still writing. At the end of
+// the file it waits for more data instead of returning io.EOF, so an event
+// only partly written is read once the server completes it. It returns
+// io.EOF only once a stop is requested.
+type followReader struct {
+	r io.Reader
+	// idle, if not nil, is called before each wait, to flush output.
+	idle func()
+}
+
+func (f *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := f.r.Read(p)
+		if n > 0 || err != io.EOF || stopRequested.Load() {
+			return n, err
+		}
+		if f.idle != nil {
+			f.idle()
+		}
+		reloadRules()
+		time.Sleep(followInterval)
+	}
+}
+
+// followIdle is called by -follow each time it waits for the server to
+// write more; the dump sets it to flush its output.
+var followIdle func()
+
+// endsFile reports whether e is the last event the server writes to its
+// file: the ROTATE event naming the next file, or the STOP event of a
+// shutdown. The artificial ROTATE events of relay logs have a zero log
+// position and do not end the file.
+func endsFile(e *replication.BinlogEvent) bool {
+	switch e.Header.EventType {
+	case replication.ROTATE_EVENT:
+		return e.Header.LogPos != 0
+	case replication.STOP_EVENT:
+		return true
+	}
+	return false
+}
+
+// waitForFile waits for the server to create name after a rotation. It
+// reports false if a stop is requested first.
+func waitForFile(name string) bool {
+	for !stopRequested.Load() {
+		if _, err := os.Stat(name); err == nil {
+			return true
+		}
+		if followIdle != nil {
+			followIdle()
+		}
+		reloadRules()
+		time.Sleep(followInterval)
+	}
+	return false
+}
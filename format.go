@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/google/uuid"
+)
+
+// appendEvent appends the text form of e to b and returns the extended
+// slice. It replaces go-mysql's Dump for the event types go-parse knows how
+// to render, writing straight into the caller's buffer with strconv rather
+// than going through fmt line by line. Event types without a dedicated
+// formatter fall back to their Dump output.
+func appendEvent(b []byte, e *replication.BinlogEvent) []byte {
+	b = appendHeader(b, e.Header)
+
+	switch ev := e.Event.(type) {
+	case *replication.FormatDescriptionEvent:
+		b = appendUintField(b, "Version", uint64(ev.Version))
+		b = appendStringField(b, "Server version", string(ev.ServerVersion))
+		b = appendUintField(b, "Checksum algorithm", uint64(ev.ChecksumAlgorithm))
+	case *replication.RotateEvent:
+		b = appendUintField(b, "Position", ev.Position)
+		b = appendStringField(b, "Next log name", string(ev.NextLogName))
+	case *replication.PreviousGTIDsEvent:
+		b = appendStringField(b, "Previous GTID Event", ev.GTIDSets)
+	case *replication.XIDEvent:
+		b = appendUintField(b, "XID", ev.XID)
+		if ev.GSet != nil {
+			b = appendStringField(b, "GTIDSet", ev.GSet.String())
+		}
+	case *replication.QueryEvent:
+		b = appendUintField(b, "Slave proxy ID", uint64(ev.SlaveProxyID))
+		b = appendUintField(b, "Execution time", uint64(ev.ExecutionTime))
+		b = appendUintField(b, "Error code", uint64(ev.ErrorCode))
+		b = appendField(b, "Schema", ev.Schema)
+		b = appendField(b, "Query", ev.Query)
+		if ev.GSet != nil {
+			b = appendStringField(b, "GTIDSet", ev.GSet.String())
+		}
+	case *replication.RowsQueryEvent:
+		b = appendField(b, "Query", ev.Query)
+	case *replication.GTIDEvent:
+		u, _ := uuid.FromBytes(ev.SID)
+		b = appendUintField(b, "Commit flag", uint64(ev.CommitFlag))
+		b = append(b, "GTID_NEXT: "...)
+		b = append(b, u.String()...)
+		b = append(b, ':')
+		b = strconv.AppendInt(b, ev.GNO, 10)
+		b = append(b, '\n')
+		b = appendIntField(b, "LAST_COMMITTED", ev.LastCommitted)
+		b = appendIntField(b, "SEQUENCE_NUMBER", ev.SequenceNumber)
+		b = appendUintField(b, "Transaction length", ev.TransactionLength)
+		if !ev.ImmediateCommitTime().IsZero() {
+			b = appendStringField(b, "Immediate commit time", ev.ImmediateCommitTime().Format(time.RFC3339Nano))
+		}
+	case *replication.TableMapEvent:
+		b = appendUintField(b, "TableID", ev.TableID)
+		b = appendUintField(b, "Flags", uint64(ev.Flags))
+		b = appendField(b, "Schema", ev.Schema)
+		b = appendField(b, "Table", ev.Table)
+		b = appendUintField(b, "Column count", ev.ColumnCount)
+		b = appendStringField(b, "Column type", hex.EncodeToString(ev.ColumnType))
+		if len(ev.ColumnName) > 0 {
+			b = appendField(b, "Column name", bytes.Join(ev.ColumnName, []byte(", ")))
+		}
+		if len(ev.PrimaryKey) > 0 {
+			b = append(b, "Primary key:"...)
+			for _, pk := range ev.PrimaryKey {
+				b = append(b, ' ')
+				b = strconv.AppendUint(b, pk, 10)
+			}
+			b = append(b, '\n')
+		}
+	case *replication.RowsEvent:
+		b = appendUintField(b, "TableID", ev.TableID)
+		b = appendUintField(b, "Flags", uint64(ev.Flags))
+		b = appendUintField(b, "Column count", ev.ColumnCount)
+		if ev.Table == nil {
+			b = append(b, "Undecodable: no TableMapEvent for this table id in the parsed range\n"...)
+		}
+		b = append(b, "Values:\n"...)
+		for _, row := range ev.Rows {
+			b = append(b, "--\n"...)
+			for j, v := range row {
+				b = strconv.AppendInt(b, int64(j), 10)
+				b = append(b, ':')
+				b = appendValue(b, v)
+				b = append(b, '\n')
+			}
+		}
+	default:
+		buf := bytes.NewBuffer(b)
+		e.Event.Dump(buf)
+		return buf.Bytes()
+	}
+
+	return append(b, '\n')
+}
+
+// appendNamedRowsEvent formats a rows event with each value labelled by
+// its column name where the names are known (see columnNames), else as @N,
+// the images of an UPDATE marked, and the columns a row image leaves out
+// shown as such rather than as NULL. From version 9 the values of unsigned
+// columns are shown unsigned, and from version 10 DECIMAL, ENUM and SET
+// values as the column reads them (see exactValue), and from version 11
+// JSON values as JSON (see readableJSON), and from version 9 TIMESTAMP
+// values in the layout of -timeFormat. Large BLOB and TEXT values are
+// shown as -blobMode says (see blobValue). With -diff an UPDATE shows
+// only what it changes (see appendRowDiff).
+func appendNamedRowsEvent(b []byte, e *replication.BinlogEvent, ev *replication.RowsEvent, version int) []byte {
+	b = appendHeader(b, e.Header)
+	b = appendUintField(b, "TableID", ev.TableID)
+	b = appendUintField(b, "Flags", uint64(ev.Flags))
+	b = appendUintField(b, "Column count", ev.ColumnCount)
+	var names []string
+	value := func(b []byte, i int, v interface{}) []byte { return appendValue(b, v) }
+	if ev.Table == nil {
+		b = append(b, "Undecodable: no TableMapEvent for this table id in the parsed range\n"...)
+	} else {
+		b = appendStringField(b, "Table", tableName(ev.Table))
+		names = columnNames(ev.Table)
+		if version >= textOutputV9 {
+			unsigned := ev.Table.UnsignedMap()
+			var lists map[int][]string
+			if version >= textOutputV10 {
+				lists = columnValueLists(ev.Table)
+			}
+			value = func(b []byte, i int, v interface{}) []byte {
+				v = displayTimestamp(ev.Table, i, typedValue(ev.Table, unsigned, i, v))
+				if version >= textOutputV10 {
+					v = exactValue(ev.Table, lists, i, v)
+				}
+				if version >= textOutputV11 {
+					v = readableJSON(ev.Table, i, v)
+				}
+				return appendValue(b, v)
+			}
+		}
+		if *blobMode != "" {
+			shown := value
+			value = func(b []byte, i int, v interface{}) []byte {
+				return shown(b, i, blobValue(ev.Table, i, v))
+			}
+		}
+	}
+	update := rowsEventKind(e.Header.EventType) == "UPDATE"
+	b = append(b, "Values:\n"...)
+	if update && *diffUpdates {
+		for r := 0; r+1 < len(ev.Rows); r += 2 {
+			b = appendRowDiff(b, ev, r, names, value)
+		}
+		return append(b, '\n')
+	}
+	for r := range ev.Rows {
+		switch {
+		case !update:
+			b = append(b, "--\n"...)
+		case r%2 == 0:
+			b = append(b, "-- before\n"...)
+		default:
+			b = append(b, "-- after\n"...)
+		}
+		for j, v := range markAbsent(ev, r) {
+			b = append(b, columnLabel(names, j)...)
+			b = append(b, ": "...)
+			b = value(b, j, v)
+			b = append(b, '\n')
+		}
+	}
+	return append(b, '\n')
+}
+
+// appendRowDiff formats the UPDATE row pair at r of ev, for -diff, as the
+// columns whose values change, each as before -> after, after the key
+// columns that identify the row. A column the before image leaves out is
+// taken to change; one the after image leaves out did not. value appends
+// the value of a column.
+func appendRowDiff(b []byte, ev *replication.RowsEvent, r int, names []string, value func(b []byte, i int, v interface{}) []byte) []byte {
+	before, after := markAbsent(ev, r), markAbsent(ev, r+1)
+	var key []int
+	if ev.Table != nil {
+		key = uniqueKey(ev.Table)
+	}
+	b = append(b, "--\n"...)
+	for _, i := range key {
+		if i < len(before) && !isAbsent(before[i]) {
+			b = append(b, columnLabel(names, i)...)
+			b = append(b, " (key): "...)
+			b = value(b, i, before[i])
+			b = append(b, '\n')
+		}
+	}
+	changed := 0
+	for i := 0; i < len(before) && i < len(after); i++ {
+		if isAbsent(after[i]) || !isAbsent(before[i]) && reflect.DeepEqual(before[i], after[i]) {
+			continue
+		}
+		changed++
+		b = append(b, columnLabel(names, i)...)
+		b = append(b, ": "...)
+		b = value(b, i, before[i])
+		b = append(b, " -> "...)
+		b = value(b, i, after[i])
+		b = append(b, '\n')
+	}
+	if changed == 0 {
+		b = append(b, "(no column changed)\n"...)
+	}
+	return b
+}
+
+// appendTableMapEvent formats a table map with a definition of each column
+// (see columnDefinitions) in place of the raw column types.
+func appendTableMapEvent(b []byte, e *replication.BinlogEvent, ev *replication.TableMapEvent) []byte {
+	b = appendHeader(b, e.Header)
+	b = appendUintField(b, "TableID", ev.TableID)
+	b = appendUintField(b, "Flags", uint64(ev.Flags))
+	b = appendStringField(b, "Table", tableName(ev))
+	b = appendUintField(b, "Column count", ev.ColumnCount)
+	names := columnNames(ev)
+	b = append(b, "Columns:\n"...)
+	for i, def := range columnDefinitions(ev) {
+		b = append(b, "  "...)
+		b = append(b, columnLabel(names, i)...)
+		b = append(b, ' ')
+		b = append(b, def...)
+		b = append(b, '\n')
+	}
+	return append(b, '\n')
+}
+
+// appendPayloadEvent formats a TRANSACTION_PAYLOAD_EVENT by its sizes; the
+// events it holds follow it as events of their own.
+func appendPayloadEvent(b []byte, e *replication.BinlogEvent, ev *replication.TransactionPayloadEvent) []byte {
+	b = appendHeader(b, e.Header)
+	compression := "ZSTD"
+	if ev.CompressionType != replication.ZSTD {
+		compression = strconv.FormatUint(ev.CompressionType, 10)
+	}
+	b = appendStringField(b, "Compression", compression)
+	b = appendUintField(b, "Payload size", ev.Size)
+	b = appendUintField(b, "Uncompressed size", ev.UncompressedSize)
+	b = appendIntField(b, "Events", int64(len(ev.Events)))
+	return append(b, '\n')
+}
+
+// appendServerEvent formats the events that describe the source server
+// rather than data: STOP and heartbeats.
+func appendServerEvent(b []byte, e *replication.BinlogEvent) []byte {
+	b = appendHeader(b, e.Header)
+	if e.Header.EventType == replication.STOP_EVENT {
+		b = append(b, "Stop: the source shut down or stopped writing this binlog; no events follow\n"...)
+		return append(b, '\n')
+	}
+	hb, ok := decodeHeartbeat(e)
+	if !ok {
+		b = append(b, "Heartbeat: malformed body\n"...)
+		return append(b, '\n')
+	}
+	b = append(b, "Heartbeat: source alive at "...)
+	b = append(b, hb.LogFile...)
+	b = append(b, ':')
+	b = strconv.AppendUint(b, hb.LogPos, 10)
+	b = append(b, ", no newer events\n"...)
+	return append(b, '\n')
+}
+
+// appendPassthroughEvent formats an event that is not decoded: its type as
+// named by the compatibility matrix, what it is, and its raw body.
+func appendPassthroughEvent(b []byte, e *replication.BinlogEvent, ev *replication.GenericEvent) []byte {
+	b = appendNamedHeader(b, e.Header, eventTypeName(e.Header.EventType))
+	if s, ok := eventTypeSupport[e.Header.EventType]; ok {
+		b = append(b, "Not decoded: "...)
+		b = append(b, s.name...)
+		b = append(b, ", written since "...)
+		b = append(b, s.since...)
+		if s.note != "" {
+			b = append(b, "; "...)
+			b = append(b, s.note...)
+		}
+	} else {
+		b = append(b, "Not decoded: unknown event type "...)
+		b = strconv.AppendUint(b, uint64(e.Header.EventType), 10)
+	}
+	b = append(b, '\n')
+	b = append(b, "Event data:\n"...)
+	b = append(b, hex.Dump(ev.Data)...)
+	return append(b, '\n')
+}
+
+func appendHeader(b []byte, h *replication.EventHeader) []byte {
+	return appendNamedHeader(b, h, h.EventType.String())
+}
+
+func appendNamedHeader(b []byte, h *replication.EventHeader, name string) []byte {
+	b = append(b, "=== "...)
+	b = append(b, name...)
+	b = append(b, " ===\nDate: "...)
+	b = time.Unix(int64(h.Timestamp), 0).AppendFormat(b, timeFormat)
+	b = append(b, "\nLog position: "...)
+	b = strconv.AppendUint(b, uint64(h.LogPos), 10)
+	b = append(b, "\nEvent size: "...)
+	b = strconv.AppendUint(b, uint64(h.EventSize), 10)
+	return append(b, '\n')
+}
+
+func appendField(b []byte, name string, value []byte) []byte {
+	b = append(b, name...)
+	b = append(b, ": "...)
+	b = append(b, value...)
+	return append(b, '\n')
+}
+
+// appendUintField and appendIntField append a numeric field, formatting
+// its value in place.
+func appendUintField(b []byte, name string, value uint64) []byte {
+	b = append(b, name...)
+	b = append(b, ": "...)
+	b = strconv.AppendUint(b, value, 10)
+	return append(b, '\n')
+}
+
+func appendIntField(b []byte, name string, value int64) []byte {
+	b = append(b, name...)
+	b = append(b, ": "...)
+	b = strconv.AppendInt(b, value, 10)
+	return append(b, '\n')
+}
+
+func appendStringField(b []byte, name, value string) []byte {
+	b = append(b, name...)
+	b = append(b, ": "...)
+	b = append(b, value...)
+	return append(b, '\n')
+}
+
+// appendValue renders a single decoded column value.
+func appendValue(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, "NULL"...)
+	case []byte:
+		return strconv.AppendQuote(b, string(v))
+	case string:
+		return strconv.AppendQuote(b, v)
+	case int8:
+		return strconv.AppendInt(b, int64(v), 10)
+	case int16:
+		return strconv.AppendInt(b, int64(v), 10)
+	case int32:
+		return strconv.AppendInt(b, int64(v), 10)
+	case int64:
+		return strconv.AppendInt(b, v, 10)
+	case int:
+		return strconv.AppendInt(b, int64(v), 10)
+	case uint8:
+		return strconv.AppendUint(b, uint64(v), 10)
+	case uint16:
+		return strconv.AppendUint(b, uint64(v), 10)
+	case uint32:
+		return strconv.AppendUint(b, uint64(v), 10)
+	case uint64:
+		return strconv.AppendUint(b, v, 10)
+	case float32:
+		return strconv.AppendFloat(b, float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.AppendFloat(b, v, 'g', -1, 64)
+	case time.Time:
+		return v.AppendFormat(b, "2006-01-02 15:04:05.999999")
+	case interface{ String() string }:
+		return append(b, v.String()...)
+	}
+	return fmt.Appendf(b, "%v", v)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// TestAppendEventAllocs checks that the fields of the text dump are
+// formatted into the line buffer, without allocating.
+func TestAppendEventAllocs(t *testing.T) {
+	header := func(typ replication.EventType) *replication.EventHeader {
+		return &replication.EventHeader{Timestamp: 1704067200, EventType: typ, LogPos: 1234, EventSize: 31}
+	}
+	for _, e := range []*replication.BinlogEvent{
+		{Header: header(replication.XID_EVENT), Event: &replication.XIDEvent{XID: 42}},
+		{Header: header(replication.ROTATE_EVENT), Event: &replication.RotateEvent{Position: 4, NextLogName: []byte("mysql-bin.000002")}},
+		{Header: header(replication.QUERY_EVENT), Event: &replication.QueryEvent{
+			SlaveProxyID: 7, ExecutionTime: 1, Schema: []byte("shop"), Query: []byte("BEGIN"),
+		}},
+	} {
+		b := make([]byte, 0, 1024)
+		if n := testing.AllocsPerRun(100, func() { b = appendEvent(b[:0], e) }); n != 0 {
+			t.Errorf("%s: %v allocations per event, want 0:\n%s", e.Header.EventType, n, b)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// formatChangeReport follows, for each table, whether its changes reach
+// the binlog as rows events or as statements, and reports where that
+// switches: a SET binlog_format, or with binlog_format=MIXED a statement
+// the server found unsafe to log as such. Consumers that apply rows events
+// miss the changes logged as statements.
+type formatChangeReport struct {
+	tx   txTracker
+	file string
+	// modes are "row" or "statement" by table.
+	modes map[string]string
+	// tables are those that switch, in the order first met, and switches
+	// theirs.
+	tables   []string
+	switches map[string][]*formatSwitch
+}
+
+// formatSwitch is where a table's changes move from one way of logging to
+// the other.
+type formatSwitch struct {
+	file      string
+	pos       uint32
+	timestamp uint32
+	gtid      string
+	from, to  string
+	// query is the statement, when the switch is to statement.
+	query string
+}
+
+func newFormatChangeReport() *formatChangeReport {
+	return &formatChangeReport{
+		modes:    make(map[string]string),
+		switches: make(map[string][]*formatSwitch),
+	}
+}
+
+func (r *formatChangeReport) nextFile(name string) {
+	r.file = binlogBase(name)
+}
+
+func (r *formatChangeReport) observe(e *replication.BinlogEvent) {
+	defer r.tx.observe(e)
+	var table, mode, query string
+	switch ev := e.Event.(type) {
+	case *replication.RowsEvent:
+		if ev.Table == nil {
+			return
+		}
+		table, mode = tableName(ev.Table), "row"
+	case *replication.QueryEvent:
+		query = string(ev.Query)
+		if table = dmlTable(query, string(ev.Schema)); table == "" {
+			return
+		}
+		mode = "statement"
+	default:
+		return
+	}
+	prev := r.modes[table]
+	r.modes[table] = mode
+	if prev == "" || prev == mode {
+		return
+	}
+	if _, ok := r.switches[table]; !ok {
+		r.tables = append(r.tables, table)
+	}
+	sw := &formatSwitch{
+		file:      r.file,
+		pos:       e.Header.LogPos - e.Header.EventSize,
+		timestamp: e.Header.Timestamp,
+		gtid:      r.tx.gtid(),
+		from:      prev,
+		to:        mode,
+	}
+	if query != "" {
+		sw.query = truncateQuery(query)
+	}
+	r.switches[table] = append(r.switches[table], sw)
+}
+
+// dmlTable returns the table a statement logged in statement format
+// changes: the target of an INSERT, REPLACE, UPDATE, DELETE or LOAD DATA,
+// or the first one of a multi-table UPDATE or DELETE. It returns "" for any
+// other statement.
+func dmlTable(query, schema string) string {
+	verb := statementVerb(query)
+	switch verb {
+	case "INSERT", "REPLACE", "UPDATE", "DELETE", "LOAD":
+	default:
+		return ""
+	}
+	fields := strings.Fields(query[strings.Index(strings.ToUpper(query), verb)+len(verb):])
+	for i := 0; i < len(fields); i++ {
+		word := strings.ToUpper(fields[i])
+		switch word {
+		case "LOW_PRIORITY", "DELAYED", "HIGH_PRIORITY", "IGNORE", "QUICK", "INTO", "FROM", "CONCURRENT", "LOCAL", "DATA":
+			continue
+		case "INFILE", "XML":
+			// LOAD DATA INFILE 'file' ... INTO TABLE t
+			for ; i < len(fields) && !strings.EqualFold(fields[i], "TABLE"); i++ {
+			}
+			continue
+		}
+		name := fields[i]
+		if j := strings.IndexAny(name, "(,;"); j >= 0 {
+			name = name[:j]
+		}
+		name = strings.ReplaceAll(name, "`", "")
+		if name == "" {
+			return ""
+		}
+		if schema != "" && !strings.Contains(name, ".") {
+			name = schema + "." + name
+		}
+		return name
+	}
+	return ""
+}
+
+func (r *formatChangeReport) report(w io.Writer) {
+	fmt.Fprintln(w, "=== Binlog format changes ===")
+	n := 0
+	for _, table := range r.tables {
+		fmt.Fprintln(w, table)
+		for _, sw := range r.switches[table] {
+			n++
+			at := fmt.Sprintf("%s:%d", sw.file, sw.pos)
+			ts := time.Unix(int64(sw.timestamp), 0).Format(timeFormat)
+			fmt.Fprintf(w, "  %s  %-24s %s -> %s%s", ts, at, sw.from, sw.to, gtidSuffix(sw.gtid))
+			if sw.query != "" {
+				fmt.Fprintf(w, ": %s", sw.query)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+	if len(r.tables) == 0 {
+		fmt.Fprintln(w, "No table switches between row and statement events")
+	} else {
+		fmt.Fprintf(w, "%s switched between row and statement events; %s\n", plural(len(r.tables), "table"), plural(n, "change"))
+	}
+	fmt.Fprintln(w)
+}
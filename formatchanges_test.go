@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestDMLTable(t *testing.T) {
+	for _, tc := range []struct {
+		query, schema, want string
+	}{
+		{"INSERT INTO t (a) VALUES (1)", "db", "db.t"},
+		{"insert low_priority ignore into `db2`.`t` values (1)", "db", "db2.t"},
+		{"REPLACE t(a) VALUES (1)", "", "t"},
+		{"UPDATE t SET a = 1", "db", "db.t"},
+		{"UPDATE t1, t2 SET t1.a = t2.a", "db", "db.t1"},
+		{"DELETE QUICK FROM t WHERE a = 1", "db", "db.t"},
+		{"LOAD DATA LOCAL INFILE '/tmp/x' INTO TABLE t", "db", "db.t"},
+		{"CREATE TABLE t (a int)", "db", ""},
+		{"BEGIN", "db", ""},
+	} {
+		if got := dmlTable(tc.query, tc.schema); got != tc.want {
+			t.Errorf("dmlTable(%q, %q) = %q, want %q", tc.query, tc.schema, got, tc.want)
+		}
+	}
+}
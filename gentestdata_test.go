@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestTestdataSchema checks that the schema of every gen-testdata case
+// loads with -schemaFile and gives the columns of every table its binlog
+// writes to.
+func TestTestdataSchema(t *testing.T) {
+	for _, c := range testdataCases() {
+		t.Run(c.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), c.name+".sql")
+			if err := os.WriteFile(file, []byte(testdataSchema(c)), 0644); err != nil {
+				t.Fatal(err)
+			}
+			schemas, err := loadSchemaFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, tx := range c.spec.Transactions {
+				for _, ch := range tx.Changes {
+					s := schemas[ch.Schema+"."+ch.Table]
+					if s == nil {
+						t.Errorf("no CREATE TABLE for %s.%s", ch.Schema, ch.Table)
+						continue
+					}
+					var names []string
+					for _, col := range ch.Columns {
+						names = append(names, col.Name)
+					}
+					if !slices.Equal(s.columns, names) {
+						t.Errorf("%s.%s has columns %v, the binlog %v", ch.Schema, ch.Table, s.columns, names)
+					}
+				}
+			}
+		})
+	}
+}
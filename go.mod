@@ -4,23 +4,25 @@ replace github.com/siddontang/go-mysql => github.com/go-mysql-org/go-mysql v1.9.
 
 go 1.23.2
 
-require github.com/go-mysql-org/go-mysql v1.9.1
+require (
+	github.com/go-mysql-org/go-mysql v1.9.1
+	github.com/google/uuid v1.3.0
+	github.com/klauspost/compress v1.17.8
+	github.com/siddontang/go-log v0.0.0-20180807004314-8d05993dda07
+	golang.org/x/text v0.13.0
+)
 
 require (
 	github.com/Masterminds/semver v1.5.0 // indirect
 	github.com/goccy/go-json v0.10.2 // indirect
-	github.com/google/uuid v1.3.0 // indirect
-	github.com/klauspost/compress v1.17.8 // indirect
 	github.com/pingcap/errors v0.11.5-0.20221009092201-b66cddb77c32 // indirect
 	github.com/pingcap/log v1.1.1-0.20230317032135-a0d097d16e22 // indirect
 	github.com/pingcap/tidb/pkg/parser v0.0.0-20231103042308-035ad5ccbe67 // indirect
 	github.com/shopspring/decimal v1.2.0 // indirect
 	github.com/siddontang/go v0.0.0-20180604090527-bdc77568d726 // indirect
-	github.com/siddontang/go-log v0.0.0-20180807004314-8d05993dda07 // indirect
 	go.uber.org/atomic v1.11.0 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
 	go.uber.org/zap v1.26.0 // indirect
 	golang.org/x/exp v0.0.0-20231006140011-7918f672742d // indirect
-	golang.org/x/text v0.13.0 // indirect
 	gopkg.in/natefinch/lumberjack.v2 v2.2.1 // indirect
 )
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/ChaosHour/go-parse/pkg/binlogwriter"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files of the tests")
+
+// TestMain runs go-parse itself when the tests start the test binary with
+// GO_PARSE_MAIN set, so that runGoParse can run it with its own flags.
+func TestMain(m *testing.M) {
+	if os.Getenv("GO_PARSE_MAIN") != "" {
+		os.Args = append([]string{"go-parse"}, os.Args[1:]...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runGoParse runs go-parse with args and returns its output.
+func runGoParse(t *testing.T, args ...string) []byte {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "GO_PARSE_MAIN=1", "TZ=UTC")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go-parse %v: %v\n%s", args, err, out)
+	}
+	return out
+}
+
+// writeTestdataBinlog writes the binlog of the gen-testdata case named name
+// into a temporary directory and returns its path.
+func writeTestdataBinlog(t *testing.T, name string) string {
+	t.Helper()
+	for _, c := range testdataCases() {
+		if c.name == name {
+			file := filepath.Join(t.TempDir(), name+".000001")
+			if err := binlogwriter.WriteFile(file, c.spec); err != nil {
+				t.Fatal(err)
+			}
+			return file
+		}
+	}
+	t.Fatalf("no gen-testdata case %s", name)
+	return ""
+}
+
+// TestFrozenOutputVersions checks that the text output versions that
+// predate a change of the values they show still print them as they did.
+func TestFrozenOutputVersions(t *testing.T) {
+	for _, tc := range []struct {
+		corpus   string
+		versions []int
+	}{
+		// Partial JSON updates are expanded from version 11.
+		{"json", []int{textOutputV1, textOutputV2}},
+		// Strings are decoded from their character sets from version 12.
+		{"charsets", []int{textOutputV2, textOutputV11}},
+	} {
+		file := writeTestdataBinlog(t, tc.corpus)
+		for _, v := range tc.versions {
+			name := tc.corpus + ".v" + strconv.Itoa(v)
+			t.Run(name, func(t *testing.T) {
+				got := runGoParse(t, "-file", file, "-offset", "4", "-outputVersion", strconv.Itoa(v))
+				golden := filepath.Join("testdata", "golden", name+".txt")
+				if *updateGolden {
+					if err := os.WriteFile(golden, got, 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("output differs from %s:\n%s", golden, got)
+				}
+			})
+		}
+	}
+}
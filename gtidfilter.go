@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/google/uuid"
+)
+
+// gtidFilter keeps or drops whole transactions by GTID, from -includeGTIDs
+// and -excludeGTIDs. Every event of a transaction, from its GTID event to
+// the XID or COMMIT that ends it, shares the transaction's fate. Transactions
+// without a GTID (anonymous, tagged or pre-GTID) are dropped by
+// -includeGTIDs and kept by -excludeGTIDs. With -dedupGTIDs it also drops
+// transactions whose GTID it already kept, as overlapping files repeat. It
+// follows transaction boundaries, so keep must see the events in order.
+type gtidFilter struct {
+	include, exclude *mysql.MysqlGTIDSet
+	// seen holds the GTIDs of the transactions kept so far, for
+	// -dedupGTIDs. A GTID is added when its transaction commits, so a
+	// copy cut off mid-transaction does not hide the complete one, unless
+	// claim is set: then it is added as the transaction starts.
+	seen  *mysql.MysqlGTIDSet
+	claim bool
+
+	tx txTracker
+	// cur is the transaction kept decides for, gtid its GTID event and kept
+	// the decision.
+	cur  *transaction
+	gtid *replication.GTIDEvent
+	kept bool
+}
+
+// transactionFilter is the GTID filter of the run, nil when no flag sets
+// one.
+var transactionFilter *gtidFilter
+
+// newGTIDFilter returns the filter set by the command line, or nil when
+// no flag sets one.
+func newGTIDFilter() (*gtidFilter, error) {
+	if *includeGTIDs == "" && *excludeGTIDs == "" && !*dedupGTIDs {
+		return nil, nil
+	}
+	f := new(gtidFilter)
+	if *dedupGTIDs {
+		f.seen = new(mysql.MysqlGTIDSet)
+		f.seen.Sets = make(map[string]*mysql.UUIDSet)
+	}
+	var err error
+	if f.include, err = parseGTIDFlag("-includeGTIDs", *includeGTIDs); err != nil {
+		return nil, err
+	}
+	if f.exclude, err = parseGTIDFlag("-excludeGTIDs", *excludeGTIDs); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseGTIDFlag(name, s string) (*mysql.MysqlGTIDSet, error) {
+	if s == "" {
+		return nil, nil
+	}
+	set, err := mysql.ParseMysqlGTIDSet(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %v", name, s, err)
+	}
+	return set.(*mysql.MysqlGTIDSet), nil
+}
+
+// keep reports whether e passes the filter.
+func (f *gtidFilter) keep(e *replication.BinlogEvent) bool {
+	done := f.tx.observe(e)
+	tx := f.tx.cur
+	if tx == nil {
+		tx = done
+	}
+	if tx == nil {
+		switch e.Event.(type) {
+		case *replication.QueryEvent, *replication.TableMapEvent, *replication.RowsEvent,
+			*replication.XIDEvent, *replication.IntVarEvent:
+			// A statement outside a tracked transaction: a DDL in a file
+			// without GTIDs, or the tail of a transaction begun before the
+			// start position.
+			return f.matches(nil)
+		}
+		// File and stream events such as the FormatDescriptionEvent.
+		return true
+	}
+	if tx != f.cur {
+		ev, _ := e.Event.(*replication.GTIDEvent)
+		f.cur, f.gtid, f.kept = tx, ev, f.matches(ev)
+		if f.kept && f.duplicate(e, ev) {
+			f.kept = false
+		} else if f.kept && f.claim {
+			f.record(ev)
+		}
+	}
+	if done != nil && done == f.cur && f.kept && !f.claim {
+		f.record(f.gtid)
+	}
+	return f.kept
+}
+
+// duplicate reports whether the GTID of ev, which starts a transaction at
+// e, is in f.seen, noting it as a warning if so.
+func (f *gtidFilter) duplicate(e *replication.BinlogEvent, ev *replication.GTIDEvent) bool {
+	if f.seen == nil || ev == nil || !gtidSetContains(f.seen, ev) {
+		return false
+	}
+	runWarnings.note(warnDuplicateGTID, e.Header.LogPos-e.Header.EventSize, gtidString(ev))
+	return true
+}
+
+// record adds the GTID of ev to f.seen.
+func (f *gtidFilter) record(ev *replication.GTIDEvent) {
+	if f.seen == nil || ev == nil {
+		return
+	}
+	if u, err := uuid.FromBytes(ev.SID); err == nil && u != uuid.Nil {
+		f.seen.AddGTID(u, ev.GNO)
+	}
+}
+
+// matches reports whether the transaction of GTID event ev passes the
+// filter; ev is nil for a transaction without a GTID event.
+func (f *gtidFilter) matches(ev *replication.GTIDEvent) bool {
+	if f.include != nil && (ev == nil || !gtidSetContains(f.include, ev)) {
+		return false
+	}
+	return f.exclude == nil || ev == nil || !gtidSetContains(f.exclude, ev)
+}
+
+// gtidSetsOverlap reports whether a and b share a GTID.
+func gtidSetsOverlap(a, b *mysql.MysqlGTIDSet) bool {
+	for sid, s := range a.Sets {
+		o := b.Sets[sid]
+		if o == nil {
+			continue
+		}
+		for _, x := range s.Intervals {
+			for _, y := range o.Intervals {
+				if x.Start < y.Stop && y.Start < x.Stop {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
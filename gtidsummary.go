@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// fileGTIDs is the GTID state of one binlog: what its Previous_gtids
+// header says was executed before it, the GTIDs of its own transactions,
+// and the two together, what was executed once it was written. Its
+// transactions are counted by whether they were assigned a GTID, were
+// anonymous, or have no GTID event at all.
+type fileGTIDs struct {
+	previous  *mysql.MysqlGTIDSet
+	contained *mysql.MysqlGTIDSet
+	executed  *mysql.MysqlGTIDSet
+	assigned  int
+	anonymous int
+	noGTID    int
+}
+
+func newFileGTIDs(md *fileMetadata) (*fileGTIDs, error) {
+	s := new(fileGTIDs)
+	for _, x := range []struct {
+		set  **mysql.MysqlGTIDSet
+		spec string
+		what string
+	}{
+		{&s.previous, md.PreviousGTIDs, "Previous_gtids"},
+		{&s.contained, md.GTIDSet, "GTID set"},
+		{&s.executed, md.PreviousGTIDs, "Previous_gtids"},
+	} {
+		set, err := mysql.ParseMysqlGTIDSet(x.spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s %q: %v", md.Path, x.what, x.spec, err)
+		}
+		*x.set = set.(*mysql.MysqlGTIDSet)
+	}
+	if err := s.executed.Add(*s.contained); err != nil {
+		return nil, err
+	}
+	for _, t := range md.Transactions {
+		switch {
+		case t.GTID != "" || t.Tagged:
+			s.assigned++
+		case t.Anonymous:
+			s.anonymous++
+		default:
+			s.noGTID++
+		}
+	}
+	return s, nil
+}
+
+// mixed reports whether the file has both transactions assigned a GTID and
+// anonymous ones, which a server only writes while gtid_mode is
+// OFF_PERMISSIVE or ON_PERMISSIVE, or as it moves between OFF and ON.
+func (s *fileGTIDs) mixed() bool {
+	return s.assigned > 0 && s.anonymous > 0
+}
+
+// gtidSetString renders set, or "(none)" when it is empty.
+func gtidSetString(set *mysql.MysqlGTIDSet) string {
+	if s := set.String(); s != "" {
+		return s
+	}
+	return "(none)"
+}
+
+func (s *fileGTIDs) print(w io.Writer, name string) {
+	fmt.Fprintf(w, "File: %s\n", name)
+	fmt.Fprintf(w, "Previous GTIDs: %s\n", gtidSetString(s.previous))
+	fmt.Fprintf(w, "GTIDs in file: %s\n", gtidSetString(s.contained))
+	fmt.Fprintf(w, "Executed at end of file: %s\n", gtidSetString(s.executed))
+	fmt.Fprintf(w, "Transactions: %d with a GTID, %d anonymous", s.assigned, s.anonymous)
+	if s.noGTID > 0 {
+		fmt.Fprintf(w, ", %d without a GTID event", s.noGTID)
+	}
+	fmt.Fprintln(w)
+	if s.mixed() {
+		fmt.Fprintf(w, "Warning: mixed GTID modes; gtid_mode was OFF_PERMISSIVE or ON_PERMISSIVE while this file was written. Until every server is at ON, failover with GTID auto-positioning can miss or repeat the anonymous transactions.\n")
+	}
+}
+
+// printGTIDSummaries prints the GTID summary of each file and, for more
+// than one, the GTIDs all of them contain.
+func printGTIDSummaries(files []string) {
+	all := &mysql.MysqlGTIDSet{Sets: make(map[string]*mysql.UUIDSet)}
+	var assigned, anonymous int
+	var mixed []string
+	failed := false
+	for i, file := range files {
+		if i > 0 {
+			fmt.Println()
+		}
+		// A damaged file still has a summary of the events before the
+		// damage.
+		md, err := loadFileMetadata(file, !*noCache)
+		if md != nil {
+			s, err := newFileGTIDs(md)
+			if err != nil {
+				fmt.Println(err.Error())
+				failed = true
+				continue
+			}
+			s.print(os.Stdout, file)
+			all.Add(*s.contained)
+			assigned += s.assigned
+			anonymous += s.anonymous
+			if s.mixed() {
+				mixed = append(mixed, file)
+			}
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			failed = true
+		}
+	}
+	if len(files) > 1 {
+		fmt.Printf("\nGTIDs in all files: %s\n", gtidSetString(all))
+		fmt.Printf("Transactions in all files: %d with a GTID, %d anonymous\n", assigned, anonymous)
+		if len(mixed) > 0 {
+			fmt.Printf("Files with mixed GTID modes: %s\n", strings.Join(mixed, ", "))
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
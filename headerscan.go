@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// scanHeaders walks binlogFile reading only the fixed 19-byte event headers
+// and skipping over event bodies. fn receives each header together with the
+// file offset the event starts at. It is used wherever the decoded event body
+// is not needed, which avoids decoding rows entirely.
+func scanHeaders(binlogFile string, start int64, fn func(h *replication.EventHeader, offset int64) error) error {
+	f, err := openBinlogFile(binlogFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := fi.Size()
+
+	magic := make([]byte, len(replication.BinLogFileHeader))
+	if _, err := io.ReadFull(f, magic); err != nil || !bytes.Equal(magic, replication.BinLogFileHeader) {
+		if err := encryptedBinlogError(binlogFile, magic); err != nil {
+			return err
+		}
+		return fmt.Errorf("%s is not a valid binlog file", binlogFile)
+	}
+
+	if start < 4 {
+		start = 4
+	}
+
+	buf := make([]byte, replication.EventHeaderSize)
+	for offset := start; offset < size; {
+		if _, err := f.ReadAt(buf, offset); err != nil {
+			return fmt.Errorf("read event header at %d: %v", offset, err)
+		}
+		h := new(replication.EventHeader)
+		if err := h.Decode(buf); err != nil {
+			return fmt.Errorf("decode event header at %d: %v", offset, err)
+		}
+		if h.EventSize < replication.EventHeaderSize {
+			return fmt.Errorf("invalid %s event at %d: event size %d is smaller than its header", h.EventType, offset, h.EventSize)
+		}
+		if offset+int64(h.EventSize) > size {
+			return fmt.Errorf("truncated %s event at %d: need %d bytes but only %d remain", h.EventType, offset, h.EventSize, size-offset)
+		}
+		if err := fn(h, offset); err != nil {
+			return err
+		}
+		offset += int64(h.EventSize)
+	}
+	return nil
+}
+
+// countEventTypes prints the number of events of each type using the header
+// scan only. Over several files it prints the counts of all of them,
+// followed by each file's total. Events of unknown types are counted as
+// -unknownEvents has them: dump-hex counts them, warn and skip leave them
+// out, and fail stops at the first, exiting with status 1 once the counts
+// so far are printed.
+func countEventTypes(files []string, startPosition int64) {
+	counts := make(map[replication.EventType]int)
+	total := 0
+	perFile := make([]int, 0, len(files))
+	var err error
+	for i, file := range files {
+		start := startPosition
+		if i > 0 {
+			start = 4
+		}
+		perFile = append(perFile, 0)
+		err = scanHeaders(file, start, func(h *replication.EventHeader, _ int64) error {
+			if eventTimes.past(h) {
+				return errStopParsing
+			}
+			if eventTimes.bounded() && !eventTimes.contains(h) {
+				return nil
+			}
+			if ok, err := admitEventType(file, h); !ok {
+				return err
+			}
+			counts[h.EventType]++
+			perFile[i]++
+			total++
+			return nil
+		})
+		if err != nil {
+			break
+		}
+	}
+	if err == errStopParsing {
+		err = nil
+	}
+
+	types := make([]replication.EventType, 0, len(counts))
+	for t := range counts {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+
+	for _, t := range types {
+		fmt.Printf("%s: %d\n", t, counts[t])
+	}
+	if len(files) > 1 {
+		for i, n := range perFile {
+			fmt.Printf("%s: %d events\n", files[i], n)
+		}
+	}
+	fmt.Printf("Total events: %d\n", total)
+	runWarnings.summary(os.Stderr)
+
+	if err != nil {
+		fmt.Println(err.Error())
+		if errors.Is(err, errUnknownEventType) {
+			os.Exit(1)
+		}
+	}
+}
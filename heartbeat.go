@@ -0,0 +1,59 @@
+package main
+
+import (
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// Heartbeat v2 field types (MySQL 8.0.26+).
+const (
+	heartbeatEndMark = 0
+	heartbeatLogFile = 1
+	heartbeatLogPos  = 2
+)
+
+// heartbeat is what a HEARTBEAT event tells about the source: it is alive
+// and has nothing newer than LogPos in LogFile to send.
+type heartbeat struct {
+	LogFile string
+	LogPos  uint64
+}
+
+// decodeHeartbeat extracts the source coordinates from a HEARTBEAT or
+// HEARTBEAT_LOG_EVENT_V2 event. go-mysql leaves both as generic events.
+// Heartbeats are only sent over a replication connection; they never appear
+// in binlog or relay log files.
+func decodeHeartbeat(e *replication.BinlogEvent) (heartbeat, bool) {
+	ev, ok := e.Event.(*replication.GenericEvent)
+	if !ok {
+		return heartbeat{}, false
+	}
+	switch e.Header.EventType {
+	case replication.HEARTBEAT_EVENT:
+		// The body is the log file name; the header carries the position.
+		return heartbeat{LogFile: string(ev.Data), LogPos: uint64(e.Header.LogPos)}, true
+	case replication.HEARTBEAT_LOG_EVENT_V2:
+		var hb heartbeat
+		for pos := 0; pos < len(ev.Data); {
+			typ := ev.Data[pos]
+			if typ == heartbeatEndMark {
+				break
+			}
+			size, n, ok := lengthEncodedInt(ev.Data, pos+1)
+			if !ok || uint64(len(ev.Data)-pos-1-n) < size {
+				return hb, false
+			}
+			value := ev.Data[pos+1+n : pos+1+n+int(size)]
+			switch typ {
+			case heartbeatLogFile:
+				hb.LogFile = string(value)
+			case heartbeatLogPos:
+				if hb.LogPos, _, ok = lengthEncodedInt(value, 0); !ok {
+					return hb, false
+				}
+			}
+			pos += 1 + n + int(size)
+		}
+		return hb, true
+	}
+	return heartbeat{}, false
+}
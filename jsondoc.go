@@ -0,0 +1,388 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/google/uuid"
+)
+
+// JSON format versions. jsonFormatVersion is the newest; bump it, and add a
+// new schema file, whenever a field is removed or changes meaning or its
+// values change; adding optional fields does not require a new version.
+const (
+	jsonFormatV1 = 1
+	// jsonFormatV2 decodes string values from the character sets of their
+	// columns, and shows a partial JSON update as the document after it.
+	jsonFormatV2 = 2
+	// jsonFormatV3 shows unsigned values as unsigned, and strings that are
+	// not UTF-8 by their bytes in hex.
+	jsonFormatV3 = 3
+
+	jsonFormatVersion = jsonFormatV3
+)
+
+// jsonVersion is the JSON format version of the run, selected with
+// -outputVersion, stamped into every JSON document go-parse emits.
+var jsonVersion = jsonFormatVersion
+
+// outputSchemas are the JSON Schemas describing the documents of each JSON
+// format version.
+var (
+	//go:embed schema/v1.json
+	outputSchemaV1 []byte
+	//go:embed schema/v2.json
+	outputSchemaV2 []byte
+	//go:embed schema/v3.json
+	outputSchemaV3 []byte
+
+	outputSchemas = map[int][]byte{jsonFormatV1: outputSchemaV1, jsonFormatV2: outputSchemaV2, jsonFormatV3: outputSchemaV3}
+)
+
+// eventDocument is the JSON form of a single binlog event. Besides the
+// header fields it records where the event came from: the file, its byte
+// range and the GTID of its transaction.
+type eventDocument struct {
+	FormatVersion int                    `json:"format_version"`
+	Type          string                 `json:"type"`
+	Timestamp     uint32                 `json:"timestamp"`
+	Date          string                 `json:"date"`
+	ServerID      uint32                 `json:"server_id"`
+	Source        string                 `json:"source,omitempty"`
+	File          string                 `json:"file,omitempty"`
+	StartPos      uint32                 `json:"start_pos"`
+	LogPos        uint32                 `json:"log_pos"`
+	EventSize     uint32                 `json:"event_size"`
+	GTID          string                 `json:"gtid,omitempty"`
+	InPayload     bool                   `json:"in_payload,omitempty"`
+	Event         map[string]interface{} `json:"event,omitempty"`
+}
+
+// statsDocument is the JSON form of the -showStats report.
+type statsDocument struct {
+	FormatVersion int                           `json:"format_version"`
+	Type          string                        `json:"type"`
+	RowsDecoded   bool                          `json:"rows_decoded"`
+	Events        map[string]statsEventCount    `json:"events"`
+	Tables        map[string]statsTableSummary  `json:"tables"`
+	Sources       map[string]statsSourceSummary `json:"sources,omitempty"`
+	Applications  map[string]statsAppSummary    `json:"applications,omitempty"`
+}
+
+type statsAppSummary struct {
+	Events int    `json:"events"`
+	Rows   *int   `json:"rows,omitempty"`
+	Bytes  uint64 `json:"bytes"`
+}
+
+type statsSourceSummary struct {
+	Transactions int    `json:"transactions"`
+	Events       int    `json:"events"`
+	Rows         *int   `json:"rows,omitempty"`
+	Bytes        uint64 `json:"bytes"`
+}
+
+type statsEventCount struct {
+	Count int    `json:"count"`
+	Bytes uint64 `json:"bytes"`
+}
+
+type statsTableSummary struct {
+	Inserts int    `json:"inserts"`
+	Updates int    `json:"updates"`
+	Deletes int    `json:"deletes"`
+	Rows    *int   `json:"rows,omitempty"`
+	Bytes   uint64 `json:"bytes"`
+}
+
+func newEventDocument(e *replication.BinlogEvent) *eventDocument {
+	doc := &eventDocument{
+		FormatVersion: jsonVersion,
+		Type:          e.Header.EventType.String(),
+		Timestamp:     e.Header.Timestamp,
+		Date:          time.Unix(int64(e.Header.Timestamp), 0).Format(timeFormat),
+		ServerID:      e.Header.ServerID,
+		LogPos:        e.Header.LogPos,
+		EventSize:     e.Header.EventSize,
+		InPayload:     inPayload(e.Header),
+	}
+	if e.Header.LogPos >= e.Header.EventSize {
+		// Artificial events, such as heartbeats, have no position.
+		doc.StartPos = e.Header.LogPos - e.Header.EventSize
+	}
+	if doc.Type == "UnknownEvent" {
+		// Name the types go-mysql does not know, such as tagged GTIDs.
+		doc.Type = eventTypeName(e.Header.EventType)
+	}
+
+	switch ev := e.Event.(type) {
+	case *replication.FormatDescriptionEvent:
+		doc.Event = map[string]interface{}{
+			"version":            ev.Version,
+			"server_version":     strings.TrimRight(string(ev.ServerVersion), "\x00 "),
+			"checksum_algorithm": ev.ChecksumAlgorithm,
+		}
+	case *replication.RotateEvent:
+		doc.Event = map[string]interface{}{
+			"position":      ev.Position,
+			"next_log_name": string(ev.NextLogName),
+		}
+	case *replication.PreviousGTIDsEvent:
+		doc.Event = map[string]interface{}{"gtid_sets": ev.GTIDSets}
+	case *replication.XIDEvent:
+		doc.Event = map[string]interface{}{"xid": ev.XID}
+	case *replication.QueryEvent:
+		doc.Event = map[string]interface{}{
+			"slave_proxy_id": ev.SlaveProxyID,
+			"execution_time": ev.ExecutionTime,
+			"error_code":     ev.ErrorCode,
+			"schema":         string(ev.Schema),
+			"query":          string(ev.Query),
+		}
+	case *replication.RowsQueryEvent:
+		doc.Event = map[string]interface{}{"query": string(ev.Query)}
+	case *replication.GTIDEvent:
+		u, _ := uuid.FromBytes(ev.SID)
+		doc.Event = map[string]interface{}{
+			"gtid":            u.String() + ":" + strconv.FormatInt(ev.GNO, 10),
+			"commit_flag":     ev.CommitFlag,
+			"last_committed":  ev.LastCommitted,
+			"sequence_number": ev.SequenceNumber,
+		}
+	case *replication.TableMapEvent:
+		types := make([]int, len(ev.ColumnType))
+		for i, t := range ev.ColumnType {
+			types[i] = int(t)
+		}
+		doc.Event = map[string]interface{}{
+			"table_id":     ev.TableID,
+			"schema":       string(ev.Schema),
+			"table":        string(ev.Table),
+			"column_count": ev.ColumnCount,
+			"column_types": types,
+		}
+		if names := columnNames(ev); len(names) > 0 {
+			doc.Event["column_names"] = names
+		}
+		doc.Event["column_definitions"] = columnDefinitions(ev)
+	case *replication.RowsEvent:
+		var unsigned map[int]bool
+		if ev.Table != nil && jsonVersion >= jsonFormatV3 {
+			unsigned = ev.Table.UnsignedMap()
+		}
+		rows := make([][]interface{}, len(ev.Rows))
+		for i, row := range ev.Rows {
+			rows[i] = make([]interface{}, len(row))
+			for j, v := range row {
+				if ev.Table != nil {
+					if jsonVersion >= jsonFormatV3 {
+						v = typedValue(ev.Table, unsigned, j, v)
+					}
+					v = blobValue(ev.Table, j, displayTimestamp(ev.Table, j, v))
+				}
+				rows[i][j] = jsonValue(v)
+			}
+		}
+		doc.Event = map[string]interface{}{
+			"table_id":     ev.TableID,
+			"column_count": ev.ColumnCount,
+			"action":       rowsEventKind(e.Header.EventType),
+			"rows":         rows,
+		}
+		if ev.Table != nil {
+			doc.Event["schema"] = string(ev.Table.Schema)
+			doc.Event["table"] = string(ev.Table.Table)
+		} else {
+			doc.Event["undecodable"] = true
+		}
+	case *replication.TransactionPayloadEvent:
+		doc.Event = map[string]interface{}{
+			"compression_type":  ev.CompressionType,
+			"payload_size":      ev.Size,
+			"uncompressed_size": ev.UncompressedSize,
+			"events":            len(ev.Events),
+		}
+	case *replication.BeginLoadQueryEvent, *appendBlockEvent, *loadQueryEvent:
+		doc.Event = loadDataDocument(e)
+	case *replication.GenericEvent:
+		doc.Event = map[string]interface{}{"data": hex.EncodeToString(ev.Data)}
+		if s, ok := eventTypeSupport[e.Header.EventType]; ok && s.handling == handledPassthrough {
+			doc.Event["not_decoded"] = s.name
+		}
+		if hb, ok := decodeHeartbeat(e); ok {
+			doc.Event["log_file"] = hb.LogFile
+			doc.Event["log_position"] = hb.LogPos
+		}
+	}
+
+	return doc
+}
+
+// eventSource follows the events of one binlog file to stamp their
+// documents with the file name and the GTID of their transaction.
+type eventSource struct {
+	file string
+	tx   txTracker
+	gtid string
+}
+
+func newEventSource(binlogFile string) *eventSource {
+	return &eventSource{file: filepath.Base(binlogFile)}
+}
+
+// observe advances the source by one event. It must see every event in
+// order, including those that are not output, to follow transactions.
+func (s *eventSource) observe(e *replication.BinlogEvent) {
+	done := s.tx.observe(e)
+	switch {
+	case s.tx.cur != nil:
+		s.gtid = s.tx.cur.GTID
+	case done != nil:
+		// The XID or COMMIT closing a transaction still belongs to it.
+		s.gtid = done.GTID
+	default:
+		s.gtid = ""
+	}
+}
+
+// document returns the stamped document of e, the event observed last.
+func (s *eventSource) document(e *replication.BinlogEvent) *eventDocument {
+	doc := newEventDocument(e)
+	doc.File = s.file
+	doc.GTID = s.gtid
+	return doc
+}
+
+// document returns the JSON form of the statistics report.
+func (r *statsReport) document() *statsDocument {
+	doc := &statsDocument{
+		FormatVersion: jsonVersion,
+		Type:          "stats",
+		RowsDecoded:   r.rowsDecoded,
+		Events:        make(map[string]statsEventCount, len(r.events)),
+		Tables:        make(map[string]statsTableSummary, len(r.tables)),
+	}
+	for t, n := range r.events {
+		doc.Events[t.String()] = statsEventCount{Count: n, Bytes: r.eventBytes[t]}
+	}
+	for name, ts := range r.tables {
+		s := statsTableSummary{Inserts: ts.inserts, Updates: ts.updates, Deletes: ts.deletes, Bytes: ts.bytes}
+		if r.rowsDecoded {
+			rows := ts.rows
+			s.Rows = &rows
+		}
+		doc.Tables[name] = s
+	}
+	if len(r.sources) > 0 {
+		doc.Sources = make(map[string]statsSourceSummary, len(r.sources))
+		for name, ss := range r.sources {
+			s := statsSourceSummary{Transactions: ss.transactions, Events: ss.events, Bytes: ss.bytes}
+			if r.rowsDecoded {
+				rows := ss.rows
+				s.Rows = &rows
+			}
+			doc.Sources[name] = s
+		}
+	}
+	if r.appTagged {
+		doc.Applications = make(map[string]statsAppSummary, len(r.apps))
+		for app, as := range r.apps {
+			s := statsAppSummary{Events: as.events, Bytes: as.bytes}
+			if r.rowsDecoded {
+				rows := as.rows
+				s.Rows = &rows
+			}
+			doc.Applications[app] = s
+		}
+	}
+	return doc
+}
+
+// jsonValue converts a decoded column value into something encoding/json
+// renders readably: byte strings become strings and temporal and decimal
+// values use their string form. From JSON format 3 a string that is not
+// UTF-8, which a JSON string cannot carry, becomes rawBytes.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []byte:
+		if jsonVersion >= jsonFormatV3 && !utf8.Valid(v) {
+			return rawBytes(v)
+		}
+		return string(v)
+	case string:
+		if jsonVersion >= jsonFormatV3 && !utf8.ValidString(v) {
+			return rawBytes(v)
+		}
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05.999999")
+	case interface{ String() string }:
+		return v.String()
+	}
+	return v
+}
+
+// rawBytes is a string that is not UTF-8. It marshals to an object holding
+// its bytes in hex, and prints as the bytes themselves, so the keys built
+// from values with fmt.Sprint still match.
+type rawBytes []byte
+
+func (b rawBytes) String() string { return string(b) }
+
+func (b rawBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"hex": hex.EncodeToString(b)})
+}
+
+// appendJSONEvent appends doc to b. For the json format it is the next
+// element of a JSON array, opened when n, the number of elements already
+// written, is zero; for ndjson it is a line of its own.
+func appendJSONEvent(b []byte, doc *eventDocument, n int, format string) ([]byte, error) {
+	if format == "json" {
+		if n == 0 {
+			b = append(b, "[\n"...)
+		} else {
+			b = append(b, ",\n"...)
+		}
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return b, err
+	}
+	b = append(b, data...)
+	if format == "ndjson" {
+		b = append(b, '\n')
+	}
+	return b, nil
+}
+
+// closeJSONArray ends an array of n elements started by appendJSONEvent.
+func closeJSONArray(w io.Writer, n int) error {
+	end := "\n]\n"
+	if n == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(w, end)
+	return err
+}
+
+// jsonStatsReport prints the statistics report as a statsDocument,
+// indented unless compact.
+type jsonStatsReport struct {
+	*statsReport
+	compact bool
+}
+
+func (r jsonStatsReport) report(w io.Writer) {
+	enc := json.NewEncoder(w)
+	if !r.compact {
+		enc.SetIndent("", "  ")
+	}
+	enc.Encode(r.document())
+}
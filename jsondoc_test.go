@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// TestEventDocumentServerVersion checks that the server version of a format
+// description is the string the server wrote, without its NUL padding.
+func TestEventDocumentServerVersion(t *testing.T) {
+	version := make([]byte, 50)
+	copy(version, "8.0.36")
+	e := &replication.BinlogEvent{
+		Header: &replication.EventHeader{EventType: replication.FORMAT_DESCRIPTION_EVENT, LogPos: 126, EventSize: 122},
+		Event:  &replication.FormatDescriptionEvent{Version: 4, ServerVersion: version},
+	}
+	data, err := json.Marshal(newEventDocument(e))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Event struct {
+			ServerVersion string `json:"server_version"`
+		} `json:"event"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Event.ServerVersion != "8.0.36" {
+		t.Errorf("server_version %q, want %q", doc.Event.ServerVersion, "8.0.36")
+	}
+}
+
+// TestJSONRowValues checks that from JSON format 3 rows carry unsigned
+// values as unsigned and binary strings losslessly, and that format 2 still
+// shows them as it did.
+func TestJSONRowValues(t *testing.T) {
+	for _, tc := range []struct {
+		corpus, version string
+		want, notWant   string
+	}{
+		{"all-types", "3", `,18446744073709551615,`, `,9223372036854775807,-1,`},
+		{"all-types", "2", `,9223372036854775807,-1,`, `,18446744073709551615,`},
+		{"charsets", "3", `{"hex":"deadbeef"}`, "\ufffd"},
+		{"charsets", "2", "\ufffd", `{"hex":`},
+	} {
+		t.Run(tc.corpus+".v"+tc.version, func(t *testing.T) {
+			file := writeTestdataBinlog(t, tc.corpus)
+			out := string(runGoParse(t, "-file", file, "-offset", "4", "-format", "ndjson", "-outputVersion", tc.version))
+			if !strings.Contains(out, tc.want) {
+				t.Errorf("no %s in the rows:\n%s", tc.want, out)
+			}
+			if strings.Contains(out, tc.notWant) {
+				t.Errorf("%s in the rows:\n%s", tc.notWant, out)
+			}
+		})
+	}
+}
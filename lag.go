@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// lagReport attributes a replica's lag: given the GTID set it has
+// executed, it counts the transactions of the files it has still to apply
+// with their rows and bytes, by table and by transaction size.
+type lagReport struct {
+	executed *mysql.MysqlGTIDSet
+
+	tx txTracker
+	// The open transaction: its size so far, and rows and bytes per table.
+	bytes  uint64
+	rows   map[string]int
+	tables map[string]uint64
+
+	total     lagCount // transactions still to apply
+	applied   int      // transactions the replica has
+	anonymous lagCount // transactions without a GTID
+	byTable   map[string]*lagCount
+	bySize    [len(lagSizeBuckets) + 1]lagCount
+	first     *largeTrx
+	largest   *largeTrx
+}
+
+// lagCount counts transactions, rows and bytes.
+type lagCount struct {
+	transactions int
+	rows         int
+	bytes        uint64
+}
+
+func (c *lagCount) add(rows int, bytes uint64) {
+	c.transactions++
+	c.rows += rows
+	c.bytes += bytes
+}
+
+// lagSizeBuckets are the upper bounds of the transaction size classes.
+var lagSizeBuckets = [...]uint64{1 << 10, 64 << 10, 1 << 20, 16 << 20, 256 << 20}
+
+func newLagReport(executed string) (*lagReport, error) {
+	// SHOW REPLICA STATUS breaks Executed_Gtid_Set over lines.
+	set, err := mysql.ParseMysqlGTIDSet(strings.Join(strings.Fields(executed), ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid -replicaGTIDs: %v", err)
+	}
+	return &lagReport{
+		executed: set.(*mysql.MysqlGTIDSet),
+		rows:     make(map[string]int),
+		tables:   make(map[string]uint64),
+		byTable:  make(map[string]*lagCount),
+	}, nil
+}
+
+func (r *lagReport) observe(e *replication.BinlogEvent) {
+	if r.tx.cur == nil {
+		r.bytes = 0
+		clear(r.rows)
+		clear(r.tables)
+	}
+	r.bytes += uint64(e.Header.EventSize)
+	table := ""
+	switch ev := e.Event.(type) {
+	case *replication.TableMapEvent:
+		table = tableName(ev)
+	case *replication.RowsEvent:
+		if ev.Table != nil {
+			table = tableName(ev.Table)
+			r.rows[table] += rowsAffected(e)
+		}
+	}
+	if table != "" {
+		r.tables[table] += uint64(e.Header.EventSize)
+	}
+	done := r.tx.observe(e)
+	if done == nil {
+		return
+	}
+	if done.GTID != "" {
+		if set, err := mysql.ParseMysqlGTIDSet(done.GTID); err == nil && r.executed.Contain(set) {
+			r.applied++
+			return
+		}
+	}
+	rows := 0
+	for _, n := range r.rows {
+		rows += n
+	}
+	if done.GTID == "" {
+		// Whether the replica has them is not known.
+		r.anonymous.add(rows, r.bytes)
+		return
+	}
+	r.total.add(rows, r.bytes)
+	for table, bytes := range r.tables {
+		c := r.byTable[table]
+		if c == nil {
+			c = new(lagCount)
+			r.byTable[table] = c
+		}
+		c.add(r.rows[table], bytes)
+	}
+	r.bySize[sort.Search(len(lagSizeBuckets), func(i int) bool { return r.bytes <= lagSizeBuckets[i] })].add(rows, r.bytes)
+	t := &largeTrx{gtid: done.GTID, start: done.Start, end: done.End, timestamp: done.Timestamp, bytes: r.bytes, rows: rows}
+	if r.first == nil {
+		r.first = t
+	}
+	if r.largest == nil || t.bytes > r.largest.bytes {
+		r.largest = t
+	}
+}
+
+func (r *lagReport) report(w io.Writer) {
+	fmt.Fprintf(w, "=== Replica lag (executed %s) ===\n", gtidSetString(r.executed))
+	fmt.Fprintf(w, "Still to apply: %s, %d rows, %s", plural(r.total.transactions, "transaction"), r.total.rows,
+		formatByteSize(r.total.bytes))
+	fmt.Fprintf(w, " (%d already applied)\n", r.applied)
+	if r.anonymous.transactions > 0 {
+		fmt.Fprintf(w, "Anonymous transactions, not known to be applied: %d, %d rows, %s\n", r.anonymous.transactions,
+			r.anonymous.rows, formatByteSize(r.anonymous.bytes))
+	}
+	if r.total.transactions == 0 {
+		fmt.Fprintln(w)
+		return
+	}
+	for _, x := range []struct {
+		what string
+		t    *largeTrx
+	}{{"Next to apply", r.first}, {"Largest", r.largest}} {
+		fmt.Fprintf(w, "%s: %s  %s  positions %d-%d  %s  %d rows\n", x.what, x.t.gtid,
+			time.Unix(int64(x.t.timestamp), 0).Format(timeFormat), x.t.start, x.t.end, formatByteSize(x.t.bytes), x.t.rows)
+	}
+
+	fmt.Fprintln(w, "\nBy table:")
+	tables := make([]string, 0, len(r.byTable))
+	for table := range r.byTable {
+		tables = append(tables, table)
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		a, b := r.byTable[tables[i]], r.byTable[tables[j]]
+		if a.bytes != b.bytes {
+			return a.bytes > b.bytes
+		}
+		return tables[i] < tables[j]
+	})
+	fmt.Fprintf(w, "%-40s %12s %12s %10s %6s\n", "Table", "Transactions", "Rows", "Bytes", "%")
+	for _, table := range tables {
+		c := r.byTable[table]
+		fmt.Fprintf(w, "%-40s %12d %12d %10s %5.1f%%\n", table, c.transactions, c.rows, formatByteSize(c.bytes),
+			100*float64(c.bytes)/float64(r.total.bytes))
+	}
+
+	fmt.Fprintln(w, "\nBy transaction size:")
+	fmt.Fprintf(w, "%-20s %12s %12s %10s %6s\n", "Size", "Transactions", "Rows", "Bytes", "%")
+	for i, c := range r.bySize {
+		if c.transactions == 0 {
+			continue
+		}
+		var class string
+		switch {
+		case i == 0:
+			class = "up to " + formatByteSize(lagSizeBuckets[0])
+		case i == len(lagSizeBuckets):
+			class = "over " + formatByteSize(lagSizeBuckets[i-1])
+		default:
+			class = formatByteSize(lagSizeBuckets[i-1]) + "-" + formatByteSize(lagSizeBuckets[i])
+		}
+		fmt.Fprintf(w, "%-20s %12d %12d %10s %5.1f%%\n", class, c.transactions, c.rows, formatByteSize(c.bytes),
+			100*float64(c.bytes)/float64(r.total.bytes))
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// largeTrxReport lists the transactions bigger than -threshold bytes or
+// -thresholdRows rows, the usual cause of replication lag: a replica
+// applies a transaction only once it has all of it, and then in one go.
+type largeTrxReport struct {
+	maxBytes uint64
+	maxRows  int
+
+	tx txTracker
+	// The open transaction: its size so far, rows per table, and the
+	// tables in the order first touched.
+	bytes  uint64
+	rows   map[string]int
+	tables []string
+
+	found []*largeTrx
+	total int // transactions seen
+}
+
+type largeTrx struct {
+	gtid       string
+	start, end uint32
+	timestamp  uint32
+	bytes      uint64
+	rows       int
+	tables     []string
+}
+
+func newLargeTrxReport(threshold string, rows int) (*largeTrxReport, error) {
+	maxBytes, err := parseByteSize(threshold)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -threshold %q: %v", threshold, err)
+	}
+	return &largeTrxReport{maxBytes: maxBytes, maxRows: rows, rows: make(map[string]int)}, nil
+}
+
+// parseByteSize parses a size in bytes with an optional K, M, G or T
+// suffix, optionally followed by B or iB; like MySQL's own size settings
+// the units are powers of 1024.
+func parseByteSize(s string) (uint64, error) {
+	num := strings.TrimSpace(s)
+	unit := strings.ToUpper(strings.TrimLeft(num, "0123456789."))
+	num = num[:len(num)-len(unit)]
+	unit = strings.TrimSuffix(strings.TrimSuffix(strings.TrimSpace(unit), "B"), "I")
+	shift := strings.Index("KMGT", unit) + 1
+	if len(unit) > 1 || (unit != "" && shift == 0) {
+		return 0, fmt.Errorf("unknown unit, want bytes or KB, MB, GB, TB")
+	}
+	if unit == "" {
+		shift = 0
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("not a size")
+	}
+	return uint64(v * float64(uint64(1)<<(10*shift))), nil
+}
+
+// formatByteSize renders n in the largest unit that keeps it at least 1.
+func formatByteSize(n uint64) string {
+	const units = "KMGT"
+	if n < 1024 {
+		return strconv.FormatUint(n, 10) + "B"
+	}
+	v, i := float64(n)/1024, 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	return strconv.FormatFloat(v, 'f', 1, 64) + units[i:i+1] + "B"
+}
+
+func (r *largeTrxReport) observe(e *replication.BinlogEvent) {
+	if r.tx.cur == nil {
+		r.bytes = 0
+		r.tables = r.tables[:0]
+		clear(r.rows)
+	}
+	r.bytes += uint64(e.Header.EventSize)
+	if re, ok := e.Event.(*replication.RowsEvent); ok && re.Table != nil {
+		table := tableName(re.Table)
+		if _, ok := r.rows[table]; !ok {
+			r.tables = append(r.tables, table)
+		}
+		r.rows[table] += rowsAffected(e)
+	}
+	done := r.tx.observe(e)
+	if done == nil {
+		return
+	}
+	r.total++
+	rows := 0
+	for _, n := range r.rows {
+		rows += n
+	}
+	if r.bytes <= r.maxBytes && (r.maxRows <= 0 || rows <= r.maxRows) {
+		return
+	}
+	t := &largeTrx{gtid: done.GTID, start: done.Start, end: done.End, timestamp: done.Timestamp, bytes: r.bytes, rows: rows}
+	for _, table := range r.tables {
+		t.tables = append(t.tables, fmt.Sprintf("%s (%d rows)", table, r.rows[table]))
+	}
+	r.found = append(r.found, t)
+}
+
+func (r *largeTrxReport) report(w io.Writer) {
+	limit := "over " + formatByteSize(r.maxBytes)
+	if r.maxRows > 0 {
+		limit += fmt.Sprintf(" or %d rows", r.maxRows)
+	}
+	fmt.Fprintf(w, "=== Large transactions (%s) ===\n", limit)
+	if len(r.found) == 0 {
+		fmt.Fprintf(w, "None of %s\n\n", plural(r.total, "transaction"))
+		return
+	}
+	for _, t := range r.found {
+		gtid := t.gtid
+		if gtid == "" {
+			gtid = "(no GTID)"
+		}
+		fmt.Fprintf(w, "%s  %s  positions %d-%d  %s  %d rows\n", gtid, time.Unix(int64(t.timestamp), 0).Format(timeFormat),
+			t.start, t.end, formatByteSize(t.bytes), t.rows)
+		if len(t.tables) > 0 {
+			fmt.Fprintf(w, "  tables: %s\n", strings.Join(t.tables, ", "))
+		}
+	}
+	largest := r.found[0]
+	for _, t := range r.found[1:] {
+		if t.bytes > largest.bytes {
+			largest = t
+		}
+	}
+	fmt.Fprintf(w, "%d of %s over the limit; largest %s at %d\n\n", len(r.found), plural(r.total, "transaction"),
+		formatByteSize(largest.bytes), largest.start)
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// Post-header of an EXECUTE_LOAD_QUERY event: a QUERY_EVENT post-header
+// followed by the file id, the range of the file name clause in the query
+// and the duplicate handling.
+const executeLoadPostHeaderSize = 13 + 13
+
+// appendBlockEvent is a decoded APPEND_BLOCK event: one more block of the
+// file a LOAD DATA statement loads. It keeps the undecoded event for the
+// text output versions that show it raw.
+type appendBlockEvent struct {
+	*replication.GenericEvent
+	FileID    uint32
+	BlockData []byte
+}
+
+// loadQueryEvent is an EXECUTE_LOAD_QUERY event decoded in full, with the
+// file it loaded reassembled from the BEGIN_LOAD_QUERY and APPEND_BLOCK
+// events before it. go-mysql decodes only the post-header, which it keeps
+// for the text output versions that show that.
+type loadQueryEvent struct {
+	*replication.ExecuteLoadQueryEvent
+	Schema []byte
+	Query  []byte
+	// Size and Blocks describe the loaded file; Data holds its first
+	// -loadDataBytes bytes. Found is false when its blocks were not in
+	// the parsed range.
+	Size   int64
+	Blocks int
+	Data   []byte
+	Found  bool
+	// LocalFile is where -loadDataDir wrote the file.
+	LocalFile string
+}
+
+// loadFile is a LOAD DATA file being reassembled.
+type loadFile struct {
+	size   int64
+	blocks int
+	data   []byte
+	out    *os.File
+	path   string
+}
+
+// loadData follows the LOAD DATA files of one binlog stream.
+type loadData struct {
+	name     func() string // binlog being read, for -loadDataDir
+	checksum bool
+	files    map[uint32]*loadFile
+}
+
+// withLoadData wraps onEvent so that APPEND_BLOCK and EXECUTE_LOAD_QUERY
+// events are delivered decoded, the latter with the file its statement
+// loaded. name returns the binlog being read.
+func withLoadData(name func() string, onEvent replication.OnEventFunc) replication.OnEventFunc {
+	ld := &loadData{name: name, files: make(map[uint32]*loadFile)}
+	return func(e *replication.BinlogEvent) error {
+		if err := ld.observe(e); err != nil {
+			return err
+		}
+		return onEvent(e)
+	}
+}
+
+func (ld *loadData) observe(e *replication.BinlogEvent) error {
+	switch ev := e.Event.(type) {
+	case *replication.FormatDescriptionEvent:
+		ld.checksum = ev.ChecksumAlgorithm == replication.BINLOG_CHECKSUM_ALG_CRC32
+	case *replication.BeginLoadQueryEvent:
+		ld.close(ev.FileID)
+		f := new(loadFile)
+		ld.files[ev.FileID] = f
+		if *loadDataDir != "" {
+			f.path = filepath.Join(*loadDataDir, fmt.Sprintf("%s-%d-%d.data", filepath.Base(ld.name()), ev.FileID, e.Header.LogPos))
+			var err error
+			if f.out, err = os.Create(f.path); err != nil {
+				return fmt.Errorf("-loadDataDir: %v", err)
+			}
+		}
+		return f.add(ev.BlockData)
+	case *replication.GenericEvent:
+		switch e.Header.EventType {
+		case replication.APPEND_BLOCK_EVENT:
+			if len(ev.Data) < 4 {
+				return nil
+			}
+			b := &appendBlockEvent{GenericEvent: ev, FileID: binary.LittleEndian.Uint32(ev.Data), BlockData: ev.Data[4:]}
+			e.Event = b
+			if f := ld.files[b.FileID]; f != nil {
+				return f.add(b.BlockData)
+			}
+		case replication.DELETE_FILE_EVENT:
+			// The statement failed on the source; the file is discarded.
+			if len(ev.Data) >= 4 {
+				ld.close(binary.LittleEndian.Uint32(ev.Data))
+			}
+		}
+	case *replication.ExecuteLoadQueryEvent:
+		q := &loadQueryEvent{ExecuteLoadQueryEvent: ev}
+		body := e.RawData[min(replication.EventHeaderSize, len(e.RawData)):]
+		if ld.checksum && !inPayload(e.Header) && len(body) >= replication.BinlogChecksumLength {
+			body = body[:len(body)-replication.BinlogChecksumLength]
+		}
+		if rest := executeLoadPostHeaderSize + int(ev.StatusVars); len(body) >= rest+int(ev.SchemaLength)+1 {
+			q.Schema = body[rest : rest+int(ev.SchemaLength)]
+			q.Query = body[rest+int(ev.SchemaLength)+1:]
+		}
+		if f := ld.files[ev.FileID]; f != nil {
+			q.Found, q.Size, q.Blocks, q.Data, q.LocalFile = true, f.size, f.blocks, f.data, f.path
+			ld.close(ev.FileID)
+		}
+		e.Event = q
+	}
+	return nil
+}
+
+func (f *loadFile) add(block []byte) error {
+	f.size += int64(len(block))
+	f.blocks++
+	if keep := *loadDataBytes; keep < 0 {
+		f.data = append(f.data, block...)
+	} else if len(f.data) < keep {
+		f.data = append(f.data, block[:min(len(block), keep-len(f.data))]...)
+	}
+	if f.out != nil {
+		if _, err := f.out.Write(block); err != nil {
+			return fmt.Errorf("-loadDataDir: %v", err)
+		}
+	}
+	return nil
+}
+
+func (ld *loadData) close(id uint32) {
+	if f := ld.files[id]; f != nil && f.out != nil {
+		f.out.Close()
+	}
+	delete(ld.files, id)
+}
+
+// dupHandling names the duplicate key handling of a LOAD DATA statement.
+func dupHandling(flag uint8) string {
+	switch flag {
+	case 1:
+		return "IGNORE"
+	case 2:
+		return "REPLACE"
+	}
+	return "ERROR"
+}
+
+// replayQuery returns the statement with its file name clause replaced by
+// LOCAL INFILE and the file -loadDataDir wrote, as mysqlbinlog
+// --local-load does, or "" when there is no written file.
+func (q *loadQueryEvent) replayQuery() string {
+	start, end := int(q.StartPos), int(q.EndPos)
+	if q.LocalFile == "" || start > end || end > len(q.Query) {
+		return ""
+	}
+	b := append([]byte(nil), q.Query[:start]...)
+	b = append(b, " LOCAL INFILE "...)
+	b = appendSQLString(b, q.LocalFile)
+	if d := dupHandling(q.DupHandlingFlags); d != "ERROR" {
+		b = append(b, ' ')
+		b = append(b, d...)
+	}
+	return string(append(b, q.Query[end:]...))
+}
+
+// appendLoadDataEvent formats the LOAD DATA events in text output version
+// 6 and later.
+func appendLoadDataEvent(b []byte, e *replication.BinlogEvent) []byte {
+	b = appendNamedHeader(b, e.Header, eventTypeName(e.Header.EventType))
+	switch ev := e.Event.(type) {
+	case *replication.BeginLoadQueryEvent:
+		b = appendUintField(b, "File ID", uint64(ev.FileID))
+		b = appendIntField(b, "Block size", int64(len(ev.BlockData)))
+	case *appendBlockEvent:
+		b = appendUintField(b, "File ID", uint64(ev.FileID))
+		b = appendIntField(b, "Block size", int64(len(ev.BlockData)))
+	case *loadQueryEvent:
+		b = appendUintField(b, "Slave proxy ID", uint64(ev.SlaveProxyID))
+		b = appendUintField(b, "Execution time", uint64(ev.ExecutionTime))
+		b = appendUintField(b, "Error code", uint64(ev.ErrorCode))
+		b = appendField(b, "Schema", ev.Schema)
+		b = appendField(b, "Query", ev.Query)
+		b = appendUintField(b, "File ID", uint64(ev.FileID))
+		b = appendStringField(b, "Duplicates", dupHandling(ev.DupHandlingFlags))
+		if !ev.Found {
+			b = append(b, "Loaded file: its blocks are not in the parsed range\n"...)
+			break
+		}
+		b = appendStringField(b, "Loaded file", fmt.Sprintf("%d bytes in %d blocks", ev.Size, ev.Blocks))
+		if ev.LocalFile != "" {
+			b = appendStringField(b, "Written to", ev.LocalFile)
+			b = appendStringField(b, "Replay query", ev.replayQuery())
+		}
+		if len(ev.Data) > 0 {
+			b = append(b, "Data:\n"...)
+			b = append(b, ev.Data...)
+			if ev.Data[len(ev.Data)-1] != '\n' {
+				b = append(b, '\n')
+			}
+		}
+		if more := ev.Size - int64(len(ev.Data)); more > 0 && *loadDataBytes != 0 {
+			b = appendStringField(b, "Truncated", fmt.Sprintf("%d more bytes; raise -loadDataBytes or set -loadDataDir", more))
+		}
+	}
+	return append(b, '\n')
+}
+
+// loadDataDocument returns the JSON event fields of the LOAD DATA events.
+func loadDataDocument(e *replication.BinlogEvent) map[string]interface{} {
+	switch ev := e.Event.(type) {
+	case *replication.BeginLoadQueryEvent:
+		return map[string]interface{}{"file_id": ev.FileID, "block_size": len(ev.BlockData)}
+	case *appendBlockEvent:
+		return map[string]interface{}{"data": hex.EncodeToString(ev.Data), "file_id": ev.FileID, "block_size": len(ev.BlockData)}
+	case *loadQueryEvent:
+		doc := map[string]interface{}{
+			"slave_proxy_id": ev.SlaveProxyID,
+			"execution_time": ev.ExecutionTime,
+			"error_code":     ev.ErrorCode,
+			"schema":         string(ev.Schema),
+			"query":          string(ev.Query),
+			"file_id":        ev.FileID,
+			"duplicates":     dupHandling(ev.DupHandlingFlags),
+		}
+		if ev.Found {
+			doc["file_size"] = ev.Size
+			doc["blocks"] = ev.Blocks
+			doc["file_data"] = string(ev.Data)
+			doc["file_data_truncated"] = int64(len(ev.Data)) < ev.Size
+		}
+		if ev.LocalFile != "" {
+			doc["local_file"] = ev.LocalFile
+			doc["replay_query"] = ev.replayQuery()
+		}
+		return doc
+	}
+	return nil
+}
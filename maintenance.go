@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+const (
+	// maintenanceInsertShare is the share of a table's rows that must be
+	// inserts for its writes to look like a copy.
+	maintenanceInsertShare = 0.9
+	// maintenanceMinRows is how many rows a new table that is never renamed
+	// must be loaded with, in ascending key order, to count as a restore.
+	maintenanceMinRows = 1000
+)
+
+// shadowTable matches the tables online schema change tools copy into and
+// log through: gh-ost's _t_gho and _t_ghc, pt-online-schema-change's _t_new.
+var shadowTable = regexp.MustCompile(`^_.+_(gho|ghc|new)$`)
+
+// maintenance is the detector of the run, nil unless -maintenance is set.
+// The capacity reports consult it when they print, once every event has
+// been seen.
+var maintenance *maintenanceDetector
+
+// maintenanceDetector recognizes the writes of clone, restore and schema
+// change operations: a table created in the range, filled with inserts,
+// usually in ascending key order, then renamed over the table it replaces.
+// Tables named as online schema change tools name their copies count too.
+type maintenanceDetector struct {
+	tables map[string]*tableWrites
+	// classified holds the operation of each maintenance table once report
+	// time classification ran.
+	classified map[string]string
+}
+
+// tableWrites is what the detector knows about one table.
+type tableWrites struct {
+	created      uint32 // position of its CREATE TABLE, 0 if not in range
+	renamedTo    string
+	renamedAt    uint32
+	insertRows   int
+	otherRows    int
+	events       int
+	bytes        uint64
+	lastKey      string
+	ascending    bool
+	keysCompared bool
+}
+
+func newMaintenanceDetector() *maintenanceDetector {
+	return &maintenanceDetector{tables: make(map[string]*tableWrites)}
+}
+
+func (d *maintenanceDetector) table(name string) *tableWrites {
+	t := d.tables[name]
+	if t == nil {
+		t = &tableWrites{ascending: true}
+		d.tables[name] = t
+	}
+	return t
+}
+
+func (d *maintenanceDetector) observe(e *replication.BinlogEvent) {
+	d.classified = nil
+	start := e.Header.LogPos - e.Header.EventSize
+
+	switch ev := e.Event.(type) {
+	case *replication.QueryEvent:
+		d.observeStatement(start, string(ev.Schema), string(ev.Query))
+	case *replication.RowsEvent:
+		if ev.Table == nil {
+			return
+		}
+		t := d.table(tableName(ev.Table))
+		t.events++
+		t.bytes += uint64(e.Header.EventSize)
+		rows := rowsAffected(e)
+		if rowsEventKind(e.Header.EventType) != "INSERT" {
+			t.otherRows += max(rows, 1)
+			return
+		}
+		t.insertRows += max(rows, 1)
+		key := keyColumns(ev.Table)[0]
+		for _, row := range ev.Rows {
+			if key >= len(row) || row[key] == nil {
+				continue
+			}
+			k := fmt.Sprint(jsonValue(row[key]))
+			if t.keysCompared || t.lastKey != "" {
+				t.keysCompared = true
+				if compareValues(k, t.lastKey) <= 0 {
+					t.ascending = false
+				}
+			}
+			t.lastKey = k
+		}
+	}
+}
+
+func (d *maintenanceDetector) observeStatement(pos uint32, schema, query string) {
+	switch statementVerb(query) {
+	case "CREATE":
+		if object, name := statementTarget(query, schema); object == "TABLE" && name != "" {
+			// A table created again starts a new history.
+			*d.table(name) = tableWrites{created: pos, ascending: true}
+		}
+	case "RENAME", "ALTER":
+		for _, r := range renamedTables(query, schema) {
+			t := d.table(r[0])
+			t.renamedTo, t.renamedAt = r[1], pos
+		}
+	}
+}
+
+// renamedTables returns the from and to names of the tables a RENAME TABLE
+// or ALTER TABLE ... RENAME statement renames.
+func renamedTables(query, schema string) [][2]string {
+	fields := strings.Fields(strings.NewReplacer(",", " , ", ";", " ").Replace(query))
+	qualify := func(name string) string {
+		name = strings.ReplaceAll(name, "`", "")
+		if schema != "" && !strings.Contains(name, ".") {
+			name = schema + "." + name
+		}
+		return name
+	}
+	var pairs [][2]string
+	switch statementVerb(query) {
+	case "RENAME":
+		// RENAME TABLE a TO b, c TO d
+		for i := 2; i+2 < len(fields); i += 4 {
+			if !strings.EqualFold(fields[i+1], "TO") {
+				break
+			}
+			pairs = append(pairs, [2]string{qualify(fields[i]), qualify(fields[i+2])})
+			if i+3 < len(fields) && fields[i+3] != "," {
+				break
+			}
+		}
+	case "ALTER":
+		object, from := statementTarget(query, schema)
+		if object != "TABLE" || from == "" {
+			return nil
+		}
+		for i, f := range fields {
+			if !strings.EqualFold(f, "RENAME") || i+1 >= len(fields) {
+				continue
+			}
+			to := fields[i+1]
+			if strings.EqualFold(to, "TO") || strings.EqualFold(to, "AS") {
+				if i+2 >= len(fields) {
+					break
+				}
+				to = fields[i+2]
+			}
+			switch strings.ToUpper(to) {
+			case "COLUMN", "INDEX", "KEY":
+				continue
+			}
+			pairs = append(pairs, [2]string{from, qualify(to)})
+			break
+		}
+	}
+	return pairs
+}
+
+// operation returns what maintenance operation wrote table, or "" when its
+// writes are organic traffic.
+func (d *maintenanceDetector) operation(table string) string {
+	if d == nil {
+		return ""
+	}
+	if d.classified == nil {
+		d.classified = make(map[string]string)
+		for name, t := range d.tables {
+			if op := t.operation(name); op != "" {
+				d.classified[name] = op
+			}
+		}
+	}
+	return d.classified[table]
+}
+
+func (t *tableWrites) operation(name string) string {
+	if t.events == 0 {
+		return ""
+	}
+	short := name[strings.IndexByte(name, '.')+1:]
+	if shadowTable.MatchString(short) {
+		return "online schema change table"
+	}
+	if t.created == 0 || float64(t.insertRows) < maintenanceInsertShare*float64(t.insertRows+t.otherRows) {
+		return ""
+	}
+	switch {
+	case t.renamedTo != "":
+		return "copy renamed to " + t.renamedTo
+	case t.otherRows == 0 && t.ascending && t.keysCompared && t.insertRows >= maintenanceMinRows:
+		return "bulk load into a new table"
+	}
+	return ""
+}
+
+func (d *maintenanceDetector) report(w io.Writer) {
+	names := make([]string, 0, len(d.tables))
+	var total, churn uint64
+	for name, t := range d.tables {
+		total += t.bytes
+		if d.operation(name) != "" {
+			names = append(names, name)
+			churn += t.bytes
+		}
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "=== Maintenance churn ===")
+	if len(names) == 0 {
+		fmt.Fprintln(w, "No clone, restore or schema change copies found")
+	}
+	for _, name := range names {
+		t := d.tables[name]
+		fmt.Fprintf(w, "%s  %s", name, d.operation(name))
+		if t.created != 0 {
+			fmt.Fprintf(w, "  created at %d", t.created)
+		}
+		if t.renamedTo != "" {
+			fmt.Fprintf(w, "  renamed at %d", t.renamedAt)
+		}
+		fmt.Fprintf(w, "  inserted: %d  other: %d  events: %d  bytes: %d", t.insertRows, t.otherRows, t.events, t.bytes)
+		if t.keysCompared && t.ascending {
+			fmt.Fprint(w, "  keys ascending")
+		}
+		fmt.Fprintln(w)
+	}
+	if total > 0 {
+		fmt.Fprintf(w, "Rows event bytes: organic %d, maintenance %d (%.1f%%)\n", total-churn, churn, 100*float64(churn)/float64(total))
+	}
+	fmt.Fprintln(w)
+}
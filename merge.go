@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// mergeSource is one server's binlogs in a merge, named by the tag its
+// events carry in the merged stream.
+type mergeSource struct {
+	name  string
+	files []string
+
+	events chan *mergedEvent
+	err    error
+}
+
+// mergedEvent is an event of a source that passed the filters, with its
+// JSON document when the output is JSON.
+type mergedEvent struct {
+	e   *replication.BinlogEvent
+	doc *eventDocument
+}
+
+// parseMergeSources parses the merge arguments, each [name=]files where
+// files is a comma-separated list or glob as -file takes. A source without
+// a name is named after the directory of its first file.
+func parseMergeSources(args []string) ([]*mergeSource, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("merge needs at least two sources, as shard1='/backups/shard1/mysql-bin.*' shard2=...")
+	}
+	seen := make(map[string]bool)
+	var sources []*mergeSource
+	for _, arg := range args {
+		name, spec, ok := strings.Cut(arg, "=")
+		if !ok {
+			name, spec = "", arg
+		}
+		files, err := expandBinlogFiles(spec)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("merge source %q names no files", arg)
+		}
+		for _, file := range files {
+			if _, err := statBinlog(file); err != nil {
+				return nil, err
+			}
+		}
+		if name == "" {
+			name = filepath.Base(filepath.Dir(files[0]))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("two merge sources are named %s; name them as name=files", name)
+		}
+		seen[name] = true
+		sources = append(sources, &mergeSource{name: name, files: files})
+	}
+	return sources, nil
+}
+
+// read parses the files of s in sequence and sends the events that pass the
+// run's filters, until done is closed. It closes s.events when it returns.
+func (s *mergeSource) read(jsonOut bool, done <-chan struct{}) {
+	defer close(s.events)
+	// The GTID filter follows transactions, so each source needs its own.
+	gtids, _ := newGTIDFilter()
+	var src *eventSource
+	err := parseBinlogs(newParser(true), s.files, 4, func(file string, _ int64) {
+		src = newEventSource(file)
+	}, func(e *replication.BinlogEvent) error {
+		src.observe(e)
+		if eventTimes.past(e.Header) {
+			return errStopParsing
+		}
+		if gtids != nil && !gtids.keep(e) {
+			return nil
+		}
+		if (eventFilter != nil && !eventFilter.keep(e)) || (eventTimes.bounded() && !eventTimes.contains(e.Header)) {
+			return nil
+		}
+		m := &mergedEvent{e: e}
+		if jsonOut {
+			m.doc = src.document(e)
+			m.doc.Source = s.name
+		}
+		select {
+		case s.events <- m:
+			return nil
+		case <-done:
+			return errStopParsing
+		}
+	})
+	if err != nil {
+		s.err = fmt.Errorf("%s: %v", s.name, err)
+	}
+}
+
+// mergeEvents interleaves the events of sources by timestamp into out, each
+// tagged with its source. The sources are read concurrently and each is
+// assumed to be in time order, as a server's binlogs are. Timestamps have a
+// one-second resolution, so among events of the same second the source that
+// output last goes on, which keeps its transactions together, and then the
+// sources in the order given. Events without a timestamp, such as the
+// artificial ROTATE events of relay logs, are output as soon as they come.
+// A source that fails ends the merge, since the stream would silently miss
+// its later events.
+func mergeEvents(out *bufio.Writer, sources []*mergeSource, format string, textVersion int) (int, error) {
+	done := make(chan struct{})
+	defer close(done)
+	jsonOut := format != "text"
+	for _, s := range sources {
+		s.events = make(chan *mergedEvent, 256)
+		go s.read(jsonOut, done)
+	}
+	heads := make([]*mergedEvent, len(sources))
+	for i, s := range sources {
+		if heads[i] = <-s.events; heads[i] == nil && s.err != nil {
+			return 0, s.err
+		}
+	}
+	// With -dedupGTIDs a transaction another source already output is
+	// skipped. The sources share the GTIDs seen, claimed as each
+	// transaction starts since the copies are interleaved.
+	var dedup []*gtidFilter
+	if *dedupGTIDs {
+		seen := &mysql.MysqlGTIDSet{Sets: make(map[string]*mysql.UUIDSet)}
+		for range sources {
+			dedup = append(dedup, &gtidFilter{seen: seen, claim: true})
+		}
+	}
+	written, last := 0, -1
+	for {
+		next := -1
+		for i, h := range heads {
+			if h == nil {
+				continue
+			}
+			ts := h.e.Header.Timestamp
+			if next == -1 || ts == 0 || ts < heads[next].e.Header.Timestamp ||
+				(i == last && ts == heads[next].e.Header.Timestamp) {
+				next = i
+				if ts == 0 {
+					break
+				}
+			}
+		}
+		if next == -1 {
+			break
+		}
+		if stopRequested.Load() {
+			break
+		}
+		m, s := heads[next], sources[next]
+		if dedup != nil && !dedup[next].keep(m.e) {
+			if heads[next] = <-s.events; heads[next] == nil && s.err != nil {
+				return written, s.err
+			}
+			continue
+		}
+		buf := getBuffer()
+		b := *buf
+		if jsonOut {
+			var err error
+			if b, err = appendJSONEvent(b, m.doc, written, format); err != nil {
+				putBuffer(buf, b)
+				return written, err
+			}
+		} else if textShowsEvent(m.e, textVersion) {
+			b = appendSourceEvent(b, m.e, s.name, textVersion)
+		}
+		_, err := out.Write(b)
+		putBuffer(buf, b)
+		if err != nil {
+			return written, err
+		}
+		written++
+		last = next
+		if heads[next] = <-s.events; heads[next] == nil && s.err != nil {
+			return written, s.err
+		}
+	}
+	return written, nil
+}
+
+// appendSourceEvent appends the text form of e with a Source line after its
+// heading.
+func appendSourceEvent(b []byte, e *replication.BinlogEvent, source string, version int) []byte {
+	ev := appendTextEvent(nil, e, version)
+	heading := bytes.IndexByte(ev, '\n') + 1
+	b = append(b, ev[:heading]...)
+	b = append(b, "Source: "+source+"\n"...)
+	return append(b, ev[heading:]...)
+}
+
+func mergeCommand(int64) {
+	if *binlogFile != "" || *indexFile != "" {
+		fmt.Fprintf(os.Stderr, "Error: merge takes its sources as arguments, not -file or -index\n")
+		os.Exit(1)
+	}
+	if positions != nil {
+		fmt.Fprintf(os.Stderr, "Error: merge does not record positions; drop -stateFile and -positionStore\n")
+		os.Exit(1)
+	}
+	sources, err := parseMergeSources(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	textVersion, err := resolveOutputVersion(*outputVersion, "text", textOutputLatest)
+	if *outputFormat != "text" {
+		_, err = resolveOutputVersion(*outputVersion, "json", jsonFormatVersion)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	out := bufio.NewWriterSize(os.Stdout, outputBufferSize)
+	written, err := mergeEvents(out, sources, *outputFormat, textVersion)
+	if *outputFormat == "json" {
+		closeJSONArray(out, written)
+	}
+	out.Flush()
+	runWarnings.summary(os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/google/uuid"
+)
+
+// metadataCacheVersion invalidates every cached entry when fileMetadata
+// changes shape, or what a scan finds does, as when the transactions of
+// compressed payloads became visible in version 3, anonymous GTIDs were
+// told apart in version 5, or -normalizeShards joined the key in version 6.
+const metadataCacheVersion = 6
+
+// fileMetadata is the per-file summary cached between runs.
+type fileMetadata struct {
+	CacheVersion   int           `json:"cache_version"`
+	Path           string        `json:"path"`
+	Size           int64         `json:"size"`
+	ModTime        int64         `json:"mod_time"`
+	Events         int           `json:"events"`
+	FirstTimestamp uint32        `json:"first_timestamp"`
+	LastTimestamp  uint32        `json:"last_timestamp"`
+	FirstPos       uint32        `json:"first_pos"`
+	LastPos        uint32        `json:"last_pos"`
+	ServerVersion  string        `json:"server_version"`
+	PreviousGTIDs  string        `json:"previous_gtids,omitempty"`
+	GTIDSet        string        `json:"gtid_set,omitempty"`
+	Tables         []string      `json:"tables"`
+	Transactions   []transaction `json:"transactions"`
+	// Ends is how the file ends: "rotate" to NextLog, "stop" at a server
+	// shutdown, or empty when the server did not close it.
+	Ends    string `json:"ends,omitempty"`
+	NextLog string `json:"next_log,omitempty"`
+}
+
+// metadataCachePath returns where the metadata of the file described by fi
+// is cached. The key combines the file identity with its size and
+// modification time, so an appended or rewritten binlog misses the cache,
+// and with the -normalizeShards rules, which rename the tables a scan
+// finds.
+func metadataCachePath(fi os.FileInfo) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	id := fileIdentity(fi)
+	if o, ok := fi.(*s3FileInfo); ok {
+		// An S3 object is identified by its URL and version.
+		id = o.url + "|" + o.etag
+	}
+	rules := ""
+	if shardNames != nil {
+		rules = shardNames.String()
+	}
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%d|%s", id, fi.Size(), fi.ModTime().UnixNano(), rules)))
+	return filepath.Join(dir, "go-parse", hex.EncodeToString(h[:16])+".json"), nil
+}
+
+// loadFileMetadata returns the metadata of binlogFile from the cache, or
+// scans the file and stores the result when there is no usable entry.
+func loadFileMetadata(binlogFile string, useCache bool) (*fileMetadata, error) {
+	fi, err := statBinlog(binlogFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cachePath, cacheErr := metadataCachePath(fi)
+	if useCache && cacheErr == nil {
+		if data, err := os.ReadFile(cachePath); err == nil {
+			md := new(fileMetadata)
+			if json.Unmarshal(data, md) == nil && md.CacheVersion == metadataCacheVersion {
+				md.Path = binlogFile
+				return md, nil
+			}
+		}
+	}
+
+	md, err := scanFileMetadata(binlogFile)
+	if err != nil {
+		return md, err
+	}
+	md.Size = fi.Size()
+	md.ModTime = fi.ModTime().Unix()
+
+	if useCache && cacheErr == nil {
+		if data, err := json.Marshal(md); err == nil {
+			if os.MkdirAll(filepath.Dir(cachePath), 0o755) == nil {
+				os.WriteFile(cachePath, data, 0o644)
+			}
+		}
+	}
+	return md, nil
+}
+
+func scanFileMetadata(binlogFile string) (*fileMetadata, error) {
+	md := &fileMetadata{CacheVersion: metadataCacheVersion, Path: binlogFile}
+	gset := new(mysql.MysqlGTIDSet)
+	gset.Sets = make(map[string]*mysql.UUIDSet)
+	tables := make(map[string]bool)
+	var tx txTracker
+
+	p := newParser(false)
+	err := parseBinlog(p, binlogFile, 4, func(e *replication.BinlogEvent) error {
+		md.Events++
+		if e.Header.Timestamp != 0 {
+			if md.FirstTimestamp == 0 {
+				md.FirstTimestamp = e.Header.Timestamp
+			}
+			md.LastTimestamp = e.Header.Timestamp
+		}
+		if md.FirstPos == 0 {
+			md.FirstPos = e.Header.LogPos - e.Header.EventSize
+		}
+		md.LastPos = e.Header.LogPos
+
+		switch ev := e.Event.(type) {
+		case *replication.FormatDescriptionEvent:
+			md.ServerVersion = strings.TrimRight(string(ev.ServerVersion), "\x00 ")
+		case *replication.PreviousGTIDsEvent:
+			md.PreviousGTIDs = ev.GTIDSets
+		case *replication.GTIDEvent:
+			if u, err := uuid.FromBytes(ev.SID); err == nil && u != uuid.Nil {
+				gset.AddGTID(u, ev.GNO)
+			}
+		case *replication.TableMapEvent:
+			tables[tableName(ev)] = true
+		case *replication.RotateEvent:
+			if endsFile(e) {
+				md.Ends, md.NextLog = "rotate", string(ev.NextLogName)
+			}
+		}
+		if e.Header.EventType == replication.STOP_EVENT {
+			md.Ends = "stop"
+		}
+		if t := tx.observe(e); t != nil {
+			md.Transactions = append(md.Transactions, *t)
+		}
+		return nil
+	})
+
+	md.GTIDSet = gset.String()
+	for name := range tables {
+		md.Tables = append(md.Tables, name)
+	}
+	sort.Strings(md.Tables)
+	return md, err
+}
+
+func (md *fileMetadata) dump(w io.Writer) {
+	fmt.Fprintf(w, "File: %s\n", md.Path)
+	fmt.Fprintf(w, "Size: %d\n", md.Size)
+	fmt.Fprintf(w, "Server version: %s\n", md.ServerVersion)
+	fmt.Fprintf(w, "Events: %d\n", md.Events)
+	fmt.Fprintf(w, "Positions: %d - %d\n", md.FirstPos, md.LastPos)
+	fmt.Fprintf(w, "First event: %s\n", time.Unix(int64(md.FirstTimestamp), 0).Format(timeFormat))
+	fmt.Fprintf(w, "Last event: %s\n", time.Unix(int64(md.LastTimestamp), 0).Format(timeFormat))
+	fmt.Fprintf(w, "Previous GTIDs: %s\n", md.PreviousGTIDs)
+	fmt.Fprintf(w, "GTID set: %s\n", md.GTIDSet)
+	fmt.Fprintf(w, "Transactions: %d\n", len(md.Transactions))
+	fmt.Fprintf(w, "Tables: %d\n", len(md.Tables))
+	for _, t := range md.Tables {
+		fmt.Fprintf(w, "  %s\n", t)
+	}
+}
+
+func printFileMetadata(binlogFile string) {
+	md, err := loadFileMetadata(binlogFile, !*noCache)
+	if md != nil {
+		md.dump(os.Stdout)
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// mmapFile is never produced on platforms without mmap support.
+type mmapFile struct {
+	*os.File
+}
+
+// openMmap falls back to regular file reads.
+func openMmap(name string) (binlogSource, error) {
+	return os.Open(name)
+}
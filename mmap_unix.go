@@ -0,0 +1,46 @@
+//go:build unix
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+)
+
+// mmapFile is a read-only memory mapping of a whole binlog file.
+type mmapFile struct {
+	*bytes.Reader
+	data []byte
+}
+
+func openMmap(name string) (binlogSource, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() == 0 {
+		return &mmapFile{Reader: bytes.NewReader(nil)}, nil
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(fi.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	return &mmapFile{Reader: bytes.NewReader(data), data: data}, nil
+}
+
+func (m *mmapFile) Close() error {
+	if m.data == nil {
+		return nil
+	}
+	err := syscall.Munmap(m.data)
+	m.data = nil
+	return err
+}
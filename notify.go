@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// pagerDutyEventsURL is the PagerDuty Events API v2 endpoint, used when a
+// pagerduty rule has no url.
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// alertEncoder builds the request body sent for an alert.
+type alertEncoder func(r *webhookRule, a *webhookAlert) ([]byte, error)
+
+var alertSinks = map[string]alertEncoder{
+	"webhook":   encodeWebhookAlert,
+	"slack":     encodeSlackAlert,
+	"pagerduty": encodePagerDutyAlert,
+}
+
+func (r *webhookRule) configureSink() error {
+	if r.Sink == "" {
+		r.Sink = "webhook"
+	}
+	r.encode = alertSinks[r.Sink]
+	if r.encode == nil {
+		return fmt.Errorf("unknown sink %q", r.Sink)
+	}
+	if r.Sink != "pagerduty" {
+		return nil
+	}
+	if r.URL == "" {
+		r.URL = pagerDutyEventsURL
+	}
+	if r.RoutingKey == "" {
+		return fmt.Errorf("pagerduty sink requires routing_key")
+	}
+	switch r.Severity {
+	case "":
+		r.Severity = "critical"
+	case "critical", "error", "warning", "info":
+	default:
+		return fmt.Errorf("invalid severity %q", r.Severity)
+	}
+	return nil
+}
+
+func encodeWebhookAlert(_ *webhookRule, a *webhookAlert) ([]byte, error) {
+	return json.Marshal(a)
+}
+
+// encodeSlackAlert formats an alert for a Slack incoming webhook.
+func encodeSlackAlert(_ *webhookRule, a *webhookAlert) ([]byte, error) {
+	text := fmt.Sprintf(":rotating_light: *%s*: %s", a.Rule, describeAlert(a))
+	if a.Event.Event["query"] != nil {
+		text += fmt.Sprintf("\n```%s```", a.Event.Event["query"])
+	}
+	return json.Marshal(map[string]string{"text": text})
+}
+
+// encodePagerDutyAlert formats an alert as a PagerDuty Events API v2
+// trigger. The dedup key makes redelivery of the same event idempotent.
+func encodePagerDutyAlert(r *webhookRule, a *webhookAlert) ([]byte, error) {
+	start := a.Event.LogPos - a.Event.EventSize
+	return json.Marshal(map[string]interface{}{
+		"routing_key":  r.RoutingKey,
+		"event_action": "trigger",
+		"dedup_key":    fmt.Sprintf("go-parse:%s:%s:%d", r.Name, a.File, start),
+		"payload": map[string]interface{}{
+			"summary":        r.Name + ": " + describeAlert(a),
+			"source":         a.File,
+			"severity":       r.Severity,
+			"component":      qualifiedName(a.DB, a.Table),
+			"custom_details": a,
+		},
+	})
+}
+
+// describeAlert summarizes the matched event in one line:
+// "DELETE of 1500 rows on shop.payments at mysql-bin.000042:1183 (GTID ...)".
+func describeAlert(a *webhookAlert) string {
+	var b strings.Builder
+	switch {
+	case a.Op != "" && a.Op != "QUERY":
+		fmt.Fprintf(&b, "%s of %s", a.Op, plural(a.Rows, "row"))
+	case a.Event.Event["query"] != nil:
+		q := fmt.Sprint(a.Event.Event["query"])
+		if v := statementVerb(q); v != "" {
+			b.WriteString(v + " statement")
+		} else {
+			b.WriteString("statement")
+		}
+	default:
+		b.WriteString(a.Event.Type)
+	}
+	if name := qualifiedName(a.DB, a.Table); name != "" {
+		fmt.Fprintf(&b, " on %s", name)
+	}
+	fmt.Fprintf(&b, " at %s:%d", a.File, a.Event.LogPos-a.Event.EventSize)
+	if a.GTID != "" {
+		fmt.Fprintf(&b, " (GTID %s)", a.GTID)
+	}
+	return b.String()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// Frozen text output versions. Once released a version's layout never
+// changes; formatting improvements go into a new version so scripts can pin
+// the one they were written against with -outputVersion.
+const (
+	// textOutputV1 is go-mysql's Dump format, as printed by the original go-parse.
+	textOutputV1 = 1
+	// textOutputV2 is go-parse's own formatter (appendEvent).
+	textOutputV2 = 2
+	// textOutputV3 adds dedicated STOP and HEARTBEAT formatting.
+	textOutputV3 = 3
+	// textOutputV4 names and labels event types that are not decoded,
+	// including types go-mysql does not know.
+	textOutputV4 = 4
+	// textOutputV5 summarizes compressed transaction payloads and outputs
+	// the events they hold as events of their own.
+	textOutputV5 = 5
+	// textOutputV6 decodes the LOAD DATA events and shows the file a
+	// LOAD DATA statement loaded.
+	textOutputV6 = 6
+	// textOutputV7 groups the events of the dump by transaction, each
+	// after a header summarizing it.
+	textOutputV7 = 7
+	// textOutputV8 labels row values with their column names, marks the
+	// images of an UPDATE, and shows the columns a row image leaves out.
+	textOutputV8 = 8
+	// textOutputV9 lists the columns of a table map with their types and,
+	// with binlog_row_metadata=FULL, their definitions, and shows unsigned
+	// values as unsigned.
+	textOutputV9 = 9
+	// textOutputV10 shows DECIMAL values as numbers rather than strings,
+	// and ENUM and SET values by their values rather than their index or
+	// bitmap.
+	textOutputV10 = 10
+	// textOutputV11 shows JSON values as JSON rather than quoted strings,
+	// and a partial JSON update as the document after it, with the update.
+	textOutputV11 = 11
+	// textOutputV12 shows string values decoded from the character sets
+	// of their columns into UTF-8.
+	textOutputV12 = 12
+
+	textOutputLatest = textOutputV12
+)
+
+// Row values are rewritten as events are decoded, so that everything that
+// reads them sees the rewrite: expandPartialJSON expands partial JSON
+// updates and decodeCharsets decodes strings from their character sets.
+// Output versions that predate a rewrite turn it off to keep their layout,
+// as does roundtrip, which re-encodes the values as go-mysql decoded them.
+var (
+	expandJSONDiffs = true
+	decodeStrings   = true
+)
+
+// setValueRewrites turns the row value rewrites on or off for version of
+// the text or json output mode.
+func setValueRewrites(mode string, version int) {
+	if mode == "json" {
+		expandJSONDiffs = version >= jsonFormatV2
+		decodeStrings = version >= jsonFormatV2
+		return
+	}
+	expandJSONDiffs = version >= textOutputV11
+	decodeStrings = version >= textOutputV12
+}
+
+// resolveOutputVersion maps the -outputVersion flag onto a concrete version
+// for a mode whose newest version is latest. 0 selects the latest.
+func resolveOutputVersion(requested int, mode string, latest int) (int, error) {
+	if requested == 0 {
+		return latest, nil
+	}
+	if requested < 1 || requested > latest {
+		return 0, fmt.Errorf("unsupported -outputVersion %d for %s output (1-%d)", requested, mode, latest)
+	}
+	return requested, nil
+}
+
+// textShowsEvent reports whether the given text output version outputs e.
+// Before version 5 the events of a compressed transaction payload are part
+// of the payload's output.
+func textShowsEvent(e *replication.BinlogEvent, version int) bool {
+	return version >= textOutputV5 || !inPayload(e.Header)
+}
+
+// appendTextEvent appends e to b in the given text output version.
+func appendTextEvent(b []byte, e *replication.BinlogEvent, version int) []byte {
+	if version == textOutputV1 {
+		buf := bytes.NewBuffer(b)
+		e.Dump(buf)
+		return buf.Bytes()
+	}
+	if version >= textOutputV3 {
+		switch e.Header.EventType {
+		case replication.STOP_EVENT, replication.HEARTBEAT_EVENT, replication.HEARTBEAT_LOG_EVENT_V2:
+			return appendServerEvent(b, e)
+		}
+	}
+	switch e.Event.(type) {
+	case *replication.BeginLoadQueryEvent, *appendBlockEvent, *loadQueryEvent:
+		if version >= textOutputV6 {
+			return appendLoadDataEvent(b, e)
+		}
+	}
+	if ev, ok := e.Event.(*appendBlockEvent); ok && version >= textOutputV4 {
+		return appendPassthroughEvent(b, e, ev.GenericEvent)
+	}
+	if ev, ok := e.Event.(*replication.GenericEvent); ok && version >= textOutputV4 {
+		return appendPassthroughEvent(b, e, ev)
+	}
+	if ev, ok := e.Event.(*replication.TransactionPayloadEvent); ok && version >= textOutputV5 {
+		return appendPayloadEvent(b, e, ev)
+	}
+	if ev, ok := e.Event.(*replication.RowsEvent); ok && version >= textOutputV8 {
+		return appendNamedRowsEvent(b, e, ev, version)
+	}
+	if ev, ok := e.Event.(*replication.TableMapEvent); ok && version >= textOutputV9 {
+		return appendTableMapEvent(b, e, ev)
+	}
+	return appendEvent(b, e)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// parallelWorkerCounts are the replica_parallel_workers settings the
+// parallel report simulates.
+var parallelWorkerCounts = []int{1, 2, 4, 8, 16, 32, 64}
+
+// parallelReport analyses the logical clock (last_committed and
+// sequence_number) of GTID events to show how much a replica using
+// replica_parallel_type=LOGICAL_CLOCK could apply in parallel.
+//
+// Transactions sharing a last_committed value were prepared together on the
+// source and form a commit group. The speedup estimate replays the
+// transactions through a simulated multi-threaded applier: a transaction is
+// dispatched in binlog order once every transaction with a sequence number
+// up to its last_committed has finished, and its cost is its size in bytes.
+type parallelReport struct {
+	tx  txTracker
+	txs []transaction
+}
+
+func newParallelReport() *parallelReport {
+	return &parallelReport{}
+}
+
+func (r *parallelReport) observe(e *replication.BinlogEvent) {
+	if t := r.tx.observe(e); t != nil && t.SequenceNumber > 0 {
+		r.txs = append(r.txs, *t)
+	}
+}
+
+// commitGroups returns the sizes of runs of consecutive transactions with
+// the same last_committed.
+func (r *parallelReport) commitGroups() []int {
+	var groups []int
+	for i, t := range r.txs {
+		if i > 0 && t.LastCommitted == r.txs[i-1].LastCommitted {
+			groups[len(groups)-1]++
+		} else {
+			groups = append(groups, 1)
+		}
+	}
+	return groups
+}
+
+// simulate returns the time, in bytes applied, a replica with the given
+// number of workers needs to apply r.txs.
+func (r *parallelReport) simulate(workers int) uint64 {
+	free := make([]uint64, workers)
+	// done[i] is the latest finish time among r.txs[:i+1]; sequence numbers
+	// increase through a binlog file, so dependencies are always a prefix.
+	done := make([]uint64, len(r.txs))
+	var dispatched, makespan uint64
+	for i, t := range r.txs {
+		ready := dispatched
+		if dep := sort.Search(i, func(j int) bool { return r.txs[j].SequenceNumber > t.LastCommitted }); dep > 0 && done[dep-1] > ready {
+			ready = done[dep-1]
+		}
+		w := 0
+		for j := range free {
+			if free[j] < free[w] {
+				w = j
+			}
+		}
+		if free[w] > ready {
+			ready = free[w]
+		}
+		finish := ready + uint64(t.End-t.Start)
+		free[w] = finish
+		dispatched = ready
+		done[i] = finish
+		if i > 0 && done[i-1] > done[i] {
+			done[i] = done[i-1]
+		}
+		if finish > makespan {
+			makespan = finish
+		}
+	}
+	return makespan
+}
+
+func (r *parallelReport) report(w io.Writer) {
+	fmt.Fprintln(w, "=== Parallel replication ===")
+	if len(r.txs) == 0 {
+		fmt.Fprintln(w, "No transactions with logical clock information (needs MySQL 5.7+ GTID or anonymous GTID events)")
+		fmt.Fprintln(w)
+		return
+	}
+
+	groups := r.commitGroups()
+	largest := 0
+	buckets := []struct {
+		label string
+		max   int
+		n     int
+	}{{"1", 1, 0}, {"2-4", 4, 0}, {"5-8", 8, 0}, {"9-16", 16, 0}, {"17-64", 64, 0}, {"65+", int(^uint(0) >> 1), 0}}
+	for _, g := range groups {
+		if g > largest {
+			largest = g
+		}
+		for i := range buckets {
+			if g <= buckets[i].max {
+				buckets[i].n++
+				break
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "Transactions: %d\n", len(r.txs))
+	fmt.Fprintf(w, "Commit groups: %d\n", len(groups))
+	fmt.Fprintf(w, "Average group size: %.2f\n", float64(len(r.txs))/float64(len(groups)))
+	fmt.Fprintf(w, "Largest group: %d\n", largest)
+	fmt.Fprintln(w, "Group size distribution:")
+	for _, b := range buckets {
+		fmt.Fprintf(w, "  %-6s %d\n", b.label, b.n)
+	}
+
+	fmt.Fprintln(w, "Theoretical apply speedup (LOGICAL_CLOCK, cost = transaction bytes):")
+	serial := r.simulate(1)
+	for _, n := range parallelWorkerCounts {
+		speedup := 1.0
+		if makespan := r.simulate(n); makespan > 0 {
+			speedup = float64(serial) / float64(makespan)
+		}
+		fmt.Fprintf(w, "  %2d workers: %.2fx\n", n, speedup)
+	}
+	fmt.Fprintln(w)
+}
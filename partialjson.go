@@ -0,0 +1,735 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// warnPartialJSON is a partial JSON update whose diffs could not be read
+// back from the event, leaving go-mysql's decoding of it.
+var warnPartialJSON = &warningCategory{
+	name: "partial JSON updates not expanded",
+	hint: "go-parse could not read their JSON diffs; only the first change of each is shown.",
+}
+
+// partialJSON is the after image value of a JSON column updated in place
+// with binlog_row_value_options=PARTIAL_JSON: the changes the update made
+// to the document rather than the document. go-mysql keeps only the first
+// change of each update; expandPartialJSON reads them all.
+type partialJSON struct {
+	// column is the quoted name of the column, or @N.
+	column string
+	diffs  []replication.JsonDiff
+	// doc is the document after the update, when the before image has
+	// the document the diffs apply to.
+	doc string
+}
+
+// String returns the document after the update when it is known, else the
+// update as a SQL expression of the column.
+func (p *partialJSON) String() string {
+	if p.doc != "" {
+		return p.doc
+	}
+	return p.expression()
+}
+
+// expression returns the diffs as the JSON functions that make them, in
+// order: JSON_REPLACE, JSON_INSERT for an object member, JSON_ARRAY_INSERT
+// for an array element and JSON_REMOVE, consecutive diffs of the same
+// function sharing a call.
+func (p *partialJSON) expression() string {
+	expr := p.column
+	for i := 0; i < len(p.diffs); {
+		fn := jsonDiffFunction(p.diffs[i])
+		b := append([]byte(fn+"("), expr...)
+		for ; i < len(p.diffs) && jsonDiffFunction(p.diffs[i]) == fn; i++ {
+			b = append(b, ", "...)
+			b = appendSQLString(b, p.diffs[i].Path)
+			if p.diffs[i].Op != replication.JsonDiffOperationRemove {
+				b = append(b, ", CAST("...)
+				b = appendSQLString(b, p.diffs[i].Value)
+				b = append(b, " AS JSON)"...)
+			}
+		}
+		expr = string(append(b, ')'))
+	}
+	return expr
+}
+
+func jsonDiffFunction(d replication.JsonDiff) string {
+	switch d.Op {
+	case replication.JsonDiffOperationInsert:
+		if strings.HasSuffix(d.Path, "]") {
+			return "JSON_ARRAY_INSERT"
+		}
+		return "JSON_INSERT"
+	case replication.JsonDiffOperationRemove:
+		return "JSON_REMOVE"
+	}
+	return "JSON_REPLACE"
+}
+
+// describe is the text output of a partial update: the document after it,
+// followed by the update, or the update alone.
+func (p *partialJSON) describe() string {
+	if p.doc == "" {
+		return p.expression()
+	}
+	return p.doc + "  (partial: " + p.expression() + ")"
+}
+
+// expandPartialJSON replaces the partial JSON values go-mysql decoded in a
+// PARTIAL_UPDATE_ROWS_EVENT, each holding only the first diff of its
+// update, with a partialJSON of all of them, read again from the event.
+// Output versions that predate it turn it off (see setValueRewrites).
+func expandPartialJSON(e *replication.BinlogEvent) {
+	re, ok := e.Event.(*replication.RowsEvent)
+	if !ok || !expandJSONDiffs || e.Header.EventType != replication.PARTIAL_UPDATE_ROWS_EVENT || re.Table == nil {
+		return
+	}
+	diffs, err := partialJSONDiffs(re, e.RawData)
+	if err != nil {
+		pos := e.Header.LogPos
+		if pos >= e.Header.EventSize {
+			pos -= e.Header.EventSize
+		}
+		runWarnings.note(warnPartialJSON, pos, err.Error())
+		return
+	}
+	names := columnNames(re.Table)
+	for at, d := range diffs {
+		r, i := at[0], at[1]
+		p := &partialJSON{column: "@" + strconv.Itoa(i+1), diffs: d}
+		if i < len(names) {
+			p.column = quoteIdent(names[i])
+		}
+		if before, ok := markAbsent(re, r-1)[i].(string); ok {
+			p.doc, _ = applyJSONDiffs(before, d)
+		}
+		re.Rows[r][i] = p
+	}
+}
+
+// partialJSONDiffs reads the diffs of the partial JSON values in the rows of
+// re from data, the event with its header, by row and column index.
+func partialJSONDiffs(re *replication.RowsEvent, data []byte) (map[[2]int][]replication.JsonDiff, error) {
+	short := errors.New("event too short")
+	pos := replication.EventHeaderSize + 6 + 2 // table id and flags
+	if pos+2 > len(data) {
+		return nil, short
+	}
+	pos += int(binary.LittleEndian.Uint16(data[pos:])) // extra data, its length included
+	n, size, ok := lengthEncodedInt(data, pos)
+	if !ok || n != re.ColumnCount {
+		return nil, fmt.Errorf("column count does not match the table map")
+	}
+	pos += size
+	bitmapSize := int(n+7) / 8
+	if pos+2*bitmapSize > len(data) {
+		return nil, short
+	}
+	bitmaps := [2][]byte{data[pos : pos+bitmapSize], data[pos+bitmapSize : pos+2*bitmapSize]}
+	pos += 2 * bitmapSize
+
+	t := re.Table
+	diffs := make(map[[2]int][]replication.JsonDiff)
+	for r := range re.Rows {
+		bitmap := bitmaps[r%2]
+		var partial []byte
+		if r%2 == 1 {
+			options, size, ok := lengthEncodedInt(data, pos)
+			if !ok {
+				return nil, short
+			}
+			pos += size
+			if options&1 != 0 {
+				size := (t.JsonColumnCount() + 7) / 8
+				if pos+int(size) > len(data) {
+					return nil, short
+				}
+				partial = data[pos : pos+int(size)]
+				pos += int(size)
+			}
+		}
+		present := 0
+		for i := 0; i < int(n); i++ {
+			if bitSet(bitmap, i) {
+				present++
+			}
+		}
+		if pos+(present+7)/8 > len(data) {
+			return nil, short
+		}
+		nulls := data[pos : pos+(present+7)/8]
+		pos += (present + 7) / 8
+		// The partial bitmap has a bit for every JSON column, present or
+		// not.
+		jsonColumn, column := 0, 0
+		for i := 0; i < int(n); i++ {
+			isPartial := false
+			if t.ColumnType[i] == mysql.MYSQL_TYPE_JSON {
+				isPartial = bitSet(partial, jsonColumn)
+				jsonColumn++
+			}
+			if !bitSet(bitmap, i) {
+				continue
+			}
+			column++
+			if bitSet(nulls, column-1) {
+				continue
+			}
+			size, err := rawColumnSize(t.ColumnType[i], t.ColumnMeta[i], data[pos:])
+			if err != nil {
+				return nil, fmt.Errorf("column %d: %v", i+1, err)
+			}
+			if isPartial {
+				meta := int(t.ColumnMeta[i])
+				d, err := decodeJSONDiffs(data[pos+meta : pos+size])
+				if err != nil {
+					return nil, fmt.Errorf("column %d: %v", i+1, err)
+				}
+				diffs[[2]int{r, i}] = d
+			}
+			pos += size
+		}
+	}
+	return diffs, nil
+}
+
+func bitSet(bitmap []byte, i int) bool {
+	return i/8 < len(bitmap) && bitmap[i/8]&(1<<(i%8)) != 0
+}
+
+// rawColumnSize returns the bytes a value of a column of type typ with
+// metadata meta takes at the start of data, as go-mysql decodes it.
+func rawColumnSize(typ byte, meta uint16, data []byte) (int, error) {
+	prefixed := func(prefix int) (int, error) {
+		if prefix < 1 || prefix > 4 || len(data) < prefix {
+			return 0, errors.New("value too short")
+		}
+		var n int
+		for i := prefix - 1; i >= 0; i-- {
+			n = n<<8 | int(data[i])
+		}
+		return prefix + n, nil
+	}
+	size := 0
+	switch typ {
+	case mysql.MYSQL_TYPE_TINY, mysql.MYSQL_TYPE_YEAR:
+		size = 1
+	case mysql.MYSQL_TYPE_SHORT:
+		size = 2
+	case mysql.MYSQL_TYPE_INT24, mysql.MYSQL_TYPE_DATE, mysql.MYSQL_TYPE_TIME:
+		size = 3
+	case mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_FLOAT, mysql.MYSQL_TYPE_TIMESTAMP:
+		size = 4
+	case mysql.MYSQL_TYPE_LONGLONG, mysql.MYSQL_TYPE_DOUBLE, mysql.MYSQL_TYPE_DATETIME:
+		size = 8
+	case mysql.MYSQL_TYPE_TIME2:
+		size = 3 + int(meta+1)/2
+	case mysql.MYSQL_TYPE_DATETIME2:
+		size = 5 + int(meta+1)/2
+	case mysql.MYSQL_TYPE_TIMESTAMP2:
+		size = 4 + int(meta+1)/2
+	case mysql.MYSQL_TYPE_NEWDECIMAL:
+		size = decimalBytes(int(meta>>8), int(meta&0xff))
+	case mysql.MYSQL_TYPE_BIT:
+		size = (int(meta>>8)*8 + int(meta&0xff) + 7) / 8
+	case mysql.MYSQL_TYPE_ENUM, mysql.MYSQL_TYPE_SET:
+		size = int(meta & 0xff)
+	case mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_VAR_STRING:
+		if meta < 256 {
+			return prefixed(1)
+		}
+		return prefixed(2)
+	case mysql.MYSQL_TYPE_STRING:
+		length := int(meta)
+		if meta >= 256 {
+			real := byte(meta >> 8)
+			switch {
+			case real == mysql.MYSQL_TYPE_ENUM || real == mysql.MYSQL_TYPE_SET:
+				size = int(meta & 0xff)
+			case real&0x30 != 0x30:
+				length = int(meta&0xff) | int((real&0x30)^0x30)<<4
+			default:
+				length = int(meta & 0xff)
+			}
+		}
+		if size > 0 {
+			break
+		}
+		if length < 256 {
+			return prefixed(1)
+		}
+		return prefixed(2)
+	case mysql.MYSQL_TYPE_BLOB, mysql.MYSQL_TYPE_JSON, mysql.MYSQL_TYPE_GEOMETRY:
+		return prefixed(int(meta))
+	default:
+		return 0, fmt.Errorf("unknown column type %d", typ)
+	}
+	if size > len(data) {
+		return 0, errors.New("value too short")
+	}
+	return size, nil
+}
+
+// decodeJSONDiffs reads a partial JSON value: a list of diffs, each an
+// operation, a path and, but for a removal, a binary JSON value.
+func decodeJSONDiffs(data []byte) ([]replication.JsonDiff, error) {
+	var diffs []replication.JsonDiff
+	for pos := 0; pos < len(data); {
+		d := replication.JsonDiff{Op: replication.JsonDiffOperation(data[pos])}
+		if d.Op > replication.JsonDiffOperationRemove {
+			return nil, fmt.Errorf("unknown JSON diff operation %d", data[pos])
+		}
+		pos++
+		n, size, ok := lengthEncodedInt(data, pos)
+		if !ok || pos+size+int(n) > len(data) {
+			return nil, errors.New("JSON diff too short")
+		}
+		d.Path = string(data[pos+size : pos+size+int(n)])
+		pos += size + int(n)
+		if d.Op != replication.JsonDiffOperationRemove {
+			n, size, ok := lengthEncodedInt(data, pos)
+			if !ok || n == 0 || pos+size+int(n) > len(data) {
+				return nil, errors.New("JSON diff too short")
+			}
+			value := data[pos+size : pos+size+int(n)]
+			pos += size + int(n)
+			v, err := decodeBinaryJSON(value[0], value[1:])
+			if err != nil {
+				return nil, fmt.Errorf("JSON diff of %s: %v", d.Path, err)
+			}
+			text, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			d.Value = string(text)
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs, nil
+}
+
+// The types of MySQL's binary JSON format.
+const (
+	jsonbSmallObject = 0x00
+	jsonbLargeObject = 0x01
+	jsonbSmallArray  = 0x02
+	jsonbLargeArray  = 0x03
+	jsonbLiteral     = 0x04
+	jsonbInt16       = 0x05
+	jsonbUint16      = 0x06
+	jsonbInt32       = 0x07
+	jsonbUint32      = 0x08
+	jsonbInt64       = 0x09
+	jsonbUint64      = 0x0a
+	jsonbDouble      = 0x0b
+	jsonbString      = 0x0c
+	jsonbOpaque      = 0x0f
+)
+
+var errShortJSON = errors.New("binary JSON too short")
+
+// decodeBinaryJSON decodes a binary JSON value of type typ into the values
+// encoding/json marshals, as go-mysql decodes whole documents.
+func decodeBinaryJSON(typ byte, data []byte) (interface{}, error) {
+	fixed := func(n int) ([]byte, error) {
+		if len(data) < n {
+			return nil, errShortJSON
+		}
+		return data[:n], nil
+	}
+	switch typ {
+	case jsonbSmallObject, jsonbLargeObject, jsonbSmallArray, jsonbLargeArray:
+		return decodeBinaryJSONContainer(data, typ == jsonbSmallObject || typ == jsonbSmallArray,
+			typ == jsonbSmallObject || typ == jsonbLargeObject)
+	case jsonbLiteral:
+		b, err := fixed(1)
+		if err != nil {
+			return nil, err
+		}
+		switch b[0] {
+		case 0x00:
+			return nil, nil
+		case 0x01:
+			return true, nil
+		case 0x02:
+			return false, nil
+		}
+		return nil, fmt.Errorf("invalid JSON literal %d", b[0])
+	case jsonbInt16, jsonbUint16:
+		b, err := fixed(2)
+		if err != nil {
+			return nil, err
+		}
+		if typ == jsonbInt16 {
+			return int16(binary.LittleEndian.Uint16(b)), nil
+		}
+		return binary.LittleEndian.Uint16(b), nil
+	case jsonbInt32, jsonbUint32:
+		b, err := fixed(4)
+		if err != nil {
+			return nil, err
+		}
+		if typ == jsonbInt32 {
+			return int32(binary.LittleEndian.Uint32(b)), nil
+		}
+		return binary.LittleEndian.Uint32(b), nil
+	case jsonbInt64, jsonbUint64, jsonbDouble:
+		b, err := fixed(8)
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case jsonbInt64:
+			return int64(binary.LittleEndian.Uint64(b)), nil
+		case jsonbUint64:
+			return binary.LittleEndian.Uint64(b), nil
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+	case jsonbString:
+		s, _, err := variableLengthBytes(data)
+		return string(s), err
+	case jsonbOpaque:
+		if len(data) < 1 {
+			return nil, errShortJSON
+		}
+		v, _, err := variableLengthBytes(data[1:])
+		if err != nil {
+			return nil, err
+		}
+		return decodeJSONOpaque(data[0], v)
+	}
+	return nil, fmt.Errorf("invalid JSON type %d", typ)
+}
+
+func decodeBinaryJSONContainer(data []byte, small, object bool) (interface{}, error) {
+	size := 4
+	if small {
+		size = 2
+	}
+	offset := func(at int) int {
+		if small {
+			return int(binary.LittleEndian.Uint16(data[at:]))
+		}
+		return int(binary.LittleEndian.Uint32(data[at:]))
+	}
+	if len(data) < 2*size {
+		return nil, errShortJSON
+	}
+	count, total := offset(0), offset(size)
+	valueEntries := 2 * size
+	if object {
+		valueEntries += count * (size + 2)
+	}
+	if total > len(data) || valueEntries+count*(1+size) > total {
+		return nil, errShortJSON
+	}
+	data = data[:total]
+	values := make([]interface{}, count)
+	for i := range values {
+		entry := valueEntries + i*(1+size)
+		typ := data[entry]
+		var err error
+		switch {
+		case typ == jsonbLiteral || typ == jsonbInt16 || typ == jsonbUint16 ||
+			!small && (typ == jsonbInt32 || typ == jsonbUint32):
+			values[i], err = decodeBinaryJSON(typ, data[entry+1:entry+1+size])
+		case offset(entry+1) >= len(data):
+			return nil, errShortJSON
+		default:
+			values[i], err = decodeBinaryJSON(typ, data[offset(entry+1):])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !object {
+		return values, nil
+	}
+	m := make(map[string]interface{}, count)
+	for i, v := range values {
+		entry := 2*size + i*(size+2)
+		at, n := offset(entry), int(binary.LittleEndian.Uint16(data[entry+size:]))
+		if at+n > len(data) {
+			return nil, errShortJSON
+		}
+		m[string(data[at:at+n])] = v
+	}
+	return m, nil
+}
+
+// variableLengthBytes reads the bytes led by their length in binary JSON's
+// variable-length format: seven bits a byte, low bits first.
+func variableLengthBytes(data []byte) ([]byte, int, error) {
+	n := 0
+	for i := 0; i < len(data) && i < 5; i++ {
+		n |= int(data[i]&0x7f) << (7 * i)
+		if data[i]&0x80 == 0 {
+			if i+1+n > len(data) {
+				return nil, 0, errShortJSON
+			}
+			return data[i+1 : i+1+n], i + 1 + n, nil
+		}
+	}
+	return nil, 0, errShortJSON
+}
+
+// decodeJSONOpaque decodes a MySQL value of type typ stored in a JSON
+// document: a DECIMAL as a number, a TIME, DATE or DATETIME as go-mysql
+// formats them, and anything else as its bytes.
+func decodeJSONOpaque(typ byte, data []byte) (interface{}, error) {
+	switch typ {
+	case mysql.MYSQL_TYPE_NEWDECIMAL:
+		if len(data) < 2 {
+			return nil, errShortJSON
+		}
+		s, err := binaryDecimal(data[2:], int(data[0]), int(data[1]))
+		return json.Number(s), err
+	case mysql.MYSQL_TYPE_TIME, mysql.MYSQL_TYPE_DATE, mysql.MYSQL_TYPE_DATETIME, mysql.MYSQL_TYPE_TIMESTAMP:
+		if len(data) < 8 {
+			return nil, errShortJSON
+		}
+		v := int64(binary.LittleEndian.Uint64(data))
+		sign := ""
+		if v < 0 {
+			sign, v = "-", -v
+		}
+		whole, frac := v>>24, v%(1<<24)
+		if typ == mysql.MYSQL_TYPE_TIME {
+			if v == 0 {
+				return "00:00:00", nil
+			}
+			return fmt.Sprintf("%s%02d:%02d:%02d.%06d", sign, (whole>>12)%(1<<10), (whole>>6)%(1<<6), whole%(1<<6), frac), nil
+		}
+		if v == 0 {
+			return "0000-00-00 00:00:00", nil
+		}
+		ymd, hms := whole>>17, whole%(1<<17)
+		return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d.%06d", (ymd>>5)/13, (ymd>>5)%13, ymd%(1<<5),
+			hms>>12, (hms>>6)%(1<<6), hms%(1<<6), frac), nil
+	}
+	return string(data), nil
+}
+
+// binaryDecimal decodes a DECIMAL(precision, scale) in MySQL's binary
+// format: the digits in groups of nine to four bytes, big-endian, the
+// integer part's shorter group first and the fraction's last, with the top
+// bit flipped and, for a negative number, all bits inverted.
+func binaryDecimal(data []byte, precision, scale int) (string, error) {
+	if decimalBytes(precision, scale) > len(data) || precision < scale {
+		return "", errShortJSON
+	}
+	data = append([]byte(nil), data[:decimalBytes(precision, scale)]...)
+	negative := data[0]&0x80 == 0
+	data[0] ^= 0x80
+	if negative {
+		for i := range data {
+			data[i] = ^data[i]
+		}
+	}
+	groupBytes := [9]int{0, 1, 1, 2, 2, 3, 3, 4, 4}
+	group := func(n int) int64 {
+		var v int64
+		for _, c := range data[:n] {
+			v = v<<8 | int64(c)
+		}
+		data = data[n:]
+		return v
+	}
+	var b strings.Builder
+	if negative {
+		b.WriteByte('-')
+	}
+	integer := precision - scale
+	var digits strings.Builder
+	if lead := integer % 9; lead > 0 {
+		fmt.Fprintf(&digits, "%d", group(groupBytes[lead]))
+	}
+	for i := 0; i < integer/9; i++ {
+		fmt.Fprintf(&digits, "%09d", group(4))
+	}
+	s := strings.TrimLeft(digits.String(), "0")
+	if s == "" {
+		s = "0"
+	}
+	b.WriteString(s)
+	if scale > 0 {
+		b.WriteByte('.')
+		for i := 0; i < scale/9; i++ {
+			fmt.Fprintf(&b, "%09d", group(4))
+		}
+		if tail := scale % 9; tail > 0 {
+			fmt.Fprintf(&b, "%0*d", tail, group(groupBytes[tail]))
+		}
+	}
+	return b.String(), nil
+}
+
+// applyJSONDiffs applies diffs to the JSON document doc, returning the
+// document after them.
+func applyJSONDiffs(doc string, diffs []replication.JsonDiff) (string, error) {
+	root, err := parseJSONNumbers(doc)
+	if err != nil {
+		return "", err
+	}
+	for _, d := range diffs {
+		path, err := parseJSONPath(d.Path)
+		if err != nil {
+			return "", err
+		}
+		var value interface{}
+		if d.Op != replication.JsonDiffOperationRemove {
+			if value, err = parseJSONNumbers(d.Value); err != nil {
+				return "", err
+			}
+		}
+		if root, err = applyJSONDiff(root, path, d.Op, value); err != nil {
+			return "", fmt.Errorf("%s: %v", d.Path, err)
+		}
+	}
+	text, err := json.Marshal(root)
+	return string(text), err
+}
+
+// parseJSONNumbers parses JSON text keeping its numbers as written.
+func parseJSONNumbers(text string) (interface{}, error) {
+	d := json.NewDecoder(strings.NewReader(text))
+	d.UseNumber()
+	var v interface{}
+	err := d.Decode(&v)
+	return v, err
+}
+
+// applyJSONDiff applies one diff at path below v, returning v changed.
+func applyJSONDiff(v interface{}, path []interface{}, op replication.JsonDiffOperation, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		if op != replication.JsonDiffOperationReplace {
+			return nil, errors.New("cannot insert or remove the document")
+		}
+		return value, nil
+	}
+	switch leg := path[0].(type) {
+	case string:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("not an object")
+		}
+		child, exists := m[leg]
+		if len(path) > 1 {
+			if !exists {
+				return nil, errors.New("no such member")
+			}
+			changed, err := applyJSONDiff(child, path[1:], op, value)
+			m[leg] = changed
+			return m, err
+		}
+		switch op {
+		case replication.JsonDiffOperationRemove:
+			delete(m, leg)
+		case replication.JsonDiffOperationInsert:
+			if !exists {
+				m[leg] = value
+			}
+		default:
+			if !exists {
+				return nil, errors.New("no such member")
+			}
+			m[leg] = value
+		}
+		return m, nil
+	case int:
+		a, ok := v.([]interface{})
+		if !ok {
+			return nil, errors.New("not an array")
+		}
+		if len(path) > 1 || op != replication.JsonDiffOperationInsert {
+			if leg >= len(a) {
+				return nil, errors.New("no such element")
+			}
+		}
+		if len(path) > 1 {
+			changed, err := applyJSONDiff(a[leg], path[1:], op, value)
+			a[leg] = changed
+			return a, err
+		}
+		switch op {
+		case replication.JsonDiffOperationRemove:
+			return append(a[:leg], a[leg+1:]...), nil
+		case replication.JsonDiffOperationInsert:
+			leg = min(leg, len(a))
+			return append(a[:leg], append([]interface{}{value}, a[leg:]...)...), nil
+		}
+		a[leg] = value
+		return a, nil
+	}
+	return nil, errors.New("invalid path")
+}
+
+// parseJSONPath parses a JSON path of the form MySQL logs in a diff, $
+// followed by .member, ."quoted member" and [index] legs, into member names
+// and indexes.
+func parseJSONPath(path string) ([]interface{}, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("invalid JSON path %q", path)
+	}
+	var legs []interface{}
+	for s := path[1:]; s != ""; {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			if strings.HasPrefix(s, `"`) {
+				end := 1
+				for end < len(s) && s[end] != '"' {
+					if s[end] == '\\' {
+						end++
+					}
+					end++
+				}
+				if end >= len(s) {
+					return nil, fmt.Errorf("invalid JSON path %q", path)
+				}
+				name, err := strconv.Unquote(s[:end+1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid JSON path %q", path)
+				}
+				legs = append(legs, name)
+				s = s[end+1:]
+				continue
+			}
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid JSON path %q", path)
+			}
+			legs = append(legs, s[:end])
+			s = s[end:]
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid JSON path %q", path)
+			}
+			i, err := strconv.Atoi(strings.TrimSpace(s[1:end]))
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("invalid JSON path %q", path)
+			}
+			legs = append(legs, i)
+			s = s[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid JSON path %q", path)
+		}
+	}
+	return legs, nil
+}
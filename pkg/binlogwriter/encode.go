@@ -0,0 +1,724 @@
+package binlogwriter
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/google/uuid"
+)
+
+// ErrNotEncodable is returned (wrapped) by EncodeEvent for events and values
+// it has no encoder for.
+var ErrNotEncodable = errors.New("not encodable")
+
+// EncodeEvent re-encodes an event decoded by go-mysql into its binlog
+// representation, including the header and, when the format uses them, the
+// CRC32 checksum. format is the FORMAT_DESCRIPTION event in effect and is
+// ignored when e is itself the FORMAT_DESCRIPTION event.
+//
+// Rows events must have been decoded with parseTime and useDecimal off (the
+// go-mysql defaults), which keeps temporal and decimal values as strings.
+func EncodeEvent(e *replication.BinlogEvent, format *replication.FormatDescriptionEvent) ([]byte, error) {
+	if fde, ok := e.Event.(*replication.FormatDescriptionEvent); ok {
+		format = fde
+	}
+	if format == nil {
+		return nil, fmt.Errorf("%s before any FormatDescriptionEvent", e.Header.EventType)
+	}
+
+	body, err := encodeBody(e, format)
+	if err != nil {
+		return nil, err
+	}
+
+	checksum := format.ChecksumAlgorithm == replication.BINLOG_CHECKSUM_ALG_CRC32
+	if e.Header.EventType == replication.FORMAT_DESCRIPTION_EVENT {
+		checksum = format.ChecksumAlgorithm != replication.BINLOG_CHECKSUM_ALG_UNDEF
+	}
+	h := e.Header
+	return appendEvent(nil, h.Timestamp, h.EventType, h.ServerID, h.LogPos, h.Flags, body, checksum), nil
+}
+
+// appendEvent appends body framed with an event header and, optionally, a
+// CRC32 checksum to b.
+func appendEvent(b []byte, ts uint32, typ replication.EventType, serverID, logPos uint32, flags uint16, body []byte, checksum bool) []byte {
+	size := uint32(replication.EventHeaderSize + len(body))
+	if checksum {
+		size += replication.BinlogChecksumLength
+	}
+	start := len(b)
+	b = binary.LittleEndian.AppendUint32(b, ts)
+	b = append(b, byte(typ))
+	b = binary.LittleEndian.AppendUint32(b, serverID)
+	b = binary.LittleEndian.AppendUint32(b, size)
+	b = binary.LittleEndian.AppendUint32(b, logPos)
+	b = binary.LittleEndian.AppendUint16(b, flags)
+	b = append(b, body...)
+	if checksum {
+		b = binary.LittleEndian.AppendUint32(b, crc32.ChecksumIEEE(b[start:]))
+	}
+	return b
+}
+
+func encodeBody(e *replication.BinlogEvent, format *replication.FormatDescriptionEvent) ([]byte, error) {
+	switch ev := e.Event.(type) {
+	case *replication.FormatDescriptionEvent:
+		b := binary.LittleEndian.AppendUint16(nil, ev.Version)
+		sv := make([]byte, 50)
+		copy(sv, ev.ServerVersion)
+		b = append(b, sv...)
+		b = binary.LittleEndian.AppendUint32(b, ev.CreateTimestamp)
+		b = append(b, ev.EventHeaderLength)
+		b = append(b, ev.EventTypeHeaderLengths...)
+		if ev.ChecksumAlgorithm != replication.BINLOG_CHECKSUM_ALG_UNDEF {
+			b = append(b, ev.ChecksumAlgorithm)
+		}
+		return b, nil
+	case *replication.PreviousGTIDsEvent:
+		return encodePreviousGTIDs(ev.GTIDSets)
+	case *replication.GTIDEvent:
+		return encodeGTID(ev), nil
+	case *replication.QueryEvent:
+		b := binary.LittleEndian.AppendUint32(nil, ev.SlaveProxyID)
+		b = binary.LittleEndian.AppendUint32(b, ev.ExecutionTime)
+		b = append(b, byte(len(ev.Schema)))
+		b = binary.LittleEndian.AppendUint16(b, ev.ErrorCode)
+		b = binary.LittleEndian.AppendUint16(b, uint16(len(ev.StatusVars)))
+		b = append(b, ev.StatusVars...)
+		b = append(b, ev.Schema...)
+		b = append(b, 0)
+		return append(b, ev.Query...), nil
+	case *replication.RowsQueryEvent:
+		// The length byte is informational; long statements store 255.
+		return append([]byte{byte(min(len(ev.Query), 255))}, ev.Query...), nil
+	case *replication.XIDEvent:
+		return binary.LittleEndian.AppendUint64(nil, ev.XID), nil
+	case *replication.RotateEvent:
+		return append(binary.LittleEndian.AppendUint64(nil, ev.Position), ev.NextLogName...), nil
+	case *replication.TableMapEvent:
+		return encodeTableMap(ev, format)
+	case *replication.RowsEvent:
+		return encodeRows(e.Header.EventType, ev, format)
+	}
+	if e.Header.EventType == replication.STOP_EVENT {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotEncodable, e.Header.EventType)
+}
+
+// encodePreviousGTIDs encodes a GTID set string keeping the order of its
+// UUIDs and intervals as written.
+func encodePreviousGTIDs(set string) ([]byte, error) {
+	var sids []string
+	if set != "" {
+		sids = strings.Split(set, ",")
+	}
+	b := binary.LittleEndian.AppendUint64(nil, uint64(len(sids)))
+	for _, s := range sids {
+		parts := strings.Split(strings.TrimSpace(s), ":")
+		u, err := uuid.Parse(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("previous GTIDs %q: %v", set, err)
+		}
+		b = append(b, u[:]...)
+		b = binary.LittleEndian.AppendUint64(b, uint64(len(parts)-1))
+		for _, iv := range parts[1:] {
+			lo, hi, found := strings.Cut(iv, "-")
+			start, err := strconv.ParseUint(lo, 10, 64)
+			stop := start
+			if err == nil && found {
+				stop, err = strconv.ParseUint(hi, 10, 64)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("previous GTIDs %q: invalid interval %q", set, iv)
+			}
+			b = binary.LittleEndian.AppendUint64(b, start)
+			b = binary.LittleEndian.AppendUint64(b, stop+1)
+		}
+	}
+	return b, nil
+}
+
+func encodeGTID(ev *replication.GTIDEvent) []byte {
+	b := []byte{ev.CommitFlag}
+	b = append(b, ev.SID...)
+	b = binary.LittleEndian.AppendUint64(b, uint64(ev.GNO))
+	b = append(b, replication.LogicalTimestampTypeCode)
+	b = binary.LittleEndian.AppendUint64(b, uint64(ev.LastCommitted))
+	b = binary.LittleEndian.AppendUint64(b, uint64(ev.SequenceNumber))
+	if ev.ImmediateCommitTimestamp == 0 {
+		// MySQL 5.7 layout.
+		return b
+	}
+
+	immediate := ev.ImmediateCommitTimestamp
+	if ev.OriginalCommitTimestamp != ev.ImmediateCommitTimestamp {
+		immediate |= 1 << 55
+	}
+	b = appendUint56(b, immediate)
+	if ev.OriginalCommitTimestamp != ev.ImmediateCommitTimestamp {
+		b = appendUint56(b, ev.OriginalCommitTimestamp)
+	}
+	b = mysql.AppendLengthEncodedInteger(b, ev.TransactionLength)
+	if ev.ImmediateServerVersion == replication.UndefinedServerVer {
+		return b
+	}
+	server := ev.ImmediateServerVersion
+	if ev.OriginalServerVersion != ev.ImmediateServerVersion {
+		server |= 1 << 31
+	}
+	b = binary.LittleEndian.AppendUint32(b, server)
+	if ev.OriginalServerVersion != ev.ImmediateServerVersion {
+		b = binary.LittleEndian.AppendUint32(b, ev.OriginalServerVersion)
+	}
+	return b
+}
+
+func appendUint56(b []byte, v uint64) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24), byte(v>>32), byte(v>>40), byte(v>>48))
+}
+
+// tableIDSize mirrors go-mysql: table ids are 4 bytes when the event type's
+// post-header is 6 bytes long, and 6 bytes otherwise.
+func tableIDSize(format *replication.FormatDescriptionEvent, t replication.EventType) int {
+	if int(t) <= len(format.EventTypeHeaderLengths) && format.EventTypeHeaderLengths[t-1] == 6 {
+		return 4
+	}
+	return 6
+}
+
+func appendTableIDSize(b []byte, id uint64, size int) []byte {
+	for i := 0; i < size; i++ {
+		b = append(b, byte(id>>(8*i)))
+	}
+	return b
+}
+
+func encodeTableMap(ev *replication.TableMapEvent, format *replication.FormatDescriptionEvent) ([]byte, error) {
+	b := appendTableIDSize(nil, ev.TableID, tableIDSize(format, replication.TABLE_MAP_EVENT))
+	b = binary.LittleEndian.AppendUint16(b, ev.Flags)
+	b = append(b, byte(len(ev.Schema)))
+	b = append(b, ev.Schema...)
+	b = append(b, 0, byte(len(ev.Table)))
+	b = append(b, ev.Table...)
+	b = append(b, 0)
+	b = mysql.AppendLengthEncodedInteger(b, ev.ColumnCount)
+	b = append(b, ev.ColumnType...)
+
+	var meta []byte
+	for i, t := range ev.ColumnType {
+		m := ev.ColumnMeta[i]
+		switch t {
+		case mysql.MYSQL_TYPE_STRING, mysql.MYSQL_TYPE_NEWDECIMAL:
+			meta = append(meta, byte(m>>8), byte(m))
+		case mysql.MYSQL_TYPE_VAR_STRING, mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_BIT:
+			meta = binary.LittleEndian.AppendUint16(meta, m)
+		case mysql.MYSQL_TYPE_BLOB, mysql.MYSQL_TYPE_DOUBLE, mysql.MYSQL_TYPE_FLOAT, mysql.MYSQL_TYPE_GEOMETRY,
+			mysql.MYSQL_TYPE_JSON, mysql.MYSQL_TYPE_TIME2, mysql.MYSQL_TYPE_DATETIME2, mysql.MYSQL_TYPE_TIMESTAMP2:
+			meta = append(meta, byte(m))
+		}
+	}
+	b = mysql.AppendLengthEncodedInteger(b, uint64(len(meta)))
+	b = append(b, meta...)
+	b = append(b, ev.NullBitmap...)
+
+	tlv := func(t byte, v []byte) {
+		b = append(b, t)
+		b = mysql.AppendLengthEncodedInteger(b, uint64(len(v)))
+		b = append(b, v...)
+	}
+	if ev.SignednessBitmap != nil {
+		tlv(replication.TABLE_MAP_OPT_META_SIGNEDNESS, ev.SignednessBitmap)
+	}
+	if ev.DefaultCharset != nil {
+		tlv(replication.TABLE_MAP_OPT_META_DEFAULT_CHARSET, appendIntSeq(nil, ev.DefaultCharset))
+	}
+	if ev.ColumnCharset != nil {
+		tlv(replication.TABLE_MAP_OPT_META_COLUMN_CHARSET, appendIntSeq(nil, ev.ColumnCharset))
+	}
+	if ev.ColumnName != nil {
+		var v []byte
+		for _, name := range ev.ColumnName {
+			v = mysql.AppendLengthEncodedInteger(v, uint64(len(name)))
+			v = append(v, name...)
+		}
+		tlv(replication.TABLE_MAP_OPT_META_COLUMN_NAME, v)
+	}
+	if ev.SetStrValue != nil {
+		tlv(replication.TABLE_MAP_OPT_META_SET_STR_VALUE, appendStrValues(nil, ev.SetStrValue))
+	}
+	if ev.EnumStrValue != nil {
+		tlv(replication.TABLE_MAP_OPT_META_ENUM_STR_VALUE, appendStrValues(nil, ev.EnumStrValue))
+	}
+	if ev.GeometryType != nil {
+		tlv(replication.TABLE_MAP_OPT_META_GEOMETRY_TYPE, appendIntSeq(nil, ev.GeometryType))
+	}
+	if ev.PrimaryKey != nil {
+		prefixed := false
+		for _, p := range ev.PrimaryKeyPrefix {
+			prefixed = prefixed || p != 0
+		}
+		if prefixed {
+			var v []byte
+			for i, col := range ev.PrimaryKey {
+				v = mysql.AppendLengthEncodedInteger(v, col)
+				v = mysql.AppendLengthEncodedInteger(v, ev.PrimaryKeyPrefix[i])
+			}
+			tlv(replication.TABLE_MAP_OPT_META_PRIMARY_KEY_WITH_PREFIX, v)
+		} else {
+			tlv(replication.TABLE_MAP_OPT_META_SIMPLE_PRIMARY_KEY, appendIntSeq(nil, ev.PrimaryKey))
+		}
+	}
+	if ev.EnumSetDefaultCharset != nil {
+		tlv(replication.TABLE_MAP_OPT_META_ENUM_AND_SET_DEFAULT_CHARSET, appendIntSeq(nil, ev.EnumSetDefaultCharset))
+	}
+	if ev.EnumSetColumnCharset != nil {
+		tlv(replication.TABLE_MAP_OPT_META_ENUM_AND_SET_COLUMN_CHARSET, appendIntSeq(nil, ev.EnumSetColumnCharset))
+	}
+	if ev.VisibilityBitmap != nil {
+		tlv(replication.TABLE_MAP_OPT_META_COLUMN_VISIBILITY, ev.VisibilityBitmap)
+	}
+	return b, nil
+}
+
+func appendIntSeq(b []byte, seq []uint64) []byte {
+	for _, v := range seq {
+		b = mysql.AppendLengthEncodedInteger(b, v)
+	}
+	return b
+}
+
+func appendStrValues(b []byte, columns [][][]byte) []byte {
+	for _, values := range columns {
+		b = mysql.AppendLengthEncodedInteger(b, uint64(len(values)))
+		for _, v := range values {
+			b = mysql.AppendLengthEncodedInteger(b, uint64(len(v)))
+			b = append(b, v...)
+		}
+	}
+	return b
+}
+
+func encodeRows(t replication.EventType, ev *replication.RowsEvent, format *replication.FormatDescriptionEvent) ([]byte, error) {
+	if ev.Table == nil {
+		return nil, fmt.Errorf("%w: rows event without its TableMapEvent", ErrNotEncodable)
+	}
+	switch t {
+	case replication.WRITE_ROWS_EVENTv1, replication.UPDATE_ROWS_EVENTv1, replication.DELETE_ROWS_EVENTv1,
+		replication.WRITE_ROWS_EVENTv2, replication.UPDATE_ROWS_EVENTv2, replication.DELETE_ROWS_EVENTv2:
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrNotEncodable, t)
+	}
+
+	b := appendTableIDSize(nil, ev.TableID, tableIDSize(format, t))
+	b = binary.LittleEndian.AppendUint16(b, ev.Flags)
+	if ev.Version == 2 {
+		if ev.NdbData != nil {
+			b = binary.LittleEndian.AppendUint16(b, uint16(2+3+len(ev.NdbData)))
+			b = append(b, replication.ENUM_EXTRA_ROW_INFO_TYPECODE_NDB, byte(len(ev.NdbData)+2), ev.NdbFormat)
+			b = append(b, ev.NdbData...)
+		} else {
+			b = binary.LittleEndian.AppendUint16(b, 2)
+		}
+	}
+	b = mysql.AppendLengthEncodedInteger(b, ev.ColumnCount)
+	b = append(b, ev.ColumnBitmap1...)
+	update := t == replication.UPDATE_ROWS_EVENTv1 || t == replication.UPDATE_ROWS_EVENTv2
+	if update {
+		b = append(b, ev.ColumnBitmap2...)
+	}
+
+	for i, row := range ev.Rows {
+		bitmap := ev.ColumnBitmap1
+		if update && i%2 == 1 {
+			bitmap = ev.ColumnBitmap2
+		}
+		var err error
+		if b, err = appendImage(b, ev.Table, bitmap, row); err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+	}
+	return b, nil
+}
+
+// padNullBitmap sets the unused high bits of a row's NULL bitmap, as
+// MySQL does.
+func padNullBitmap(nulls []byte, columns int) []byte {
+	if columns%8 != 0 {
+		nulls[len(nulls)-1] |= 0xff << (columns % 8)
+	}
+	return nulls
+}
+
+func bitSet(bitmap []byte, i int) bool {
+	return bitmap[i/8]&(1<<(i%8)) != 0
+}
+
+// appendImage appends one row image: the NULL bitmap over the columns
+// present in bitmap, then the non-NULL values.
+func appendImage(b []byte, table *replication.TableMapEvent, bitmap []byte, row []interface{}) ([]byte, error) {
+	var present []int
+	for i := range row {
+		if bitSet(bitmap, i) {
+			present = append(present, i)
+		}
+	}
+	nulls := make([]byte, (len(present)+7)/8)
+	for j, i := range present {
+		if row[i] == nil {
+			nulls[j/8] |= 1 << (j % 8)
+		}
+	}
+	b = append(b, padNullBitmap(nulls, len(present))...)
+	for _, i := range present {
+		if row[i] == nil {
+			continue
+		}
+		var err error
+		if b, err = appendColumnValue(b, table.ColumnType[i], table.ColumnMeta[i], row[i]); err != nil {
+			return nil, fmt.Errorf("column %d: %w", i, err)
+		}
+	}
+	return b, nil
+}
+
+// appendColumnValue is the inverse of go-mysql's RowsEvent.decodeValue.
+func appendColumnValue(b []byte, tp byte, meta uint16, v interface{}) ([]byte, error) {
+	length := 0
+	if tp == mysql.MYSQL_TYPE_STRING {
+		if meta >= 256 {
+			b0, b1 := uint8(meta>>8), uint8(meta&0xff)
+			if b0&0x30 != 0x30 {
+				length = int(uint16(b1) | uint16((b0&0x30)^0x30)<<4)
+				tp = b0 | 0x30
+			} else {
+				length = int(meta & 0xff)
+				tp = b0
+			}
+		} else {
+			length = int(meta)
+		}
+	}
+
+	switch tp {
+	case mysql.MYSQL_TYPE_TINY:
+		return appendInt(b, v, 1)
+	case mysql.MYSQL_TYPE_SHORT:
+		return appendInt(b, v, 2)
+	case mysql.MYSQL_TYPE_INT24:
+		return appendInt(b, v, 3)
+	case mysql.MYSQL_TYPE_LONG:
+		return appendInt(b, v, 4)
+	case mysql.MYSQL_TYPE_LONGLONG:
+		return appendInt(b, v, 8)
+	case mysql.MYSQL_TYPE_FLOAT:
+		f, ok := v.(float32)
+		if !ok {
+			return nil, fmt.Errorf("float column holds %T", v)
+		}
+		return binary.LittleEndian.AppendUint32(b, math.Float32bits(f)), nil
+	case mysql.MYSQL_TYPE_DOUBLE:
+		f, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("double column holds %T", v)
+		}
+		return binary.LittleEndian.AppendUint64(b, math.Float64bits(f)), nil
+	case mysql.MYSQL_TYPE_YEAR:
+		y, ok := v.(int)
+		if !ok {
+			return nil, fmt.Errorf("year column holds %T", v)
+		}
+		if y != 0 {
+			y -= 1900
+		}
+		return append(b, byte(y)), nil
+	case mysql.MYSQL_TYPE_ENUM:
+		return appendInt(b, v, int(meta&0xff))
+	case mysql.MYSQL_TYPE_SET:
+		return appendInt(b, v, int(meta&0xff))
+	case mysql.MYSQL_TYPE_BIT:
+		i, ok := v.(int64)
+		if !ok {
+			return nil, fmt.Errorf("bit column holds %T", v)
+		}
+		n := (int((meta>>8)*8+meta&0xff) + 7) / 8
+		for k := n - 1; k >= 0; k-- {
+			b = append(b, byte(i>>(8*k)))
+		}
+		return b, nil
+	case mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_VAR_STRING:
+		return appendString(b, v, int(meta))
+	case mysql.MYSQL_TYPE_STRING:
+		return appendString(b, v, length)
+	case mysql.MYSQL_TYPE_BLOB, mysql.MYSQL_TYPE_GEOMETRY:
+		var data []byte
+		switch s := v.(type) {
+		case []byte:
+			data = s
+		case string:
+			data = []byte(s)
+		default:
+			return nil, fmt.Errorf("blob column holds %T", v)
+		}
+		for k := 0; k < int(meta); k++ {
+			b = append(b, byte(len(data)>>(8*k)))
+		}
+		return append(b, data...), nil
+	case mysql.MYSQL_TYPE_NEWDECIMAL:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("decimal column holds %T", v)
+		}
+		return appendDecimal(b, s, int(meta>>8), int(meta&0xff))
+	case mysql.MYSQL_TYPE_DATE:
+		y, mo, d, _, _, _, _, err := parseTemporal(v, "date")
+		if err != nil {
+			return nil, err
+		}
+		i := uint32(y*16*32 + mo*32 + d)
+		return append(b, byte(i), byte(i>>8), byte(i>>16)), nil
+	case mysql.MYSQL_TYPE_DATETIME:
+		y, mo, d, h, mi, s, _, err := parseTemporal(v, "datetime")
+		if err != nil {
+			return nil, err
+		}
+		i := uint64(y*10000+mo*100+d)*1000000 + uint64(h*10000+mi*100+s)
+		return binary.LittleEndian.AppendUint64(b, i), nil
+	case mysql.MYSQL_TYPE_DATETIME2:
+		y, mo, d, h, mi, s, frac, err := parseTemporal(v, "datetime")
+		if err != nil {
+			return nil, err
+		}
+		var ymdhms int64
+		if y != 0 || mo != 0 || d != 0 || h != 0 || mi != 0 || s != 0 {
+			ymdhms = (int64(y*13+mo)<<5|int64(d))<<17 | int64(h<<12|mi<<6|s)
+		}
+		v := ymdhms + 0x8000000000
+		b = append(b, byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+		return appendFraction(b, frac, meta), nil
+	case mysql.MYSQL_TYPE_TIMESTAMP, mysql.MYSQL_TYPE_TIMESTAMP2:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("timestamp column holds %T", v)
+		}
+		var sec int64
+		var frac int
+		if !strings.HasPrefix(s, "0000-00-00") {
+			t, err := time.ParseInLocation("2006-01-02 15:04:05.999999", s, time.Local)
+			if err != nil {
+				return nil, err
+			}
+			sec, frac = t.Unix(), t.Nanosecond()/1000
+		} else if _, _, _, _, _, _, f, err := parseTemporal(s, "timestamp"); err == nil {
+			frac = f
+		}
+		if tp == mysql.MYSQL_TYPE_TIMESTAMP {
+			return binary.LittleEndian.AppendUint32(b, uint32(sec)), nil
+		}
+		b = binary.BigEndian.AppendUint32(b, uint32(sec))
+		return appendFraction(b, frac, meta), nil
+	case mysql.MYSQL_TYPE_TIME:
+		s, ok := v.(string)
+		var h, mi, sec int
+		if !ok || strings.HasPrefix(s, "-") {
+			return nil, fmt.Errorf("%w: time value %v", ErrNotEncodable, v)
+		}
+		if _, err := fmt.Sscanf(s, "%d:%d:%d", &h, &mi, &sec); err != nil {
+			return nil, fmt.Errorf("time value %q: %v", s, err)
+		}
+		i := uint32(h*10000 + mi*100 + sec)
+		return append(b, byte(i), byte(i>>8), byte(i>>16)), nil
+	case mysql.MYSQL_TYPE_TIME2:
+		s, ok := v.(string)
+		if !ok || strings.HasPrefix(s, "-") {
+			return nil, fmt.Errorf("%w: time value %v", ErrNotEncodable, v)
+		}
+		var h, mi, sec int
+		whole, fraction, _ := strings.Cut(s, ".")
+		if _, err := fmt.Sscanf(whole, "%d:%d:%d", &h, &mi, &sec); err != nil {
+			return nil, fmt.Errorf("time value %q: %v", s, err)
+		}
+		frac, err := parseFraction(fraction)
+		if err != nil {
+			return nil, err
+		}
+		intPart := int64(h<<12 | mi<<6 | sec)
+		if meta >= 5 {
+			x := intPart<<24 + int64(frac) + 0x800000000000
+			return append(b, byte(x>>40), byte(x>>32), byte(x>>24), byte(x>>16), byte(x>>8), byte(x)), nil
+		}
+		x := intPart + 0x800000
+		b = append(b, byte(x>>16), byte(x>>8), byte(x))
+		return appendFraction(b, frac, meta), nil
+	}
+	return nil, fmt.Errorf("%w: column type %d", ErrNotEncodable, tp)
+}
+
+func appendInt(b []byte, v interface{}, size int) ([]byte, error) {
+	var i uint64
+	switch x := v.(type) {
+	case int8:
+		i = uint64(x)
+	case int16:
+		i = uint64(x)
+	case int32:
+		i = uint64(x)
+	case int64:
+		i = uint64(x)
+	case uint8:
+		i = uint64(x)
+	case uint16:
+		i = uint64(x)
+	case uint32:
+		i = uint64(x)
+	case uint64:
+		i = x
+	case int:
+		i = uint64(x)
+	default:
+		return nil, fmt.Errorf("integer column holds %T", v)
+	}
+	for k := 0; k < size; k++ {
+		b = append(b, byte(i>>(8*k)))
+	}
+	return b, nil
+}
+
+func appendString(b []byte, v interface{}, maxLength int) ([]byte, error) {
+	var s string
+	switch x := v.(type) {
+	case string:
+		s = x
+	case []byte:
+		s = string(x)
+	default:
+		return nil, fmt.Errorf("string column holds %T", v)
+	}
+	if maxLength < 256 {
+		b = append(b, byte(len(s)))
+	} else {
+		b = binary.LittleEndian.AppendUint16(b, uint16(len(s)))
+	}
+	return append(b, s...), nil
+}
+
+// appendFraction appends the fractional seconds part of a TIME2, DATETIME2
+// or TIMESTAMP2 value with dec digits of precision; frac is in microseconds.
+func appendFraction(b []byte, frac int, dec uint16) []byte {
+	switch dec {
+	case 1, 2:
+		return append(b, byte(frac/10000))
+	case 3, 4:
+		return binary.BigEndian.AppendUint16(b, uint16(frac/100))
+	case 5, 6:
+		return append(b, byte(frac>>16), byte(frac>>8), byte(frac))
+	}
+	return b
+}
+
+func parseFraction(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if len(s) > 6 {
+		return 0, fmt.Errorf("fraction %q has more than 6 digits", s)
+	}
+	f, err := strconv.Atoi(s + strings.Repeat("0", 6-len(s)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid fraction %q", s)
+	}
+	return f, nil
+}
+
+// parseTemporal splits "YYYY-MM-DD[ HH:MM:SS[.ffffff]]" into its fields,
+// accepting the zero dates MySQL allows and time.Parse rejects.
+func parseTemporal(v interface{}, what string) (y, mo, d, h, mi, s, frac int, err error) {
+	str, ok := v.(string)
+	if !ok {
+		err = fmt.Errorf("%s column holds %T", what, v)
+		return
+	}
+	date, clock, _ := strings.Cut(str, " ")
+	if _, err = fmt.Sscanf(date, "%d-%d-%d", &y, &mo, &d); err != nil {
+		err = fmt.Errorf("%s value %q: %v", what, str, err)
+		return
+	}
+	if clock == "" {
+		return
+	}
+	whole, fraction, _ := strings.Cut(clock, ".")
+	if _, err = fmt.Sscanf(whole, "%d:%d:%d", &h, &mi, &s); err != nil {
+		err = fmt.Errorf("%s value %q: %v", what, str, err)
+		return
+	}
+	frac, err = parseFraction(fraction)
+	return
+}
+
+var decimalBytes = [10]int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4}
+
+// appendDecimal encodes a DECIMAL(precision, scale) value in MySQL's binary
+// format: groups of nine digits in four big-endian bytes, leftover digits in
+// the fewest bytes that hold them, negative values bit-inverted, and the top
+// bit flipped so the encoding sorts bytewise.
+func appendDecimal(b []byte, s string, precision, scale int) ([]byte, error) {
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	intDigits, fracDigits, _ := strings.Cut(s, ".")
+	intg := precision - scale
+	if len(intDigits) > intg && strings.TrimLeft(intDigits, "0") != "" || len(fracDigits) > scale {
+		return nil, fmt.Errorf("decimal %q does not fit DECIMAL(%d,%d)", s, precision, scale)
+	}
+	intDigits = strings.Repeat("0", intg-min(len(intDigits), intg)) + intDigits[max(len(intDigits)-intg, 0):]
+	fracDigits += strings.Repeat("0", scale-len(fracDigits))
+
+	start := len(b)
+	group := func(digits string, size int) error {
+		n, err := strconv.ParseUint(digits, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid decimal %q", s)
+		}
+		for k := size - 1; k >= 0; k-- {
+			b = append(b, byte(n>>(8*k)))
+		}
+		return nil
+	}
+
+	lead := intg % 9
+	if lead > 0 {
+		if err := group(intDigits[:lead], decimalBytes[lead]); err != nil {
+			return nil, err
+		}
+	}
+	for i := lead; i < intg; i += 9 {
+		if err := group(intDigits[i:i+9], 4); err != nil {
+			return nil, err
+		}
+	}
+	for i := 0; i+9 <= scale; i += 9 {
+		if err := group(fracDigits[i:i+9], 4); err != nil {
+			return nil, err
+		}
+	}
+	if trail := scale % 9; trail > 0 {
+		if err := group(fracDigits[scale-trail:], decimalBytes[trail]); err != nil {
+			return nil, err
+		}
+	}
+
+	if negative {
+		for i := start; i < len(b); i++ {
+			b[i] = ^b[i]
+		}
+	}
+	b[start] ^= 0x80
+	return b, nil
+}
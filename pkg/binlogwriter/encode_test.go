@@ -0,0 +1,253 @@
+package binlogwriter
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// parseEvents decodes the events of a binlog written by Write.
+func parseEvents(t *testing.T, binlog []byte) []*replication.BinlogEvent {
+	t.Helper()
+	var events []*replication.BinlogEvent
+	p := replication.NewBinlogParser()
+	err := p.ParseReader(bytes.NewReader(binlog[len(replication.BinLogFileHeader):]), func(e *replication.BinlogEvent) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+// writtenRows writes an insert of rows into a table of columns and returns
+// the rows go-mysql decodes from the binlog.
+func writtenRows(t *testing.T, columns []Column, rows [][]interface{}) [][]interface{} {
+	t.Helper()
+	spec := &Spec{
+		Checksum:     true,
+		FullMetadata: true,
+		Transactions: []Transaction{{
+			Changes: []Change{{Type: "insert", Schema: "db", Table: "t", Columns: columns, Rows: rows}},
+		}},
+	}
+	var b bytes.Buffer
+	if err := Write(&b, spec); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range parseEvents(t, b.Bytes()) {
+		if re, ok := e.Event.(*replication.RowsEvent); ok {
+			return re.Rows
+		}
+	}
+	t.Fatal("no rows event written")
+	return nil
+}
+
+func TestWriteColumnTypes(t *testing.T) {
+	// Timestamps are written from UTC and decode in the local time zone.
+	local := time.Local
+	t.Cleanup(func() { time.Local = local })
+	time.Local = time.UTC
+	for _, tc := range []struct {
+		column Column
+		values []interface{}
+		// want are the values go-mysql decodes, the values when nil.
+		want []interface{}
+	}{
+		{Column{Type: "tinyint"}, []interface{}{math.MinInt8, 0, math.MaxInt8},
+			[]interface{}{int8(math.MinInt8), int8(0), int8(math.MaxInt8)}},
+		{Column{Type: "tinyint", Unsigned: true}, []interface{}{0, math.MaxUint8},
+			[]interface{}{int8(0), int8(-1)}},
+		{Column{Type: "smallint"}, []interface{}{math.MinInt16, math.MaxInt16},
+			[]interface{}{int16(math.MinInt16), int16(math.MaxInt16)}},
+		{Column{Type: "mediumint"}, []interface{}{-1 << 23, 1<<23 - 1},
+			[]interface{}{int32(-1 << 23), int32(1<<23 - 1)}},
+		{Column{Type: "mediumint", Unsigned: true}, []interface{}{1<<24 - 1},
+			[]interface{}{int32(-1)}},
+		{Column{Type: "int"}, []interface{}{math.MinInt32, math.MaxInt32},
+			[]interface{}{int32(math.MinInt32), int32(math.MaxInt32)}},
+		{Column{Type: "int", Unsigned: true}, []interface{}{uint32(math.MaxUint32)},
+			[]interface{}{int32(-1)}},
+		{Column{Type: "bigint"}, []interface{}{int64(math.MinInt64), int64(math.MaxInt64)}, nil},
+		{Column{Type: "bigint", Unsigned: true}, []interface{}{uint64(math.MaxUint64)},
+			[]interface{}{int64(-1)}},
+		{Column{Type: "double"}, []interface{}{-math.MaxFloat64, 0.5, math.SmallestNonzeroFloat64}, nil},
+		{Column{Type: "float"}, []interface{}{-math.MaxFloat32, 0.5, float32(math.SmallestNonzeroFloat32)},
+			[]interface{}{float32(-math.MaxFloat32), float32(0.5), float32(math.SmallestNonzeroFloat32)}},
+		{Column{Type: "year"}, []interface{}{0, 1901, 2155}, nil},
+		{Column{Type: "bit"}, []interface{}{0, 1}, []interface{}{int64(0), int64(1)}},
+		{Column{Type: "bit", Length: 9}, []interface{}{1<<9 - 1}, []interface{}{int64(1<<9 - 1)}},
+		{Column{Type: "bit", Length: 64}, []interface{}{uint64(math.MaxUint64)}, []interface{}{int64(-1)}},
+		{Column{Type: "decimal", Precision: 20, Scale: 4}, []interface{}{"-9999999999999999.9999", "0.0001", "1.5000"}, nil},
+		{Column{Type: "varchar", Length: 16}, []interface{}{"", "héllo", "it's"}, nil},
+		{Column{Type: "varchar", Length: 1024}, []interface{}{string(bytes.Repeat([]byte("x"), 300))}, nil},
+		{Column{Type: "char", Length: 16}, []interface{}{"", "héllo"}, nil},
+		{Column{Type: "char", Length: 1020}, []interface{}{string(bytes.Repeat([]byte("x"), 1020))}, nil},
+		{Column{Type: "blob"}, []interface{}{[]byte{}, []byte{0, 0xff, '\''}},
+			[]interface{}{[]byte{}, []byte{0, 0xff, '\''}}},
+		{Column{Type: "date"}, []interface{}{"1000-01-01", "9999-12-31"}, nil},
+		{Column{Type: "time"}, []interface{}{"00:00:00", "838:59:59"}, nil},
+		{Column{Type: "time", Precision: 6}, []interface{}{"00:00:00.000000", "838:59:59.000000", "12:34:56.789012"},
+			[]interface{}{"00:00:00", "838:59:59", "12:34:56.789012"}},
+		{Column{Type: "time", Precision: 2}, []interface{}{"12:34:56.78"}, nil},
+		{Column{Type: "datetime"}, []interface{}{"1000-01-01 00:00:00", "9999-12-31 23:59:59"}, nil},
+		{Column{Type: "datetime", Precision: 6}, []interface{}{"1000-01-01 00:00:00.000000", "9999-12-31 23:59:59.999999"}, nil},
+		{Column{Type: "timestamp"}, []interface{}{"1970-01-01 00:00:01", "2038-01-19 03:14:07"}, nil},
+		{Column{Type: "timestamp", Precision: 6}, []interface{}{"0000-00-00 00:00:00.000000", "2038-01-19 03:14:07.999999"}, nil},
+		{Column{Type: "timestamp", Precision: 3}, []interface{}{time.Date(2024, 2, 29, 12, 34, 56, 789e6, time.UTC)},
+			[]interface{}{"2024-02-29 12:34:56.789"}},
+		{Column{Type: "enum", Values: []string{"a", "b"}}, []interface{}{"a", 2},
+			[]interface{}{int64(1), int64(2)}},
+		{Column{Type: "set", Values: []string{"a", "b", "c"}}, []interface{}{"", "a,c"},
+			[]interface{}{int64(0), int64(5)}},
+		{Column{Type: "json"}, []interface{}{`{"a":[1,"b",null]}`},
+			[]interface{}{`{"a":[1,"b",null]}`}},
+	} {
+		name := tc.column.Type
+		if tc.column.Unsigned {
+			name += " unsigned"
+		}
+		t.Run(name, func(t *testing.T) {
+			tc.column.Name = "c"
+			var rows [][]interface{}
+			for _, v := range tc.values {
+				rows = append(rows, []interface{}{v}, []interface{}{nil})
+			}
+			want := tc.want
+			if want == nil {
+				want = tc.values
+			}
+			got := writtenRows(t, []Column{tc.column}, rows)
+			if len(got) != len(rows) {
+				t.Fatalf("decoded %d rows, wrote %d", len(got), len(rows))
+			}
+			for i, w := range want {
+				v := got[2*i][0]
+				// Dates and times decode as strings or as values
+				// printing as those strings.
+				if s, ok := v.(fmt.Stringer); ok {
+					v = s.String()
+				}
+				if !reflect.DeepEqual(v, w) {
+					t.Errorf("wrote %#v, decoded %#v (%T), want %#v", tc.values[i], v, v, w)
+				}
+				if v := got[2*i+1][0]; v != nil {
+					t.Errorf("wrote NULL, decoded %#v", v)
+				}
+			}
+		})
+	}
+}
+
+// testFormat is the format of the events TestEncodeEventColumnTypes
+// encodes.
+var testFormat = &replication.FormatDescriptionEvent{
+	Version:                4,
+	ServerVersion:          []byte(DefaultServerVersion),
+	EventHeaderLength:      replication.EventHeaderSize,
+	EventTypeHeaderLengths: postHeaderLengths,
+	ChecksumAlgorithm:      replication.BINLOG_CHECKSUM_ALG_CRC32,
+}
+
+// encodeAndParse encodes events with EncodeEvent, after the format
+// description, and returns them as go-mysql decodes them again.
+func encodeAndParse(t *testing.T, events ...*replication.BinlogEvent) []*replication.BinlogEvent {
+	t.Helper()
+	binlog := append([]byte(nil), replication.BinLogFileHeader...)
+	events = append([]*replication.BinlogEvent{{
+		Header: &replication.EventHeader{EventType: replication.FORMAT_DESCRIPTION_EVENT},
+		Event:  testFormat,
+	}}, events...)
+	for _, e := range events {
+		b, err := EncodeEvent(e, testFormat)
+		if err != nil {
+			t.Fatalf("%s: %v", e.Header.EventType, err)
+		}
+		binlog = append(binlog, b...)
+	}
+	return parseEvents(t, binlog)[1:]
+}
+
+func TestEncodeEventColumnTypes(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		typ    byte
+		meta   uint16
+		values []interface{}
+	}{
+		{"tinyint", mysql.MYSQL_TYPE_TINY, 0, []interface{}{int8(math.MinInt8), int8(math.MaxInt8)}},
+		{"smallint", mysql.MYSQL_TYPE_SHORT, 0, []interface{}{int16(math.MinInt16), int16(math.MaxInt16)}},
+		{"mediumint", mysql.MYSQL_TYPE_INT24, 0, []interface{}{int32(-1 << 23), int32(1<<23 - 1)}},
+		{"int", mysql.MYSQL_TYPE_LONG, 0, []interface{}{int32(math.MinInt32), int32(math.MaxInt32)}},
+		{"bigint", mysql.MYSQL_TYPE_LONGLONG, 0, []interface{}{int64(math.MinInt64), int64(math.MaxInt64)}},
+		{"float", mysql.MYSQL_TYPE_FLOAT, 4, []interface{}{float32(-math.MaxFloat32), float32(0.5)}},
+		{"double", mysql.MYSQL_TYPE_DOUBLE, 8, []interface{}{-math.MaxFloat64, 0.5}},
+		{"decimal", mysql.MYSQL_TYPE_NEWDECIMAL, 20<<8 | 4, []interface{}{"-9999999999999999.9999", "0.0001"}},
+		{"year", mysql.MYSQL_TYPE_YEAR, 0, []interface{}{0, 1901, 2155}},
+		{"bit", mysql.MYSQL_TYPE_BIT, 1<<8 | 1, []interface{}{int64(0), int64(1<<9 - 1)}},
+		{"bit(64)", mysql.MYSQL_TYPE_BIT, 8 << 8, []interface{}{int64(-1)}},
+		{"date", mysql.MYSQL_TYPE_DATE, 0, []interface{}{"1000-01-01", "9999-12-31"}},
+		{"time", mysql.MYSQL_TYPE_TIME, 0, []interface{}{"00:00:00", "838:59:59"}},
+		{"time(6)", mysql.MYSQL_TYPE_TIME2, 6, []interface{}{"00:00:00", "838:59:59.999999"}},
+		{"time(2)", mysql.MYSQL_TYPE_TIME2, 2, []interface{}{"12:34:56.78"}},
+		{"datetime", mysql.MYSQL_TYPE_DATETIME, 0, []interface{}{"1000-01-01 00:00:00", "9999-12-31 23:59:59"}},
+		{"datetime(0)", mysql.MYSQL_TYPE_DATETIME2, 0, []interface{}{"1000-01-01 00:00:00", "9999-12-31 23:59:59"}},
+		{"datetime(6)", mysql.MYSQL_TYPE_DATETIME2, 6, []interface{}{"2024-02-29 12:34:56.123456"}},
+		{"timestamp", mysql.MYSQL_TYPE_TIMESTAMP, 0, []interface{}{"2024-01-02 03:04:05"}},
+		{"timestamp(3)", mysql.MYSQL_TYPE_TIMESTAMP2, 3, []interface{}{"0000-00-00 00:00:00.000", "2038-01-19 03:14:07.999"}},
+		{"char", mysql.MYSQL_TYPE_STRING, uint16(mysql.MYSQL_TYPE_STRING)<<8 | 40, []interface{}{"", "héllo"}},
+		{"char(255) utf8mb4", mysql.MYSQL_TYPE_STRING, 0xce<<8 | 0xfc, []interface{}{string(bytes.Repeat([]byte("x"), 300))}},
+		{"enum", mysql.MYSQL_TYPE_STRING, uint16(mysql.MYSQL_TYPE_ENUM)<<8 | 1, []interface{}{int64(1), int64(255)}},
+		{"set", mysql.MYSQL_TYPE_STRING, uint16(mysql.MYSQL_TYPE_SET)<<8 | 2, []interface{}{int64(0), int64(0xffff)}},
+		{"varchar", mysql.MYSQL_TYPE_VARCHAR, 64, []interface{}{"", "it's"}},
+		{"varchar(1024)", mysql.MYSQL_TYPE_VARCHAR, 1024, []interface{}{string(bytes.Repeat([]byte("y"), 1000))}},
+		{"blob", mysql.MYSQL_TYPE_BLOB, 2, []interface{}{[]byte{}, []byte{0, 0xff, '\''}}},
+		{"longblob", mysql.MYSQL_TYPE_BLOB, 4, []interface{}{[]byte{0}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			table := &replication.TableMapEvent{
+				TableID:     firstTableID,
+				Schema:      []byte("db"),
+				Table:       []byte("t"),
+				ColumnCount: 1,
+				ColumnType:  []byte{tc.typ},
+				ColumnMeta:  []uint16{tc.meta},
+				NullBitmap:  []byte{1},
+			}
+			var rows [][]interface{}
+			for _, v := range tc.values {
+				rows = append(rows, []interface{}{v}, []interface{}{nil})
+			}
+			events := encodeAndParse(t, &replication.BinlogEvent{
+				Header: &replication.EventHeader{EventType: replication.TABLE_MAP_EVENT},
+				Event:  table,
+			}, &replication.BinlogEvent{
+				Header: &replication.EventHeader{EventType: replication.WRITE_ROWS_EVENTv2},
+				Event: &replication.RowsEvent{
+					Version:       2,
+					Table:         table,
+					TableID:       firstTableID,
+					Flags:         rowsStmtEnd,
+					ColumnCount:   1,
+					ColumnBitmap1: []byte{1},
+					Rows:          rows,
+				},
+			})
+			re, ok := events[1].Event.(*replication.RowsEvent)
+			if !ok {
+				t.Fatalf("decoded %T, want a rows event", events[1].Event)
+			}
+			if !reflect.DeepEqual(re.Rows, rows) {
+				t.Errorf("encoded %#v, decoded %#v", rows, re.Rows)
+			}
+		})
+	}
+}
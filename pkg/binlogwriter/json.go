@@ -0,0 +1,248 @@
+package binlogwriter
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// JSONDiff is one change of a partial JSON update, as MySQL logs an update
+// of a JSON column through JSON_SET, JSON_REPLACE or JSON_REMOVE with
+// binlog_row_value_options=PARTIAL_JSON.
+type JSONDiff struct {
+	// Op is "replace", "insert" or "remove".
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	// Value is the JSON text of the value replaced or inserted.
+	Value string `json:"value,omitempty"`
+}
+
+// The types of MySQL's binary JSON format.
+const (
+	jsonbSmallObject = 0x00
+	jsonbLargeObject = 0x01
+	jsonbSmallArray  = 0x02
+	jsonbLargeArray  = 0x03
+	jsonbLiteral     = 0x04
+	jsonbInt16       = 0x05
+	jsonbUint16      = 0x06
+	jsonbInt32       = 0x07
+	jsonbUint32      = 0x08
+	jsonbInt64       = 0x09
+	jsonbUint64      = 0x0a
+	jsonbDouble      = 0x0b
+	jsonbString      = 0x0c
+
+	jsonbNull  = 0x00
+	jsonbTrue  = 0x01
+	jsonbFalse = 0x02
+)
+
+// jsonDiffOps are the operation codes of a JSON diff.
+var jsonDiffOps = map[string]byte{"replace": 0, "insert": 1, "remove": 2}
+
+// jsonDiffs returns v as the changes of a partial JSON update when it is
+// one: []JSONDiff, or as read from a JSON spec, a list of objects.
+func jsonDiffs(v interface{}) ([]JSONDiff, bool, error) {
+	switch v := v.(type) {
+	case []JSONDiff:
+		return v, true, nil
+	case []interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, true, err
+		}
+		var diffs []JSONDiff
+		if err := json.Unmarshal(data, &diffs); err != nil {
+			return nil, true, fmt.Errorf("json diffs: %v", err)
+		}
+		return diffs, true, nil
+	}
+	return nil, false, nil
+}
+
+// appendJSON appends v, the JSON text of a json column or the changes of a
+// partial update of it, as MySQL logs it: its length in four bytes, then
+// the binary JSON or the diffs.
+func appendJSON(b []byte, v interface{}) ([]byte, error) {
+	var data []byte
+	if diffs, ok, err := jsonDiffs(v); err != nil {
+		return nil, err
+	} else if ok {
+		for _, d := range diffs {
+			op, known := jsonDiffOps[strings.ToLower(d.Op)]
+			if !known {
+				return nil, fmt.Errorf("unknown json diff op %q (replace, insert or remove)", d.Op)
+			}
+			data = append(data, op)
+			data = mysql.AppendLengthEncodedInteger(data, uint64(len(d.Path)))
+			data = append(data, d.Path...)
+			if op == jsonDiffOps["remove"] {
+				continue
+			}
+			value, err := jsonBinary(d.Value)
+			if err != nil {
+				return nil, err
+			}
+			data = mysql.AppendLengthEncodedInteger(data, uint64(len(value)))
+			data = append(data, value...)
+		}
+	} else {
+		text, err := toBytes(v)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = jsonBinary(string(text)); err != nil {
+			return nil, err
+		}
+	}
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(data)))
+	return append(b, data...), nil
+}
+
+// jsonBinary encodes JSON text in MySQL's binary JSON format.
+func jsonBinary(text string) ([]byte, error) {
+	d := json.NewDecoder(strings.NewReader(text))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, fmt.Errorf("invalid JSON %q: %v", text, err)
+	}
+	typ, data, err := jsonbValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{typ}, data...), nil
+}
+
+// jsonbValue returns the type and the encoding of a decoded JSON value.
+func jsonbValue(v interface{}) (byte, []byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return jsonbLiteral, []byte{jsonbNull}, nil
+	case bool:
+		if v {
+			return jsonbLiteral, []byte{jsonbTrue}, nil
+		}
+		return jsonbLiteral, []byte{jsonbFalse}, nil
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			switch {
+			case i >= math.MinInt16 && i <= math.MaxInt16:
+				return jsonbInt16, binary.LittleEndian.AppendUint16(nil, uint16(i)), nil
+			case i >= math.MinInt32 && i <= math.MaxInt32:
+				return jsonbInt32, binary.LittleEndian.AppendUint32(nil, uint32(i)), nil
+			}
+			return jsonbInt64, binary.LittleEndian.AppendUint64(nil, uint64(i)), nil
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return jsonbUint64, binary.LittleEndian.AppendUint64(nil, u), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return 0, nil, err
+		}
+		return jsonbDouble, binary.LittleEndian.AppendUint64(nil, math.Float64bits(f)), nil
+	case string:
+		return jsonbString, append(appendVariableLength(nil, len(v)), v...), nil
+	case []interface{}:
+		return jsonbContainer(nil, v)
+	case map[string]interface{}:
+		// MySQL orders the keys by length, then bytes.
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if len(keys[i]) != len(keys[j]) {
+				return len(keys[i]) < len(keys[j])
+			}
+			return keys[i] < keys[j]
+		})
+		values := make([]interface{}, len(keys))
+		for i, k := range keys {
+			values[i] = v[k]
+		}
+		return jsonbContainer(keys, values)
+	}
+	return 0, nil, fmt.Errorf("unsupported JSON value %T", v)
+}
+
+// jsonbContainer encodes an array, or an object when keys are given, in
+// the small format when it fits in 64KiB and the large one otherwise.
+func jsonbContainer(keys []string, values []interface{}) (byte, []byte, error) {
+	object := keys != nil
+	for _, small := range []bool{true, false} {
+		size, limit := 4, uint64(math.MaxUint32)
+		if small {
+			size, limit = 2, math.MaxUint16
+		}
+		put := func(b []byte, v int) {
+			if small {
+				binary.LittleEndian.PutUint16(b, uint16(v))
+			} else {
+				binary.LittleEndian.PutUint32(b, uint32(v))
+			}
+		}
+		n := len(values)
+		keyEntries := 2 * size
+		valueEntries := keyEntries
+		if object {
+			valueEntries += n * (size + 2)
+		}
+		buf := make([]byte, valueEntries+n*(1+size))
+		for i, k := range keys {
+			entry := keyEntries + i*(size+2)
+			put(buf[entry:], len(buf))
+			binary.LittleEndian.PutUint16(buf[entry+size:], uint16(len(k)))
+			buf = append(buf, k...)
+		}
+		for i, v := range values {
+			typ, data, err := jsonbValue(v)
+			if err != nil {
+				return 0, nil, err
+			}
+			entry := valueEntries + i*(1+size)
+			buf[entry] = typ
+			// Literals and integers that fit the offset are inlined.
+			if typ == jsonbLiteral || typ == jsonbInt16 || typ == jsonbUint16 ||
+				!small && (typ == jsonbInt32 || typ == jsonbUint32) {
+				copy(buf[entry+1:], data)
+				continue
+			}
+			put(buf[entry+1:], len(buf))
+			buf = append(buf, data...)
+		}
+		if uint64(len(buf)) > limit {
+			continue
+		}
+		put(buf, n)
+		put(buf[size:], len(buf))
+		switch {
+		case object && small:
+			return jsonbSmallObject, buf, nil
+		case object:
+			return jsonbLargeObject, buf, nil
+		case small:
+			return jsonbSmallArray, buf, nil
+		}
+		return jsonbLargeArray, buf, nil
+	}
+	return 0, nil, fmt.Errorf("JSON value of more than 4GiB")
+}
+
+// appendVariableLength appends n seven bits a byte, low bits first, with
+// the high bit set on all bytes but the last.
+func appendVariableLength(b []byte, n int) []byte {
+	for n >= 0x80 {
+		b = append(b, byte(n)|0x80)
+		n >>= 7
+	}
+	return append(b, byte(n))
+}
@@ -0,0 +1,133 @@
+// Package binlogwriter synthesizes small, valid MySQL binlog files from a
+// declarative Spec. The files use the row-based v4 format written by MySQL
+// 5.7 and 8.0 and are meant as deterministic fixtures for tests of binlog
+// consumers, including go-parse itself.
+package binlogwriter
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// Spec describes a binlog file.
+type Spec struct {
+	// ServerID is written into every event header. Defaults to 1.
+	ServerID uint32 `json:"server_id"`
+	// ServerVersion is recorded in the FORMAT_DESCRIPTION event. Defaults
+	// to DefaultServerVersion.
+	ServerVersion string `json:"server_version"`
+	// Start is the timestamp of the first event; transactions without a
+	// timestamp of their own are one second apart from it. Defaults to
+	// 2024-01-01 00:00:00 UTC.
+	Start time.Time `json:"start"`
+	// Checksum enables CRC32 event checksums.
+	Checksum bool `json:"checksum"`
+	// FullMetadata writes column signedness, collations, names and primary
+	// keys into TableMapEvents, as binlog_row_metadata=FULL does.
+	FullMetadata bool `json:"full_metadata"`
+	// RowImage is binlog_row_image: "full" (the default) logs every column
+	// in every image; "noblob" leaves blob and json columns out of before images
+	// when the table has a primary key, and out of the after images of an
+	// update that does not change them; "minimal" logs only the primary key
+	// in before images and only the changed columns in update after images.
+	RowImage string `json:"row_image"`
+	// RowsEventVersion is the version of the rows events: 2 (the default)
+	// as written since MySQL 5.6, or 1 as written by 5.1 to 5.5, without
+	// the extra data field.
+	RowsEventVersion int `json:"rows_event_version"`
+	// PartialJSON writes updates as PARTIAL_UPDATE_ROWS events, as
+	// binlog_row_value_options=PARTIAL_JSON does. An after image value of
+	// a json column may then be a list of JSONDiff, the changes of the
+	// update, instead of the whole document.
+	PartialJSON bool `json:"partial_json"`
+	// PreviousGTIDs is the GTID set written into the PREVIOUS_GTIDS event.
+	PreviousGTIDs string `json:"previous_gtids"`
+	// NextLog, when set, ends the file with a ROTATE event to that file
+	// instead of a STOP event.
+	NextLog string `json:"next_log"`
+
+	Transactions []Transaction `json:"transactions"`
+}
+
+// Transaction is one transaction: a DDL statement when Query is set,
+// otherwise BEGIN, the row changes and an XID commit.
+type Transaction struct {
+	// GTID is "uuid:gno"; an empty GTID writes an ANONYMOUS_GTID event.
+	GTID string `json:"gtid"`
+	// LastCommitted and SequenceNumber are the logical clock. A zero
+	// SequenceNumber defaults to the transaction's 1-based index and a zero
+	// LastCommitted to SequenceNumber-1, i.e. fully serial.
+	LastCommitted  int64 `json:"last_committed"`
+	SequenceNumber int64 `json:"sequence_number"`
+	// Timestamp overrides the transaction's event timestamps.
+	Timestamp time.Time `json:"timestamp"`
+	// Schema is the default database of the BEGIN or DDL query.
+	Schema string `json:"schema"`
+	// Query makes this a DDL transaction.
+	Query string `json:"query"`
+	// XID defaults to the transaction's 1-based index.
+	XID uint64 `json:"xid"`
+
+	Changes []Change `json:"changes"`
+}
+
+// Change is one rows event and the TableMapEvent preceding it.
+type Change struct {
+	// Type is "insert", "update" or "delete".
+	Type    string   `json:"type"`
+	Schema  string   `json:"schema"`
+	Table   string   `json:"table"`
+	Columns []Column `json:"columns"`
+	// Rows holds one value per column. Values may be nil, integers,
+	// floats, strings, []byte or time.Time. Update changes list before and
+	// after images alternately.
+	Rows [][]interface{} `json:"rows"`
+	// Query, when set, is written as a ROWS_QUERY event ahead of the
+	// change, as MySQL does with binlog_rows_query_log_events=ON.
+	Query string `json:"query,omitempty"`
+}
+
+// Column is a table column. Type is one of tinyint, smallint, mediumint,
+// int, bigint, float, double, decimal, year, bit, char, varchar, blob,
+// date, time, datetime, timestamp, enum, set and json. Row values of a json
+// column are JSON text, those of the date and time columns strings as MySQL
+// prints them, with timestamps in UTC; negative times are not supported.
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Unsigned marks an unsigned integer column. The binlog only records it
+	// with FullMetadata.
+	Unsigned bool `json:"unsigned"`
+	// Length is the maximum length of a varchar or char, in bytes, and
+	// defaults to 255; that of a bit, in bits, defaults to 1.
+	Length int `json:"length"`
+	// Precision and Scale are those of a decimal. Precision defaults to
+	// 10. The precision of a time, datetime or timestamp is its digits of
+	// fractional seconds, 0 to 6.
+	Precision int `json:"precision,omitempty"`
+	Scale     int `json:"scale,omitempty"`
+	// Values are those of an enum or set. Row values of an enum are given
+	// by value or 1-based index, those of a set as comma-separated values
+	// or a bitmap.
+	Values []string `json:"values,omitempty"`
+	// Collation is the collation id of a varchar, char or blob column,
+	// written with FullMetadata. Defaults to utf8mb4_0900_ai_ci (255) for a
+	// varchar or char and binary (63) for a blob; a blob with another
+	// collation is a TEXT column. Values are written as given, in bytes of the collation's
+	// character set.
+	Collation int `json:"collation,omitempty"`
+	// PrimaryKey marks the columns of the table's primary key.
+	PrimaryKey bool `json:"primary_key"`
+}
+
+// ParseSpec reads a JSON encoded Spec.
+func ParseSpec(r io.Reader) (*Spec, error) {
+	d := json.NewDecoder(r)
+	d.UseNumber()
+	spec := new(Spec)
+	if err := d.Decode(spec); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
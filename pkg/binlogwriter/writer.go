@@ -0,0 +1,956 @@
+package binlogwriter
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/google/uuid"
+)
+
+// DefaultServerVersion is the server version written when Spec leaves it
+// empty.
+const DefaultServerVersion = "8.0.36-binlogwriter"
+
+// postHeaderLengths are the per-event-type post-header lengths of a MySQL
+// 8.0 FORMAT_DESCRIPTION event, indexed by event type - 1.
+var postHeaderLengths = []byte{
+	56, 13, 0, 8, 0, 18, 0, 4, 4, 4, 4, 18, 0, 0, 95, 0, 4, 26, 8, 0,
+	0, 0, 8, 8, 8, 2, 0, 0, 0, 10, 10, 10, 42, 42, 0, 18, 52, 0, 10, 40,
+	0,
+}
+
+const (
+	rowsStmtEnd  = 0x1
+	firstTableID = 100
+	// logEventIgnorable is LOG_EVENT_IGNORABLE_F, set on ROWS_QUERY events.
+	logEventIgnorable = 0x80
+	// defaultCollation (utf8mb4_0900_ai_ci) and binaryCollation are the
+	// collations FullMetadata gives varchar, char, enum and set, and blob
+	// columns.
+	defaultCollation = 255
+	binaryCollation  = 63
+	// partialJSONOption is the PARTIAL_JSON bit of the value options of a
+	// partial update after image.
+	partialJSONOption = 0x1
+)
+
+// WriteFile writes the binlog described by spec to name.
+func WriteFile(name string, spec *Spec) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := Write(f, spec); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Write writes the binlog described by spec to w.
+func Write(w io.Writer, spec *Spec) error {
+	bw := &writer{
+		w:        w,
+		spec:     spec,
+		pos:      uint32(len(replication.BinLogFileHeader)),
+		serverID: spec.ServerID,
+		tableIDs: make(map[string]uint64),
+	}
+	if bw.serverID == 0 {
+		bw.serverID = 1
+	}
+	return bw.write()
+}
+
+type writer struct {
+	w        io.Writer
+	spec     *Spec
+	pos      uint32
+	serverID uint32
+	ts       uint32
+	tableIDs map[string]uint64
+}
+
+func (bw *writer) write() error {
+	start := bw.spec.Start
+	if start.IsZero() {
+		start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	bw.ts = uint32(start.Unix())
+
+	if _, err := bw.w.Write(replication.BinLogFileHeader); err != nil {
+		return err
+	}
+	if err := bw.event(replication.FORMAT_DESCRIPTION_EVENT, 0, bw.formatDescription()); err != nil {
+		return err
+	}
+	prev, err := previousGTIDs(bw.spec.PreviousGTIDs)
+	if err != nil {
+		return err
+	}
+	if err := bw.event(replication.PREVIOUS_GTIDS_EVENT, 0, prev); err != nil {
+		return err
+	}
+
+	for i := range bw.spec.Transactions {
+		tx := &bw.spec.Transactions[i]
+		bw.ts = uint32(start.Unix()) + uint32(i)
+		if !tx.Timestamp.IsZero() {
+			bw.ts = uint32(tx.Timestamp.Unix())
+		}
+		if err := bw.transaction(i+1, tx); err != nil {
+			return fmt.Errorf("transaction %d: %v", i+1, err)
+		}
+	}
+
+	if bw.spec.NextLog != "" {
+		body := binary.LittleEndian.AppendUint64(nil, 4)
+		return bw.event(replication.ROTATE_EVENT, 0, append(body, bw.spec.NextLog...))
+	}
+	return bw.event(replication.STOP_EVENT, 0, nil)
+}
+
+func (bw *writer) transaction(n int, tx *Transaction) error {
+	gtid, err := bw.gtid(n, tx)
+	if err != nil {
+		return err
+	}
+	typ := replication.GTID_EVENT
+	if tx.GTID == "" {
+		typ = replication.ANONYMOUS_GTID_EVENT
+	}
+	if err := bw.event(typ, 0, gtid); err != nil {
+		return err
+	}
+
+	if tx.Query != "" {
+		return bw.event(replication.QUERY_EVENT, 0, query(tx.Schema, tx.Query))
+	}
+
+	if err := bw.event(replication.QUERY_EVENT, 0, query(tx.Schema, "BEGIN")); err != nil {
+		return err
+	}
+	for i := range tx.Changes {
+		if err := bw.change(&tx.Changes[i]); err != nil {
+			return fmt.Errorf("change %d: %v", i+1, err)
+		}
+	}
+	xid := tx.XID
+	if xid == 0 {
+		xid = uint64(n)
+	}
+	return bw.event(replication.XID_EVENT, 0, binary.LittleEndian.AppendUint64(nil, xid))
+}
+
+// event frames body with an event header and, when enabled, a checksum.
+// The FORMAT_DESCRIPTION event always carries a checksum, whatever the
+// checksum algorithm it announces.
+func (bw *writer) event(typ replication.EventType, flags uint16, body []byte) error {
+	checksum := bw.spec.Checksum || typ == replication.FORMAT_DESCRIPTION_EVENT
+	size := uint32(replication.EventHeaderSize + len(body))
+	if checksum {
+		size += replication.BinlogChecksumLength
+	}
+	bw.pos += size
+	_, err := bw.w.Write(appendEvent(nil, bw.ts, typ, bw.serverID, bw.pos, flags, body, checksum))
+	return err
+}
+
+func (bw *writer) formatDescription() []byte {
+	version := bw.spec.ServerVersion
+	if version == "" {
+		version = DefaultServerVersion
+	}
+	b := binary.LittleEndian.AppendUint16(nil, 4)
+	sv := make([]byte, 50)
+	copy(sv, version)
+	b = append(b, sv...)
+	b = binary.LittleEndian.AppendUint32(b, bw.ts)
+	b = append(b, replication.EventHeaderSize)
+	b = append(b, postHeaderLengths...)
+	if bw.spec.Checksum {
+		return append(b, replication.BINLOG_CHECKSUM_ALG_CRC32)
+	}
+	return append(b, replication.BINLOG_CHECKSUM_ALG_OFF)
+}
+
+func previousGTIDs(set string) ([]byte, error) {
+	if set == "" {
+		return binary.LittleEndian.AppendUint64(nil, 0), nil
+	}
+	gset, err := mysql.ParseMysqlGTIDSet(set)
+	if err != nil {
+		return nil, fmt.Errorf("previous GTIDs: %v", err)
+	}
+	return gset.Encode(), nil
+}
+
+func (bw *writer) gtid(n int, tx *Transaction) ([]byte, error) {
+	sid := make([]byte, 16)
+	var gno int64
+	if tx.GTID != "" {
+		u, g, ok := strings.Cut(tx.GTID, ":")
+		id, err := uuid.Parse(u)
+		if err != nil || !ok {
+			return nil, fmt.Errorf("invalid GTID %q", tx.GTID)
+		}
+		if gno, err = strconv.ParseInt(g, 10, 64); err != nil || gno < 1 {
+			return nil, fmt.Errorf("invalid GTID %q", tx.GTID)
+		}
+		copy(sid, id[:])
+	}
+
+	seq := tx.SequenceNumber
+	if seq == 0 {
+		seq = int64(n)
+	}
+	lastCommitted := tx.LastCommitted
+	if lastCommitted == 0 {
+		lastCommitted = seq - 1
+	}
+
+	b := []byte{1} // commit flag
+	b = append(b, sid...)
+	b = binary.LittleEndian.AppendUint64(b, uint64(gno))
+	b = append(b, replication.LogicalTimestampTypeCode)
+	b = binary.LittleEndian.AppendUint64(b, uint64(lastCommitted))
+	return binary.LittleEndian.AppendUint64(b, uint64(seq)), nil
+}
+
+func query(schema, q string) []byte {
+	b := binary.LittleEndian.AppendUint32(nil, 1) // slave proxy id
+	b = binary.LittleEndian.AppendUint32(b, 0)    // execution time
+	b = append(b, byte(len(schema)))
+	b = binary.LittleEndian.AppendUint16(b, 0) // error code
+	b = binary.LittleEndian.AppendUint16(b, 0) // status vars length
+	b = append(b, schema...)
+	b = append(b, 0)
+	return append(b, q...)
+}
+
+func (bw *writer) change(c *Change) error {
+	var typ replication.EventType
+	switch strings.ToLower(c.Type) {
+	case "insert":
+		typ = replication.WRITE_ROWS_EVENTv2
+	case "update":
+		typ = replication.UPDATE_ROWS_EVENTv2
+		if len(c.Rows)%2 != 0 {
+			return fmt.Errorf("update of %s.%s needs before and after images, got %d rows", c.Schema, c.Table, len(c.Rows))
+		}
+		if bw.spec.PartialJSON {
+			typ = replication.PARTIAL_UPDATE_ROWS_EVENT
+		}
+	case "delete":
+		typ = replication.DELETE_ROWS_EVENTv2
+	default:
+		return fmt.Errorf("unknown change type %q", c.Type)
+	}
+	switch bw.spec.RowsEventVersion {
+	case 0, 2:
+	case 1:
+		if typ == replication.PARTIAL_UPDATE_ROWS_EVENT {
+			return fmt.Errorf("partial JSON updates need rows event version 2")
+		}
+		// The version 1 types are numbered 23-25 to version 2's 30-32.
+		typ -= replication.WRITE_ROWS_EVENTv2 - replication.WRITE_ROWS_EVENTv1
+	default:
+		return fmt.Errorf("unknown rows event version %d (1 or 2)", bw.spec.RowsEventVersion)
+	}
+	if len(c.Columns) == 0 {
+		return fmt.Errorf("%s.%s has no columns", c.Schema, c.Table)
+	}
+
+	name := c.Schema + "." + c.Table
+	id, ok := bw.tableIDs[name]
+	if !ok {
+		id = firstTableID + uint64(len(bw.tableIDs))
+		bw.tableIDs[name] = id
+	}
+
+	if c.Query != "" {
+		// The length byte is informational; long statements store 255.
+		q := append([]byte{byte(min(len(c.Query), 255))}, c.Query...)
+		if err := bw.event(replication.ROWS_QUERY_EVENT, logEventIgnorable, q); err != nil {
+			return err
+		}
+	}
+
+	tm, err := bw.tableMap(id, c)
+	if err != nil {
+		return err
+	}
+	if err := bw.event(replication.TABLE_MAP_EVENT, 0, tm); err != nil {
+		return err
+	}
+	rows, err := rowsBody(id, typ, c, bw.spec.RowImage)
+	if err != nil {
+		return err
+	}
+	return bw.event(typ, 0, rows)
+}
+
+func (bw *writer) tableMap(id uint64, c *Change) ([]byte, error) {
+	b := appendTableID(nil, id)
+	b = binary.LittleEndian.AppendUint16(b, 0) // flags
+	b = append(b, byte(len(c.Schema)))
+	b = append(b, c.Schema...)
+	b = append(b, 0, byte(len(c.Table)))
+	b = append(b, c.Table...)
+	b = append(b, 0)
+	b = mysql.AppendLengthEncodedInteger(b, uint64(len(c.Columns)))
+
+	var meta []byte
+	for _, col := range c.Columns {
+		t, m, err := columnType(col)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, t)
+		meta = append(meta, m...)
+	}
+	b = mysql.AppendLengthEncodedInteger(b, uint64(len(meta)))
+	b = append(b, meta...)
+
+	// Every column is nullable.
+	nullable := make([]byte, (len(c.Columns)+7)/8)
+	for i := range c.Columns {
+		nullable[i/8] |= 1 << (i % 8)
+	}
+	b = append(b, nullable...)
+
+	if bw.spec.FullMetadata {
+		// One bit per numeric column, most significant first.
+		var signedness []byte
+		numeric := 0
+		for _, col := range c.Columns {
+			switch strings.ToLower(col.Type) {
+			case "tinyint", "smallint", "mediumint", "int", "bigint", "float", "double", "decimal":
+			default:
+				continue
+			}
+			if numeric%8 == 0 {
+				signedness = append(signedness, 0)
+			}
+			if col.Unsigned {
+				signedness[numeric/8] |= 0x80 >> (numeric % 8)
+			}
+			numeric++
+		}
+		if numeric > 0 {
+			b = append(b, replication.TABLE_MAP_OPT_META_SIGNEDNESS)
+			b = mysql.AppendLengthEncodedInteger(b, uint64(len(signedness)))
+			b = append(b, signedness...)
+		}
+
+		// Character columns default to utf8mb4_0900_ai_ci, listing the
+		// others apart by their index among the character columns.
+		var charset []byte
+		character := 0
+		for _, col := range c.Columns {
+			collation := col.Collation
+			switch strings.ToLower(col.Type) {
+			case "varchar", "char":
+			case "blob":
+				if collation == 0 {
+					collation = binaryCollation
+				}
+			default:
+				continue
+			}
+			if collation != 0 && collation != defaultCollation {
+				charset = mysql.AppendLengthEncodedInteger(charset, uint64(character))
+				charset = mysql.AppendLengthEncodedInteger(charset, uint64(collation))
+			}
+			character++
+		}
+		if character > 0 {
+			charset = append(mysql.AppendLengthEncodedInteger(nil, defaultCollation), charset...)
+			b = append(b, replication.TABLE_MAP_OPT_META_DEFAULT_CHARSET)
+			b = mysql.AppendLengthEncodedInteger(b, uint64(len(charset)))
+			b = append(b, charset...)
+		}
+
+		var names []byte
+		for _, col := range c.Columns {
+			names = mysql.AppendLengthEncodedInteger(names, uint64(len(col.Name)))
+			names = append(names, col.Name...)
+		}
+		b = append(b, replication.TABLE_MAP_OPT_META_COLUMN_NAME)
+		b = mysql.AppendLengthEncodedInteger(b, uint64(len(names)))
+		b = append(b, names...)
+
+		// The values of the enum and of the set columns, each list led by
+		// its length.
+		for _, typ := range []string{"set", "enum"} {
+			var values []byte
+			for _, col := range c.Columns {
+				if strings.ToLower(col.Type) != typ {
+					continue
+				}
+				values = mysql.AppendLengthEncodedInteger(values, uint64(len(col.Values)))
+				for _, v := range col.Values {
+					values = mysql.AppendLengthEncodedInteger(values, uint64(len(v)))
+					values = append(values, v...)
+				}
+			}
+			if len(values) == 0 {
+				continue
+			}
+			field := byte(replication.TABLE_MAP_OPT_META_SET_STR_VALUE)
+			if typ == "enum" {
+				field = replication.TABLE_MAP_OPT_META_ENUM_STR_VALUE
+			}
+			b = append(b, field)
+			b = mysql.AppendLengthEncodedInteger(b, uint64(len(values)))
+			b = append(b, values...)
+		}
+
+		var pk []byte
+		for i, col := range c.Columns {
+			if col.PrimaryKey {
+				pk = mysql.AppendLengthEncodedInteger(pk, uint64(i))
+			}
+		}
+		if len(pk) > 0 {
+			b = append(b, replication.TABLE_MAP_OPT_META_SIMPLE_PRIMARY_KEY)
+			b = mysql.AppendLengthEncodedInteger(b, uint64(len(pk)))
+			b = append(b, pk...)
+		}
+
+		// Enum and set values are in the default collation too.
+		enumSet := 0
+		for _, col := range c.Columns {
+			if t := strings.ToLower(col.Type); t == "enum" || t == "set" {
+				enumSet++
+			}
+		}
+		if enumSet > 0 {
+			charset := mysql.AppendLengthEncodedInteger(nil, defaultCollation)
+			b = append(b, replication.TABLE_MAP_OPT_META_ENUM_AND_SET_DEFAULT_CHARSET)
+			b = mysql.AppendLengthEncodedInteger(b, uint64(len(charset)))
+			b = append(b, charset...)
+		}
+	}
+	return b, nil
+}
+
+// columnType returns the binlog type code and table map metadata of col.
+func columnType(col Column) (byte, []byte, error) {
+	switch strings.ToLower(col.Type) {
+	case "tinyint":
+		return mysql.MYSQL_TYPE_TINY, nil, nil
+	case "smallint":
+		return mysql.MYSQL_TYPE_SHORT, nil, nil
+	case "int":
+		return mysql.MYSQL_TYPE_LONG, nil, nil
+	case "mediumint":
+		return mysql.MYSQL_TYPE_INT24, nil, nil
+	case "bigint":
+		return mysql.MYSQL_TYPE_LONGLONG, nil, nil
+	case "float":
+		return mysql.MYSQL_TYPE_FLOAT, []byte{4}, nil
+	case "double":
+		return mysql.MYSQL_TYPE_DOUBLE, []byte{8}, nil
+	case "year":
+		return mysql.MYSQL_TYPE_YEAR, nil, nil
+	case "bit":
+		bits := bitLength(col)
+		if bits < 1 || bits > 64 {
+			return 0, nil, fmt.Errorf("column %s: invalid bit(%d)", col.Name, bits)
+		}
+		return mysql.MYSQL_TYPE_BIT, []byte{byte(bits % 8), byte(bits / 8)}, nil
+	case "decimal":
+		precision, scale := decimalSize(col)
+		if precision < 1 || precision > 65 || scale < 0 || scale > 30 || scale > precision {
+			return 0, nil, fmt.Errorf("column %s: invalid decimal(%d,%d)", col.Name, precision, scale)
+		}
+		return mysql.MYSQL_TYPE_NEWDECIMAL, []byte{byte(precision), byte(scale)}, nil
+	case "enum", "set":
+		// Both are written as MYSQL_TYPE_STRING, with the real type and
+		// the size of a value in the metadata.
+		if len(col.Values) == 0 || strings.ToLower(col.Type) == "set" && len(col.Values) > 64 {
+			return 0, nil, fmt.Errorf("column %s: invalid number of %s values %d", col.Name, col.Type, len(col.Values))
+		}
+		if strings.ToLower(col.Type) == "enum" {
+			return mysql.MYSQL_TYPE_STRING, []byte{mysql.MYSQL_TYPE_ENUM, byte(enumSize(col))}, nil
+		}
+		return mysql.MYSQL_TYPE_STRING, []byte{mysql.MYSQL_TYPE_SET, byte(setSize(col))}, nil
+	case "char":
+		// The length is split between the two bytes: its bits 8 and 9
+		// are stored inverted in bits 4 and 5 of the real type.
+		length := varcharLength(col)
+		if length > 1020 {
+			return 0, nil, fmt.Errorf("column %s: %d bytes exceed char(255) of utf8mb4", col.Name, length)
+		}
+		return mysql.MYSQL_TYPE_STRING, []byte{mysql.MYSQL_TYPE_STRING ^ byte(length>>4&0x30), byte(length)}, nil
+	case "varchar":
+		return mysql.MYSQL_TYPE_VARCHAR, binary.LittleEndian.AppendUint16(nil, uint16(varcharLength(col))), nil
+	case "blob":
+		return mysql.MYSQL_TYPE_BLOB, []byte{2}, nil
+	case "date":
+		return mysql.MYSQL_TYPE_DATE, nil, nil
+	case "time", "datetime", "timestamp":
+		if col.Precision < 0 || col.Precision > 6 {
+			return 0, nil, fmt.Errorf("column %s: invalid %s(%d)", col.Name, col.Type, col.Precision)
+		}
+		typ := map[string]byte{
+			"time":      mysql.MYSQL_TYPE_TIME2,
+			"datetime":  mysql.MYSQL_TYPE_DATETIME2,
+			"timestamp": mysql.MYSQL_TYPE_TIMESTAMP2,
+		}[strings.ToLower(col.Type)]
+		return typ, []byte{byte(col.Precision)}, nil
+	case "json":
+		return mysql.MYSQL_TYPE_JSON, []byte{4}, nil
+	}
+	return 0, nil, fmt.Errorf("column %s: unsupported type %q", col.Name, col.Type)
+}
+
+func decimalSize(col Column) (precision, scale int) {
+	if col.Precision == 0 {
+		return 10, col.Scale
+	}
+	return col.Precision, col.Scale
+}
+
+// enumSize is the size of an enum value: its index in one byte, or two for
+// more than 255 values.
+func enumSize(col Column) int {
+	if len(col.Values) > 255 {
+		return 2
+	}
+	return 1
+}
+
+// setSize is the size of a set value: a bitmap of its values.
+func setSize(col Column) int {
+	return (len(col.Values) + 7) / 8
+}
+
+// bitLength is the number of bits of a bit column.
+func bitLength(col Column) int {
+	if col.Length == 0 {
+		return 1
+	}
+	return col.Length
+}
+
+// varcharLength is the maximum length of a varchar or char column, in
+// bytes.
+func varcharLength(col Column) int {
+	if col.Length <= 0 {
+		return 255
+	}
+	return col.Length
+}
+
+func rowsBody(id uint64, typ replication.EventType, c *Change, rowImage string) ([]byte, error) {
+	n := len(c.Columns)
+	for i, row := range c.Rows {
+		if len(row) != n {
+			return nil, fmt.Errorf("%s.%s row %d has %d values for %d columns", c.Schema, c.Table, i+1, len(row), n)
+		}
+	}
+	before, after, err := imageColumns(typ, c, rowImage)
+	if err != nil {
+		return nil, err
+	}
+
+	partial := typ == replication.PARTIAL_UPDATE_ROWS_EVENT
+	update := typ == replication.UPDATE_ROWS_EVENTv1 || typ == replication.UPDATE_ROWS_EVENTv2 || partial
+	b := appendTableID(nil, id)
+	b = binary.LittleEndian.AppendUint16(b, rowsStmtEnd)
+	if typ >= replication.WRITE_ROWS_EVENTv2 {
+		b = binary.LittleEndian.AppendUint16(b, 2) // extra data length, including itself
+	}
+	b = mysql.AppendLengthEncodedInteger(b, uint64(n))
+	b = append(b, columnBitmap(before)...)
+	if update {
+		b = append(b, columnBitmap(after)...)
+	}
+
+	for i, row := range c.Rows {
+		image := before
+		if update && i%2 == 1 {
+			image = after
+		}
+		if partial && i%2 == 1 {
+			// The value options, and with PARTIAL_JSON a bit per json
+			// column telling whether its value is a diff.
+			var diffs []bool
+			for j, col := range c.Columns {
+				if strings.ToLower(col.Type) == "json" {
+					_, isDiff, _ := jsonDiffs(row[j])
+					diffs = append(diffs, isDiff)
+				}
+			}
+			if len(diffs) == 0 {
+				b = append(b, 0)
+			} else {
+				b = append(b, partialJSONOption)
+				b = append(b, columnBitmap(diffs)...)
+			}
+		}
+		present := 0
+		nulls := make([]byte, (n+7)/8)
+		for j, v := range row {
+			if !image[j] {
+				continue
+			}
+			if v == nil {
+				nulls[present/8] |= 1 << (present % 8)
+			}
+			present++
+		}
+		b = append(b, padNullBitmap(nulls[:(present+7)/8], present)...)
+		for j, v := range row {
+			if !image[j] || v == nil {
+				continue
+			}
+			if _, isDiff, _ := jsonDiffs(v); isDiff && strings.ToLower(c.Columns[j].Type) == "json" && (!partial || i%2 == 0) {
+				return nil, fmt.Errorf("%s.%s row %d column %s: json diffs need the after image of a partial_json update", c.Schema, c.Table, i+1, c.Columns[j].Name)
+			}
+			var err error
+			if b, err = appendValue(b, c.Columns[j], v); err != nil {
+				return nil, fmt.Errorf("%s.%s row %d column %s: %v", c.Schema, c.Table, i+1, c.Columns[j].Name, err)
+			}
+		}
+	}
+	return b, nil
+}
+
+// imageColumns returns which columns the before and after images of a
+// change carry under rowImage. Inserts use the before set for their only
+// image.
+func imageColumns(typ replication.EventType, c *Change, rowImage string) (before, after []bool, err error) {
+	n := len(c.Columns)
+	before, after = make([]bool, n), make([]bool, n)
+	for i := range before {
+		before[i], after[i] = true, true
+	}
+	image := strings.ToLower(rowImage)
+	switch image {
+	case "", "full":
+		return before, after, nil
+	case "noblob", "minimal":
+	default:
+		return nil, nil, fmt.Errorf("unknown row image %q (full, noblob or minimal)", rowImage)
+	}
+	if typ == replication.WRITE_ROWS_EVENTv1 || typ == replication.WRITE_ROWS_EVENTv2 {
+		return before, after, nil
+	}
+	hasPK := false
+	for _, col := range c.Columns {
+		hasPK = hasPK || col.PrimaryKey
+	}
+	for j, col := range c.Columns {
+		if image == "minimal" {
+			// Before images keep the key; after images what changed.
+			before[j] = !hasPK || col.PrimaryKey
+			after[j] = changed(c.Rows, j)
+			continue
+		}
+		if t := strings.ToLower(col.Type); t != "blob" && t != "json" {
+			continue
+		}
+		// Without a primary key the whole before image identifies the row.
+		before[j] = !hasPK
+		after[j] = changed(c.Rows, j)
+	}
+	return before, after, nil
+}
+
+// changed reports whether any update of rows, given as before and after
+// image pairs, changes column j.
+func changed(rows [][]interface{}, j int) bool {
+	for r := 0; r+1 < len(rows); r += 2 {
+		if fmt.Sprint(rows[r][j]) != fmt.Sprint(rows[r+1][j]) {
+			return true
+		}
+	}
+	return false
+}
+
+func columnBitmap(columns []bool) []byte {
+	bitmap := make([]byte, (len(columns)+7)/8)
+	for i, ok := range columns {
+		if ok {
+			bitmap[i/8] |= 1 << (i % 8)
+		}
+	}
+	return bitmap
+}
+
+func appendValue(b []byte, col Column, v interface{}) ([]byte, error) {
+	switch strings.ToLower(col.Type) {
+	case "tinyint", "smallint", "mediumint", "int", "bigint":
+		i, err := toInt(v)
+		if err != nil {
+			return nil, err
+		}
+		switch strings.ToLower(col.Type) {
+		case "tinyint":
+			return append(b, byte(i)), nil
+		case "smallint":
+			return binary.LittleEndian.AppendUint16(b, uint16(i)), nil
+		case "mediumint":
+			return append(b, byte(i), byte(i>>8), byte(i>>16)), nil
+		case "int":
+			return binary.LittleEndian.AppendUint32(b, uint32(i)), nil
+		}
+		return binary.LittleEndian.AppendUint64(b, uint64(i)), nil
+	case "float", "double":
+		f, err := toFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		if strings.ToLower(col.Type) == "float" {
+			return binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(f))), nil
+		}
+		return binary.LittleEndian.AppendUint64(b, math.Float64bits(f)), nil
+	case "year":
+		y, err := toInt(v)
+		if err != nil {
+			return nil, err
+		}
+		// 0 is the zero year, others are stored from 1900.
+		if y != 0 && (y < 1901 || y > 2155) {
+			return nil, fmt.Errorf("year %d out of range", y)
+		}
+		if y != 0 {
+			y -= 1900
+		}
+		return append(b, byte(y)), nil
+	case "bit":
+		i, err := toInt(v)
+		if err != nil {
+			return nil, err
+		}
+		for k := (bitLength(col)+7)/8 - 1; k >= 0; k-- {
+			b = append(b, byte(uint64(i)>>(8*k)))
+		}
+		return b, nil
+	case "json":
+		return appendJSON(b, v)
+	case "varchar", "char", "blob":
+		s, err := toBytes(v)
+		if err != nil {
+			return nil, err
+		}
+		if strings.ToLower(col.Type) == "blob" {
+			if len(s) > math.MaxUint16 {
+				return nil, fmt.Errorf("blob of %d bytes is too long", len(s))
+			}
+			b = binary.LittleEndian.AppendUint16(b, uint16(len(s)))
+		} else {
+			if len(s) > varcharLength(col) {
+				return nil, fmt.Errorf("%d bytes exceed %s(%d)", len(s), strings.ToLower(col.Type), varcharLength(col))
+			}
+			if varcharLength(col) < 256 {
+				b = append(b, byte(len(s)))
+			} else {
+				b = binary.LittleEndian.AppendUint16(b, uint16(len(s)))
+			}
+		}
+		return append(b, s...), nil
+	case "date", "time", "datetime":
+		s, err := toTemporal(v)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(s, "-") {
+			return nil, fmt.Errorf("negative time %s is not supported", s)
+		}
+		typ, meta, err := columnType(col)
+		if err != nil {
+			return nil, err
+		}
+		var dec uint16
+		if len(meta) > 0 {
+			dec = uint16(meta[0])
+		}
+		return appendColumnValue(b, typ, dec, s)
+	case "timestamp":
+		s, err := toTemporal(v)
+		if err != nil {
+			return nil, err
+		}
+		// Timestamps are seconds since the epoch, taking the values as
+		// UTC; the zero timestamp is 0.
+		var sec int64
+		frac := 0
+		if strings.HasPrefix(s, "0000-00-00") {
+			_, _, _, _, _, _, frac, err = parseTemporal(s, "timestamp")
+		} else {
+			var t time.Time
+			t, err = time.Parse("2006-01-02 15:04:05.999999", s)
+			sec, frac = t.Unix(), t.Nanosecond()/1000
+		}
+		if err != nil {
+			return nil, err
+		}
+		if sec < 0 || sec > math.MaxInt32 {
+			return nil, fmt.Errorf("timestamp %s out of range", s)
+		}
+		b = binary.BigEndian.AppendUint32(b, uint32(sec))
+		return appendFraction(b, frac, uint16(col.Precision)), nil
+	case "decimal":
+		s, err := decimalString(v)
+		if err != nil {
+			return nil, err
+		}
+		precision, scale := decimalSize(col)
+		return appendDecimal(b, s, precision, scale)
+	case "enum":
+		i, err := valueIndex(col, v)
+		if err != nil {
+			return nil, err
+		}
+		if enumSize(col) == 1 {
+			return append(b, byte(i)), nil
+		}
+		return binary.LittleEndian.AppendUint16(b, uint16(i)), nil
+	case "set":
+		var bits uint64
+		if s, ok := v.(string); ok {
+			for _, value := range strings.Split(s, ",") {
+				if value == "" {
+					continue
+				}
+				i, err := valueIndex(col, value)
+				if err != nil {
+					return nil, err
+				}
+				bits |= 1 << (i - 1)
+			}
+		} else {
+			i, err := toInt(v)
+			if err != nil {
+				return nil, err
+			}
+			bits = uint64(i)
+		}
+		for i := 0; i < setSize(col); i++ {
+			b = append(b, byte(bits>>(8*i)))
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("unsupported type %q", col.Type)
+}
+
+// valueIndex returns the 1-based index of an enum or set value, given as
+// the value or as the index.
+func valueIndex(col Column, v interface{}) (int, error) {
+	if s, ok := v.(string); ok {
+		for i, value := range col.Values {
+			if value == s {
+				return i + 1, nil
+			}
+		}
+		return 0, fmt.Errorf("%q is not one of the %s values", s, col.Type)
+	}
+	i, err := toInt(v)
+	if err != nil {
+		return 0, err
+	}
+	if i < 0 || i > int64(len(col.Values)) {
+		return 0, fmt.Errorf("index %d out of the %d %s values", i, len(col.Values), col.Type)
+	}
+	return int(i), nil
+}
+
+// decimalString returns v, a number or its decimal string, as a decimal
+// string.
+func decimalString(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return string(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	}
+	i, err := toInt(v)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(i, 10), nil
+}
+
+func appendTableID(b []byte, id uint64) []byte {
+	return appendTableIDSize(b, id, 6)
+}
+
+func toInt(v interface{}) (int64, error) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		return int64(v), nil
+	case float64:
+		return int64(v), nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		u, err := strconv.ParseUint(string(v), 10, 64)
+		return int64(u), err
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	}
+	return 0, fmt.Errorf("cannot use %T as an integer", v)
+}
+
+func toFloat(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case json.Number:
+		return v.Float64()
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	i, err := toInt(v)
+	return float64(i), err
+}
+
+func toBytes(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	case json.Number:
+		return []byte(v), nil
+	}
+	return nil, fmt.Errorf("cannot use %T as a string", v)
+}
+
+// toTemporal returns v, a time.Time or a string as MySQL writes dates and
+// times, as that string.
+func toTemporal(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05.999999"), nil
+	case string:
+		return v, nil
+	}
+	return "", fmt.Errorf("cannot use %T as a date or time", v)
+}
@@ -0,0 +1,252 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultLayout formats the times unix-time and timezone return, as MySQL
+// writes a DATETIME.
+const DefaultLayout = "2006-01-02 15:04:05.999999"
+
+// Rule binds a built-in transformer to the columns matching Column, as a
+// rules file lists them:
+//
+//	[{"column": "shop.orders.total_cents", "transform": "scale", "factor": 0.01, "digits": 2},
+//	 {"column": "shop.*.created_at", "transform": "unix-time", "zone": "Europe/Paris"},
+//	 {"column": "shop.orders.status", "transform": "map", "values": {"1": "paid", "2": "shipped"}}]
+//
+// The built-in transformers are:
+//
+//   - scale: multiplies a number by Factor, rounded to Digits when given,
+//     for unit conversions such as cents to units.
+//   - round: rounds a number to Digits decimal places.
+//   - unix-time: formats seconds since the epoch, or milliseconds or
+//     microseconds with Unit "ms" or "us", as a time in Zone (UTC by
+//     default) with Layout.
+//   - timezone: formats a DATETIME stored in From (UTC by default) as the
+//     same instant in Zone with Layout.
+//   - map: replaces a value, as text, with its entry in Values, or Default
+//     when it has none and Default is set. An ENUM value is its index.
+//   - upper, lower and trim: change the case of a string, or trim the
+//     white space around it.
+type Rule struct {
+	Column    string `json:"column"`
+	Transform string `json:"transform"`
+
+	Factor  float64           `json:"factor,omitempty"`
+	Digits  *int              `json:"digits,omitempty"`
+	Unit    string            `json:"unit,omitempty"`
+	Zone    string            `json:"zone,omitempty"`
+	From    string            `json:"from,omitempty"`
+	Layout  string            `json:"layout,omitempty"`
+	Values  map[string]string `json:"values,omitempty"`
+	Default *string           `json:"default,omitempty"`
+}
+
+// LoadRules reads a JSON array of Rules from path and registers their
+// transformers in r.
+func LoadRules(r *Registry, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if len(rules) == 0 {
+		return fmt.Errorf("%s: no rules", path)
+	}
+	for i, rule := range rules {
+		t, err := New(rule)
+		if err != nil {
+			return fmt.Errorf("%s: rule %d: %v", path, i+1, err)
+		}
+		if err := r.Register(rule.Column, t); err != nil {
+			return fmt.Errorf("%s: rule %d: %v", path, i+1, err)
+		}
+	}
+	return nil
+}
+
+// New returns the built-in transformer rule names, configured by rule.
+func New(rule Rule) (Transformer, error) {
+	layout := rule.Layout
+	if layout == "" {
+		layout = DefaultLayout
+	}
+	zone, err := location(rule.Zone)
+	if err != nil {
+		return nil, err
+	}
+	switch rule.Transform {
+	case "scale":
+		if rule.Factor == 0 {
+			return nil, fmt.Errorf("scale needs a factor")
+		}
+		return Func(func(v interface{}) (interface{}, error) {
+			return numeric(v, func(f float64) float64 { return roundTo(f*rule.Factor, rule.Digits) })
+		}), nil
+	case "round":
+		if rule.Digits == nil {
+			return nil, fmt.Errorf("round needs digits")
+		}
+		return Func(func(v interface{}) (interface{}, error) {
+			return numeric(v, func(f float64) float64 { return roundTo(f, rule.Digits) })
+		}), nil
+	case "unix-time":
+		var unit time.Duration
+		switch rule.Unit {
+		case "", "s":
+			unit = time.Second
+		case "ms":
+			unit = time.Millisecond
+		case "us":
+			unit = time.Microsecond
+		default:
+			return nil, fmt.Errorf("unknown unit %q (s, ms or us)", rule.Unit)
+		}
+		return Func(func(v interface{}) (interface{}, error) {
+			if v == nil {
+				return nil, nil
+			}
+			n, ok := number(v)
+			if !ok {
+				return nil, fmt.Errorf("%.32q is not a number", text(v))
+			}
+			return time.UnixMicro(int64(n * float64(unit/time.Microsecond))).In(zone).Format(layout), nil
+		}), nil
+	case "timezone":
+		if rule.Zone == "" {
+			return nil, fmt.Errorf("timezone needs a zone")
+		}
+		from, err := location(rule.From)
+		if err != nil {
+			return nil, err
+		}
+		return Func(func(v interface{}) (interface{}, error) {
+			var t time.Time
+			switch v := v.(type) {
+			case nil:
+				return nil, nil
+			case time.Time:
+				t = time.Date(v.Year(), v.Month(), v.Day(), v.Hour(), v.Minute(), v.Second(), v.Nanosecond(), from)
+			case string:
+				if t, err = time.ParseInLocation("2006-01-02 15:04:05.999999", v, from); err != nil {
+					return nil, fmt.Errorf("%.32q is not a DATETIME", v)
+				}
+			default:
+				return nil, fmt.Errorf("%.32q is not a DATETIME", text(v))
+			}
+			return t.In(zone).Format(layout), nil
+		}), nil
+	case "map":
+		if len(rule.Values) == 0 {
+			return nil, fmt.Errorf("map needs values")
+		}
+		return Func(func(v interface{}) (interface{}, error) {
+			if v == nil {
+				return nil, nil
+			}
+			if mapped, ok := rule.Values[text(v)]; ok {
+				return mapped, nil
+			}
+			if rule.Default != nil {
+				return *rule.Default, nil
+			}
+			return v, nil
+		}), nil
+	case "upper", "lower", "trim":
+		change := map[string]func(string) string{
+			"upper": strings.ToUpper, "lower": strings.ToLower, "trim": strings.TrimSpace,
+		}[rule.Transform]
+		return Func(func(v interface{}) (interface{}, error) {
+			switch v := v.(type) {
+			case string:
+				return change(v), nil
+			case []byte:
+				return change(string(v)), nil
+			}
+			return v, nil
+		}), nil
+	case "":
+		return nil, fmt.Errorf("no transform")
+	}
+	return nil, fmt.Errorf("unknown transform %q (scale, round, unix-time, timezone, map, upper, lower or trim)", rule.Transform)
+}
+
+func location(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(name)
+}
+
+// numeric applies f to v as a number, leaving NULL alone.
+func numeric(v interface{}, f func(float64) float64) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	n, ok := number(v)
+	if !ok {
+		return nil, fmt.Errorf("%.32q is not a number", text(v))
+	}
+	return f(n), nil
+}
+
+// number returns v as a float64: a Go number, or the text of one.
+func number(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	f, err := strconv.ParseFloat(text(v), 64)
+	return f, err == nil
+}
+
+// text is v as text, as go-parse outputs it.
+func text(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(v)
+}
+
+func roundTo(f float64, digits *int) float64 {
+	if digits == nil {
+		return f
+	}
+	p := math.Pow10(*digits)
+	return math.Round(f*p) / p
+}
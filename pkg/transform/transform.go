@@ -0,0 +1,137 @@
+// Package transform changes column values of decoded row events before
+// go-parse outputs them: unit conversions, timestamp normalization, or
+// enrichment from a lookup table. Transformers are bound to columns by
+// db.table.column patterns in a Registry, either in Go or from a JSON file
+// of Rules naming the built-in transformers.
+//
+// go-parse applies the transformers of Default. A custom build registers
+// its own from an init function in a file added to package main:
+//
+//	func init() {
+//		transform.Default.Register("shop.orders.total_cents", transform.Func(func(v interface{}) (interface{}, error) {
+//			...
+//		}))
+//	}
+package transform
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Transformer changes one column value. Values are those go-mysql decodes,
+// unsigned integers as unsigned: Go integers and floats, strings and byte
+// slices, nil for NULL, and for DECIMAL and other types go-parse formats
+// itself, a fmt.Stringer. A transformer may return a value of another
+// type; it is output as such. An error leaves the value as it was.
+type Transformer interface {
+	Transform(v interface{}) (interface{}, error)
+}
+
+// Func adapts a function to a Transformer.
+type Func func(v interface{}) (interface{}, error)
+
+// Transform calls f.
+func (f Func) Transform(v interface{}) (interface{}, error) { return f(v) }
+
+// Registry binds transformers to columns.
+type Registry struct {
+	mu    sync.Mutex
+	rules []binding
+}
+
+type binding struct {
+	// db, table and column are path.Match patterns.
+	db, table, column string
+	t                 Transformer
+}
+
+// Default is the registry go-parse applies.
+var Default = new(Registry)
+
+// Register binds t to the columns matching pattern, db.table.column, each
+// part of which may use the wildcards of path.Match (* and ?). A column is
+// named as in the table map with binlog_row_metadata=FULL or -schemaFile,
+// or by position as @N. A column matched by several transformers goes
+// through each, in the order they were registered.
+func (r *Registry) Register(pattern string, t Transformer) error {
+	parts := strings.Split(pattern, ".")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return fmt.Errorf("invalid column pattern %q, want db.table.column", pattern)
+	}
+	for _, p := range parts {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid column pattern %q: %v", pattern, err)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rules = append(r.rules, binding{parts[0], parts[1], parts[2], t})
+	return nil
+}
+
+// Empty reports whether no transformer is registered.
+func (r *Registry) Empty() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.rules) == 0
+}
+
+// Clone returns a registry holding the bindings of r.
+func (r *Registry) Clone() *Registry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Registry{rules: append([]binding(nil), r.rules...)}
+}
+
+// Replace replaces the bindings of r with those of from, so that a set of
+// rules can be reloaded in one step.
+func (r *Registry) Replace(from *Registry) {
+	from.mu.Lock()
+	rules := append([]binding(nil), from.rules...)
+	from.mu.Unlock()
+	r.mu.Lock()
+	r.rules = rules
+	r.mu.Unlock()
+}
+
+// Lookup returns the transformers of a column of db.table, known by any of
+// names (its name and @N), chained into one, or nil when there are none.
+func (r *Registry) Lookup(db, table string, names ...string) Transformer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var chain []Transformer
+	for _, b := range r.rules {
+		if !match(b.db, db) || !match(b.table, table) {
+			continue
+		}
+		for _, name := range names {
+			if match(b.column, name) {
+				chain = append(chain, b.t)
+				break
+			}
+		}
+	}
+	switch len(chain) {
+	case 0:
+		return nil
+	case 1:
+		return chain[0]
+	}
+	return Func(func(v interface{}) (interface{}, error) {
+		for _, t := range chain {
+			var err error
+			if v, err = t.Transform(v); err != nil {
+				return nil, err
+			}
+		}
+		return v, nil
+	})
+}
+
+func match(pattern, name string) bool {
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
@@ -0,0 +1,525 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// runPlan is -plan: it checks the flags of the run against the file's
+// cached metadata and event headers and prints what the run would do,
+// without decoding the events. It returns the number of problems found.
+func runPlan(w io.Writer, name string, startPosition int64) int {
+	p := &planner{w: w}
+	if *binlogFile == "" {
+		// Only commands that name their files elsewhere get here.
+		fmt.Fprintf(w, "Run: %s command\n", name)
+		p.planCommand(name)
+		return p.finish()
+	}
+	md, err := loadFileMetadata(*binlogFile, !*noCache)
+	if err != nil {
+		p.problem("%v", err)
+		return p.finish()
+	}
+	p.md = md
+	fmt.Fprintf(w, "File: %s, positions %d - %d, %s to %s\n", md.Path, md.FirstPos, md.LastPos,
+		time.Unix(int64(md.FirstTimestamp), 0).Format(timeFormat), time.Unix(int64(md.LastTimestamp), 0).Format(timeFormat))
+
+	if name == "" && *listPositions {
+		fmt.Fprintln(w, "Run: list event positions")
+		return p.finish()
+	}
+	if name == "" && *metadata {
+		fmt.Fprintln(w, "Run: print file metadata")
+		return p.finish()
+	}
+	if name == "" && *gtidSummary {
+		fmt.Fprintln(w, "Run: print the GTID summary")
+		return p.finish()
+	}
+	if name == "" && *findTimeAt != "" {
+		if t, err := parseDatetime(*findTimeAt); err != nil {
+			p.problem("-findTime: %v", err)
+		} else {
+			fmt.Fprintf(w, "Run: find the first event at or after %s from event headers\n", t.Format(timeFormat))
+		}
+		return p.finish()
+	}
+	if name == "" && *findGTID != "" {
+		if _, err := parseGTID(*findGTID); err != nil {
+			p.problem("-findGTID: %v", err)
+		} else {
+			fmt.Fprintf(w, "Run: find the transaction of GTID %s\n", *findGTID)
+		}
+		return p.finish()
+	}
+	if startPosition == -1 && name == "" && !*countEvents && !reportRequested() && !eventTimes.bounded() && transactionFilter == nil && positions == nil {
+		p.problem("either -offset or -logPosition must be specified")
+		return p.finish()
+	}
+	if startPosition == -1 {
+		startPosition = 4
+	}
+	p.checkPosition("start", startPosition)
+
+	switch {
+	case name != "":
+		fmt.Fprintf(w, "Run: %s command\n", name)
+		p.planCommand(name)
+	case *countEvents:
+		fmt.Fprintln(w, "Run: count events by type from event headers")
+	case reportRequested():
+		fmt.Fprintf(w, "Run: reports %s\n", strings.Join(requestedReports(), ", "))
+	default:
+		if *outputFormat != "text" {
+			if v, err := resolveOutputVersion(*outputVersion, "json", jsonFormatVersion); err != nil {
+				p.problem("%v", err)
+			} else {
+				fmt.Fprintf(w, "Run: %s dump, format version %d\n", *outputFormat, v)
+			}
+		} else if v, err := resolveOutputVersion(*outputVersion, "text", textOutputLatest); err != nil {
+			p.problem("%v", err)
+		} else {
+			fmt.Fprintf(w, "Run: text dump, output version %d\n", v)
+		}
+		if *diffUpdates {
+			if *outputFormat != "text" || (*outputVersion != 0 && *outputVersion < textOutputV8) {
+				p.problem("-diff needs text output version %d or later", textOutputV8)
+			} else {
+				fmt.Fprintln(w, "Updates: changed columns only")
+			}
+		}
+		if g := rowsGrep; g != nil {
+			in := ""
+			if g.columns != nil {
+				in = " in " + *grepColumn
+			}
+			fmt.Fprintf(w, "Rows events: only those holding %q%s\n", g.value, in)
+		}
+		if *stopAtNext {
+			fmt.Fprintln(w, "Stop: after the event at the start position")
+		}
+	}
+	if name == "" && *maxEvents > 0 {
+		fmt.Fprintf(w, "Stop: after %s\n", plural(*maxEvents, "event"))
+	}
+	if *follow {
+		fmt.Fprintln(w, "Follow: keep reading as the server appends, into the next file at a rotation, until interrupted")
+	}
+	if name != "batch" && name != "check-chain" && name != "compare-files" && name != "compare-windows" && name != "gen-testdata" && name != "merge" && name != "purge-advisor" {
+		to := "end of file"
+		if name == "" && *stopPos > 0 {
+			to = fmt.Sprintf("first event at or after %d", *stopPos)
+			if *stopPos <= startPosition {
+				p.problem("-stopPosition %d is not after the start position %d", *stopPos, startPosition)
+			}
+		}
+		fmt.Fprintf(w, "Range: %d to %s\n", startPosition, to)
+	}
+	if r := eventTimes; r.bounded() && (name == "" || name == "merge" || strings.HasPrefix(name, "recover-")) {
+		from, to := "start of file", "end of file"
+		if !r.start.IsZero() {
+			from = r.start.Format(timeFormat)
+		}
+		if !r.stop.IsZero() {
+			to = "first event at or after " + r.stop.Format(timeFormat)
+		}
+		fmt.Fprintf(w, "Time range: %s to %s\n", from, to)
+		p.checkTimes("the", r.start, r.stop)
+	}
+	if shardNames != nil {
+		fmt.Fprintf(w, "Shards: %s\n", shardNames)
+	}
+	if tableSchemas != nil {
+		fmt.Fprintf(w, "Column names: %s from %s\n", plural(len(tableSchemas), "table"), *schemaFile)
+	}
+	if f := eventFilter; f != nil {
+		var parts []string
+		for _, x := range []struct {
+			flag     string
+			patterns []string
+		}{
+			{"-includeDB", f.includeDB},
+			{"-excludeDB", f.excludeDB},
+			{"-includeTable", f.includeTable},
+			{"-excludeTable", f.excludeTable},
+		} {
+			if len(x.patterns) > 0 {
+				parts = append(parts, x.flag+" "+strings.Join(x.patterns, ","))
+			}
+		}
+		fmt.Fprintf(w, "Filter: %s\n", strings.Join(parts, "; "))
+		for _, t := range f.includeTable {
+			p.checkTable("-includeTable", t)
+		}
+		for _, db := range f.includeDB {
+			p.checkTable("-includeDB", db+".*")
+		}
+	}
+	if f := transactionFilter; f != nil && name == "" && !*countEvents {
+		var parts []string
+		if f.include != nil {
+			parts = append(parts, "-includeGTIDs "+f.include.String())
+			p.checkGTIDOverlap("-includeGTIDs", f.include)
+		}
+		if f.exclude != nil {
+			parts = append(parts, "-excludeGTIDs "+f.exclude.String())
+		}
+		if f.seen != nil {
+			parts = append(parts, "skip GTIDs already read (-dedupGTIDs)")
+		}
+		fmt.Fprintf(w, "Transactions: %s\n", strings.Join(parts, "; "))
+	}
+	if positions != nil {
+		fmt.Fprintf(w, "Position store: %s\n", redactedStore(*stateFile+*positionStoreURL))
+		if st, err := positions.load(); err != nil {
+			p.problem("%v", err)
+		} else if st != nil {
+			fmt.Fprintf(w, "  last recorded: %s at %d", st.File, st.Position)
+			if st.GTID != "" {
+				fmt.Fprintf(w, ", GTID %s", st.GTID)
+			}
+			fmt.Fprintf(w, ", %s\n", st.Updated.Local().Format(timeFormat))
+		}
+	}
+	return p.finish()
+}
+
+// reportRequested reports whether any report mode flag is set.
+func reportRequested() bool {
+	return *busiest > 0 || *timeline || *showStats || *anomalies || *parallel || *risk || *fingerprint || *columnStats || *maintenanceChurn || *findLargeTrx || *replicaGTIDs != "" || *schemaChanges || *formatChanges || *timestampSkew > 0 || *amplification > 0
+}
+
+func requestedReports() []string {
+	var names []string
+	for _, r := range []struct {
+		name string
+		on   bool
+	}{
+		{"stats", *showStats},
+		{"busiest", *busiest > 0},
+		{"timeline", *timeline},
+		{"anomalies", *anomalies},
+		{"parallel", *parallel},
+		{"risk", *risk},
+		{"fingerprint", *fingerprint},
+		{"column stats", *columnStats},
+		{"maintenance", *maintenanceChurn},
+		{"large transactions", *findLargeTrx},
+		{"replica lag", *replicaGTIDs != ""},
+		{"schema changes", *schemaChanges},
+		{"format changes", *formatChanges},
+		{"timestamp skew", *timestampSkew > 0},
+		{"write amplification", *amplification > 0},
+	} {
+		if r.on {
+			names = append(names, r.name)
+		}
+	}
+	return names
+}
+
+type planner struct {
+	w        io.Writer
+	md       *fileMetadata
+	problems []string
+	starts   map[int64]bool
+}
+
+func (p *planner) problem(format string, args ...interface{}) {
+	p.problems = append(p.problems, fmt.Sprintf(format, args...))
+}
+
+func (p *planner) finish() int {
+	if len(p.problems) == 0 {
+		fmt.Fprintln(p.w, "No problems found")
+		return 0
+	}
+	fmt.Fprintf(p.w, "%s:\n", plural(len(p.problems), "problem"))
+	for _, s := range p.problems {
+		fmt.Fprintf(p.w, "  %s\n", s)
+	}
+	return len(p.problems)
+}
+
+// checkPosition reports a bound that is not the start of an event.
+func (p *planner) checkPosition(what string, pos int64) {
+	if p.starts == nil {
+		p.starts = make(map[int64]bool)
+		err := scanHeaders(p.md.Path, 4, func(_ *replication.EventHeader, offset int64) error {
+			p.starts[offset] = true
+			return nil
+		})
+		if err != nil {
+			p.problem("%v", err)
+		}
+	}
+	switch {
+	case pos <= 4:
+	case pos >= int64(p.md.LastPos):
+		p.problem("%s position %d is at or past the end of the file (%d)", what, pos, p.md.LastPos)
+	case !p.starts[pos]:
+		p.problem("%s position %d is not the start of an event", what, pos)
+	}
+}
+
+// checkTimes reports time bounds that leave nothing of the file to read.
+// Either bound may be zero.
+func (p *planner) checkTimes(what string, start, stop time.Time) {
+	first, last := time.Unix(int64(p.md.FirstTimestamp), 0), time.Unix(int64(p.md.LastTimestamp), 0)
+	switch {
+	case !start.IsZero() && start.After(last):
+		p.problem("%s start time %s is after the last event (%s)", what, start.Format(timeFormat), last.Format(timeFormat))
+	case !stop.IsZero() && !stop.After(first):
+		p.problem("%s stop time %s is not after the first event (%s)", what, stop.Format(timeFormat), first.Format(timeFormat))
+	}
+}
+
+// checkTable reports a table, or db.table pattern, that no table map in
+// the file matches.
+func (p *planner) checkTable(what, pattern string) {
+	if !matchAnyTable(pattern, p.md.Tables) {
+		p.problem("%s %s matches no table in the file", what, pattern)
+	}
+}
+
+func matchAnyTable(pattern string, tables []string) bool {
+	for _, t := range tables {
+		if matchTable([]string{pattern}, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkGTIDs reports GTIDs of set that the file does not contain.
+func (p *planner) checkGTIDs(what string, set *mysql.MysqlGTIDSet) {
+	have, err := mysql.ParseMysqlGTIDSet(p.md.GTIDSet)
+	if err != nil {
+		p.problem("%v", err)
+		return
+	}
+	if !have.Contain(set) {
+		fileSet := p.md.GTIDSet
+		if fileSet == "" {
+			fileSet = "none"
+		}
+		p.problem("%s %s are not all in the file (file has %s)", what, set, fileSet)
+	}
+}
+
+// checkGTIDOverlap reports a set that shares no GTID with the file.
+func (p *planner) checkGTIDOverlap(what string, set *mysql.MysqlGTIDSet) {
+	have, err := mysql.ParseMysqlGTIDSet(p.md.GTIDSet)
+	if err != nil {
+		p.problem("%v", err)
+		return
+	}
+	if gtidSetsOverlap(have.(*mysql.MysqlGTIDSet), set) {
+		return
+	}
+	p.problem("%s %s matches no transaction in the file", what, set)
+}
+
+func (p *planner) planCommand(name string) {
+	switch name {
+	case "batch":
+		if *manifest == "" {
+			p.problem("batch requires -manifest")
+			return
+		}
+		jobs, err := loadManifest(*manifest)
+		if err != nil {
+			p.problem("%v", err)
+			return
+		}
+		for _, j := range jobs {
+			fmt.Fprintf(p.w, "Job %s: %s output to %s\n", j.Name, j.Format, j.Output)
+			if j.Start > 0 {
+				p.checkPosition(j.Name+": start", j.Start)
+			}
+			if j.Stop > 0 && j.Stop < int64(p.md.LastPos) {
+				p.checkPosition(j.Name+": stop", j.Stop)
+			}
+			p.checkTimes(j.Name+":", j.startTime, j.stopTime)
+			if j.gtids != nil {
+				p.checkGTIDs(j.Name+": gtids", j.gtids)
+			}
+			for _, t := range j.Tables {
+				p.checkTable(j.Name+": table", t)
+			}
+		}
+	case "compare-relay":
+		if *relayLog == "" {
+			p.problem("compare-relay requires -relay")
+		} else if _, err := os.Stat(*relayLog); err != nil {
+			p.problem("%v", err)
+		} else {
+			fmt.Fprintf(p.w, "Relay log: %s\n", *relayLog)
+		}
+	case "merge":
+		sources, err := parseMergeSources(flag.Args())
+		if err != nil {
+			p.problem("%v", err)
+			return
+		}
+		for _, src := range sources {
+			fmt.Fprintf(p.w, "Source %s: %s\n", src.name, plural(len(src.files), "file"))
+		}
+	case "compare-files":
+		if flag.NArg() != 2 {
+			p.problem("compare-files takes two binlogs as arguments")
+			return
+		}
+		for i, spec := range flag.Args() {
+			files, err := expandBinlogFiles(spec)
+			if err != nil {
+				p.problem("%v", err)
+				continue
+			}
+			fmt.Fprintf(p.w, "%c: %s\n", "AB"[i], plural(len(files), "file"))
+		}
+	case "compare-windows":
+		for _, spec := range []string{*windowA, *windowB} {
+			if spec == "" {
+				p.problem("compare-windows requires -windowA and -windowB")
+				return
+			}
+			win, err := parseWindow(spec, *binlogFile)
+			if err != nil {
+				p.problem("%v", err)
+				continue
+			}
+			fmt.Fprintf(p.w, "Window: %s\n", win)
+			if p.md == nil || win.file != p.md.Path {
+				// Only the bounds of -file are checked against its events.
+				if _, err := os.Stat(win.file); err != nil {
+					p.problem("%v", err)
+				}
+				continue
+			}
+			if win.startPos > 0 {
+				p.checkPosition("window start", win.startPos)
+			}
+			if win.stopPos > 0 && win.stopPos < int64(p.md.LastPos) {
+				p.checkPosition("window stop", win.stopPos)
+			}
+			p.checkTimes("window", win.startTime, win.stopTime)
+		}
+	case "value-at":
+		if *valueTable == "" || *valuePK == "" || *valueTS == "" {
+			p.problem("value-at requires -table, -pk and -ts")
+			return
+		}
+		if !slices.Contains(p.md.Tables, *valueTable) {
+			p.problem("table %s is not in the file", *valueTable)
+		}
+		if at, err := parseDatetime(*valueTS); err != nil {
+			p.problem("%v", err)
+		} else if at.Before(time.Unix(int64(p.md.FirstTimestamp), 0)) {
+			p.problem("-ts %s is before the first event of the file", *valueTS)
+		}
+	case "audit":
+		if *valueTable == "" || *valuePK == "" {
+			p.problem("audit requires -table and -pk")
+			return
+		}
+		if !slices.Contains(p.md.Tables, auditTable()) {
+			p.problem("table %s is not in the file", auditTable())
+		}
+	case "recover-deletes", "recover-overwrites":
+		if *valueTable == "" {
+			p.problem("%s requires -table", name)
+			return
+		}
+		if !slices.Contains(p.md.Tables, *valueTable) {
+			p.problem("table %s is not in the file", *valueTable)
+		}
+		if _, err := newRowExporter(io.Discard, *recoverFormat); err != nil {
+			p.problem("%v", err)
+		}
+	case "erasure-audit":
+		a, err := newErasureAudit()
+		if err != nil {
+			p.problem("%v", err)
+			return
+		}
+		tables := []string{a.table}
+		if a.columns != nil {
+			tables = slices.Sorted(maps.Keys(a.columns))
+		}
+		for _, table := range tables {
+			if !slices.Contains(p.md.Tables, table) {
+				p.problem("table %s is not in the file", table)
+			}
+		}
+		fmt.Fprintf(p.w, "Erase by: %s\n", a.cutoff.Format(timeFormat))
+	case "tenant-split":
+		if *tenantColumn == "" || *outDir == "" {
+			p.problem("tenant-split requires -tenantColumn and -outDir")
+			return
+		}
+		s, err := newTenantSplitter(*tenantColumn, *tenantIDs, *tenantFormat, *outDir, *binlogFile)
+		if err != nil {
+			p.problem("%v", err)
+			return
+		}
+		for _, table := range slices.Sorted(maps.Keys(s.columns)) {
+			col := s.columns[table]
+			if !slices.Contains(p.md.Tables, table) {
+				p.problem("table %s is not in the file", table)
+				continue
+			}
+			fmt.Fprintf(p.w, "Tenant column: %s.%s\n", table, col)
+		}
+		fmt.Fprintf(p.w, "Output: %s files in %s\n", *tenantFormat, *outDir)
+	case "explain-position":
+		switch {
+		case *explainPos < 4:
+			p.problem("explain-position requires -pos")
+		case *explainPos > int64(p.md.LastPos):
+			p.problem("-pos %d is past the end of the file, at %d", *explainPos, p.md.LastPos)
+		default:
+			fmt.Fprintf(p.w, "Explain: position %d\n", *explainPos)
+		}
+	case "purge-advisor":
+		consumers, err := parseGTIDConsumers(*retainGTIDs)
+		if err != nil {
+			p.problem("%v", err)
+		}
+		for _, c := range consumers {
+			fmt.Fprintf(p.w, "Retain: %s, executed %s\n", c.name, gtidSetString(c.executed))
+		}
+		if _, err := parseRetentionPeriods(*retentionPeriods); err != nil {
+			p.problem("%v", err)
+		}
+	case "gen-testdata":
+		if *outDir == "" {
+			p.problem("gen-testdata requires -outDir")
+			return
+		}
+		for _, c := range testdataCases() {
+			fmt.Fprintf(p.w, "Case %s: %s\n", c.name, c.description)
+		}
+		fmt.Fprintf(p.w, "Output: schema, binlog and spec files in %s\n", *outDir)
+	case "watch":
+		if *webhookRules == "" {
+			p.problem("watch requires -webhooks")
+		} else if rules, err := loadWebhookRules(*webhookRules); err != nil {
+			p.problem("%v", err)
+		} else {
+			for _, r := range rules {
+				fmt.Fprintf(p.w, "Rule %s: %s\n", r.Name, r.When)
+			}
+		}
+	}
+}
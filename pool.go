@@ -0,0 +1,35 @@
+package main
+
+import "sync"
+
+// maxPooledBuffer keeps a single huge event (multi-MB blob rows) from pinning
+// its buffer in the pool for the rest of the run.
+const maxPooledBuffer = 1 << 20
+
+// outputBufferSize is the size of the buffered writer wrapping stdout.
+const outputBufferSize = 64 << 10
+
+// bufferPool holds the slices events are formatted into. A slice is the
+// caller's from getBuffer until putBuffer: the event is appended to it in
+// place and written straight from it, so whatever it is written to must copy
+// what it keeps, as bufio.Writer and txGrouper do.
+var bufferPool = sync.Pool{
+	New: func() any { return new([]byte) },
+}
+
+// getBuffer returns an empty pooled slice, by pointer so that putBuffer can
+// pool it again however far it grew.
+func getBuffer() *[]byte {
+	p := bufferPool.Get().(*[]byte)
+	*p = (*p)[:0]
+	return p
+}
+
+// putBuffer returns buf to the pool, holding b, the slice formatted from it.
+func putBuffer(buf *[]byte, b []byte) {
+	if cap(b) > maxPooledBuffer {
+		return
+	}
+	*buf = b[:0]
+	bufferPool.Put(buf)
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// TestBufferPool checks that an event formatted into a pooled slice grows
+// that slice for the next event, rather than being copied out of it.
+func TestBufferPool(t *testing.T) {
+	e := &replication.BinlogEvent{
+		Header: &replication.EventHeader{EventType: replication.QUERY_EVENT},
+		Event:  &replication.QueryEvent{Query: make([]byte, 4096)},
+	}
+	if n := testing.AllocsPerRun(100, func() {
+		buf := getBuffer()
+		putBuffer(buf, appendEvent(*buf, e))
+	}); n != 0 {
+		t.Errorf("%v allocations per event, want 0", n)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// gtidConsumer is a replica or backup that still reads the binlogs, with the
+// GTID set it has executed: it needs every file holding a transaction
+// outside that set.
+type gtidConsumer struct {
+	name     string
+	executed *mysql.MysqlGTIDSet
+}
+
+// parseGTIDConsumers parses -retainGTIDs: GTID sets separated by
+// semicolons, each optionally labelled name=set.
+func parseGTIDConsumers(spec string) ([]gtidConsumer, error) {
+	var consumers []gtidConsumer
+	for i, part := range strings.Split(spec, ";") {
+		part = strings.Join(strings.Fields(part), "")
+		if part == "" {
+			continue
+		}
+		name, set, ok := strings.Cut(part, "=")
+		if !ok {
+			name, set = fmt.Sprintf("set %d", i+1), part
+		}
+		s, err := mysql.ParseMysqlGTIDSet(set)
+		if err != nil {
+			return nil, fmt.Errorf("-retainGTIDs %s: %v", name, err)
+		}
+		consumers = append(consumers, gtidConsumer{name, s.(*mysql.MysqlGTIDSet)})
+	}
+	if len(consumers) == 0 {
+		return nil, fmt.Errorf("purge-advisor requires -retainGTIDs, the executed GTID sets of the replicas and backups reading the binlogs")
+	}
+	return consumers, nil
+}
+
+// retentionPeriod is a binlog retention period to compare, as given.
+type retentionPeriod struct {
+	label string
+	d     time.Duration
+}
+
+// parseRetentionPeriods parses -retention: comma-separated durations, in
+// days with a d suffix or as Go durations such as 12h.
+func parseRetentionPeriods(spec string) ([]retentionPeriod, error) {
+	var periods []retentionPeriod
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		var d time.Duration
+		var err error
+		if days, ok := strings.CutSuffix(s, "d"); ok {
+			var n float64
+			n, err = strconv.ParseFloat(days, 64)
+			d = time.Duration(n * float64(24*time.Hour))
+		} else {
+			d, err = time.ParseDuration(s)
+		}
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid -retention period %q: want days as 7d, or a duration as 12h", s)
+		}
+		periods = append(periods, retentionPeriod{s, d})
+	}
+	return periods, nil
+}
+
+// purgeFile is one binlog of the purge advice and who still needs it.
+type purgeFile struct {
+	md    *fileMetadata
+	gtids *fileGTIDs
+	// needed names the consumers that need the file, lacks the GTIDs each
+	// lacks.
+	needed []string
+	lacks  []string
+}
+
+// safe reports whether no consumer needs f. A file with anonymous
+// transactions is never known to be safe: they cannot be matched against
+// the GTID sets.
+func (f *purgeFile) safe() bool {
+	return len(f.needed) == 0 && f.gtids.anonymous == 0
+}
+
+// purgeAdvice works out which of files, oldest first, no consumer needs
+// any more, and what purging by each retention period would free.
+func purgeAdvice(w io.Writer, files []string, consumers []gtidConsumer, periods []retentionPeriod) error {
+	var pf []*purgeFile
+	for _, file := range files {
+		md, err := loadFileMetadata(file, !*noCache)
+		if md == nil {
+			return err
+		}
+		if err != nil {
+			// A damaged file is kept: what it holds is not all known.
+			return fmt.Errorf("%v: cannot advise on a damaged file", err)
+		}
+		gtids, err := newFileGTIDs(md)
+		if err != nil {
+			return err
+		}
+		f := &purgeFile{md: md, gtids: gtids}
+		for _, c := range consumers {
+			if lacks := gtidSetMinus(gtids.contained, c.executed); lacks != "" {
+				f.needed = append(f.needed, c.name)
+				f.lacks = append(f.lacks, lacks)
+			}
+		}
+		pf = append(pf, f)
+	}
+	if len(pf) == 0 {
+		return nil
+	}
+
+	// A consumer lacking GTIDs executed before the first file cannot catch
+	// up from these files at all.
+	for _, c := range consumers {
+		if lost := gtidSetMinus(pf[0].gtids.previous, c.executed); lost != "" {
+			fmt.Fprintf(w, "Warning: %s lacks %s, purged before %s: it cannot catch up from these files\n", c.name, lost, binlogBase(pf[0].md.Path))
+		}
+	}
+
+	// Binlogs are purged oldest first, up to the first file still needed,
+	// and never the newest, which the server is writing.
+	safe := 0
+	for safe < len(pf)-1 && pf[safe].safe() {
+		safe++
+	}
+	var freed int64
+	fmt.Fprintf(w, "%-24s %10s  %-19s  %s\n", "File", "Size", "Last event", "Needed by")
+	for i, f := range pf {
+		status := "safe to purge"
+		switch {
+		case len(f.needed) > 0:
+			parts := make([]string, len(f.needed))
+			for j, name := range f.needed {
+				parts[j] = fmt.Sprintf("%s (lacks %s)", name, f.lacks[j])
+			}
+			status = strings.Join(parts, ", ")
+		case f.gtids.anonymous > 0:
+			status = fmt.Sprintf("unknown: %s", plural(f.gtids.anonymous, "anonymous transaction"))
+		case i == len(pf)-1:
+			status = "newest file, kept"
+		case i >= safe:
+			status = "no one, but follows a file still needed"
+		}
+		if i < safe {
+			freed += f.md.Size
+		}
+		fmt.Fprintf(w, "%-24s %10s  %-19s  %s\n", binlogBase(f.md.Path), formatByteSize(uint64(f.md.Size)),
+			time.Unix(int64(f.md.LastTimestamp), 0).Format(timeFormat), status)
+	}
+	if safe == 0 {
+		fmt.Fprintln(w, "\nNo file is safe to purge")
+	} else {
+		fmt.Fprintf(w, "\nSafe to purge: %s, %s\n", plural(safe, "file"), formatByteSize(uint64(freed)))
+		fmt.Fprintf(w, "PURGE BINARY LOGS TO '%s';\n", binlogBase(pf[safe].md.Path))
+	}
+
+	if len(periods) == 0 {
+		return nil
+	}
+	// Files expire by age; the age is taken from the newest event, so an
+	// archive is judged as of when it was written.
+	now := time.Unix(int64(pf[len(pf)-1].md.LastTimestamp), 0)
+	fmt.Fprintf(w, "\nRetention periods, as of %s:\n", now.Format(timeFormat))
+	fmt.Fprintf(w, "%-10s %8s %12s  %s\n", "Retention", "Purged", "Freed", "Breaks")
+	for _, p := range periods {
+		cutoff := now.Add(-p.d)
+		n, bytes := 0, int64(0)
+		var breaks []string
+		for _, f := range pf[:len(pf)-1] {
+			if !time.Unix(int64(f.md.LastTimestamp), 0).Before(cutoff) {
+				break
+			}
+			n++
+			bytes += f.md.Size
+			for _, name := range f.needed {
+				if !slices.Contains(breaks, name) {
+					breaks = append(breaks, name)
+				}
+			}
+			if f.gtids.anonymous > 0 && !slices.Contains(breaks, "anonymous transactions") {
+				breaks = append(breaks, "anonymous transactions")
+			}
+		}
+		broken := "-"
+		if len(breaks) > 0 {
+			broken = strings.Join(breaks, ", ")
+		}
+		fmt.Fprintf(w, "%-10s %8s %12s  %s\n", p.label, plural(n, "file"), formatByteSize(uint64(bytes)), broken)
+	}
+	return nil
+}
+
+func purgeAdvisorCommand(int64) {
+	consumers, err := parseGTIDConsumers(*retainGTIDs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	periods, err := parseRetentionPeriods(*retentionPeriods)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	files, err := expandBinlogFiles(*binlogFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := purgeAdvice(os.Stdout, files, consumers, periods); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+}
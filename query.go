@@ -0,0 +1,806 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// The query command evaluates a small SQL dialect over the decoded event
+// stream:
+//
+//	SELECT table, op, count(*) FROM events
+//	WHERE db = 'shop' AND ts > '2024-05-01 12:00:00'
+//	GROUP BY 1, 2 ORDER BY 3 DESC LIMIT 10
+//
+// Every event is one row of the virtual table "events" with the columns in
+// queryColumns. Supported aggregates are count, sum, min, max and avg.
+
+var queryColumns = map[string]bool{
+	"db": true, "table": true, "op": true, "type": true, "gtid": true, "query": true, "verb": true,
+	"ts": true, "timestamp": true, "pos": true, "start_pos": true, "size": true,
+	"server_id": true, "rows": true,
+}
+
+// eventRecord is one row of the events table.
+type eventRecord struct {
+	db, table, op, typ, gtid, query string
+	verb                            string
+	timestamp, pos, startPos, size  uint32
+	serverID                        uint32
+	rows                            int
+}
+
+func (r *eventRecord) value(col string) string {
+	switch col {
+	case "db":
+		return r.db
+	case "table":
+		return r.table
+	case "op":
+		return r.op
+	case "type":
+		return r.typ
+	case "gtid":
+		return r.gtid
+	case "query":
+		return r.query
+	case "verb":
+		return r.verb
+	case "ts":
+		return time.Unix(int64(r.timestamp), 0).Format(timeFormat)
+	case "timestamp":
+		return strconv.FormatUint(uint64(r.timestamp), 10)
+	case "pos":
+		return strconv.FormatUint(uint64(r.pos), 10)
+	case "start_pos":
+		return strconv.FormatUint(uint64(r.startPos), 10)
+	case "size":
+		return strconv.FormatUint(uint64(r.size), 10)
+	case "server_id":
+		return strconv.FormatUint(uint64(r.serverID), 10)
+	case "rows":
+		return strconv.Itoa(r.rows)
+	}
+	return ""
+}
+
+// Parsing.
+
+type queryToken struct {
+	kind string // "ident", "number", "string" or "sym"
+	text string
+}
+
+func tokenizeQuery(s string) ([]queryToken, error) {
+	var toks []queryToken
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'' || c == '"':
+			j := i + 1
+			var sb strings.Builder
+			for ; j < len(s); j++ {
+				if rune(s[j]) == c {
+					if j+1 < len(s) && rune(s[j+1]) == c {
+						sb.WriteByte(s[j])
+						j++
+						continue
+					}
+					break
+				}
+				sb.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			toks = append(toks, queryToken{"string", sb.String()})
+			i = j + 1
+		case unicode.IsDigit(c) || (c == '-' && i+1 < len(s) && unicode.IsDigit(rune(s[i+1]))):
+			j := i + 1
+			for j < len(s) && (unicode.IsDigit(rune(s[j])) || s[j] == '.') {
+				j++
+			}
+			toks = append(toks, queryToken{"number", s[i:j]})
+			i = j
+		case unicode.IsLetter(c) || c == '_' || c == '`':
+			if c == '`' {
+				j := strings.IndexByte(s[i+1:], '`')
+				if j < 0 {
+					return nil, fmt.Errorf("unterminated identifier at %d", i)
+				}
+				toks = append(toks, queryToken{"ident", strings.ToLower(s[i+1 : i+1+j])})
+				i += j + 2
+				continue
+			}
+			j := i + 1
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '_') {
+				j++
+			}
+			toks = append(toks, queryToken{"ident", strings.ToLower(s[i:j])})
+			i = j
+		default:
+			op := querySymbol(s[i:])
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+			}
+			toks = append(toks, queryToken{"sym", op})
+			i += len(op)
+		}
+	}
+	return toks, nil
+}
+
+func querySymbol(s string) string {
+	for _, op := range []string{"<=", ">=", "!=", "<>", "=", "<", ">", "(", ")", ",", "*"} {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+type selectItem struct {
+	agg string // "" for a plain column
+	col string // "*" for count(*)
+}
+
+func (it selectItem) String() string {
+	if it.agg == "" {
+		return it.col
+	}
+	return it.agg + "(" + it.col + ")"
+}
+
+type orderKey struct {
+	item int
+	desc bool
+}
+
+// condition is a WHERE clause node.
+type condition interface {
+	match(r *eventRecord) bool
+}
+
+type comparison struct {
+	col, op, value string
+}
+
+type logical struct {
+	and         bool
+	left, right condition
+}
+
+type negation struct {
+	c condition
+}
+
+func (c *logical) match(r *eventRecord) bool {
+	if c.and {
+		return c.left.match(r) && c.right.match(r)
+	}
+	return c.left.match(r) || c.right.match(r)
+}
+
+func (c *negation) match(r *eventRecord) bool {
+	return !c.c.match(r)
+}
+
+func (c *comparison) match(r *eventRecord) bool {
+	v := r.value(c.col)
+	if c.op == "like" {
+		return likeMatch(strings.ToLower(v), strings.ToLower(c.value))
+	}
+	cmp := compareValues(v, c.value)
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "!=", "<>":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// compareValues compares numerically when both sides are numbers and as
+// strings otherwise, which also orders ts values correctly.
+func compareValues(a, b string) int {
+	fa, errA := strconv.ParseFloat(a, 64)
+	fb, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a, b)
+}
+
+// likeMatch implements SQL LIKE with % and _ wildcards.
+func likeMatch(s, pattern string) bool {
+	if pattern == "" {
+		return s == ""
+	}
+	switch pattern[0] {
+	case '%':
+		for i := 0; i <= len(s); i++ {
+			if likeMatch(s[i:], pattern[1:]) {
+				return true
+			}
+		}
+		return false
+	case '_':
+		return s != "" && likeMatch(s[1:], pattern[1:])
+	}
+	return s != "" && s[0] == pattern[0] && likeMatch(s[1:], pattern[1:])
+}
+
+type eventQuery struct {
+	items   []selectItem
+	where   condition
+	groupBy []int
+	orderBy []orderKey
+	limit   int
+}
+
+type queryParser struct {
+	toks []queryToken
+	pos  int
+}
+
+func (p *queryParser) peek() queryToken {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return queryToken{}
+}
+
+func (p *queryParser) next() queryToken {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *queryParser) accept(text string) bool {
+	if t := p.peek(); (t.kind == "ident" || t.kind == "sym") && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) expect(text string) error {
+	if !p.accept(text) {
+		return fmt.Errorf("expected %s, got %q", strings.ToUpper(text), p.peek().text)
+	}
+	return nil
+}
+
+func (p *queryParser) column() (string, error) {
+	t := p.next()
+	if t.kind != "ident" {
+		return "", fmt.Errorf("expected column name, got %q", t.text)
+	}
+	if !queryColumns[t.text] {
+		return "", fmt.Errorf("unknown column %q", t.text)
+	}
+	return t.text, nil
+}
+
+func parseEventQuery(s string) (*eventQuery, error) {
+	toks, err := tokenizeQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{toks: toks}
+	q := &eventQuery{limit: -1}
+
+	if err := p.expect("select"); err != nil {
+		return nil, err
+	}
+	for {
+		item, err := p.selectItem()
+		if err != nil {
+			return nil, err
+		}
+		q.items = append(q.items, item)
+		if !p.accept(",") {
+			break
+		}
+	}
+	if err := p.expect("from"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("events"); err != nil {
+		return nil, err
+	}
+	if p.accept("where") {
+		if q.where, err = p.or(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("group") {
+		if err := p.expect("by"); err != nil {
+			return nil, err
+		}
+		for {
+			i, err := p.itemRef(q.items)
+			if err != nil {
+				return nil, err
+			}
+			if q.items[i].agg != "" {
+				return nil, fmt.Errorf("cannot group by aggregate %s", q.items[i])
+			}
+			q.groupBy = append(q.groupBy, i)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.accept("order") {
+		if err := p.expect("by"); err != nil {
+			return nil, err
+		}
+		for {
+			i, err := p.itemRef(q.items)
+			if err != nil {
+				return nil, err
+			}
+			k := orderKey{item: i}
+			if p.accept("desc") {
+				k.desc = true
+			} else {
+				p.accept("asc")
+			}
+			q.orderBy = append(q.orderBy, k)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.accept("limit") {
+		t := p.next()
+		n, err := strconv.Atoi(t.text)
+		if t.kind != "number" || err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid LIMIT %q", t.text)
+		}
+		q.limit = n
+	}
+	if p.pos < len(p.toks) {
+		return nil, fmt.Errorf("unexpected %q", p.peek().text)
+	}
+
+	if q.aggregated() {
+		grouped := make(map[int]bool)
+		for _, i := range q.groupBy {
+			grouped[i] = true
+		}
+		for i, it := range q.items {
+			if it.agg == "" && !grouped[i] {
+				return nil, fmt.Errorf("column %s must appear in GROUP BY", it.col)
+			}
+		}
+	}
+	return q, nil
+}
+
+// parseCondition parses a bare WHERE expression over the events table, such
+// as the conditions of webhook rules.
+func parseCondition(s string) (condition, error) {
+	toks, err := tokenizeQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{toks: toks}
+	c, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, fmt.Errorf("unexpected %q", p.peek().text)
+	}
+	return c, nil
+}
+
+func (p *queryParser) selectItem() (selectItem, error) {
+	t := p.peek()
+	switch t.text {
+	case "count", "sum", "min", "max", "avg":
+		if p.pos+1 < len(p.toks) && p.toks[p.pos+1].text == "(" {
+			p.pos += 2
+			item := selectItem{agg: t.text}
+			if t.text == "count" && p.accept("*") {
+				item.col = "*"
+			} else {
+				col, err := p.column()
+				if err != nil {
+					return item, err
+				}
+				item.col = col
+			}
+			return item, p.expect(")")
+		}
+	}
+	col, err := p.column()
+	return selectItem{col: col}, err
+}
+
+// itemRef resolves a GROUP BY/ORDER BY reference, either a 1-based ordinal
+// or a column name, to an index into the select list.
+func (p *queryParser) itemRef(items []selectItem) (int, error) {
+	t := p.next()
+	if t.kind == "number" {
+		n, err := strconv.Atoi(t.text)
+		if err != nil || n < 1 || n > len(items) {
+			return 0, fmt.Errorf("invalid select list position %q", t.text)
+		}
+		return n - 1, nil
+	}
+	for i, it := range items {
+		if it.agg == "" && it.col == t.text {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%q is not in the select list", t.text)
+}
+
+func (p *queryParser) or() (condition, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) and() (condition, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) unary() (condition, error) {
+	if p.accept("not") {
+		c, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &negation{c}, nil
+	}
+	if p.accept("(") {
+		c, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return c, p.expect(")")
+	}
+	col, err := p.column()
+	if err != nil {
+		return nil, err
+	}
+	op := p.next()
+	switch op.text {
+	case "=", "!=", "<>", "<", "<=", ">", ">=", "like":
+	default:
+		return nil, fmt.Errorf("expected comparison operator after %s, got %q", col, op.text)
+	}
+	v := p.next()
+	if v.kind != "string" && v.kind != "number" {
+		return nil, fmt.Errorf("expected value after %s %s, got %q", col, op.text, v.text)
+	}
+	return &comparison{col: col, op: op.text, value: v.text}, nil
+}
+
+// Evaluation.
+
+func (q *eventQuery) aggregated() bool {
+	if len(q.groupBy) > 0 {
+		return true
+	}
+	for _, it := range q.items {
+		if it.agg != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *eventQuery) uses(col string) bool {
+	for _, it := range q.items {
+		if it.col == col {
+			return true
+		}
+	}
+	return conditionUses(q.where, col)
+}
+
+// conditionUses reports whether c refers to col.
+func conditionUses(c condition, col string) bool {
+	switch c := c.(type) {
+	case *comparison:
+		return c.col == col
+	case *logical:
+		return conditionUses(c.left, col) || conditionUses(c.right, col)
+	case *negation:
+		return conditionUses(c.c, col)
+	}
+	return false
+}
+
+// aggregate accumulates one select item over the events of a group.
+type aggregate struct {
+	count    int
+	sum      float64
+	min, max string
+}
+
+func (a *aggregate) add(it selectItem, r *eventRecord) {
+	if it.col == "*" {
+		a.count++
+		return
+	}
+	v := r.value(it.col)
+	if v == "" {
+		return
+	}
+	a.count++
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		a.sum += f
+	}
+	if a.count == 1 || compareValues(v, a.min) < 0 {
+		a.min = v
+	}
+	if a.count == 1 || compareValues(v, a.max) > 0 {
+		a.max = v
+	}
+}
+
+func (a *aggregate) result(it selectItem) string {
+	switch it.agg {
+	case "count":
+		return strconv.Itoa(a.count)
+	case "sum":
+		return strconv.FormatFloat(a.sum, 'f', -1, 64)
+	case "avg":
+		if a.count == 0 {
+			return "NULL"
+		}
+		return strconv.FormatFloat(a.sum/float64(a.count), 'f', 2, 64)
+	case "min":
+		return a.min
+	case "max":
+		return a.max
+	}
+	return ""
+}
+
+type queryGroup struct {
+	values []string
+	aggs   []aggregate
+}
+
+// queryRunner evaluates q over the events handed to observe.
+type queryRunner struct {
+	q      *eventQuery
+	rows   [][]string
+	groups map[string]*queryGroup
+	order  []string
+}
+
+func newQueryRunner(q *eventQuery) *queryRunner {
+	return &queryRunner{q: q, groups: make(map[string]*queryGroup)}
+}
+
+func (qr *queryRunner) add(r *eventRecord) {
+	if qr.q.where != nil && !qr.q.where.match(r) {
+		return
+	}
+	if !qr.q.aggregated() {
+		row := make([]string, len(qr.q.items))
+		for i, it := range qr.q.items {
+			row[i] = r.value(it.col)
+		}
+		qr.rows = append(qr.rows, row)
+		return
+	}
+
+	key := make([]string, len(qr.q.groupBy))
+	for i, gi := range qr.q.groupBy {
+		key[i] = r.value(qr.q.items[gi].col)
+	}
+	k := strings.Join(key, "\x00")
+	g := qr.groups[k]
+	if g == nil {
+		g = &queryGroup{aggs: make([]aggregate, len(qr.q.items))}
+		g.values = make([]string, len(qr.q.items))
+		for i, it := range qr.q.items {
+			if it.agg == "" {
+				g.values[i] = r.value(it.col)
+			}
+		}
+		qr.groups[k] = g
+		qr.order = append(qr.order, k)
+	}
+	for i, it := range qr.q.items {
+		if it.agg != "" {
+			g.aggs[i].add(it, r)
+		}
+	}
+}
+
+func (qr *queryRunner) results() [][]string {
+	rows := qr.rows
+	if qr.q.aggregated() {
+		for _, k := range qr.order {
+			g := qr.groups[k]
+			row := make([]string, len(qr.q.items))
+			for i, it := range qr.q.items {
+				if it.agg == "" {
+					row[i] = g.values[i]
+				} else {
+					row[i] = g.aggs[i].result(it)
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+	if len(qr.q.orderBy) > 0 {
+		sort.SliceStable(rows, func(a, b int) bool {
+			for _, k := range qr.q.orderBy {
+				c := compareValues(rows[a][k.item], rows[b][k.item])
+				if c == 0 {
+					continue
+				}
+				if k.desc {
+					return c > 0
+				}
+				return c < 0
+			}
+			return false
+		})
+	}
+	if qr.q.limit >= 0 && len(rows) > qr.q.limit {
+		rows = rows[:qr.q.limit]
+	}
+	return rows
+}
+
+func (qr *queryRunner) print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	header := make([]string, len(qr.q.items))
+	for i, it := range qr.q.items {
+		header[i] = it.String()
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	rows := qr.results()
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "(%d rows)\n", len(rows))
+}
+
+// newEventRecord builds the events-table row for e. gtid is the GTID of the
+// enclosing transaction, if known.
+func newEventRecord(e *replication.BinlogEvent, gtid string) *eventRecord {
+	r := &eventRecord{
+		typ:       e.Header.EventType.String(),
+		gtid:      gtid,
+		timestamp: e.Header.Timestamp,
+		pos:       e.Header.LogPos,
+		startPos:  e.Header.LogPos - e.Header.EventSize,
+		size:      e.Header.EventSize,
+		serverID:  e.Header.ServerID,
+	}
+	switch ev := e.Event.(type) {
+	case *replication.QueryEvent:
+		r.db = string(ev.Schema)
+		r.query = string(ev.Query)
+		r.verb = statementVerb(r.query)
+		r.op = "QUERY"
+	case *replication.RowsQueryEvent:
+		r.query = string(ev.Query)
+	case *replication.TableMapEvent:
+		r.db, r.table = string(ev.Schema), string(ev.Table)
+	case *replication.RowsEvent:
+		if ev.Table != nil {
+			r.db, r.table = string(ev.Table.Schema), string(ev.Table.Table)
+		}
+		r.op = rowsEventKind(e.Header.EventType)
+		r.rows = rowsAffected(e)
+	}
+	return r
+}
+
+// statementVerb returns the upper-cased first keyword of a SQL statement,
+// skipping leading /* */ comments: "DROP", "TRUNCATE", "BEGIN".
+func statementVerb(q string) string {
+	q = strings.TrimSpace(q)
+	for strings.HasPrefix(q, "/*") {
+		end := strings.Index(q, "*/")
+		if end < 0 {
+			return ""
+		}
+		q = strings.TrimSpace(q[end+2:])
+	}
+	end := strings.IndexFunc(q, func(r rune) bool { return !unicode.IsLetter(r) })
+	if end < 0 {
+		end = len(q)
+	}
+	return strings.ToUpper(q[:end])
+}
+
+func runEventQuery(binlogFile string, startPosition int64, q *eventQuery) error {
+	qr := newQueryRunner(q)
+
+	p := newParser(q.uses("rows"))
+
+	gtid := ""
+	err := parseBinlog(p, binlogFile, startPosition, func(e *replication.BinlogEvent) error {
+		if beforeStart(e, startPosition) {
+			return nil
+		}
+		if ev, ok := e.Event.(*replication.GTIDEvent); ok {
+			gtid = gtidString(ev)
+		}
+		qr.add(newEventRecord(e, gtid))
+		if _, ok := e.Event.(*replication.XIDEvent); ok {
+			gtid = ""
+		}
+		return nil
+	})
+	qr.print(os.Stdout)
+	return err
+}
+
+func queryCommand(startPosition int64) {
+	text := strings.Join(flag.Args(), " ")
+	if text == "" {
+		fmt.Fprintf(os.Stderr, "Error: query requires a SELECT statement\n")
+		os.Exit(1)
+	}
+	q, err := parseEventQuery(text)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := runEventQuery(*binlogFile, startPosition, q); err != nil {
+		fmt.Println(err.Error())
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// binlogSource is an open binlog file, either read through the OS or mapped
+// into memory.
+type binlogSource interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// openBinlog opens name for sequential parsing, mapping it into memory when
+// -mmap is set and the platform supports it.
+func openBinlog(name string) (binlogSource, error) {
+	if *useMmap && !isS3URL(name) && binlogCompression(name) == "" && *keyringFile == "" {
+		return openMmap(name)
+	}
+	return openBinlogFile(name)
+}
+
+// statBinlogSource is a binlog opened for reading, a local file or an S3 object.
+type statBinlogSource interface {
+	binlogSource
+	io.ReaderAt
+	Stat() (os.FileInfo, error)
+}
+
+// openBinlogFile opens name, which may be an s3://bucket/key URL, reading a
+// gzip or zstd compressed archive, and with -keyringFile an encrypted
+// binlog, as the binlog it holds.
+func openBinlogFile(name string) (statBinlogSource, error) {
+	f, err := openRawBinlog(name)
+	if err != nil {
+		return nil, err
+	}
+	if kind := binlogCompression(name); kind != "" {
+		f = newCompressedFile(name, kind, f)
+	}
+	if *keyringFile != "" {
+		d, err := decryptBinlog(name, f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		f = d
+	}
+	return f, nil
+}
+
+// openRawBinlog opens the file or S3 object name as it is stored.
+func openRawBinlog(name string) (statBinlogSource, error) {
+	if isS3URL(name) {
+		return openS3Object(name)
+	}
+	return os.Open(name)
+}
+
+// statBinlog is os.Stat for the names openBinlogFile opens. It describes
+// the stored file, so for a compressed archive the size is the compressed
+// size.
+func statBinlog(name string) (os.FileInfo, error) {
+	if isS3URL(name) {
+		return statS3Object(name)
+	}
+	return os.Stat(name)
+}
+
+// newParser returns a BinlogParser configured the way go-parse needs it.
+//
+// When decodeRows is false the row images of rows events are skipped: only
+// the rows event header (table id, flags, column bitmaps) is decoded, which
+// is enough for per-table counts and is far cheaper on row-heavy binlogs.
+//
+// A rows event whose TableMapEvent is not in the parsed range (typically
+// because parsing started mid-transaction) is passed on with a nil Table
+// instead of being dropped or aborting the parse, so it can be reported as
+// a table-map coverage gap.
+//
+// The event reader counts the row images of rows events for
+// -maxRowsPerEvent before they are decoded; the events it cannot count
+// there, as MariaDB's compressed rows events, are checked once decoded.
+func newParser(decodeRows bool) *replication.BinlogParser {
+	p := replication.NewBinlogParser()
+	p.SetRowsEventDecodeFunc(func(re *replication.RowsEvent, data []byte) error {
+		pos, err := re.DecodeHeader(data)
+		if err != nil {
+			if re.Table == nil {
+				return nil
+			}
+			return err
+		}
+		if !decodeRows {
+			return nil
+		}
+		if err := re.DecodeData(pos, data); err != nil {
+			return err
+		}
+		if *maxRowsPerEvent > 0 && len(re.Rows) > *maxRowsPerEvent {
+			return fmt.Errorf("%d row images exceed -maxRowsPerEvent %d", len(re.Rows), *maxRowsPerEvent)
+		}
+		return nil
+	})
+	return p
+}
+
+// parseBinlog is the replacement for BinlogParser.ParseFile used throughout
+// go-parse. Like ParseFile it always replays the FORMAT_DESCRIPTION event
+// before seeking to offset, and it reads through a buffer sized by
+// -readBuffer (or straight from the memory map).
+//
+// Unless -replayTableMaps=false, starting mid-file also replays the
+// TableMapEvents of the transaction in progress at offset, so its rows
+// events decode, and an offset that falls inside an event is moved back to
+// that event's start.
+//
+// Events are read through an eventReader, so corrupt events end the parse
+// with a positioned error. onEvent may return errStopParsing to stop early.
+//
+// With -follow it keeps reading as the server appends to the file, waiting
+// at the end, even inside a partial event, until the ROTATE or STOP event
+// that completes the file.
+//
+// A SIGINT or SIGTERM ends the parse between events with an error naming
+// the position reached. With -stateFile or -positionStore the end of the
+// last complete transaction is recorded as parsing goes.
+func parseBinlog(p *replication.BinlogParser, name string, offset int64, onEvent replication.OnEventFunc) (err error) {
+	f, err := openBinlog(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	state := newStateRecorder(positions, name)
+	if state != nil {
+		defer func() {
+			if ferr := state.flush(); ferr != nil && err == nil {
+				err = ferr
+			}
+		}()
+	}
+
+	next := onEvent
+	onEvent = func(e *replication.BinlogEvent) error {
+		recordProgress(name, e.Header.LogPos)
+		if ok, err := admitEvent(name, e); !ok {
+			return err
+		}
+		runWarnings.observe(e)
+		if err := next(e); err != nil {
+			return err
+		}
+		if state != nil {
+			return state.observe(e)
+		}
+		return nil
+	}
+	onEvent = withPayloadEvents(withLoadData(func() string { return name }, onEvent))
+
+	magic := make([]byte, len(replication.BinLogFileHeader))
+	if _, err := io.ReadFull(f, magic); err != nil || !bytes.Equal(magic, replication.BinLogFileHeader) {
+		if err := encryptedBinlogError(name, magic); err != nil {
+			return err
+		}
+		return fmt.Errorf("%s is not a valid binlog file, head 4 bytes must fe'bin'", name)
+	}
+
+	er := newEventReader(p, name)
+
+	// Only seek when starting past the FORMAT_DESCRIPTION event, so files
+	// that cannot seek (pipes) can still be parsed from the beginning.
+	if offset > 4 {
+		e, err := er.next(f)
+		if err != nil {
+			return fmt.Errorf("parse FormatDescriptionEvent: %v", err)
+		}
+		if err := onEvent(e); err != nil {
+			if err == errStopParsing {
+				return nil
+			}
+			return err
+		}
+		if *replayTableMaps {
+			if offset, err = replayToOffset(er, f, offset); err != nil {
+				return err
+			}
+		}
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return fmt.Errorf("seek %s to %d error %v", name, offset, err)
+		}
+		er.pos = offset
+	}
+
+	var r io.Reader = f
+	if *follow {
+		r = &followReader{r: f, idle: followIdle}
+	}
+	if _, mapped := f.(*mmapFile); !mapped && *readBufferSize > 0 {
+		r = bufio.NewReaderSize(r, *readBufferSize)
+	}
+	for {
+		if stopRequested.Load() {
+			return er.errorf("stopped by signal")
+		}
+		reloadRules()
+		e, err := er.next(r)
+		if err != nil && *follow && stopRequested.Load() {
+			// Interrupted while waiting, maybe inside a partial event.
+			return er.errorf("stopped by signal")
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := onEvent(e); err != nil {
+			if err == errStopParsing {
+				return nil
+			}
+			return err
+		}
+		if *follow && endsFile(e) {
+			return nil
+		}
+	}
+}
+
+// beforeStart reports whether e, delivered by parseBinlog, precedes the
+// requested start position: the FORMAT_DESCRIPTION event replayed when
+// starting mid-file. Events written with a zero log position, such as the
+// artificial ROTATE events of relay logs and heartbeats, are never before
+// the start.
+func beforeStart(e *replication.BinlogEvent, startPosition int64) bool {
+	return startPosition > 4 && e.Header.LogPos != 0 && e.Header.LogPos < uint32(startPosition)
+}
+
+// replayToOffset walks the event headers from the start of the file up to
+// offset and feeds the TableMapEvents of the transaction open at offset to
+// er's parser, without delivering them to the caller. It returns the start of the
+// event containing offset.
+func replayToOffset(er *eventReader, f io.ReadSeeker, offset int64) (int64, error) {
+	name := er.name
+	var tableMaps []int64
+	start := offset
+	buf := make([]byte, replication.EventHeaderSize)
+	for pos := int64(4); pos < offset; {
+		if _, err := f.Seek(pos, io.SeekStart); err != nil {
+			return offset, fmt.Errorf("seek %s to %d error %v", name, pos, err)
+		}
+		if _, err := io.ReadFull(f, buf); err != nil {
+			// Past the end of the file: let the normal parse report it.
+			break
+		}
+		h := new(replication.EventHeader)
+		if err := h.Decode(buf); err != nil {
+			return offset, fmt.Errorf("decode event header at %d: %v", pos, err)
+		}
+		if h.EventSize < replication.EventHeaderSize {
+			return offset, fmt.Errorf("%s: event at position %d: event size %d is smaller than its header", name, pos, h.EventSize)
+		}
+		if pos+int64(h.EventSize) > offset {
+			start = pos
+			break
+		}
+		switch h.EventType {
+		case replication.TABLE_MAP_EVENT:
+			tableMaps = append(tableMaps, pos)
+		case replication.QUERY_EVENT, replication.XID_EVENT,
+			replication.GTID_EVENT, replication.ANONYMOUS_GTID_EVENT:
+			tableMaps = tableMaps[:0]
+		}
+		pos += int64(h.EventSize)
+	}
+
+	if start != offset {
+		fmt.Fprintf(os.Stderr, "Note: position %d is inside an event, starting from its beginning at %d\n", offset, start)
+	}
+
+	for _, pos := range tableMaps {
+		if _, err := f.Seek(pos, io.SeekStart); err != nil {
+			return offset, fmt.Errorf("seek %s to %d error %v", name, pos, err)
+		}
+		er.pos = pos
+		if _, err := er.next(f); err != nil {
+			return offset, fmt.Errorf("replay TableMapEvent: %v", err)
+		}
+	}
+	return start, nil
+}
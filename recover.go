@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// rowExporter writes recovered row images as INSERT statements or CSV,
+// and the statements recover-overwrites builds.
+type rowExporter struct {
+	format string // "sql" or "csv"
+	w      *bufio.Writer
+	csv    *csv.Writer
+	header bool // whether the CSV header has been written
+	rows   int
+}
+
+func newRowExporter(w io.Writer, format string) (*rowExporter, error) {
+	x := &rowExporter{format: format, w: bufio.NewWriterSize(w, outputBufferSize)}
+	switch format {
+	case "sql":
+	case "csv":
+		x.csv = csv.NewWriter(x.w)
+	default:
+		return nil, fmt.Errorf("unknown -recoverFormat %q (sql or csv)", format)
+	}
+	return x, nil
+}
+
+// comment writes an SQL comment line; CSV output has no place for it.
+func (x *rowExporter) comment(format string, args ...interface{}) {
+	if x.format == "sql" {
+		fmt.Fprintf(x.w, "-- "+format+"\n", args...)
+	}
+}
+
+// write exports one row image of table t.
+func (x *rowExporter) write(t *replication.TableMapEvent, row []interface{}) error {
+	x.rows++
+	names := columnNames(t)
+	unsigned := t.UnsignedMap()
+	if x.format == "csv" {
+		if !x.header {
+			x.header = true
+			header := make([]string, len(row))
+			for i := range row {
+				header[i] = columnLabel(names, i)
+			}
+			if err := x.csv.Write(header); err != nil {
+				return err
+			}
+		}
+		record := make([]string, len(row))
+		for i, v := range row {
+			record[i] = csvValue(columnValue(v, unsigned[i]))
+		}
+		return x.csv.Write(record)
+	}
+
+	_, err := x.w.Write(appendInsert(nil, t, row))
+	return err
+}
+
+// appendInsert appends an INSERT statement for row of table t, naming the
+// columns when the table map carries their names. Columns the row image
+// does not carry are inserted as DEFAULT, under a comment naming them.
+func appendInsert(b []byte, t *replication.TableMapEvent, row []interface{}) []byte {
+	names := columnNames(t)
+	unsigned := t.UnsignedMap()
+	var absent []string
+	for i, v := range row {
+		if isAbsent(v) {
+			absent = append(absent, columnLabel(names, i))
+		}
+	}
+	if len(absent) > 0 {
+		b = append(b, "-- not in the row image, inserted as DEFAULT: "...)
+		b = append(b, strings.Join(absent, ", ")...)
+		b = append(b, '\n')
+	}
+	b = append(b, "INSERT INTO "...)
+	b = append(b, quoteIdent(string(t.Schema))...)
+	b = append(b, '.')
+	b = append(b, quoteIdent(string(t.Table))...)
+	if len(names) == len(row) {
+		b = append(b, " ("...)
+		for i, n := range names {
+			if i > 0 {
+				b = append(b, ", "...)
+			}
+			b = append(b, quoteIdent(n)...)
+		}
+		b = append(b, ')')
+	}
+	b = append(b, " VALUES ("...)
+	for i, v := range row {
+		if i > 0 {
+			b = append(b, ", "...)
+		}
+		b = appendSQLLiteral(b, columnValue(v, unsigned[i]))
+	}
+	return append(b, ");\n"...)
+}
+
+func (x *rowExporter) flush() error {
+	if x.csv != nil {
+		x.csv.Flush()
+		if err := x.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return x.w.Flush()
+}
+
+// columnLabel is the name of column i, or @i+1 when the table map carries
+// no names.
+func columnLabel(names []string, i int) string {
+	if i < len(names) {
+		return names[i]
+	}
+	return "@" + strconv.Itoa(i+1)
+}
+
+// columnValue undoes go-mysql's signed decoding of unsigned integer columns.
+// Whether a column is unsigned is only known with binlog_row_metadata=FULL.
+func columnValue(v interface{}, unsigned bool) interface{} {
+	if !unsigned {
+		return v
+	}
+	switch v := v.(type) {
+	case int8:
+		return uint8(v)
+	case int16:
+		return uint16(v)
+	case int32:
+		// MEDIUMINT is decoded into an int32 too.
+		if v < 0 && v >= -1<<23 {
+			return uint32(v) & 0xffffff
+		}
+		return uint32(v)
+	case int64:
+		return uint64(v)
+	}
+	return v
+}
+
+func quoteIdent(s string) string {
+	return "`" + strings.ReplaceAll(s, "`", "``") + "`"
+}
+
+// appendSQLLiteral appends v as a MySQL literal. Byte strings that are not
+// valid UTF-8 are written as hex literals.
+func appendSQLLiteral(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, "NULL"...)
+	case absentColumn:
+		return append(b, "DEFAULT"...)
+	case []byte:
+		if !utf8.Valid(v) {
+			b = append(b, "X'"...)
+			b = hex.AppendEncode(b, v)
+			return append(b, '\'')
+		}
+		return appendSQLString(b, string(v))
+	case string:
+		return appendSQLString(b, v)
+	case time.Time:
+		return appendSQLString(b, v.Format("2006-01-02 15:04:05.999999"))
+	case *partialJSON:
+		// Without the document the update is made again in place.
+		if v.doc == "" {
+			return append(b, v.expression()...)
+		}
+		return appendSQLString(b, v.doc)
+	case fmt.Stringer:
+		// DECIMAL values.
+		return appendSQLString(b, v.String())
+	}
+	return appendValue(b, v)
+}
+
+func appendSQLString(b []byte, s string) []byte {
+	b = append(b, '\'')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\'':
+			b = append(b, "\\'"...)
+		case '\\':
+			b = append(b, "\\\\"...)
+		case 0:
+			b = append(b, "\\0"...)
+		case '\n':
+			b = append(b, "\\n"...)
+		case '\r':
+			b = append(b, "\\r"...)
+		case 0x1a:
+			b = append(b, "\\Z"...)
+		default:
+			b = append(b, c)
+		}
+	}
+	return append(b, '\'')
+}
+
+// csvValue renders v for CSV, with \N for NULL as LOAD DATA expects, and
+// an empty field for a column the row image does not carry.
+func csvValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return `\N`
+	case absentColumn:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	}
+	return string(appendValue(nil, v))
+}
+
+// recoverDeletes writes the before images of the DELETE events on table
+// in the range as rows to re-insert.
+func recoverDeletes(binlogFile string, startPosition int64, table string, rng timeRange, x *rowExporter) (int, error) {
+	var tx txTracker
+	events := 0
+	err := parseBinlog(newParser(true), binlogFile, startPosition, func(e *replication.BinlogEvent) error {
+		if beforeStart(e, startPosition) {
+			return nil
+		}
+		if rng.past(e.Header) {
+			return errStopParsing
+		}
+		tx.observe(e)
+		re, ok := e.Event.(*replication.RowsEvent)
+		if !ok || re.Table == nil || rowsEventKind(e.Header.EventType) != "DELETE" ||
+			tableName(re.Table) != table || !rng.contains(e.Header) {
+			return nil
+		}
+		events++
+		desc := fmt.Sprintf("DELETE at %d, %s", e.Header.LogPos-e.Header.EventSize, time.Unix(int64(e.Header.Timestamp), 0).Format(timeFormat))
+		if gtid := tx.gtid(); gtid != "" {
+			desc += ", GTID " + gtid
+		}
+		x.comment("%s", desc)
+		for r := range re.Rows {
+			row, err := rowImages.row(re, r)
+			if err != nil {
+				return err
+			}
+			if err := x.write(re.Table, row); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if ferr := x.flush(); ferr != nil && err == nil {
+		err = ferr
+	}
+	return events, err
+}
+
+func recoverDeletesCommand(startPosition int64) {
+	if *valueTable == "" {
+		fmt.Fprintf(os.Stderr, "Error: recover-deletes requires -table\n")
+		os.Exit(1)
+	}
+	x, err := newRowExporter(os.Stdout, *recoverFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	events, err := recoverDeletes(*binlogFile, startPosition, *valueTable, eventTimes, x)
+	fmt.Fprintf(os.Stderr, "Recovered %s from %s\n", plural(x.rows, "row"), plural(events, "DELETE event"))
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+}
+
+// overwrite is one UPDATE row pair to undo.
+type overwrite struct {
+	desc          string
+	table         *replication.TableMapEvent
+	before, after []interface{}
+}
+
+// appendRestore appends an UPDATE statement that sets the columns o changed
+// back to their before values, finding the row by its key columns as they
+// were after the update. Nothing is appended when no column changed.
+// Columns the update changed whose before values are not in the row image
+// cannot be restored; a comment names them.
+func (o *overwrite) appendRestore(b []byte) ([]byte, error) {
+	names := columnNames(o.table)
+	if len(names) != len(o.before) {
+		return b, fmt.Errorf("%s: restoring UPDATEs as SQL needs column names (binlog_row_metadata=FULL or -schemaFile); use -recoverFormat csv", tableName(o.table))
+	}
+	var lost []string
+	for i, v := range o.before {
+		if isAbsent(v) && i < len(o.after) && !isAbsent(o.after[i]) {
+			lost = append(lost, names[i])
+		}
+	}
+	if len(lost) > 0 {
+		b = append(b, "-- changed, but the value before is not in the row image: "...)
+		b = append(b, strings.Join(lost, ", ")...)
+		b = append(b, '\n')
+	}
+	return appendUpdate(b, o.table, o.after, o.before), nil
+}
+
+// appendUpdate appends an UPDATE statement that changes the row of table t
+// with image from to image to, setting only the columns that differ and
+// leaving those image to does not carry. Nothing is appended when none
+// does. The table must have column names.
+func appendUpdate(b []byte, t *replication.TableMapEvent, from, to []interface{}) []byte {
+	var changed []int
+	for i := range to {
+		if isAbsent(to[i]) {
+			continue
+		}
+		if i >= len(from) || isAbsent(from[i]) || string(appendValue(nil, from[i])) != string(appendValue(nil, to[i])) {
+			changed = append(changed, i)
+		}
+	}
+	if len(changed) == 0 {
+		return b
+	}
+	names := columnNames(t)
+	unsigned := t.UnsignedMap()
+	b = append(b, "UPDATE "...)
+	b = append(b, quoteIdent(string(t.Schema))...)
+	b = append(b, '.')
+	b = append(b, quoteIdent(string(t.Table))...)
+	b = append(b, " SET "...)
+	for n, i := range changed {
+		if n > 0 {
+			b = append(b, ", "...)
+		}
+		b = append(b, quoteIdent(names[i])...)
+		b = append(b, " = "...)
+		b = appendSQLLiteral(b, columnValue(to[i], unsigned[i]))
+	}
+	b = appendRowWhere(b, t, from)
+	return append(b, ";\n"...)
+}
+
+// recoverOverwrites exports the before images of the UPDATE events on table
+// in the range. As CSV they are written in binlog order. As SQL they are
+// UPDATE statements written newest first, so that a row updated several
+// times ends up with its oldest values.
+func recoverOverwrites(binlogFile string, startPosition int64, table string, rng timeRange, x *rowExporter) (int, error) {
+	var tx txTracker
+	var undo []*overwrite
+	events := 0
+	err := parseBinlog(newParser(true), binlogFile, startPosition, func(e *replication.BinlogEvent) error {
+		if beforeStart(e, startPosition) {
+			return nil
+		}
+		if rng.past(e.Header) {
+			return errStopParsing
+		}
+		tx.observe(e)
+		re, ok := e.Event.(*replication.RowsEvent)
+		if !ok || re.Table == nil || rowsEventKind(e.Header.EventType) != "UPDATE" ||
+			tableName(re.Table) != table || !rng.contains(e.Header) {
+			return nil
+		}
+		events++
+		desc := fmt.Sprintf("UPDATE at %d, %s", e.Header.LogPos-e.Header.EventSize, time.Unix(int64(e.Header.Timestamp), 0).Format(timeFormat))
+		if gtid := tx.gtid(); gtid != "" {
+			desc += ", GTID " + gtid
+		}
+		for i := 0; i+1 < len(re.Rows); i += 2 {
+			before, after, err := rowImages.update(re, i)
+			if err != nil {
+				return err
+			}
+			if x.format == "csv" {
+				if err := x.write(re.Table, before); err != nil {
+					return err
+				}
+				continue
+			}
+			undo = append(undo, &overwrite{desc: desc, table: re.Table, before: before, after: after})
+		}
+		return nil
+	})
+	if err == nil {
+		last := ""
+		for i := len(undo) - 1; i >= 0; i-- {
+			o := undo[i]
+			b, rerr := o.appendRestore(nil)
+			if rerr != nil {
+				err = rerr
+				break
+			}
+			if len(b) == 0 {
+				continue
+			}
+			if o.desc != last {
+				x.comment("%s", o.desc)
+				last = o.desc
+			}
+			x.rows++
+			if _, werr := x.w.Write(b); werr != nil {
+				err = werr
+				break
+			}
+		}
+	}
+	if ferr := x.flush(); ferr != nil && err == nil {
+		err = ferr
+	}
+	return events, err
+}
+
+func recoverOverwritesCommand(startPosition int64) {
+	if *valueTable == "" {
+		fmt.Fprintf(os.Stderr, "Error: recover-overwrites requires -table\n")
+		os.Exit(1)
+	}
+	x, err := newRowExporter(os.Stdout, *recoverFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	events, err := recoverOverwrites(*binlogFile, startPosition, *valueTable, eventTimes, x)
+	fmt.Fprintf(os.Stderr, "Recovered %s from %s\n", plural(x.rows, "row"), plural(events, "UPDATE event"))
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+}
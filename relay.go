@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// logEventArtificial is LOG_EVENT_ARTIFICIAL_F: the event was generated by
+// the replica (or the dump thread) and never existed in the source binlog.
+const logEventArtificial = 0x20
+
+// relayedEvent is one event of a binlog, identified by the source log
+// position it ends at.
+type relayedEvent struct {
+	typ    replication.EventType
+	start  uint32
+	end    uint32
+	sum    uint64
+	offset int64 // file offset in the relay log
+}
+
+// relaySummary describes the events of a relay log.
+type relaySummary struct {
+	events   int
+	local    int            // relay-only events: no source counterpart
+	other    map[string]int // relayed from other source files
+	relayed  []relayedEvent // relayed from the compared source file
+	serverID uint32
+}
+
+// readRelayLog collects the events of relayLog that came from sourceName.
+// The relay log's first FORMAT_DESCRIPTION event identifies the replica;
+// events carrying its server id, artificial events and events with a zero
+// log position were written by the replica and have no source counterpart.
+// ROTATE events from the source say which source file follows.
+func readRelayLog(relayLog, sourceName string) (*relaySummary, error) {
+	s := &relaySummary{other: make(map[string]int)}
+	var format *replication.FormatDescriptionEvent
+	current := ""
+	offset := int64(4)
+
+	p := newParser(false)
+	err := parseBinlog(p, relayLog, 4, func(e *replication.BinlogEvent) error {
+		h := e.Header
+		defer func() { offset += int64(h.EventSize) }()
+		s.events++
+		if fde, ok := e.Event.(*replication.FormatDescriptionEvent); ok {
+			if format == nil {
+				s.serverID = h.ServerID
+			}
+			format = fde
+		}
+		if rot, ok := e.Event.(*replication.RotateEvent); ok && h.ServerID != s.serverID {
+			current = string(rot.NextLogName)
+		}
+		if h.ServerID == s.serverID || h.Flags&logEventArtificial != 0 || h.LogPos == 0 ||
+			h.EventType == replication.FORMAT_DESCRIPTION_EVENT {
+			s.local++
+			return nil
+		}
+		if filepath.Base(current) != sourceName {
+			s.other[current]++
+			return nil
+		}
+		s.relayed = append(s.relayed, newRelayedEvent(e, format, offset))
+		return nil
+	})
+	return s, err
+}
+
+// newRelayedEvent fingerprints e by its header fields and body, leaving out
+// the checksum.
+func newRelayedEvent(e *replication.BinlogEvent, format *replication.FormatDescriptionEvent, offset int64) relayedEvent {
+	data := e.RawData
+	if format != nil && format.ChecksumAlgorithm == replication.BINLOG_CHECKSUM_ALG_CRC32 &&
+		len(data) >= replication.EventHeaderSize+replication.BinlogChecksumLength {
+		data = data[:len(data)-replication.BinlogChecksumLength]
+	}
+	h := fnv.New64a()
+	h.Write(data)
+	return relayedEvent{
+		typ:    e.Header.EventType,
+		start:  e.Header.LogPos - e.Header.EventSize,
+		end:    e.Header.LogPos,
+		sum:    h.Sum64(),
+		offset: offset,
+	}
+}
+
+// relayComparison is the outcome of comparing a relay log with its source
+// binlog.
+type relayComparison struct {
+	matched   int
+	missing   []relayedEvent // in the source range, not in the relay log
+	altered   []relayedEvent // relayed with different bytes
+	reordered []relayedEvent // relayed out of source order
+	extra     []relayedEvent // relayed, but no source event ends there
+	duplicate []relayedEvent // relayed more than once
+}
+
+func (c *relayComparison) ok() bool {
+	return len(c.missing)+len(c.altered)+len(c.reordered)+len(c.extra)+len(c.duplicate) == 0
+}
+
+// compareRelay checks the relayed events against the source events in the
+// range they cover.
+func compareRelay(relayed []relayedEvent, source map[uint32]relayedEvent) *relayComparison {
+	c := new(relayComparison)
+	if len(relayed) == 0 {
+		return c
+	}
+	lo, hi := relayed[0].start, relayed[0].end
+	seen := make(map[uint32]bool)
+	var last uint32
+	for _, r := range relayed {
+		lo, hi = min(lo, r.start), max(hi, r.end)
+		if seen[r.end] {
+			c.duplicate = append(c.duplicate, r)
+			continue
+		}
+		seen[r.end] = true
+		if r.end < last {
+			c.reordered = append(c.reordered, r)
+		}
+		last = max(last, r.end)
+
+		s, ok := source[r.end]
+		switch {
+		case !ok:
+			c.extra = append(c.extra, r)
+		case s.typ != r.typ || s.sum != r.sum:
+			c.altered = append(c.altered, r)
+		default:
+			c.matched++
+		}
+	}
+	for end, s := range source {
+		if s.start >= lo && end <= hi && !seen[end] && s.typ != replication.FORMAT_DESCRIPTION_EVENT {
+			c.missing = append(c.missing, s)
+		}
+	}
+	sort.Slice(c.missing, func(i, j int) bool { return c.missing[i].end < c.missing[j].end })
+	return c
+}
+
+func compareRelayCommand(startPosition int64) {
+	if *relayLog == "" {
+		fmt.Fprintf(os.Stderr, "Error: compare-relay requires -relay <relay log>\n")
+		os.Exit(1)
+	}
+	sourceName := filepath.Base(*binlogFile)
+	rs, err := readRelayLog(*relayLog, sourceName)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	source := make(map[uint32]relayedEvent)
+	var format *replication.FormatDescriptionEvent
+	err = parseBinlog(newParser(false), *binlogFile, 4, func(e *replication.BinlogEvent) error {
+		if fde, ok := e.Event.(*replication.FormatDescriptionEvent); ok {
+			format = fde
+		}
+		source[e.Header.LogPos] = newRelayedEvent(e, format, 0)
+		return nil
+	})
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	c := compareRelay(rs.relayed, source)
+	printRelayComparison(os.Stdout, rs, sourceName, c)
+	if !c.ok() {
+		os.Exit(1)
+	}
+}
+
+func printRelayComparison(w io.Writer, rs *relaySummary, sourceName string, c *relayComparison) {
+	fmt.Fprintf(w, "Relay log %s: %d events, %d from %s, %d relay-only (replica server id %d)\n",
+		*relayLog, rs.events, len(rs.relayed), sourceName, rs.local, rs.serverID)
+	others := make([]string, 0, len(rs.other))
+	for name := range rs.other {
+		others = append(others, name)
+	}
+	sort.Strings(others)
+	for _, name := range others {
+		fmt.Fprintf(w, "Skipped %d events from source file %s\n", rs.other[name], name)
+	}
+	if len(rs.relayed) == 0 {
+		fmt.Fprintf(w, "No events from %s to compare\n", sourceName)
+		return
+	}
+	first, last := rs.relayed[0], rs.relayed[len(rs.relayed)-1]
+	fmt.Fprintf(w, "Relayed range: %s positions %d-%d\n", sourceName, first.start, last.end)
+	fmt.Fprintf(w, "Matched: %d\n", c.matched)
+
+	sections := []struct {
+		name   string
+		events []relayedEvent
+		source bool
+	}{
+		{"Missing from relay log", c.missing, true},
+		{"Altered in transit", c.altered, false},
+		{"Out of order", c.reordered, false},
+		{"Duplicated", c.duplicate, false},
+		{"Not in source", c.extra, false},
+	}
+	for _, s := range sections {
+		fmt.Fprintf(w, "%s: %d\n", s.name, len(s.events))
+		for _, e := range s.events {
+			if s.source {
+				fmt.Fprintf(w, "  %d-%d  %s\n", e.start, e.end, e.typ)
+			} else {
+				fmt.Fprintf(w, "  %d-%d  %s (relay log offset %d)\n", e.start, e.end, e.typ, e.offset)
+			}
+		}
+	}
+}
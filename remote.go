@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/client"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/siddontang/go-log/log"
+)
+
+// remoteServer is the server -dsn streams from.
+type remoteServer struct {
+	user, password string
+	host           string
+	port           uint16
+	tls            *tls.Config
+}
+
+// parseDSN parses the DSN given to flag, -dsn or -backfillDSN, in the Go
+// MySQL driver form, user:password@tcp(host:port)/. The port defaults to
+// 3306, and MYSQL_PWD supplies the password when the DSN has none, to keep
+// it out of the process list.
+func parseDSN(flag, dsn string) (*remoteServer, error) {
+	invalid := fmt.Errorf("invalid %s %q, want user:password@tcp(host:port)/", flag, redactedDSN(dsn))
+	at := strings.LastIndexByte(dsn, '@')
+	if at < 0 {
+		return nil, invalid
+	}
+	s := new(remoteServer)
+	var hasPassword bool
+	s.user, s.password, hasPassword = strings.Cut(dsn[:at], ":")
+	if !hasPassword {
+		s.password = os.Getenv("MYSQL_PWD")
+	}
+	addr, ok := strings.CutPrefix(dsn[at+1:], "tcp(")
+	if !ok {
+		return nil, invalid
+	}
+	addr, rest, ok := strings.Cut(addr, ")")
+	if !ok || (rest != "" && rest != "/") || s.user == "" {
+		return nil, invalid
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = addr, "3306"
+	}
+	n, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || host == "" {
+		return nil, invalid
+	}
+	s.host, s.port = host, uint16(n)
+	if s.tls, err = remoteTLSConfig(host); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// redactedDSN returns dsn with its password masked, for messages.
+func redactedDSN(dsn string) string {
+	at := strings.LastIndexByte(dsn, '@')
+	if user, _, ok := strings.Cut(dsn[:max(at, 0)], ":"); ok {
+		return user + ":xxxxx" + dsn[at:]
+	}
+	return dsn
+}
+
+// remoteTLSConfig returns the TLS configuration set by -tlsCA, -tlsCert,
+// -tlsKey and -tlsSkipVerify, or nil when none is set. -tlsCert and
+// -tlsKey authenticate go-parse to a server that requires X509.
+func remoteTLSConfig(host string) (*tls.Config, error) {
+	if *tlsCA == "" && *tlsCert == "" && *tlsKey == "" && !*tlsSkipVerify {
+		return nil, nil
+	}
+	cfg := &tls.Config{ServerName: host, InsecureSkipVerify: *tlsSkipVerify}
+	if *tlsCA != "" {
+		pem, err := os.ReadFile(*tlsCA)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("-tlsCA %s holds no PEM certificate", *tlsCA)
+		}
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		return nil, fmt.Errorf("-tlsCert and -tlsKey must be given together")
+	}
+	if *tlsCert != "" {
+		cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+func (s *remoteServer) addr() string {
+	return net.JoinHostPort(s.host, strconv.Itoa(int(s.port)))
+}
+
+// inspect returns the binlog coordinates the server is writing at, and
+// whether its binlogs carry CRC32 checksums.
+func (s *remoteServer) inspect() (pos mysql.Position, checksums bool, err error) {
+	conn, err := client.Connect(s.addr(), s.user, s.password, "", func(c *client.Conn) error {
+		c.SetTLSConfig(s.tls)
+		return nil
+	})
+	if err != nil {
+		return pos, false, err
+	}
+	defer conn.Close()
+	r, err := conn.Execute("SELECT @@GLOBAL.binlog_checksum")
+	if err == nil {
+		alg, _ := r.GetString(0, 0)
+		checksums = strings.EqualFold(alg, "CRC32")
+		r.Close()
+	}
+	// MySQL 8.4 renamed SHOW MASTER STATUS.
+	r, err = conn.Execute("SHOW BINARY LOG STATUS")
+	if err != nil {
+		if r, err = conn.Execute("SHOW MASTER STATUS"); err != nil {
+			return pos, false, err
+		}
+	}
+	defer r.Close()
+	if r.RowNumber() == 0 {
+		return pos, false, fmt.Errorf("binary logging is disabled")
+	}
+	name, _ := r.GetString(0, 0)
+	p, _ := r.GetUint(0, 1)
+	// The result's strings share its buffers, which Close recycles.
+	return mysql.Position{Name: strings.Clone(name), Pos: uint32(p)}, checksums, nil
+}
+
+// streamBinlog is parseBinlogs for -dsn: it registers as a replica with
+// -serverID and streams events from the server, starting at file and
+// offset, or at the server's current position when file is empty, until
+// interrupted. Positions and event sizes are those of the server's files.
+// Events are decoded by the same eventReader as files, and
+// begin is called at the start and at each rotation with the binlog being
+// read. With -stateFile or -positionStore the end of the last complete
+// transaction is recorded as for files, and when no file is given, a
+// stored position is resumed from.
+func streamBinlog(p *replication.BinlogParser, file string, offset int64, begin func(file string, start int64), onEvent replication.OnEventFunc) (err error) {
+	s, err := parseDSN("-dsn", *dsn)
+	if err != nil {
+		return err
+	}
+	start := mysql.Position{Name: file, Pos: uint32(max(offset, 4))}
+	if file == "" && positions != nil {
+		st, err := positions.load()
+		if err != nil {
+			return err
+		}
+		if st != nil {
+			start = mysql.Position{Name: st.File, Pos: st.Position}
+			fmt.Fprintf(os.Stderr, "Resuming from the position store at %s:%d\n", st.File, st.Position)
+		}
+	}
+	current, checksums, err := s.inspect()
+	if err != nil {
+		return fmt.Errorf("%s: %v", s.addr(), err)
+	}
+	if start.Name == "" {
+		start = current
+	}
+
+	logger := log.NewDefault(&log.NullHandler{})
+	if h, err := log.NewStreamHandler(os.Stderr); err == nil {
+		logger = log.NewDefault(h)
+		// Reconnection attempts and connection errors only.
+		logger.SetLevel(log.LevelError)
+	}
+	syncer := replication.NewBinlogSyncer(replication.BinlogSyncerConfig{
+		ServerID:       uint32(*serverID),
+		Host:           s.host,
+		Port:           s.port,
+		User:           s.user,
+		Password:       s.password,
+		TLSConfig:      s.tls,
+		RawModeEnabled: true,
+		Logger:         logger,
+	})
+	defer syncer.Close()
+	stream, err := syncer.StartSync(start)
+	if err != nil {
+		return fmt.Errorf("%s: %v", s.addr(), err)
+	}
+
+	name := start.Name
+	if begin != nil {
+		begin(name, int64(start.Pos))
+	}
+	er := newEventReader(p, name)
+	state := newStateRecorder(positions, name)
+	defer func() {
+		if state != nil {
+			if ferr := state.flush(); ferr != nil && err == nil {
+				err = ferr
+			}
+		}
+	}()
+	deliver := withPayloadEvents(withLoadData(func() string { return name }, func(e *replication.BinlogEvent) error {
+		recordProgress(name, e.Header.LogPos)
+		if ok, err := admitEvent(name, e); !ok {
+			return err
+		}
+		runWarnings.observe(e)
+		if err := onEvent(e); err != nil {
+			return err
+		}
+		if state != nil {
+			return state.observe(e)
+		}
+		return nil
+	}))
+	for {
+		if stopRequested.Load() {
+			return fmt.Errorf("%s: stopped by signal at %s:%d", s.addr(), name, er.pos)
+		}
+		reloadRules()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		raw, err := stream.GetEvent(ctx)
+		cancel()
+		if err == context.DeadlineExceeded {
+			if followIdle != nil {
+				followIdle()
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", s.addr(), err)
+		}
+		h := raw.Header
+		// The server opens each binlog, at the start and after a
+		// rotation, with an artificial ROTATE event naming it.
+		if rot, ok := raw.Event.(*replication.RotateEvent); ok && h.LogPos == 0 && string(rot.NextLogName) != name {
+			if state != nil {
+				if err := state.flush(); err != nil {
+					return err
+				}
+			}
+			name = string(rot.NextLogName)
+			er.name = name
+			state = newStateRecorder(positions, name)
+			if begin != nil {
+				begin(name, int64(rot.Position))
+			}
+		}
+		er.pos = 0
+		if h.LogPos >= h.EventSize {
+			er.pos = int64(h.LogPos - h.EventSize)
+		}
+		e, err := er.next(bytes.NewReader(raw.RawData))
+		if err != nil {
+			return err
+		}
+		stripped := er.format == nil || er.format.ChecksumAlgorithm != replication.BINLOG_CHECKSUM_ALG_CRC32
+		heartbeat := h.EventType == replication.HEARTBEAT_EVENT || h.EventType == replication.HEARTBEAT_LOG_EVENT_V2
+		if checksums && stripped && h.LogPos != 0 && !heartbeat {
+			// go-mysql asks for events without checksums; report the
+			// sizes they have in the server's file, so that start
+			// positions, computed from them, match the file.
+			e.Header.EventSize += replication.BinlogChecksumLength
+		}
+		if err := deliver(e); err != nil {
+			if err == errStopParsing {
+				return nil
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// binlogInUse is LOG_EVENT_BINLOG_IN_USE_F, the FORMAT_DESCRIPTION header
+// flag the server sets while it writes the file and clears when it closes
+// it. A file that still has it set was not closed, usually due to a crash.
+const binlogInUse = 0x1
+
+// repairScan is what scanning a binlog for damage found.
+type repairScan struct {
+	events int
+	// valid is the end of the last event that framed, decoded and passed
+	// its checksum; safe is the end of the last one outside a transaction.
+	valid int64
+	safe  int64
+	// lastGTID and lastEnd describe the last complete transaction.
+	lastGTID string
+	lastEnd  int64
+	// openGTID is the transaction still open at valid, if any.
+	openGTID string
+	open     bool
+	inUse    bool
+	closed   bool
+	// damage is the error that ended the scan, nil when the file read to
+	// its end.
+	damage error
+}
+
+// scanForRepair reads name from its start, verifying every event, and
+// finds the last position the file can be truncated at without leaving a
+// corrupt event or a partial transaction.
+func scanForRepair(name string) (*repairScan, error) {
+	s := &repairScan{valid: 4, safe: 4}
+	var tx txTracker
+	p := newParser(true)
+	p.SetVerifyChecksum(true)
+	err := parseBinlog(p, name, 4, func(e *replication.BinlogEvent) error {
+		if !inPayload(e.Header) {
+			s.events++
+			s.valid += int64(e.Header.EventSize)
+			s.closed = endsFile(e)
+		}
+		if e.Header.EventType == replication.FORMAT_DESCRIPTION_EVENT {
+			s.inUse = e.Header.Flags&binlogInUse != 0
+		}
+		if done := tx.observe(e); done != nil {
+			s.lastGTID, s.lastEnd = done.GTID, s.valid
+		}
+		if tx.cur == nil {
+			s.safe = s.valid
+		}
+		return nil
+	})
+	if err != nil && s.events == 0 {
+		// Not a binlog, or the FORMAT_DESCRIPTION event is damaged:
+		// nothing in the file can be kept.
+		return nil, err
+	}
+	s.damage = err
+	s.open = tx.cur != nil
+	s.openGTID = tx.gtid()
+	return s, nil
+}
+
+// writeTruncated copies the first size bytes of name to out, clearing the
+// in-use flag of the FORMAT_DESCRIPTION event so the copy reads as a file
+// the server closed.
+func writeTruncated(name string, size int64, out string) (err error) {
+	f, err := openBinlogFile(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := w.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	head := make([]byte, 4+replication.EventHeaderSize)
+	if _, err := io.ReadFull(f, head); err != nil {
+		return fmt.Errorf("%s: read FormatDescriptionEvent: %v", name, err)
+	}
+	fde := make([]byte, binary.LittleEndian.Uint32(head[4+9:]))
+	copy(fde, head[4:])
+	if _, err := io.ReadFull(f, fde[replication.EventHeaderSize:]); err != nil {
+		return fmt.Errorf("%s: read FormatDescriptionEvent: %v", name, err)
+	}
+	if flags := binary.LittleEndian.Uint16(fde[17:]); flags&binlogInUse != 0 {
+		binary.LittleEndian.PutUint16(fde[17:], flags&^binlogInUse)
+		// The checksum algorithm is the byte before the checksum.
+		if n := len(fde) - replication.BinlogChecksumLength; n > 0 && fde[n-1] == replication.BINLOG_CHECKSUM_ALG_CRC32 {
+			binary.LittleEndian.PutUint32(fde[n:], crc32.ChecksumIEEE(fde[:n]))
+		}
+	}
+	if _, err := w.Write(head[:4]); err != nil {
+		return err
+	}
+	if _, err := w.Write(fde); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(w, f, size-4-int64(len(fde))); err != nil {
+		return fmt.Errorf("%s: copy to %s: %v", name, out, err)
+	}
+	return nil
+}
+
+// printRepairScan writes the findings of s for name.
+func printRepairScan(w io.Writer, name string, s *repairScan) {
+	fmt.Fprintf(w, "%s: %s valid, ending at %d\n", name, plural(s.events, "event"), s.valid)
+	if s.damage != nil {
+		fmt.Fprintf(w, "Damaged: %v\n", s.damage)
+	}
+	if s.open {
+		what := "a transaction"
+		if s.openGTID != "" {
+			what = "transaction " + s.openGTID
+		}
+		fmt.Fprintf(w, "Incomplete: %s starting at %d has no commit\n", what, s.safe)
+	}
+	if s.lastEnd > 0 {
+		gtid := ""
+		if s.lastGTID != "" {
+			gtid = ", GTID " + s.lastGTID
+		}
+		fmt.Fprintf(w, "Last complete transaction ends at %d%s\n", s.lastEnd, gtid)
+	}
+	switch {
+	case s.closed && !s.inUse:
+		fmt.Fprintln(w, "The server closed the file")
+	case s.inUse:
+		fmt.Fprintln(w, "The server did not close the file (in-use flag set)")
+	}
+	if s.damage == nil && !s.open {
+		fmt.Fprintf(w, "Safe truncation position: %d, the end of the file; nothing to repair\n", s.safe)
+		return
+	}
+	fmt.Fprintf(w, "Safe truncation position: %d", s.safe)
+	if binlogCompression(name) == "" && *keyringFile == "" {
+		if fi, err := statBinlog(name); err == nil {
+			fmt.Fprintf(w, " (drops the last %d bytes)", fi.Size()-s.safe)
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+func repairCommand(startPosition int64) {
+	s, err := scanForRepair(*binlogFile)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	printRepairScan(os.Stdout, *binlogFile, s)
+	if *repairOut != "" {
+		if err := writeTruncated(*binlogFile, s.safe, *repairOut); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -repairOut: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Wrote %d bytes to %s\n", s.safe, *repairOut)
+		return
+	}
+	if s.damage != nil || s.open {
+		os.Exit(1)
+	}
+}
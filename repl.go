@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// indexedEvent is the compact per-event record the REPL keeps in memory so
+// questions can be answered without re-reading the binlog.
+type indexedEvent struct {
+	start     uint32
+	end       uint32
+	timestamp uint32
+	eventType replication.EventType
+	gtid      string
+	table     string
+	rows      int
+	query     string
+}
+
+// binlogIndex is built by a single pass over a binlog.
+type binlogIndex struct {
+	events []indexedEvent
+	stats  *statsReport
+}
+
+func buildIndex(binlogFile string, startPosition int64) (*binlogIndex, error) {
+	idx := &binlogIndex{stats: newStatsReport(true)}
+	gtid := ""
+
+	p := newParser(true)
+	err := parseBinlog(p, binlogFile, startPosition, func(e *replication.BinlogEvent) error {
+		if beforeStart(e, startPosition) {
+			return nil
+		}
+		idx.stats.observe(e)
+
+		ie := indexedEvent{
+			start:     e.Header.LogPos - e.Header.EventSize,
+			end:       e.Header.LogPos,
+			timestamp: e.Header.Timestamp,
+			eventType: e.Header.EventType,
+		}
+		switch ev := e.Event.(type) {
+		case *replication.GTIDEvent:
+			gtid = gtidString(ev)
+		case *replication.QueryEvent:
+			ie.query = string(ev.Query)
+		case *replication.RowsQueryEvent:
+			ie.query = string(ev.Query)
+		case *replication.TableMapEvent:
+			ie.table = tableName(ev)
+		case *replication.RowsEvent:
+			if ev.Table != nil {
+				ie.table = tableName(ev.Table)
+			}
+			ie.rows = rowsAffected(e)
+		}
+		ie.gtid = gtid
+		idx.events = append(idx.events, ie)
+
+		if _, ok := e.Event.(*replication.XIDEvent); ok {
+			gtid = ""
+		}
+		return nil
+	})
+	return idx, err
+}
+
+const replHelp = `Commands:
+  tables                 list tables with rows events
+  stats [table]          event statistics, or statistics for one table
+  show gtid <uuid:n>     events of a transaction
+  show pos <position>    the event ending at or containing a position
+  grep <regexp>          events whose query or table matches
+  help                   this text
+  quit                   leave the REPL
+`
+
+// runREPL indexes binlogFile once and answers commands read from in.
+func runREPL(binlogFile string, startPosition int64, in io.Reader, out io.Writer) {
+	start := time.Now()
+	idx, err := buildIndex(binlogFile, startPosition)
+	if err != nil {
+		fmt.Fprintln(out, err.Error())
+	}
+	fmt.Fprintf(out, "Indexed %d events from %s in %s. Type 'help' for commands.\n",
+		len(idx.events), binlogFile, time.Since(start).Round(time.Millisecond))
+
+	sc := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, "go-parse> ")
+		if !sc.Scan() {
+			fmt.Fprintln(out)
+			return
+		}
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "quit", "exit":
+			return
+		case "help":
+			fmt.Fprint(out, replHelp)
+		case "tables":
+			idx.listTables(out)
+		case "stats":
+			if len(fields) > 1 {
+				idx.tableStats(out, fields[1])
+			} else {
+				idx.stats.report(out)
+			}
+		case "show":
+			if len(fields) < 3 {
+				fmt.Fprintln(out, "usage: show gtid <uuid:n> | show pos <position>")
+				continue
+			}
+			idx.show(out, fields[1], fields[2])
+		case "grep":
+			pattern := strings.TrimSpace(strings.TrimPrefix(sc.Text(), "grep"))
+			idx.grep(out, strings.Trim(pattern, `'"`))
+		default:
+			fmt.Fprintf(out, "unknown command %q, type 'help'\n", fields[0])
+		}
+	}
+}
+
+func (idx *binlogIndex) listTables(w io.Writer) {
+	names := make([]string, 0, len(idx.stats.tables))
+	for name := range idx.stats.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ts := idx.stats.tables[name]
+		fmt.Fprintf(w, "%s  rows events: %d  rows: %d\n", name, ts.inserts+ts.updates+ts.deletes, ts.rows)
+	}
+}
+
+func (idx *binlogIndex) tableStats(w io.Writer, name string) {
+	found := false
+	for full, ts := range idx.stats.tables {
+		if full != name && !strings.HasSuffix(full, "."+name) {
+			continue
+		}
+		found = true
+		fmt.Fprintf(w, "%s  inserts: %d  updates: %d  deletes: %d  rows: %d  bytes: %d\n",
+			full, ts.inserts, ts.updates, ts.deletes, ts.rows, ts.bytes)
+	}
+	if !found {
+		fmt.Fprintf(w, "no rows events for table %s\n", name)
+	}
+}
+
+func (idx *binlogIndex) show(w io.Writer, what, arg string) {
+	n := 0
+	for _, ie := range idx.events {
+		var match bool
+		switch what {
+		case "gtid":
+			match = ie.gtid == arg
+		case "pos":
+			var pos uint32
+			if _, err := fmt.Sscan(arg, &pos); err != nil {
+				fmt.Fprintf(w, "invalid position %q\n", arg)
+				return
+			}
+			match = pos > ie.start && pos <= ie.end
+		default:
+			fmt.Fprintf(w, "unknown show target %q\n", what)
+			return
+		}
+		if match {
+			ie.dump(w)
+			n++
+		}
+	}
+	if n == 0 {
+		fmt.Fprintf(w, "nothing found for %s %s\n", what, arg)
+	}
+}
+
+func (idx *binlogIndex) grep(w io.Writer, pattern string) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		fmt.Fprintf(w, "invalid pattern: %v\n", err)
+		return
+	}
+	for _, ie := range idx.events {
+		if re.MatchString(ie.query) || re.MatchString(ie.table) {
+			ie.dump(w)
+		}
+	}
+}
+
+func (ie *indexedEvent) dump(w io.Writer) {
+	fmt.Fprintf(w, "%s  %d-%d  %s", time.Unix(int64(ie.timestamp), 0).Format(timeFormat), ie.start, ie.end, ie.eventType)
+	if ie.gtid != "" {
+		fmt.Fprintf(w, "  gtid=%s", ie.gtid)
+	}
+	if ie.table != "" {
+		fmt.Fprintf(w, "  table=%s", ie.table)
+	}
+	if ie.rows > 0 {
+		fmt.Fprintf(w, "  rows=%d", ie.rows)
+	}
+	if ie.query != "" {
+		fmt.Fprintf(w, "  query=%s", ie.query)
+	}
+	fmt.Fprintln(w)
+}
+
+func replCommand(startPosition int64) {
+	runREPL(*binlogFile, startPosition, os.Stdin, os.Stdout)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// reporter accumulates events over the parsed range and prints a summary
+// once parsing finishes. All reporters requested on the command line share a
+// single pass over the binlog.
+type reporter interface {
+	observe(e *replication.BinlogEvent)
+	report(w io.Writer)
+}
+
+// fileReporter is a reporter told when the run moves on to the next file,
+// for reports that name the file of a position.
+type fileReporter interface {
+	reporter
+	nextFile(name string)
+}
+
+// runReports parses files in sequence from startPosition and feeds every
+// event that passes the -include/-exclude filters, the GTID filter and the
+// -startDatetime and -stopDatetime range to each reporter, so the reports
+// cover all the files. When decodeRows is false the row images of rows
+// events are skipped (see newParser).
+func runReports(files []string, startPosition int64, decodeRows bool, reporters ...reporter) {
+	p := newParser(decodeRows)
+
+	fileStart := startPosition
+	var summary fileSummary
+	stop := newStopPosition(files)
+	seen := 0
+	err := parseBinlogs(p, files, startPosition, func(file string, start int64) {
+		fileStart = start
+		summary.next(file)
+		stop.next(file)
+		for _, r := range reporters {
+			if fr, ok := r.(fileReporter); ok {
+				fr.nextFile(file)
+			}
+		}
+	}, func(e *replication.BinlogEvent) error {
+		if eventTimes.past(e.Header) || stop.past(e.Header) {
+			return errStopParsing
+		}
+		// The GTID filter sees every event to follow transactions.
+		if transactionFilter != nil && !transactionFilter.keep(e) {
+			return nil
+		}
+		if beforeStart(e, fileStart) || eventFilter != nil && !eventFilter.keep(e) ||
+			eventTimes.bounded() && !eventTimes.contains(e.Header) {
+			return nil
+		}
+		summary.observe(e)
+		for _, r := range reporters {
+			r.observe(e)
+		}
+		if seen++; *maxEvents > 0 && seen >= *maxEvents {
+			return errStopParsing
+		}
+		return nil
+	})
+
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+
+	for _, r := range reporters {
+		r.report(os.Stdout)
+	}
+	if len(summary.files) > 1 {
+		if *outputFormat == "text" && !(*fingerprint && len(reporters) == 1) {
+			summary.report(os.Stdout)
+		} else {
+			// Keep stdout JSON.
+			summary.report(os.Stderr)
+		}
+	}
+	runWarnings.summary(os.Stderr)
+	if errors.Is(err, errUnknownEventType) {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// riskReport lists the dangerous operations in the parsed range: TRUNCATE
+// and DROP statements, ALTER TABLE statements (with the number of rows the
+// table saw changed earlier in the range, the only size hint a binlog has),
+// and transactions that delete or update more than threshold rows. The
+// output is a checklist to work through before a restore or after an
+// incident.
+type riskReport struct {
+	threshold int
+	tx        txTracker
+	gtid      string
+	// pending counts the deleted and updated rows per table of the open
+	// transaction.
+	pending  map[string]*riskDML
+	activity map[string]int
+	findings []anomaly
+}
+
+type riskDML struct {
+	deletes, updates int
+}
+
+func newRiskReport(threshold int) *riskReport {
+	return &riskReport{
+		threshold: threshold,
+		pending:   make(map[string]*riskDML),
+		activity:  make(map[string]int),
+	}
+}
+
+func (r *riskReport) add(pos uint32, kind, format string, args ...interface{}) {
+	r.findings = append(r.findings, anomaly{pos: pos, kind: kind, detail: fmt.Sprintf(format, args...)})
+}
+
+func (r *riskReport) observe(e *replication.BinlogEvent) {
+	start := e.Header.LogPos - e.Header.EventSize
+
+	switch ev := e.Event.(type) {
+	case *replication.GTIDEvent:
+		r.gtid = gtidString(ev)
+		r.pending = make(map[string]*riskDML)
+	case *replication.QueryEvent:
+		r.observeStatement(start, string(ev.Schema), string(ev.Query))
+	case *replication.RowsEvent:
+		if ev.Table != nil {
+			table := tableName(ev.Table)
+			rows := rowsAffected(e)
+			r.activity[table] += rows
+			d := r.pending[table]
+			if d == nil {
+				d = new(riskDML)
+				r.pending[table] = d
+			}
+			switch rowsEventKind(e.Header.EventType) {
+			case "DELETE":
+				d.deletes += rows
+			case "UPDATE":
+				d.updates += rows
+			}
+		}
+	}
+
+	if done := r.tx.observe(e); done != nil {
+		r.checkMassDML(done)
+		r.pending = make(map[string]*riskDML)
+		r.gtid = ""
+	}
+}
+
+func (r *riskReport) observeStatement(pos uint32, schema, query string) {
+	verb := statementVerb(query)
+	switch verb {
+	case "TRUNCATE", "DROP", "ALTER":
+	default:
+		return
+	}
+	object, target := statementTarget(query, schema)
+	if target == "" {
+		target = "(unknown)"
+	}
+	detail := fmt.Sprintf("%s %s %s", verb, object, target)
+	if verb == "ALTER" && object == "TABLE" {
+		detail += fmt.Sprintf(" (%d rows changed earlier in range)", r.activity[target])
+	}
+	r.add(pos, verb, "%s%s: %s", detail, gtidSuffix(r.gtid), truncateQuery(query))
+}
+
+// checkMassDML records tx when it deleted or updated more rows than the
+// threshold.
+func (r *riskReport) checkMassDML(tx *transaction) {
+	deletes, updates := 0, 0
+	tables := make([]string, 0, len(r.pending))
+	for table, d := range r.pending {
+		if d.deletes+d.updates == 0 {
+			continue
+		}
+		deletes += d.deletes
+		updates += d.updates
+		tables = append(tables, table)
+	}
+	if deletes+updates <= r.threshold {
+		return
+	}
+	sort.Strings(tables)
+	for i, table := range tables {
+		d := r.pending[table]
+		tables[i] = fmt.Sprintf("%s (%d deleted, %d updated)", table, d.deletes, d.updates)
+	}
+	r.add(tx.Start, "mass DML", "transaction%s at %d-%d deletes %d and updates %d rows: %s",
+		gtidSuffix(tx.GTID), tx.Start, tx.End, deletes, updates, strings.Join(tables, ", "))
+}
+
+func (r *riskReport) report(w io.Writer) {
+	fmt.Fprintln(w, "=== Risky operations ===")
+	if len(r.findings) == 0 {
+		fmt.Fprintln(w, "No risky operations found")
+	}
+	counts := make(map[string]int)
+	for _, f := range r.findings {
+		fmt.Fprintf(w, "[ ] %d  %s: %s\n", f.pos, f.kind, f.detail)
+		counts[f.kind]++
+	}
+	for _, kind := range []string{"TRUNCATE", "DROP", "ALTER", "mass DML"} {
+		if counts[kind] > 0 {
+			fmt.Fprintf(w, "%s: %d\n", kind, counts[kind])
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// statementTarget extracts the object type and schema-qualified name a DDL
+// statement acts on: "DROP TABLE IF EXISTS `t`" in schema shop gives
+// ("TABLE", "shop.t"), as does "CREATE TABLE IF NOT EXISTS t".
+func statementTarget(query, schema string) (object, name string) {
+	fields := strings.Fields(query)
+	for i := 0; i < len(fields); i++ {
+		if strings.HasPrefix(fields[i], "/*") {
+			for !strings.HasSuffix(fields[i], "*/") && i < len(fields)-1 {
+				i++
+			}
+			continue
+		}
+		fields = fields[i:]
+		break
+	}
+	if len(fields) < 2 {
+		return "", ""
+	}
+	i := 1
+	// TRUNCATE may omit TABLE; DROP/ALTER may carry modifiers.
+	for i < len(fields)-1 {
+		switch strings.ToUpper(fields[i]) {
+		case "TEMPORARY", "ONLINE", "OFFLINE", "IGNORE":
+			i++
+			continue
+		}
+		break
+	}
+	object = strings.ToUpper(fields[i])
+	switch object {
+	case "TABLE", "DATABASE", "SCHEMA", "VIEW", "INDEX", "TRIGGER", "PROCEDURE", "FUNCTION", "EVENT", "USER":
+		i++
+	default:
+		object = "TABLE"
+	}
+	if i+2 < len(fields) && strings.EqualFold(fields[i], "IF") && strings.EqualFold(fields[i+1], "EXISTS") {
+		i += 2
+	} else if i+3 < len(fields) && strings.EqualFold(fields[i], "IF") && strings.EqualFold(fields[i+1], "NOT") && strings.EqualFold(fields[i+2], "EXISTS") {
+		i += 3
+	}
+	if i >= len(fields) {
+		return object, ""
+	}
+	name = strings.TrimRight(fields[i], ";,(")
+	if j := strings.IndexByte(name, '('); j > 0 {
+		// CREATE TABLE t(id INT, ...)
+		name = name[:j]
+	}
+	name = strings.ReplaceAll(name, "`", "")
+	if (object == "TABLE" || object == "VIEW") && schema != "" && !strings.Contains(name, ".") {
+		name = schema + "." + name
+	}
+	return object, name
+}
+
+// truncateQuery shortens a statement for single-line display.
+func truncateQuery(q string) string {
+	q = strings.Join(strings.Fields(q), " ")
+	if len(q) > 120 {
+		return q[:117] + "..."
+	}
+	return q
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/ChaosHour/go-parse/pkg/binlogwriter"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// roundtripStats counts how the events of one type fared when re-encoded.
+type roundtripStats struct {
+	events       int
+	identical    int
+	differ       int
+	notEncodable int
+	firstFailure string
+}
+
+func (s *roundtripStats) fail(format string, args ...interface{}) {
+	if s.firstFailure == "" {
+		s.firstFailure = fmt.Sprintf(format, args...)
+	}
+}
+
+// roundtrip decodes every event from startPosition, re-encodes it with
+// pkg/binlogwriter and byte-compares the result with the original. It
+// returns false when any event did not survive.
+func roundtrip(binlogFile string, startPosition int64, out io.Writer) (bool, error) {
+	stats := make(map[replication.EventType]*roundtripStats)
+	var format *replication.FormatDescriptionEvent
+	// The events are re-encoded from the values go-mysql decoded.
+	expandJSONDiffs, decodeStrings = false, false
+
+	p := newParser(true)
+	err := parseBinlog(p, binlogFile, startPosition, func(e *replication.BinlogEvent) error {
+		if fde, ok := e.Event.(*replication.FormatDescriptionEvent); ok {
+			format = fde
+		}
+		if beforeStart(e, startPosition) {
+			return nil
+		}
+		s := stats[e.Header.EventType]
+		if s == nil {
+			s = new(roundtripStats)
+			stats[e.Header.EventType] = s
+		}
+		s.events++
+
+		start := e.Header.LogPos - e.Header.EventSize
+		encoded, err := binlogwriter.EncodeEvent(e, format)
+		switch {
+		case errors.Is(err, binlogwriter.ErrNotEncodable):
+			s.notEncodable++
+			s.fail("%d: %v", start, err)
+		case err != nil:
+			s.differ++
+			s.fail("%d: %v", start, err)
+		case !bytes.Equal(encoded, e.RawData):
+			s.differ++
+			s.fail("%d: %s", start, describeMismatch(encoded, e.RawData))
+		default:
+			s.identical++
+		}
+		return nil
+	})
+
+	types := make([]replication.EventType, 0, len(stats))
+	for t := range stats {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+
+	ok := true
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "event type\tevents\tidentical\tdiffer\tnot encodable\tfirst failure")
+	for _, t := range types {
+		s := stats[t]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%s\n", t, s.events, s.identical, s.differ, s.notEncodable, s.firstFailure)
+		ok = ok && s.identical == s.events
+	}
+	tw.Flush()
+	return ok, err
+}
+
+// describeMismatch locates the first byte where a re-encoded event differs
+// from the original.
+func describeMismatch(encoded, original []byte) string {
+	for i := 0; i < len(encoded) && i < len(original); i++ {
+		if encoded[i] != original[i] {
+			return fmt.Sprintf("byte %d is %#02x, originally %#02x", i, encoded[i], original[i])
+		}
+	}
+	return fmt.Sprintf("re-encoded to %d bytes, originally %d", len(encoded), len(original))
+}
+
+func roundtripCommand(startPosition int64) {
+	ok, err := roundtrip(*binlogFile, startPosition, os.Stdout)
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+	if !ok || err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/client"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// absentColumn stands in for a column a row image does not carry: a BLOB
+// or TEXT column left out under binlog_row_image=NOBLOB, or with MINIMAL
+// any column the change did not need. go-mysql decodes such columns as
+// nil, the same as NULL, which would make generated SQL overwrite them.
+type absentColumn struct{}
+
+func (absentColumn) String() string { return "(not in row image)" }
+
+func isAbsent(v interface{}) bool {
+	_, ok := v.(absentColumn)
+	return ok
+}
+
+// rowImages counts the absent columns met in the row images of a run, and
+// looks them up on the -backfillDSN server when one is set.
+var rowImages = new(rowImageTracker)
+
+type rowImageTracker struct {
+	absent int // absent column values left after backfilling
+	tables map[string]bool
+
+	conn    *client.Conn
+	server  string
+	lookups int
+	found   int
+	filled  int
+}
+
+// openBackfill connects to the server of -backfillDSN.
+func (t *rowImageTracker) openBackfill(dsn string) error {
+	s, err := parseDSN("-backfillDSN", dsn)
+	if err != nil {
+		return err
+	}
+	conn, err := client.Connect(s.addr(), s.user, s.password, "", func(c *client.Conn) error {
+		c.SetTLSConfig(s.tls)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("-backfillDSN %s: %v", s.addr(), err)
+	}
+	t.conn, t.server = conn, s.addr()
+	return nil
+}
+
+// row returns row r of re with the columns its image does not carry set to
+// absentColumn{}, after looking them up on the -backfillDSN server.
+func (t *rowImageTracker) row(re *replication.RowsEvent, r int) ([]interface{}, error) {
+	return t.complete(re.Table, markAbsent(re, r))
+}
+
+// markAbsent returns row r of re with the columns its image does not carry
+// set to absentColumn{}. The event's row is only copied when a column is
+// absent.
+func markAbsent(re *replication.RowsEvent, r int) []interface{} {
+	row := re.Rows[r]
+	if r >= len(re.SkippedColumns) || len(re.SkippedColumns[r]) == 0 {
+		return row
+	}
+	row = append([]interface{}(nil), row...)
+	for _, c := range re.SkippedColumns[r] {
+		if c < len(row) {
+			row[c] = absentColumn{}
+		}
+	}
+	return row
+}
+
+// update returns the before and after images of the UPDATE row pair at r of
+// re, with the columns left out of them filled in as far as they can be:
+// see carryUnchanged and completeUpdate.
+func (t *rowImageTracker) update(re *replication.RowsEvent, r int) (before, after []interface{}, err error) {
+	before = markAbsent(re, r)
+	return t.completeUpdate(re.Table, before, carryUnchanged(before, markAbsent(re, r+1)))
+}
+
+// carryUnchanged fills the absent columns of an UPDATE's after image from
+// its before image. An after image only leaves out columns the update did
+// not change, and with binlog_row_image=MINIMAL that includes the key.
+func carryUnchanged(before, after []interface{}) []interface{} {
+	for i, v := range after {
+		if isAbsent(v) && i < len(before) {
+			after[i] = before[i]
+		}
+	}
+	return after
+}
+
+// completeUpdate looks up the columns absent from both images of an UPDATE
+// on the -backfillDSN server, by the key in the after image, and counts
+// those that stay absent. A column absent only from the before image was
+// changed by the update, so its value on the server is not the value
+// before; it stays absent.
+func (t *rowImageTracker) completeUpdate(table *replication.TableMapEvent, before, after []interface{}) ([]interface{}, []interface{}, error) {
+	if t.conn != nil && slices.ContainsFunc(after, isAbsent) {
+		var both []int
+		for i, v := range after {
+			if isAbsent(v) && i < len(before) {
+				both = append(both, i)
+			}
+		}
+		if err := t.backfill(table, after); err != nil {
+			return nil, nil, err
+		}
+		for _, i := range both {
+			before[i] = after[i]
+		}
+	}
+	t.count(table, before)
+	t.count(table, after)
+	return before, after, nil
+}
+
+// complete looks up the absent columns of a row of table on the
+// -backfillDSN server, and counts those that stay absent.
+func (t *rowImageTracker) complete(table *replication.TableMapEvent, row []interface{}) ([]interface{}, error) {
+	if !slices.ContainsFunc(row, isAbsent) {
+		return row, nil
+	}
+	if t.conn != nil {
+		if err := t.backfill(table, row); err != nil {
+			return nil, err
+		}
+	}
+	t.count(table, row)
+	return row, nil
+}
+
+// count counts the columns of a row of table that are still absent.
+func (t *rowImageTracker) count(table *replication.TableMapEvent, row []interface{}) {
+	for _, v := range row {
+		if isAbsent(v) {
+			t.absent++
+			if t.tables == nil {
+				t.tables = make(map[string]bool)
+			}
+			t.tables[tableName(table)] = true
+		}
+	}
+}
+
+// backfill sets the absent columns of row to their values on the server,
+// finding the row by its key (see uniqueKey). The server has the row as it is
+// now, so a value is only right if the column has not changed since the
+// event. Rows that no longer exist, or whose key is itself absent, are left
+// as they are.
+func (t *rowImageTracker) backfill(table *replication.TableMapEvent, row []interface{}) error {
+	names := columnNames(table)
+	if len(names) != len(row) {
+		return fmt.Errorf("%s: -backfillDSN needs column names (binlog_row_metadata=FULL or -schemaFile)", tableName(table))
+	}
+	if uniqueKey(table) == nil {
+		return nil
+	}
+	unsigned := table.UnsignedMap()
+	var cols []int
+	q := []byte("SELECT ")
+	for i, v := range row {
+		if isAbsent(v) {
+			if len(cols) > 0 {
+				q = append(q, ", "...)
+			}
+			q = append(q, quoteIdent(names[i])...)
+			cols = append(cols, i)
+		}
+	}
+	q = append(q, " FROM "...)
+	q = append(q, quoteIdent(string(table.Schema))...)
+	q = append(q, '.')
+	q = append(q, quoteIdent(string(table.Table))...)
+	q = append(q, " WHERE "...)
+	var args []interface{}
+	for n, c := range keyColumns(table) {
+		if isAbsent(row[c]) {
+			return nil
+		}
+		if n > 0 {
+			q = append(q, " AND "...)
+		}
+		q = append(q, quoteIdent(names[c])...)
+		q = append(q, " <=> ?"...)
+		args = append(args, queryArg(columnValue(row[c], unsigned[c])))
+	}
+
+	t.lookups++
+	r, err := t.conn.Execute(string(q), args...)
+	if err != nil {
+		return fmt.Errorf("-backfillDSN %s: %s: %v", t.server, tableName(table), err)
+	}
+	defer r.Close()
+	if r.RowNumber() == 0 {
+		return nil
+	}
+	t.found++
+	for j, c := range cols {
+		v, err := r.GetValue(0, j)
+		if err != nil {
+			return fmt.Errorf("-backfillDSN %s: %s: %v", t.server, tableName(table), err)
+		}
+		// The result's buffers are recycled by Close.
+		if b, ok := v.([]byte); ok {
+			v = bytes.Clone(b)
+		}
+		row[c] = v
+		t.filled++
+	}
+	return nil
+}
+
+// queryArg converts a decoded value to a type the client can send as a
+// statement parameter.
+func queryArg(v interface{}) interface{} {
+	switch v := v.(type) {
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05.999999")
+	case fmt.Stringer:
+		return v.String()
+	}
+	return v
+}
+
+// report writes what backfilling did and how many column values were left
+// absent, if any.
+func (t *rowImageTracker) report(w io.Writer) {
+	if t.conn != nil {
+		fmt.Fprintf(w, "Backfilled %s from %s: %d of %d rows found\n", plural(t.filled, "column value"), t.server, t.found, t.lookups)
+		t.conn.Close()
+	}
+	if t.absent == 0 {
+		return
+	}
+	tables := make([]string, 0, len(t.tables))
+	for table := range t.tables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	fmt.Fprintf(w, "Row images of %s left out %s (binlog_row_image=NOBLOB or MINIMAL)", strings.Join(tables, ", "), plural(t.absent, "column value"))
+	if t.conn == nil {
+		fmt.Fprint(w, "; -backfillDSN looks them up on a server")
+	}
+	fmt.Fprintln(w)
+}
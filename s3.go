@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3Client makes signed (AWS Signature Version 4) requests to S3 or an
+// S3-compatible store. It takes its credentials and region from the
+// standard AWS environment variables, and AWS_ENDPOINT_URL selects another
+// endpoint, such as MinIO. Objects are addressed path-style.
+type s3Client struct {
+	endpoint     string
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	http         *http.Client
+}
+
+func newS3Client() (*s3Client, error) {
+	c := &s3Client{
+		endpoint:     strings.TrimSuffix(os.Getenv("AWS_ENDPOINT_URL"), "/"),
+		region:       os.Getenv("AWS_REGION"),
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		http:         &http.Client{Timeout: time.Minute},
+	}
+	if c.region == "" {
+		c.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if c.region == "" {
+		c.region = "us-east-1"
+	}
+	if c.accessKey == "" || c.secretKey == "" {
+		return nil, fmt.Errorf("s3: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+	if c.endpoint == "" {
+		c.endpoint = "https://s3." + c.region + ".amazonaws.com"
+	}
+	return c, nil
+}
+
+// parseS3URL splits s3://bucket/key.
+func parseS3URL(s string) (bucket, key string, err error) {
+	rest, ok := strings.CutPrefix(s, "s3://")
+	bucket, key, _ = strings.Cut(rest, "/")
+	if !ok || bucket == "" || key == "" {
+		return "", "", fmt.Errorf("invalid S3 URL %q, want s3://bucket/key", s)
+	}
+	return bucket, key, nil
+}
+
+// do sends a signed request for the object key in bucket. header may add
+// headers such as Range; they are signed too.
+func (c *s3Client) do(method, bucket, key string, header http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.endpoint+"/"+s3Escape(bucket)+"/"+s3Escape(key), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	return c.send(req, body)
+}
+
+// list sends a signed ListObjectsV2 request for bucket and returns the
+// successful response.
+func (c *s3Client) list(bucket string, query url.Values) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, c.endpoint+"/"+s3Escape(bucket)+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.send(req, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, s3Error(resp, bucket, "")
+	}
+	return resp, nil
+}
+
+func (c *s3Client) send(req *http.Request, body []byte) (*http.Response, error) {
+	sum := sha256.Sum256(body)
+	c.sign(req, hex.EncodeToString(sum[:]), time.Now())
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3: %v", err)
+	}
+	return resp, nil
+}
+
+// s3Error turns an unexpected response into an error and closes its body.
+func s3Error(resp *http.Response, bucket, key string) error {
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("s3://%s/%s: %s: %s", bucket, key, resp.Status, bytes.TrimSpace(msg))
+}
+
+// sign adds the AWS Signature Version 4 Authorization header to req,
+// signing the host, any Range header and the x-amz-* headers.
+func (c *s3Client) sign(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		if lk := strings.ToLower(k); lk == "range" || strings.HasPrefix(lk, "x-amz-") {
+			headers[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonHeaders.String(),
+		signed,
+		payloadHash,
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonical))
+	scope := day + "/" + c.region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	k := hmacSHA256([]byte("AWS4"+c.secretKey), day)
+	k = hmacSHA256(k, c.region)
+	k = hmacSHA256(k, "s3")
+	k = hmacSHA256(k, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(k, toSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+c.accessKey+"/"+scope+
+		", SignedHeaders="+signed+", Signature="+sig)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vs := append([]string(nil), q[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, strings.ReplaceAll(s3Escape(k), "/", "%2F")+"="+strings.ReplaceAll(s3Escape(v), "/", "%2F"))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape percent-encodes s as SigV4 requires: every byte but the
+// unreserved characters, keeping the slashes of object keys.
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case 'A' <= ch && ch <= 'Z', 'a' <= ch && ch <= 'z', '0' <= ch && ch <= '9',
+			ch == '-', ch == '_', ch == '.', ch == '~', ch == '/':
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
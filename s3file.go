@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// s3SkipLimit is how far forward a seek on an S3 object reads and
+	// discards the open response instead of starting a new request, so that
+	// scanning event headers streams the object.
+	s3SkipLimit = 1 << 20
+	// s3ReadRetries is how many times a read that fails mid-object
+	// resumes from where it stopped.
+	s3ReadRetries = 3
+)
+
+// isS3URL reports whether a -file entry names an S3 object.
+func isS3URL(name string) bool {
+	return strings.HasPrefix(name, "s3://")
+}
+
+// s3Reader is the client binlogs are read from S3 with, shared by the
+// files of a run. Its responses are bodies read for as long as a parse
+// takes, so it has no overall timeout, only one for the response headers.
+var s3Reader struct {
+	once sync.Once
+	c    *s3Client
+	err  error
+}
+
+func s3ReadClient() (*s3Client, error) {
+	s3Reader.once.Do(func() {
+		s3Reader.c, s3Reader.err = newS3Client()
+		if s3Reader.c != nil {
+			t := http.DefaultTransport.(*http.Transport).Clone()
+			t.ResponseHeaderTimeout = time.Minute
+			s3Reader.c.http = &http.Client{Transport: t}
+		}
+	})
+	return s3Reader.c, s3Reader.err
+}
+
+// s3Object reads a binlog stored in S3 without downloading it first. Reads
+// stream a ranged GET from the current offset, opened at the first read
+// after a seek; a read that fails mid-object resumes with a new request.
+type s3Object struct {
+	c           *s3Client
+	bucket, key string
+	info        *s3FileInfo
+	off         int64
+	body        io.ReadCloser
+}
+
+// s3FileInfo describes an S3 object as os.Stat describes a file.
+type s3FileInfo struct {
+	url     string
+	size    int64
+	modTime time.Time
+	etag    string
+}
+
+func (fi *s3FileInfo) Name() string       { return path.Base(fi.url) }
+func (fi *s3FileInfo) Size() int64        { return fi.size }
+func (fi *s3FileInfo) Mode() fs.FileMode  { return 0444 }
+func (fi *s3FileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *s3FileInfo) IsDir() bool        { return false }
+func (fi *s3FileInfo) Sys() interface{}   { return nil }
+
+// statS3Object returns the size and version of the object name. A missing
+// object is an fs.ErrNotExist error.
+func statS3Object(name string) (*s3FileInfo, error) {
+	bucket, key, err := parseS3URL(name)
+	if err != nil {
+		return nil, err
+	}
+	c, err := s3ReadClient()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(http.MethodHead, bucket, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+	default:
+		return nil, fmt.Errorf("%s: %s", name, resp.Status)
+	}
+	fi := &s3FileInfo{url: name, size: resp.ContentLength, etag: resp.Header.Get("ETag")}
+	fi.modTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return fi, nil
+}
+
+func openS3Object(name string) (*s3Object, error) {
+	info, err := statS3Object(name)
+	if err != nil {
+		return nil, err
+	}
+	o := &s3Object{info: info}
+	o.bucket, o.key, _ = parseS3URL(name)
+	o.c, _ = s3ReadClient()
+	return o, nil
+}
+
+// open starts a GET of the object from the current offset.
+func (o *s3Object) open() error {
+	resp, err := o.c.do(http.MethodGet, o.bucket, o.key, http.Header{"Range": {"bytes=" + strconv.FormatInt(o.off, 10) + "-"}}, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
+		return s3Error(resp, o.bucket, o.key)
+	}
+	if resp.StatusCode == http.StatusOK && o.off > 0 {
+		// The store ignored the range.
+		if _, err := io.CopyN(io.Discard, resp.Body, o.off); err != nil {
+			resp.Body.Close()
+			return fmt.Errorf("s3://%s/%s: %v", o.bucket, o.key, err)
+		}
+	}
+	o.body = resp.Body
+	return nil
+}
+
+func (o *s3Object) Read(p []byte) (int, error) {
+	for retries := 0; ; retries++ {
+		if o.off >= o.info.size {
+			return 0, io.EOF
+		}
+		if o.body == nil {
+			if err := o.open(); err != nil {
+				return 0, err
+			}
+		}
+		n, err := o.body.Read(p)
+		o.off += int64(n)
+		if n > 0 || err == nil {
+			return n, nil
+		}
+		o.body.Close()
+		o.body = nil
+		if o.off < o.info.size && retries == s3ReadRetries {
+			return 0, fmt.Errorf("s3://%s/%s: read at %d: %v", o.bucket, o.key, o.off, err)
+		}
+	}
+}
+
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += o.off
+	case io.SeekEnd:
+		offset += o.info.size
+	}
+	if offset < 0 {
+		return o.off, fmt.Errorf("s3://%s/%s: negative seek", o.bucket, o.key)
+	}
+	if o.body != nil {
+		if skip := offset - o.off; skip >= 0 && skip <= s3SkipLimit {
+			n, err := io.CopyN(io.Discard, o.body, skip)
+			o.off += n
+			if err == nil {
+				return o.off, nil
+			}
+		}
+		o.body.Close()
+		o.body = nil
+	}
+	o.off = offset
+	return o.off, nil
+}
+
+// ReadAt reads at off through the stream, so the ascending reads of a
+// header scan do not each start a request. It moves the read offset.
+func (o *s3Object) ReadAt(p []byte, off int64) (int, error) {
+	if _, err := o.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.ReadFull(o, p)
+}
+
+func (o *s3Object) Close() error {
+	if o.body != nil {
+		o.body.Close()
+		o.body = nil
+	}
+	return nil
+}
+
+func (o *s3Object) Stat() (os.FileInfo, error) {
+	return o.info, nil
+}
+
+// globS3Objects returns the keys of the objects matching pattern, an S3 URL
+// with * ? and [] wildcards in its key as filepath.Glob takes them, sorted.
+func globS3Objects(pattern string) ([]string, error) {
+	bucket, keyPattern, err := parseS3URL(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := path.Match(keyPattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid file pattern %q", pattern)
+	}
+	c, err := s3ReadClient()
+	if err != nil {
+		return nil, err
+	}
+	prefix := keyPattern[:strings.IndexAny(keyPattern, "*?[")]
+	var matches []string
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		resp, err := c.list(bucket, q)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3://%s: listing %s: %v", bucket, prefix, err)
+		}
+		for _, o := range result.Contents {
+			if ok, _ := path.Match(keyPattern, o.Key); ok {
+				matches = append(matches, "s3://"+bucket+"/"+o.Key)
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
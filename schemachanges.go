@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// schemaChangeReport follows the shape of each table, the column count and
+// types its table maps give, through the parsed range, and reports where it
+// changes along with the DDL statements on the table: the moment of a
+// schema migration in the log stream.
+type schemaChangeReport struct {
+	tx     txTracker
+	file   string
+	shapes map[string]*tableShape
+	// tables are those with DDL statements or a change of shape, in the
+	// order first met, and events theirs.
+	tables []string
+	events map[string][]*schemaEvent
+	// ddl marks the tables with a DDL statement since their last change of
+	// shape.
+	ddl map[string]bool
+}
+
+// tableShape is what a table map tells of a table's columns.
+type tableShape struct {
+	types []string
+	names []string // empty without binlog_row_metadata=FULL
+}
+
+// schemaEvent is a DDL statement on a table, or a change of its shape.
+type schemaEvent struct {
+	file      string
+	pos       uint32
+	timestamp uint32
+	gtid      string
+	ddl       string   // the statement, for DDL
+	changes   []string // what changed, for a change of shape
+	// unexplained is set on a change of shape with no DDL statement on the
+	// table before it in the range.
+	unexplained bool
+}
+
+func newSchemaChangeReport() *schemaChangeReport {
+	return &schemaChangeReport{
+		shapes: make(map[string]*tableShape),
+		events: make(map[string][]*schemaEvent),
+		ddl:    make(map[string]bool),
+	}
+}
+
+func (r *schemaChangeReport) nextFile(name string) {
+	r.file = binlogBase(name)
+}
+
+func (r *schemaChangeReport) add(table string, e *replication.BinlogEvent, ev *schemaEvent) {
+	ev.file = r.file
+	ev.pos = e.Header.LogPos - e.Header.EventSize
+	ev.timestamp = e.Header.Timestamp
+	ev.gtid = r.tx.gtid()
+	if _, ok := r.events[table]; !ok {
+		r.tables = append(r.tables, table)
+	}
+	r.events[table] = append(r.events[table], ev)
+}
+
+func (r *schemaChangeReport) observe(e *replication.BinlogEvent) {
+	// A DDL statement closes its transaction: follow it after reading the
+	// GTID.
+	defer r.tx.observe(e)
+	switch ev := e.Event.(type) {
+	case *replication.QueryEvent:
+		query := string(ev.Query)
+		for _, table := range ddlTables(query, string(ev.Schema)) {
+			r.add(table, e, &schemaEvent{ddl: truncateQuery(query)})
+			r.ddl[table] = true
+		}
+	case *replication.TableMapEvent:
+		table := tableName(ev)
+		shape := &tableShape{names: ev.ColumnNameString()}
+		for i := range ev.ColumnType {
+			shape.types = append(shape.types, columnTypeName(ev, i))
+		}
+		prev := r.shapes[table]
+		r.shapes[table] = shape
+		if prev == nil {
+			return
+		}
+		if changes := shapeChanges(prev, shape); len(changes) > 0 {
+			r.add(table, e, &schemaEvent{changes: changes, unexplained: !r.ddl[table]})
+			r.ddl[table] = false
+		}
+	}
+}
+
+// ddlTables returns the tables a statement changes the columns of, or may:
+// those of CREATE, ALTER and DROP TABLE, and both names of each pair of a
+// RENAME TABLE, as online schema change tools swap tables with.
+func ddlTables(query, schema string) []string {
+	verb := statementVerb(query)
+	switch verb {
+	case "CREATE", "ALTER", "DROP":
+		object, target := statementTarget(query, schema)
+		if object != "TABLE" || target == "" {
+			return nil
+		}
+		if verb == "DROP" && strings.Contains(query, ",") {
+			// DROP TABLE [IF EXISTS] a, b
+			list := query[strings.Index(strings.ToUpper(query), "TABLE")+len("TABLE"):]
+			if f := strings.Fields(list); len(f) > 2 && strings.EqualFold(f[0], "IF") && strings.EqualFold(f[1], "EXISTS") {
+				list = list[strings.Index(strings.ToUpper(list), "EXISTS")+len("EXISTS"):]
+			}
+			return qualifiedNames(list, schema, ",")
+		}
+		return []string{target}
+	case "RENAME":
+		// RENAME TABLE a TO b, c TO d
+		upper := strings.ToUpper(query)
+		i := strings.Index(upper, "TABLE")
+		if i < 0 {
+			return nil
+		}
+		var tables []string
+		for _, pair := range strings.Split(query[i+len("TABLE"):], ",") {
+			tables = append(tables, qualifiedNames(pair, schema, " TO ")...)
+		}
+		return tables
+	}
+	return nil
+}
+
+// qualifiedNames splits list at sep, a separator in any case, into table
+// names qualified with schema where they are not already.
+func qualifiedNames(list, schema, sep string) []string {
+	var names []string
+	upper := strings.ToUpper(list)
+	for upper != "" {
+		part := list
+		if i := strings.Index(upper, sep); i >= 0 {
+			part, list, upper = list[:i], list[i+len(sep):], upper[i+len(sep):]
+		} else {
+			list, upper = "", ""
+		}
+		f := strings.Fields(part)
+		if len(f) == 0 {
+			continue
+		}
+		name := strings.ReplaceAll(strings.TrimRight(f[0], ";"), "`", "")
+		if schema != "" && !strings.Contains(name, ".") {
+			name = schema + "." + name
+		}
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// shapeChanges describes how a table's columns went from a to b: by name
+// when both table maps carry names, else by position.
+func shapeChanges(a, b *tableShape) []string {
+	var changes []string
+	if len(a.types) != len(b.types) {
+		changes = append(changes, fmt.Sprintf("%d -> %d columns", len(a.types), len(b.types)))
+	}
+	if len(a.names) == len(a.types) && len(b.names) == len(b.types) {
+		for i, name := range a.names {
+			j := slices.Index(b.names, name)
+			switch {
+			case j < 0:
+				changes = append(changes, fmt.Sprintf("dropped %s %s", name, a.types[i]))
+			case a.types[i] != b.types[j]:
+				changes = append(changes, fmt.Sprintf("%s %s -> %s", name, a.types[i], b.types[j]))
+			}
+		}
+		for j, name := range b.names {
+			if !slices.Contains(a.names, name) {
+				changes = append(changes, fmt.Sprintf("added %s %s", name, b.types[j]))
+			}
+		}
+		return changes
+	}
+	for i := 0; i < max(len(a.types), len(b.types)); i++ {
+		label := columnLabel(nil, i)
+		switch {
+		case i >= len(b.types):
+			changes = append(changes, fmt.Sprintf("dropped %s %s", label, a.types[i]))
+		case i >= len(a.types):
+			changes = append(changes, fmt.Sprintf("added %s %s", label, b.types[i]))
+		case a.types[i] != b.types[i]:
+			changes = append(changes, fmt.Sprintf("%s %s -> %s", label, a.types[i], b.types[i]))
+		}
+	}
+	return changes
+}
+
+func (r *schemaChangeReport) report(w io.Writer) {
+	fmt.Fprintln(w, "=== Schema changes ===")
+	changed := 0
+	statements := make(map[string]bool)
+	for _, table := range r.tables {
+		fmt.Fprintln(w, table)
+		hasChange := false
+		for _, ev := range r.events[table] {
+			at := fmt.Sprintf("%s:%d", ev.file, ev.pos)
+			ts := time.Unix(int64(ev.timestamp), 0).Format(timeFormat)
+			if ev.ddl != "" {
+				statements[at] = true
+				fmt.Fprintf(w, "  %s  %-24s DDL%s: %s\n", ts, at, gtidSuffix(ev.gtid), ev.ddl)
+				continue
+			}
+			hasChange = true
+			fmt.Fprintf(w, "  %s  %-24s columns changed%s: %s\n", ts, at, gtidSuffix(ev.gtid), strings.Join(ev.changes, ", "))
+			if ev.unexplained {
+				fmt.Fprintln(w, "    no DDL on the table before it in the range: the change is older, or made on another server")
+			}
+		}
+		if hasChange {
+			changed++
+		}
+	}
+	if len(r.tables) == 0 {
+		fmt.Fprintln(w, "No schema changes found")
+	} else {
+		fmt.Fprintf(w, "%s changed columns; %s\n", plural(changed, "table"), plural(len(statements), "DDL statement"))
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// tableSchemas are the tables of -schemaFile, by db.table, or by table
+// name alone for a CREATE TABLE outside any database.
+var tableSchemas map[string]*tableSchema
+
+// tableSchema is what go-parse takes from a CREATE TABLE: the column names,
+// the values of the ENUM and SET columns, the NOT NULL columns and the
+// character sets of the character and binary string columns, by column
+// index, and the columns of the primary key and of each unique index.
+type tableSchema struct {
+	columns    []string
+	values     map[int][]string
+	notNull    map[int]bool
+	charsets   map[int]string
+	primaryKey []int
+	uniqueKeys [][]int
+}
+
+// schemaFor returns the -schemaFile table of t when its column count
+// matches, else nil.
+func schemaFor(t *replication.TableMapEvent) *tableSchema {
+	s, ok := tableSchemas[tableName(t)]
+	if !ok {
+		s = tableSchemas[string(t.Table)]
+	}
+	if s == nil || len(s.columns) != int(t.ColumnCount) {
+		return nil
+	}
+	return s
+}
+
+// columnNames returns the column names of table t: those its table map
+// carries with binlog_row_metadata=FULL, else those -schemaFile gives it
+// when its column count matches, else nil.
+func columnNames(t *replication.TableMapEvent) []string {
+	if names := t.ColumnNameString(); len(names) > 0 {
+		return names
+	}
+	if s := schemaFor(t); s != nil {
+		return s.columns
+	}
+	return nil
+}
+
+// uniqueKey returns the columns that identify a row of table t: its primary
+// key, from its table map with binlog_row_metadata=FULL or from -schemaFile,
+// else the best unique index of -schemaFile. Like replication applying row
+// events, it only takes a unique index whose columns are all NOT NULL, as
+// rows may share a NULL, and of those the one with the fewest columns. Its
+// columns must compare by equality (see equalityComparable). It returns nil
+// for a table without such a key.
+func uniqueKey(t *replication.TableMapEvent) []int {
+	if len(t.PrimaryKey) > 0 {
+		key := make([]int, len(t.PrimaryKey))
+		for i, c := range t.PrimaryKey {
+			key[i] = int(c)
+		}
+		return key
+	}
+	s := schemaFor(t)
+	if s == nil {
+		return nil
+	}
+	if len(s.primaryKey) > 0 {
+		return s.primaryKey
+	}
+	var best []int
+	for _, key := range s.uniqueKeys {
+		usable := true
+		for _, c := range key {
+			usable = usable && s.notNull[c] && equalityComparable(t, c)
+		}
+		if usable && (best == nil || len(key) < len(best)) {
+			best = key
+		}
+	}
+	return best
+}
+
+// loadSchemaFile reads the tables created by the CREATE TABLE statements in
+// path, as mysqldump --no-data writes them. USE statements set the database
+// of unqualified tables; other statements are ignored.
+func loadSchemaFile(path string) (map[string]*tableSchema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	schemas := make(map[string]*tableSchema)
+	db := ""
+	for _, stmt := range splitSQLStatements(string(data)) {
+		words := strings.Fields(stmt)
+		switch {
+		case len(words) == 2 && strings.EqualFold(words[0], "USE"):
+			db = unquoteIdent(words[1])
+		case len(words) > 2 && strings.EqualFold(words[0], "CREATE"):
+			name, table, ok := parseCreateTable(stmt)
+			if !ok {
+				continue
+			}
+			if !strings.Contains(name, ".") && db != "" {
+				name = db + "." + name
+			}
+			if len(table.columns) == 0 {
+				return nil, fmt.Errorf("%s: CREATE TABLE %s has no columns", path, name)
+			}
+			schemas[name] = table
+		}
+	}
+	if len(schemas) == 0 {
+		return nil, fmt.Errorf("%s: no CREATE TABLE statements", path)
+	}
+	return schemas, nil
+}
+
+// splitSQLStatements splits s at the semicolons outside quotes, dropping
+// comments.
+func splitSQLStatements(s string) []string {
+	var stmts []string
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for j < len(s) && s[j] != c {
+				if s[j] == '\\' && c != '`' {
+					j++
+				}
+				j++
+			}
+			b.WriteString(s[i:min(j+1, len(s))])
+			i = j
+		case c == '#' || strings.HasPrefix(s[i:], "--") && (i+2 == len(s) || s[i+2] <= ' '):
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+			b.WriteByte('\n')
+		case c == '/' && strings.HasPrefix(s[i:], "/*"):
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				i = len(s)
+			} else {
+				i += end + 3
+			}
+			b.WriteByte(' ')
+		case c == ';':
+			if stmt := strings.TrimSpace(b.String()); stmt != "" {
+				stmts = append(stmts, stmt)
+			}
+			b.Reset()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	if stmt := strings.TrimSpace(b.String()); stmt != "" {
+		stmts = append(stmts, stmt)
+	}
+	return stmts
+}
+
+// parseCreateTable returns the table name, possibly db.table, and the
+// columns of a CREATE TABLE statement.
+func parseCreateTable(stmt string) (name string, table *tableSchema, ok bool) {
+	open := strings.IndexByte(stmt, '(')
+	if open < 0 {
+		return "", nil, false
+	}
+	// CREATE [TEMPORARY] TABLE [IF NOT EXISTS] name
+	words := strings.Fields(stmt[:open])
+	isTable := func(w string) bool { return strings.EqualFold(w, "TABLE") }
+	if len(words) < 3 || !slices.ContainsFunc(words[1:3], isTable) {
+		return "", nil, false
+	}
+	parts := strings.Split(words[len(words)-1], ".")
+	for i, p := range parts {
+		parts[i] = unquoteIdent(p)
+	}
+	name = strings.Join(parts, ".")
+
+	table = &tableSchema{values: make(map[int][]string), notNull: make(map[int]bool), charsets: make(map[int]string)}
+	// The keys name their columns, which may come after them.
+	var primary []string
+	var unique [][]string
+	defs, end := splitDefinitions(stmt[open+1:])
+	// Character columns without a character set of their own take the
+	// table's.
+	tableCharset := charsetOption(strings.Fields(strings.ReplaceAll(stmt[open+1+end:], "=", " ")))
+	var textColumns []int
+	for _, def := range defs {
+		f := strings.Fields(def)
+		if len(f) == 0 {
+			continue
+		}
+		switch strings.ToUpper(f[0]) {
+		case "CONSTRAINT":
+			// CONSTRAINT [name] PRIMARY KEY (...) or UNIQUE (...)
+			for _, w := range f[1:min(3, len(f))] {
+				switch strings.ToUpper(w) {
+				case "PRIMARY":
+					primary = keyParts(def)
+				case "UNIQUE":
+					unique = append(unique, keyParts(def))
+				}
+			}
+			continue
+		case "PRIMARY":
+			primary = keyParts(def)
+			continue
+		case "UNIQUE":
+			unique = append(unique, keyParts(def))
+			continue
+		case "KEY", "INDEX", "FOREIGN", "FULLTEXT", "SPATIAL", "CHECK":
+			continue
+		}
+		column := unquoteIdent(f[0])
+		upper := strings.ToUpper(strings.Join(f[1:], " "))
+		if strings.Contains(upper, "NOT NULL") {
+			table.notNull[len(table.columns)] = true
+		}
+		if strings.Contains(upper, "PRIMARY KEY") {
+			primary = []string{column}
+		} else if strings.Contains(upper, " UNIQUE") {
+			unique = append(unique, []string{column})
+		}
+		// The type follows the name: ENUM('a','b') or SET('a','b').
+		typ := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(def), f[0]))
+		paren := strings.IndexByte(typ, '(')
+		if paren > 0 {
+			switch strings.ToUpper(strings.TrimSpace(typ[:paren])) {
+			case "ENUM", "SET":
+				table.values[len(table.columns)] = parseValueList(typ[paren+1:])
+			}
+		}
+		if len(f) > 1 {
+			base, _, _ := strings.Cut(strings.ToUpper(f[1]), "(")
+			switch base {
+			case "CHAR", "VARCHAR", "TINYTEXT", "TEXT", "MEDIUMTEXT", "LONGTEXT":
+				if cs := charsetOption(f[2:]); cs != "" {
+					table.charsets[len(table.columns)] = cs
+				} else {
+					textColumns = append(textColumns, len(table.columns))
+				}
+			case "NCHAR", "NVARCHAR", "NATIONAL":
+				table.charsets[len(table.columns)] = "utf8mb3"
+			case "BINARY", "VARBINARY", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB":
+				table.charsets[len(table.columns)] = "binary"
+			}
+		}
+		table.columns = append(table.columns, column)
+	}
+	if tableCharset != "" {
+		for _, c := range textColumns {
+			table.charsets[c] = tableCharset
+		}
+	}
+	table.primaryKey = keyIndexes(table.columns, primary)
+	for _, c := range table.primaryKey {
+		table.notNull[c] = true
+	}
+	for _, key := range unique {
+		if cols := keyIndexes(table.columns, key); cols != nil {
+			table.uniqueKeys = append(table.uniqueKeys, cols)
+		}
+	}
+	return name, table, true
+}
+
+// keyParts returns the column names of a key definition, such as
+// UNIQUE KEY `name` (`a`,`b`(10)), or nil for a key on an expression.
+func keyParts(def string) []string {
+	open := strings.IndexByte(def, '(')
+	if open < 0 {
+		return nil
+	}
+	var names []string
+	for _, part := range splitTopLevel(def[open+1:]) {
+		f := strings.Fields(part)
+		if len(f) == 0 || strings.HasPrefix(f[0], "(") {
+			return nil
+		}
+		// A prefix length follows the name: `b`(10).
+		name, _, _ := strings.Cut(f[0], "(")
+		names = append(names, unquoteIdent(name))
+	}
+	return names
+}
+
+// keyIndexes returns the indexes in columns of the key columns names, or nil
+// when one is not a column.
+func keyIndexes(columns, names []string) []int {
+	var cols []int
+	for _, name := range names {
+		i := slices.Index(columns, name)
+		if i < 0 {
+			return nil
+		}
+		cols = append(cols, i)
+	}
+	return cols
+}
+
+// parseValueList parses the quoted values of an ENUM or SET definition, after
+// its opening parenthesis, up to the closing one.
+func parseValueList(s string) []string {
+	var values []string
+	for i := 0; i < len(s) && s[i] != ')'; i++ {
+		q := s[i]
+		if q != '\'' && q != '"' {
+			continue
+		}
+		var b strings.Builder
+		for i++; i < len(s); i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+			} else if s[i] == q {
+				if i+1 >= len(s) || s[i+1] != q {
+					break
+				}
+				// A doubled quote stands for one.
+				i++
+			}
+			b.WriteByte(s[i])
+		}
+		values = append(values, b.String())
+	}
+	return values
+}
+
+// charsetOption returns the character set the words of a column definition
+// or of table options set with CHARACTER SET, CHARSET or COLLATE, or "".
+func charsetOption(words []string) string {
+	for i := 0; i+1 < len(words); i++ {
+		name := unquoteIdent(strings.Trim(words[i+1], "'\""))
+		switch strings.ToUpper(words[i]) {
+		case "CHARSET":
+			return normalizeCharset(name)
+		case "CHARACTER":
+			if strings.EqualFold(words[i+1], "SET") && i+2 < len(words) {
+				return normalizeCharset(unquoteIdent(strings.Trim(words[i+2], "'\"")))
+			}
+		case "COLLATE":
+			cs, _, _ := strings.Cut(name, "_")
+			return normalizeCharset(cs)
+		}
+	}
+	return ""
+}
+
+// normalizeCharset returns the name of a character set as collationCharset
+// does: lower case, utf8 as utf8mb3.
+func normalizeCharset(name string) string {
+	name = strings.ToLower(strings.TrimSuffix(name, ","))
+	if name == "utf8" {
+		return "utf8mb3"
+	}
+	return name
+}
+
+// splitTopLevel splits the definitions of a CREATE TABLE, after its opening
+// parenthesis, at the commas outside parentheses and quotes, up to the
+// closing parenthesis.
+func splitTopLevel(s string) []string {
+	defs, _ := splitDefinitions(s)
+	return defs
+}
+
+// splitDefinitions is splitTopLevel, also returning the index of the
+// closing parenthesis, or len(s) without one.
+func splitDefinitions(s string) ([]string, int) {
+	var defs []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\'', '"', '`':
+			for i++; i < len(s) && s[i] != c; i++ {
+				if s[i] == '\\' && c != '`' {
+					i++
+				}
+			}
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return append(defs, s[start:i]), i
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				defs = append(defs, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(defs, s[start:]), len(s)
+}
+
+// unquoteIdent undoes quoteIdent.
+func unquoteIdent(s string) string {
+	if len(s) >= 2 && s[0] == '`' && s[len(s)-1] == '`' {
+		return strings.ReplaceAll(s[1:len(s)-1], "``", "`")
+	}
+	return s
+}
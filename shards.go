@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// shardNormalizer folds the names of sharded databases and tables into
+// their logical name, from -normalizeShards, so that orders_0 to
+// orders_255 count as one table orders. It renames the schema and table of
+// TableMapEvents, and the schema of QueryEvents, as they are decoded, so the
+// filters, the reports and the output all see the logical names.
+type shardNormalizer struct {
+	rules []shardRule
+	// names caches the result of each name seen; mu guards it for merge,
+	// which decodes several sources at once.
+	mu    sync.Mutex
+	names map[string][]byte
+}
+
+// shardRule renames the database or table names matching re as a whole to
+// repl, which may refer to the pattern's groups as $1.
+type shardRule struct {
+	re   *regexp.Regexp
+	repl string
+}
+
+// shardNames is the normalizer of the run, nil when -normalizeShards is
+// not set.
+var shardNames *shardNormalizer
+
+// newShardNormalizer parses rules of the form 'pattern -> name', separated
+// by semicolons. The first rule whose pattern matches a name wins.
+func newShardNormalizer(spec string) (*shardNormalizer, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	n := &shardNormalizer{names: make(map[string][]byte)}
+	for _, rule := range strings.Split(spec, ";") {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		pattern, repl, ok := strings.Cut(rule, "->")
+		pattern, repl = strings.TrimSpace(pattern), strings.TrimSpace(repl)
+		if !ok || pattern == "" || repl == "" {
+			return nil, fmt.Errorf("invalid -normalizeShards rule %q, want 'pattern -> name'", rule)
+		}
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid -normalizeShards pattern %q: %v", pattern, err)
+		}
+		n.rules = append(n.rules, shardRule{re: re, repl: repl})
+	}
+	if len(n.rules) == 0 {
+		return nil, fmt.Errorf("-normalizeShards has no rules")
+	}
+	return n, nil
+}
+
+// name returns the logical name of a database or table name.
+func (n *shardNormalizer) name(b []byte) []byte {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if out, ok := n.names[string(b)]; ok {
+		return out
+	}
+	out := b
+	for _, r := range n.rules {
+		if r.re.Match(b) {
+			out = r.re.ReplaceAll(b, []byte(r.repl))
+			break
+		}
+	}
+	n.names[string(b)] = out
+	return out
+}
+
+// normalize renames the objects e names.
+func (n *shardNormalizer) normalize(e *replication.BinlogEvent) {
+	switch ev := e.Event.(type) {
+	case *replication.TableMapEvent:
+		ev.Schema = n.name(ev.Schema)
+		ev.Table = n.name(ev.Table)
+	case *replication.QueryEvent:
+		if len(ev.Schema) > 0 {
+			ev.Schema = n.name(ev.Schema)
+		}
+	}
+}
+
+// String lists the rules as given, for -plan.
+func (n *shardNormalizer) String() string {
+	var rules []string
+	for _, r := range n.rules {
+		pattern := strings.TrimSuffix(strings.TrimPrefix(r.re.String(), "^(?:"), ")$")
+		rules = append(rules, pattern+" -> "+r.repl)
+	}
+	return strings.Join(rules, "; ")
+}
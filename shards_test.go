@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestShardNormalizer(t *testing.T) {
+	n, err := newShardNormalizer(`orders_\d+ -> orders; shop_(eu|us)_\d+ -> shop_$1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for in, want := range map[string]string{
+		"orders_0":    "orders",
+		"orders_255":  "orders",
+		"orders_x":    "orders_x",
+		"my_orders_1": "my_orders_1",
+		"shop_eu_3":   "shop_eu",
+		"shop_us_12":  "shop_us",
+	} {
+		if got := string(n.name([]byte(in))); got != want {
+			t.Errorf("name(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got, want := n.String(), `orders_\d+ -> orders; shop_(eu|us)_\d+ -> shop_$1`; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	for _, spec := range []string{"orders", "orders_( -> orders", " ; "} {
+		if _, err := newShardNormalizer(spec); err == nil {
+			t.Errorf("newShardNormalizer(%q) succeeded", spec)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// skewReport finds transactions whose event timestamps fall behind those of
+// transactions before them in the binlog by at least a threshold. Binlog
+// order is commit order, while an event's timestamp is when its statement
+// started: a long transaction is written at its commit with the timestamps
+// of its start, and a clock stepped back writes older times after newer
+// ones. Either way, filtering by time (-startDatetime, -stopDatetime,
+// -findTime) and any event-time processing downstream see them out of
+// place.
+type skewReport struct {
+	threshold time.Duration
+
+	tx   txTracker
+	file string
+	// high is the latest event timestamp of the transactions so far, at
+	// highAt; commitHigh the latest commit time.
+	high       uint32
+	highAt     string
+	commitHigh time.Time
+
+	// The open transaction: its earliest and latest event timestamps and
+	// its commit time from the GTID event (MySQL 8.0.1+), zero without.
+	first, last uint32
+	commit      time.Time
+
+	episodes []*skewEpisode
+	// clockRun is set while the transactions fall behind after the clock
+	// went back.
+	clockRun bool
+	total    int // transactions seen
+	skewed   int
+}
+
+// skewEpisode is a transaction out of order, or a run of consecutive ones
+// after the clock went back.
+type skewEpisode struct {
+	clock      bool
+	file       string
+	start, end uint32
+	endFile    string
+	gtid       string
+	timestamp  uint32
+	count      int
+	// behind is the largest skew, against the timestamp of ahead.
+	behind time.Duration
+	ahead  string
+	// open is how long before its commit a long transaction began.
+	open time.Duration
+}
+
+func newSkewReport(threshold time.Duration) *skewReport {
+	return &skewReport{threshold: threshold}
+}
+
+func (r *skewReport) nextFile(name string) {
+	r.file = binlogBase(name)
+}
+
+func (r *skewReport) observe(e *replication.BinlogEvent) {
+	if r.tx.cur == nil {
+		r.first, r.last, r.commit = 0, 0, time.Time{}
+	}
+	if ev, ok := e.Event.(*replication.GTIDEvent); ok {
+		r.commit = ev.ImmediateCommitTime()
+	}
+	// Artificial events carry no timestamp.
+	if ts := e.Header.Timestamp; ts != 0 {
+		if r.first == 0 || ts < r.first {
+			r.first = ts
+		}
+		r.last = max(r.last, ts)
+	}
+	done := r.tx.observe(e)
+	if done == nil || r.first == 0 {
+		return
+	}
+	r.total++
+	commit := r.commit
+	if commit.IsZero() {
+		// The COMMIT or XID was written as the transaction committed.
+		commit = time.Unix(int64(e.Header.Timestamp), 0)
+	}
+	at := fmt.Sprintf("%s:%d", r.file, done.Start)
+
+	if behind := time.Duration(int64(r.high)-int64(r.first)) * time.Second; r.high != 0 && behind >= r.threshold {
+		r.skewed++
+		clock := commit.Before(r.commitHigh.Add(-r.threshold))
+		var ep *skewEpisode
+		if clock && r.clockRun {
+			// The transactions after a clock step all fall behind the
+			// times before it until the clock catches up.
+			ep = r.episodes[len(r.episodes)-1]
+		} else {
+			ep = &skewEpisode{clock: clock, file: r.file, start: done.Start, gtid: done.GTID, timestamp: r.first, ahead: r.highAt}
+			r.episodes = append(r.episodes, ep)
+		}
+		r.clockRun = clock
+		ep.count++
+		ep.endFile, ep.end = r.file, done.End
+		ep.behind = max(ep.behind, behind)
+		if !clock {
+			ep.open = commit.Sub(time.Unix(int64(r.first), 0)).Truncate(time.Second)
+		}
+	} else {
+		r.clockRun = false
+	}
+	if r.last > r.high {
+		r.high, r.highAt = r.last, at
+	}
+	if commit.After(r.commitHigh) {
+		r.commitHigh = commit
+	}
+}
+
+func (r *skewReport) report(w io.Writer) {
+	fmt.Fprintf(w, "=== Timestamp skew (%s or more behind binlog order) ===\n", r.threshold)
+	if len(r.episodes) == 0 {
+		fmt.Fprintf(w, "None of %s\n\n", plural(r.total, "transaction"))
+		return
+	}
+	var largest *skewEpisode
+	for _, ep := range r.episodes {
+		gtid := ep.gtid
+		if gtid == "" {
+			gtid = "(no GTID)"
+		}
+		ts := time.Unix(int64(ep.timestamp), 0).Format(timeFormat)
+		if ep.clock {
+			fmt.Fprintf(w, "%s:%d  %s  %s  %s behind the transaction at %s: clock went back", ep.file, ep.start, gtid, ts, ep.behind, ep.ahead)
+			if ep.count > 1 {
+				fmt.Fprintf(w, ", %s until %s:%d", plural(ep.count, "transaction"), ep.endFile, ep.end)
+			}
+			fmt.Fprintln(w)
+		} else {
+			fmt.Fprintf(w, "%s:%d  %s  %s  %s behind the transaction at %s: long transaction, began %s before its commit\n",
+				ep.file, ep.start, gtid, ts, ep.behind, ep.ahead, ep.open)
+		}
+		if largest == nil || ep.behind > largest.behind {
+			largest = ep
+		}
+	}
+	fmt.Fprintf(w, "%d of %s out of order; largest skew %s at %s:%d\n\n", r.skewed, plural(r.total, "transaction"),
+		largest.behind, largest.file, largest.start)
+}
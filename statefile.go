@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// stopRequested is set by the first SIGINT or SIGTERM. parseBinlog checks
+// it between events, so outputs are flushed and the state file records a
+// transaction boundary before the process exits. A second signal exits
+// immediately.
+var stopRequested atomic.Bool
+
+func handleStopSignals() {
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-ch
+		fmt.Fprintf(os.Stderr, "Received %s, stopping after the current event (send again to exit now)\n", sig)
+		sdNotify("STOPPING=1")
+		stopRequested.Store(true)
+		<-ch
+		os.Exit(130)
+	}()
+}
+
+// stateFileInterval bounds how often the position store is written while
+// parsing.
+const stateFileInterval = time.Second
+
+// parseState is what a position store holds, and the content of
+// -stateFile: the end of the last transaction parsed completely, from
+// which a later run can resume with -offset.
+type parseState struct {
+	File     string    `json:"file"`
+	Position uint32    `json:"position"`
+	GTID     string    `json:"gtid,omitempty"`
+	Updated  time.Time `json:"updated"`
+}
+
+// resumeFrom returns the files to read and the position to start at, for a
+// run given neither -offset nor -logPosition: the end of the last
+// transaction store recorded, in the file of files it was in, dropping the
+// files before it. A -follow run that went on past files resumes in the
+// file it reached. With nothing to resume from it returns files and -1.
+func resumeFrom(store positionStore, files []string) ([]string, int64, error) {
+	st, err := store.load()
+	if err != nil || st == nil {
+		return files, -1, err
+	}
+	i := slices.IndexFunc(files, func(f string) bool { return filepath.Base(f) == filepath.Base(st.File) })
+	_, statErr := os.Stat(st.File)
+	switch {
+	case i >= 0:
+		files = files[i:]
+	case *follow && statErr == nil:
+		files = []string{st.File}
+	default:
+		fmt.Fprintf(os.Stderr, "Position store is at %s, not in -file\n", st.File)
+		return files, -1, nil
+	}
+	fmt.Fprintf(os.Stderr, "Resuming from the position store at %s:%d\n", files[0], st.Position)
+	return files, int64(st.Position), nil
+}
+
+// stateRecorder tracks transaction boundaries for the position store.
+type stateRecorder struct {
+	store   positionStore
+	tx      txTracker
+	state   parseState
+	dirty   bool
+	written time.Time
+}
+
+func newStateRecorder(store positionStore, file string) *stateRecorder {
+	if store == nil {
+		return nil
+	}
+	return &stateRecorder{store: store, state: parseState{File: file}}
+}
+
+func (s *stateRecorder) observe(e *replication.BinlogEvent) error {
+	done := s.tx.observe(e)
+	if done == nil {
+		return nil
+	}
+	s.state.Position, s.state.GTID = done.End, done.GTID
+	s.dirty = true
+	if time.Since(s.written) < stateFileInterval {
+		return nil
+	}
+	return s.flush()
+}
+
+// flush saves the state if it changed.
+func (s *stateRecorder) flush() error {
+	if !s.dirty {
+		return nil
+	}
+	s.state.Updated = time.Now().UTC()
+	if err := s.store.save(&s.state); err != nil {
+		return err
+	}
+	s.dirty = false
+	s.written = time.Now()
+	return nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// tableStats counts rows events and their volume for a single table.
+type tableStats struct {
+	inserts int
+	updates int
+	deletes int
+	rows    int
+	bytes   uint64
+}
+
+// sourceStats counts the write volume attributed to one originating server.
+type sourceStats struct {
+	transactions int
+	events       int
+	rows         int
+	bytes        uint64
+}
+
+// anonymousSource keys transactions without an assigned GTID.
+const anonymousSource = "anonymous"
+
+// statsReport summarizes event types, per-table write volume and, when the
+// binlog has GTIDs, write volume per originating server UUID. When
+// rowsDecoded is false row images were skipped by the parser, so only event
+// counts and sizes are reported.
+type statsReport struct {
+	rowsDecoded bool
+	events      map[replication.EventType]int
+	eventBytes  map[replication.EventType]uint64
+	tables      map[string]*tableStats
+	sources     map[string]*sourceStats
+	source      string // source of the transaction in progress
+	apps        map[string]*appStats
+	app         string // application tag of the statement in progress
+	appKeys     []string
+	appTagged   bool // whether any statement carried an application tag
+}
+
+func newStatsReport(rowsDecoded bool) *statsReport {
+	return &statsReport{
+		rowsDecoded: rowsDecoded,
+		events:      make(map[replication.EventType]int),
+		eventBytes:  make(map[replication.EventType]uint64),
+		tables:      make(map[string]*tableStats),
+		sources:     make(map[string]*sourceStats),
+		apps:        make(map[string]*appStats),
+		appKeys:     appTagKeys(),
+	}
+}
+
+func (r *statsReport) observe(e *replication.BinlogEvent) {
+	r.events[e.Header.EventType]++
+	r.eventBytes[e.Header.EventType] += uint64(e.Header.EventSize)
+	r.observeSource(e)
+	r.observeApplication(e)
+
+	re, ok := e.Event.(*replication.RowsEvent)
+	if !ok || re.Table == nil {
+		return
+	}
+	name := tableName(re.Table)
+	ts := r.tables[name]
+	if ts == nil {
+		ts = new(tableStats)
+		r.tables[name] = ts
+	}
+	switch rowsEventKind(e.Header.EventType) {
+	case "INSERT":
+		ts.inserts++
+	case "UPDATE":
+		ts.updates++
+	case "DELETE":
+		ts.deletes++
+	}
+	ts.rows += rowsAffected(e)
+	ts.bytes += uint64(e.Header.EventSize)
+}
+
+func (r *statsReport) report(w io.Writer) {
+	types := make([]replication.EventType, 0, len(r.events))
+	for t := range r.events {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+
+	fmt.Fprintln(w, "=== Event statistics ===")
+	for _, t := range types {
+		fmt.Fprintf(w, "%s: %d events, %d bytes\n", t, r.events[t], r.eventBytes[t])
+	}
+	fmt.Fprintln(w)
+
+	names := make([]string, 0, len(r.tables))
+	for name := range r.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "=== Table statistics ===")
+	for _, name := range names {
+		ts := r.tables[name]
+		fmt.Fprintf(w, "%s  inserts: %d  updates: %d  deletes: %d", name, ts.inserts, ts.updates, ts.deletes)
+		if r.rowsDecoded {
+			fmt.Fprintf(w, "  rows: %d", ts.rows)
+		}
+		fmt.Fprintf(w, "  bytes: %d", ts.bytes)
+		if op := maintenance.operation(name); op != "" {
+			fmt.Fprintf(w, "  maintenance: %s", op)
+		}
+		fmt.Fprintln(w)
+	}
+	if !r.rowsDecoded && len(names) > 0 {
+		fmt.Fprintln(w, "(row images not decoded; counts are rows events, use -statsRows for row counts)")
+	}
+	fmt.Fprintln(w)
+
+	r.reportApplications(w)
+
+	if len(r.sources) == 0 {
+		return
+	}
+	sources := make([]string, 0, len(r.sources))
+	for s := range r.sources {
+		sources = append(sources, s)
+	}
+	sort.Strings(sources)
+
+	fmt.Fprintln(w, "=== Source server statistics ===")
+	for _, s := range sources {
+		ss := r.sources[s]
+		fmt.Fprintf(w, "%s  transactions: %d  events: %d", s, ss.transactions, ss.events)
+		if r.rowsDecoded {
+			fmt.Fprintf(w, "  rows: %d", ss.rows)
+		}
+		fmt.Fprintf(w, "  bytes: %d\n", ss.bytes)
+	}
+	fmt.Fprintln(w)
+}
+
+// reportApplications prints the write volume per application tag and its
+// share of the tagged and untagged data changes. It prints nothing when no
+// statement carried a tag.
+func (r *statsReport) reportApplications(w io.Writer) {
+	if !r.appTagged {
+		return
+	}
+	var total uint64
+	apps := make([]string, 0, len(r.apps))
+	for app, as := range r.apps {
+		apps = append(apps, app)
+		total += as.bytes
+	}
+	sort.Slice(apps, func(i, j int) bool {
+		if r.apps[apps[i]].bytes != r.apps[apps[j]].bytes {
+			return r.apps[apps[i]].bytes > r.apps[apps[j]].bytes
+		}
+		return apps[i] < apps[j]
+	})
+
+	fmt.Fprintln(w, "=== Application statistics ===")
+	for _, app := range apps {
+		as := r.apps[app]
+		fmt.Fprintf(w, "%s  events: %d", app, as.events)
+		if r.rowsDecoded {
+			fmt.Fprintf(w, "  rows: %d", as.rows)
+		}
+		fmt.Fprintf(w, "  bytes: %d  share: %.1f%%\n", as.bytes, 100*float64(as.bytes)/float64(total))
+	}
+	fmt.Fprintln(w)
+}
+
+// observeSource attributes e to the server UUID of the GTID that opened its
+// transaction.
+func (r *statsReport) observeSource(e *replication.BinlogEvent) {
+	if ev, ok := e.Event.(*replication.GTIDEvent); ok {
+		r.source = anonymousSource
+		if gtid := gtidString(ev); gtid != "" {
+			r.source = gtid[:strings.IndexByte(gtid, ':')]
+		}
+		if r.sources[r.source] == nil {
+			r.sources[r.source] = new(sourceStats)
+		}
+		r.sources[r.source].transactions++
+	}
+	if r.source == "" {
+		return
+	}
+	ss := r.sources[r.source]
+	ss.events++
+	ss.rows += rowsAffected(e)
+	ss.bytes += uint64(e.Header.EventSize)
+}
+
+// tableName returns the schema-qualified name of a table map.
+func tableName(t *replication.TableMapEvent) string {
+	return string(t.Schema) + "." + string(t.Table)
+}
+
+// rowsEventKind maps a rows event type to the DML it represents.
+func rowsEventKind(t replication.EventType) string {
+	switch t {
+	case replication.WRITE_ROWS_EVENTv0, replication.WRITE_ROWS_EVENTv1, replication.WRITE_ROWS_EVENTv2,
+		replication.MARIADB_WRITE_ROWS_COMPRESSED_EVENT_V1:
+		return "INSERT"
+	case replication.UPDATE_ROWS_EVENTv0, replication.UPDATE_ROWS_EVENTv1, replication.UPDATE_ROWS_EVENTv2,
+		replication.MARIADB_UPDATE_ROWS_COMPRESSED_EVENT_V1, replication.PARTIAL_UPDATE_ROWS_EVENT:
+		return "UPDATE"
+	case replication.DELETE_ROWS_EVENTv0, replication.DELETE_ROWS_EVENTv1, replication.DELETE_ROWS_EVENTv2,
+		replication.MARIADB_DELETE_ROWS_COMPRESSED_EVENT_V1:
+		return "DELETE"
+	}
+	return ""
+}
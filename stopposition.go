@@ -0,0 +1,35 @@
+package main
+
+import "github.com/go-mysql-org/go-mysql/replication"
+
+// stopPosition ends a run at -stopPosition. The semantics are
+// mysqlbinlog's: reading stops at the first event of the last file that
+// starts at or after the position, so the position is exclusive and need
+// not be the start of an event. With -dsn the last file is the one
+// streaming starts from.
+type stopPosition struct {
+	pos  int64 // 0 when not set
+	last string
+	// inLast is set while the last file is read.
+	inLast bool
+}
+
+func newStopPosition(files []string) stopPosition {
+	return stopPosition{pos: *stopPos, last: binlogBase(files[len(files)-1])}
+}
+
+// next tells s the run has moved on to file.
+func (s *stopPosition) next(file string) {
+	s.inLast = binlogBase(file) == s.last
+}
+
+// past reports whether the event with header h is at or after the stop
+// position, where reading ends. Events expanded from a compressed payload
+// have no position of their own and are never past it, nor are artificial
+// events without one.
+func (s *stopPosition) past(h *replication.EventHeader) bool {
+	if s.pos == 0 || !s.inLast || h.LogPos == 0 || inPayload(h) {
+		return false
+	}
+	return int64(h.LogPos-h.EventSize) >= s.pos
+}
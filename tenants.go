@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// maxTenantFiles bounds the files tenant-split keeps open; past it, they are
+// all closed and reopened for appending as rows come.
+const maxTenantFiles = 256
+
+// tenantRowDocument is the ndjson form of one row change in tenant-split.
+type tenantRowDocument struct {
+	FormatVersion int                    `json:"format_version"`
+	Type          string                 `json:"type"`
+	Tenant        string                 `json:"tenant"`
+	Op            string                 `json:"op"`
+	Schema        string                 `json:"schema"`
+	Table         string                 `json:"table"`
+	Timestamp     uint32                 `json:"timestamp"`
+	Date          string                 `json:"date"`
+	File          string                 `json:"file"`
+	StartPos      uint32                 `json:"start_pos"`
+	GTID          string                 `json:"gtid,omitempty"`
+	Before        map[string]interface{} `json:"before,omitempty"`
+	After         map[string]interface{} `json:"after,omitempty"`
+}
+
+// tenantFile is an output file of tenant-split.
+type tenantFile struct {
+	path    string
+	f       *os.File
+	w       *bufio.Writer
+	csv     *csv.Writer
+	created bool
+	last    string // the description of the last event commented on
+}
+
+// tenantSplitter writes the row changes of the tables named by
+// -tenantColumn to one file per tenant in -outDir: as SQL statements that
+// replay them, as CSV with one file per tenant and table, or as ndjson.
+type tenantSplitter struct {
+	format  string
+	dir     string
+	columns map[string]string // the tenant column of each table, a name or @N
+	only    map[string]bool   // -tenants, nil for all
+	file    string
+
+	tx      txTracker
+	files   map[string]*tenantFile
+	open    int
+	tenants map[string]bool
+	rows    int
+}
+
+// newTenantSplitter parses -tenantColumn, db.table.column for each table
+// separated by commas, and -tenants.
+func newTenantSplitter(spec, only, format, dir, file string) (*tenantSplitter, error) {
+	switch format {
+	case "sql", "csv", "ndjson":
+	default:
+		return nil, fmt.Errorf("unknown -tenantFormat %q (sql, csv or ndjson)", format)
+	}
+	s := &tenantSplitter{
+		format:  format,
+		dir:     dir,
+		file:    filepath.Base(file),
+		files:   make(map[string]*tenantFile),
+		tenants: make(map[string]bool),
+	}
+	var err error
+	if s.columns, err = parseTableColumns(spec, "-tenantColumn"); err != nil {
+		return nil, err
+	}
+	if only != "" {
+		s.only = make(map[string]bool)
+		for _, t := range strings.Split(only, ",") {
+			s.only[strings.TrimSpace(t)] = true
+		}
+	}
+	return s, nil
+}
+
+// parseTableColumns parses a comma-separated list of db.table.column, given
+// by flag, into the column of each table.
+func parseTableColumns(spec, flag string) (map[string]string, error) {
+	columns := make(map[string]string)
+	for _, c := range strings.Split(spec, ",") {
+		c = strings.TrimSpace(c)
+		dot := strings.LastIndexByte(c, '.')
+		if dot < 0 || !strings.Contains(c[:dot], ".") || dot == len(c)-1 {
+			return nil, fmt.Errorf("invalid %s %q, want db.table.column", flag, c)
+		}
+		columns[c[:dot]] = c[dot+1:]
+	}
+	return columns, nil
+}
+
+// columnIndex returns the index of the column of t named by col, a name or
+// @N.
+func columnIndex(t *replication.TableMapEvent, col string) (int, error) {
+	if n, ok := strings.CutPrefix(col, "@"); ok {
+		i, err := strconv.Atoi(n)
+		if err != nil || i < 1 || i > int(t.ColumnCount) {
+			return 0, fmt.Errorf("%s has no column %s", tableName(t), col)
+		}
+		return i - 1, nil
+	}
+	names := columnNames(t)
+	if len(names) == 0 {
+		return 0, fmt.Errorf("%s: finding column %s needs column names (binlog_row_metadata=FULL or -schemaFile); give its position as @N", tableName(t), col)
+	}
+	for i, n := range names {
+		if strings.EqualFold(n, col) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%s has no column %s", tableName(t), col)
+}
+
+// tenantOf returns the tenant a row image belongs to, NULL for a NULL
+// tenant column.
+func tenantOf(t *replication.TableMapEvent, row []interface{}, i int) string {
+	if i >= len(row) || row[i] == nil {
+		return "NULL"
+	}
+	return fmt.Sprint(jsonValue(columnValue(row[i], t.UnsignedMap()[i])))
+}
+
+func (s *tenantSplitter) observe(e *replication.BinlogEvent) error {
+	re, ok := e.Event.(*replication.RowsEvent)
+	if !ok || re.Table == nil {
+		return nil
+	}
+	col, ok := s.columns[tableName(re.Table)]
+	if !ok {
+		return nil
+	}
+	i, err := columnIndex(re.Table, col)
+	if err != nil {
+		return err
+	}
+	op := rowsEventKind(e.Header.EventType)
+	if op == "UPDATE" {
+		for r := 0; r+1 < len(re.Rows); r += 2 {
+			before, after, err := rowImages.update(re, r)
+			if err != nil {
+				return err
+			}
+			from, to := tenantOf(re.Table, before, i), tenantOf(re.Table, after, i)
+			if from == to {
+				if err := s.write(e, re.Table, to, "UPDATE", before, after); err != nil {
+					return err
+				}
+				continue
+			}
+			// A row moved to another tenant leaves the first and arrives
+			// in the second, neither seeing the other's data.
+			if err := s.write(e, re.Table, from, "DELETE", before, nil); err != nil {
+				return err
+			}
+			if err := s.write(e, re.Table, to, "INSERT", nil, after); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for r := range re.Rows {
+		row, err := rowImages.row(re, r)
+		if err != nil {
+			return err
+		}
+		if op == "DELETE" {
+			err = s.write(e, re.Table, tenantOf(re.Table, row, i), op, row, nil)
+		} else {
+			err = s.write(e, re.Table, tenantOf(re.Table, row, i), op, nil, row)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write writes one row change to the file of tenant.
+func (s *tenantSplitter) write(e *replication.BinlogEvent, t *replication.TableMapEvent, tenant, op string, before, after []interface{}) error {
+	if s.only != nil && !s.only[tenant] {
+		return nil
+	}
+	f, err := s.tenantFile(tenant, t)
+	if err != nil {
+		return err
+	}
+	s.tenants[tenant] = true
+	s.rows++
+	start := e.Header.LogPos - e.Header.EventSize
+	switch s.format {
+	case "ndjson":
+		doc := &tenantRowDocument{
+			FormatVersion: jsonVersion,
+			Type:          "tenant_row",
+			Tenant:        tenant,
+			Op:            op,
+			Schema:        string(t.Schema),
+			Table:         string(t.Table),
+			Timestamp:     e.Header.Timestamp,
+			Date:          time.Unix(int64(e.Header.Timestamp), 0).Format(timeFormat),
+			File:          s.file,
+			StartPos:      start,
+			GTID:          s.tx.gtid(),
+			Before:        rowDocument(t, before),
+			After:         rowDocument(t, after),
+		}
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		_, err = f.w.Write(append(data, '\n'))
+		return err
+	case "csv":
+		row := after
+		if row == nil {
+			row = before
+		}
+		unsigned := t.UnsignedMap()
+		record := []string{op, time.Unix(int64(e.Header.Timestamp), 0).Format(timeFormat), s.tx.gtid()}
+		for i, v := range row {
+			record = append(record, csvValue(columnValue(v, unsigned[i])))
+		}
+		return f.csv.Write(record)
+	}
+
+	names := columnNames(t)
+	if op != "INSERT" && len(names) != int(t.ColumnCount) {
+		return fmt.Errorf("%s: %s statements need column names (binlog_row_metadata=FULL or -schemaFile); use -tenantFormat csv or ndjson", tableName(t), op)
+	}
+	desc := fmt.Sprintf("%s at %d, %s", rowsEventKind(e.Header.EventType), start, time.Unix(int64(e.Header.Timestamp), 0).Format(timeFormat))
+	if gtid := s.tx.gtid(); gtid != "" {
+		desc += ", GTID " + gtid
+	}
+	if desc != f.last {
+		f.last = desc
+		fmt.Fprintf(f.w, "-- %s\n", desc)
+	}
+	var b []byte
+	switch op {
+	case "INSERT":
+		b = appendInsert(b, t, after)
+	case "UPDATE":
+		b = appendUpdate(b, t, before, after)
+	case "DELETE":
+		b = append(b, "DELETE FROM "...)
+		b = append(b, quoteIdent(string(t.Schema))...)
+		b = append(b, '.')
+		b = append(b, quoteIdent(string(t.Table))...)
+		b = appendRowWhere(b, t, before)
+		b = append(b, ";\n"...)
+	}
+	_, err = f.w.Write(b)
+	return err
+}
+
+// rowDocument maps the columns of a row image to their values, nil for no
+// image. Columns the image does not carry are left out.
+func rowDocument(t *replication.TableMapEvent, row []interface{}) map[string]interface{} {
+	if row == nil {
+		return nil
+	}
+	names := columnNames(t)
+	unsigned := t.UnsignedMap()
+	doc := make(map[string]interface{}, len(row))
+	for i, v := range row {
+		if !isAbsent(v) {
+			doc[columnLabel(names, i)] = jsonValue(columnValue(v, unsigned[i]))
+		}
+	}
+	return doc
+}
+
+// tenantFile returns the open file of tenant, or for CSV of tenant and t.
+// A file is truncated when first opened in a run and appended to when
+// reopened.
+func (s *tenantSplitter) tenantFile(tenant string, t *replication.TableMapEvent) (*tenantFile, error) {
+	// Escaping keeps tenant ids such as ../x or a/b inside -outDir.
+	name := url.PathEscape(tenant)
+	if strings.HasPrefix(name, ".") {
+		name = "%2E" + name[1:]
+	}
+	switch s.format {
+	case "csv":
+		name += "." + url.PathEscape(string(t.Schema)) + "." + url.PathEscape(string(t.Table)) + ".csv"
+	default:
+		name += "." + s.format
+	}
+	f := s.files[name]
+	if f == nil {
+		f = &tenantFile{path: filepath.Join(s.dir, name)}
+		s.files[name] = f
+	}
+	if f.f != nil {
+		return f, nil
+	}
+	if s.open >= maxTenantFiles {
+		if err := s.closeAll(); err != nil {
+			return nil, err
+		}
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if !f.created {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(f.path, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	f.f, f.w = file, bufio.NewWriter(file)
+	s.open++
+	if s.format == "csv" {
+		f.csv = csv.NewWriter(f.w)
+		if !f.created {
+			names := columnNames(t)
+			header := []string{"op", "timestamp", "gtid"}
+			for i := 0; i < int(t.ColumnCount); i++ {
+				header = append(header, columnLabel(names, i))
+			}
+			if err := f.csv.Write(header); err != nil {
+				return nil, err
+			}
+		}
+	}
+	f.created = true
+	return f, nil
+}
+
+// closeAll flushes and closes the open files.
+func (s *tenantSplitter) closeAll() error {
+	var first error
+	for _, f := range s.files {
+		if f.f == nil {
+			continue
+		}
+		if f.csv != nil {
+			f.csv.Flush()
+			if err := f.csv.Error(); err != nil && first == nil {
+				first = err
+			}
+		}
+		if err := f.w.Flush(); err != nil && first == nil {
+			first = err
+		}
+		if err := f.f.Close(); err != nil && first == nil {
+			first = err
+		}
+		f.f, f.w, f.csv = nil, nil, nil
+	}
+	s.open = 0
+	return first
+}
+
+func tenantSplitCommand(startPosition int64) {
+	if *tenantColumn == "" || *outDir == "" {
+		fmt.Fprintf(os.Stderr, "Error: tenant-split requires -tenantColumn and -outDir\n")
+		os.Exit(1)
+	}
+	s, err := newTenantSplitter(*tenantColumn, *tenantIDs, *tenantFormat, *outDir, *binlogFile)
+	if err == nil {
+		err = os.MkdirAll(*outDir, 0755)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	err = parseBinlog(newParser(true), *binlogFile, startPosition, func(e *replication.BinlogEvent) error {
+		if eventTimes.past(e.Header) {
+			return errStopParsing
+		}
+		// The tracker sees every event to know each row's GTID.
+		s.tx.observe(e)
+		if transactionFilter != nil && !transactionFilter.keep(e) {
+			return nil
+		}
+		if beforeStart(e, startPosition) || eventFilter != nil && !eventFilter.keep(e) ||
+			eventTimes.bounded() && !eventTimes.contains(e.Header) {
+			return nil
+		}
+		return s.observe(e)
+	})
+	if cerr := s.closeAll(); cerr != nil && err == nil {
+		err = cerr
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s for %s to %s\n", plural(s.rows, "row change"), plural(len(s.tenants), "tenant"), *outDir)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+const timelineWidth = 60
+
+// dumpTimeline draws one bar per bucket between the first and last bucket
+// seen, so quiet periods show up as empty rows rather than disappearing.
+// The part of a bar written by maintenance copies, m, is drawn with +.
+func (c *intervalCounter) dumpTimeline(w io.Writer, counts, m map[int64]int, label string) {
+	if len(counts) == 0 {
+		return
+	}
+
+	first, last, max := int64(-1), int64(-1), 0
+	for b, v := range counts {
+		if first == -1 || b < first {
+			first = b
+		}
+		if b > last {
+			last = b
+		}
+		if v > max {
+			max = v
+		}
+	}
+
+	fmt.Fprintf(w, "=== Timeline: %s per %s ===\n", label, time.Duration(c.width)*time.Second)
+	if m != nil {
+		fmt.Fprintln(w, "(# organic, + maintenance)")
+	}
+	for b := first; b <= last; b += c.width {
+		v := counts[b]
+		n := 0
+		if max > 0 {
+			n = v * timelineWidth / max
+		}
+		if n == 0 && v > 0 {
+			n = 1
+		}
+		bar := strings.Repeat("#", n)
+		if m != nil {
+			mn := 0
+			if max > 0 {
+				mn = m[b] * timelineWidth / max
+			}
+			if mn == 0 && m[b] > 0 {
+				mn = 1
+			}
+			mn = min(mn, n)
+			bar = strings.Repeat("#", n-mn) + strings.Repeat("+", mn)
+		}
+		fmt.Fprintf(w, "%s | %-*s %d", time.Unix(b, 0).Format(timeFormat), timelineWidth, bar, v)
+		if m != nil {
+			fmt.Fprintf(w, " (maintenance %d)", m[b])
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// timelineReport charts events, or rows affected, per time bucket.
+type timelineReport struct {
+	c    *intervalCounter
+	rows bool
+}
+
+func newTimelineReport(bucket time.Duration, rows bool) *timelineReport {
+	if bucket < time.Second {
+		bucket = time.Second
+	}
+	return &timelineReport{c: newIntervalCounter(bucket), rows: rows}
+}
+
+func (r *timelineReport) observe(e *replication.BinlogEvent) {
+	if e.Header.Timestamp == 0 {
+		return
+	}
+	r.c.add(e)
+}
+
+func (r *timelineReport) report(w io.Writer) {
+	var mEvents, mRows map[int64]int
+	if maintenance != nil {
+		mEvents, mRows = r.c.maintenanceCounts()
+	}
+	if r.rows {
+		r.c.dumpTimeline(w, r.c.rows, mRows, "rows affected")
+	} else {
+		r.c.dumpTimeline(w, r.c.events, mEvents, "events")
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// timeRange bounds events by header timestamp, from -startDatetime and
+// -stopDatetime. The semantics are mysqlbinlog's: events before the start
+// time are skipped, and reading stops at the first event at or after the
+// stop time, so the stop time is exclusive.
+type timeRange struct {
+	start, stop time.Time
+}
+
+// eventTimes is the time range of the run, zero when neither flag is set.
+var eventTimes timeRange
+
+// newTimeRange returns the time range set by the command line.
+func newTimeRange() (timeRange, error) {
+	var r timeRange
+	var err error
+	if *startDatetime != "" {
+		if r.start, err = parseDatetime(*startDatetime); err != nil {
+			return r, err
+		}
+	}
+	if *stopDatetime != "" {
+		if r.stop, err = parseDatetime(*stopDatetime); err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+// bounded reports whether either bound is set.
+func (r timeRange) bounded() bool {
+	return !r.start.IsZero() || !r.stop.IsZero()
+}
+
+// contains reports whether the event with header h is inside the range.
+func (r timeRange) contains(h *replication.EventHeader) bool {
+	ts := time.Unix(int64(h.Timestamp), 0)
+	return (r.start.IsZero() || !ts.Before(r.start)) && (r.stop.IsZero() || ts.Before(r.stop))
+}
+
+// past reports whether the event with header h is at or after the stop
+// time, where reading ends. Events without a timestamp, such as the
+// artificial RotateEvent a server sends first, are never past it.
+func (r timeRange) past(h *replication.EventHeader) bool {
+	return !r.stop.IsZero() && h.Timestamp != 0 && !time.Unix(int64(h.Timestamp), 0).Before(r.stop)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/google/uuid"
+)
+
+// transaction is one transaction located in a binlog.
+type transaction struct {
+	GTID      string `json:"gtid,omitempty"`
+	Start     uint32 `json:"start"`
+	End       uint32 `json:"end"`
+	Timestamp uint32 `json:"timestamp"`
+
+	// LastCommitted and SequenceNumber are the logical clock the source
+	// wrote into the GTID event (MySQL 5.7+); zero otherwise.
+	LastCommitted  int64 `json:"last_committed,omitempty"`
+	SequenceNumber int64 `json:"sequence_number,omitempty"`
+
+	// Anonymous is set for a transaction an ANONYMOUS_GTID event opens, as
+	// MySQL 5.7+ writes while gtid_mode is not ON, and Tagged for one with
+	// a tagged GTID. A transaction with neither and no GTID has no GTID
+	// event, as before MySQL 5.7.
+	Anonymous bool `json:"anonymous,omitempty"`
+	Tagged    bool `json:"tagged,omitempty"`
+}
+
+// txTracker follows transaction boundaries through the event stream. A
+// transaction opens at a GTID event or a BEGIN query and closes at an XID
+// event, a COMMIT/ROLLBACK query, or a DDL statement that follows a GTID
+// without a BEGIN.
+type txTracker struct {
+	cur   *transaction
+	begun bool
+}
+
+// observe advances the tracker by one event and returns the transaction
+// that e completed, if any.
+func (t *txTracker) observe(e *replication.BinlogEvent) *transaction {
+	start := e.Header.LogPos - e.Header.EventSize
+
+	switch ev := e.Event.(type) {
+	case *replication.GTIDEvent:
+		t.cur = &transaction{
+			GTID:           gtidString(ev),
+			Start:          start,
+			Timestamp:      e.Header.Timestamp,
+			LastCommitted:  ev.LastCommitted,
+			SequenceNumber: ev.SequenceNumber,
+			Anonymous:      e.Header.EventType == replication.ANONYMOUS_GTID_EVENT,
+		}
+		t.begun = false
+	case *replication.QueryEvent:
+		q := strings.ToUpper(strings.TrimSpace(string(ev.Query)))
+		switch {
+		case q == "BEGIN" || strings.HasPrefix(q, "XA START"):
+			if t.cur == nil {
+				t.cur = &transaction{Start: start, Timestamp: e.Header.Timestamp}
+			}
+			t.begun = true
+		case q == "COMMIT" || q == "ROLLBACK" || strings.HasPrefix(q, "XA COMMIT") || strings.HasPrefix(q, "XA ROLLBACK"):
+			return t.finish(e)
+		case t.cur != nil && !t.begun:
+			// A DDL statement carries its own implicit commit.
+			return t.finish(e)
+		}
+	case *replication.XIDEvent:
+		return t.finish(e)
+	case *replication.GenericEvent:
+		if e.Header.EventType == gtidTaggedLogEvent {
+			// The tagged GTID itself is not decoded.
+			t.cur = &transaction{Start: start, Timestamp: e.Header.Timestamp, Tagged: true}
+			t.begun = false
+		}
+	}
+	return nil
+}
+
+func (t *txTracker) finish(e *replication.BinlogEvent) *transaction {
+	tx := t.cur
+	t.cur, t.begun = nil, false
+	if tx != nil {
+		tx.End = e.Header.LogPos
+	}
+	return tx
+}
+
+// gtid returns the GTID of the open transaction, if any.
+func (t *txTracker) gtid() string {
+	if t.cur == nil {
+		return ""
+	}
+	return t.cur.GTID
+}
+
+// gtidString renders a GTID event's transaction id as uuid:gno. Anonymous
+// GTID events have an all-zero SID and render as the empty string.
+func gtidString(ev *replication.GTIDEvent) string {
+	u, err := uuid.FromBytes(ev.SID)
+	if err != nil || u == uuid.Nil {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", u, ev.GNO)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/ChaosHour/go-parse/pkg/transform"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+var warnTransform = &warningCategory{
+	name: "values transformers could not convert",
+	hint: "they are output as decoded; check the -transforms rules matching their columns.",
+}
+
+// columnTransformers are the transformers of a table's columns, by column
+// index; a nil one leaves the column alone.
+type columnTransformers []transform.Transformer
+
+// valueTransformers caches the transformers of each table map, as a table
+// map is shared by the rows events that follow it.
+var valueTransformers = struct {
+	sync.Mutex
+	m map[*replication.TableMapEvent]columnTransformers
+}{m: make(map[*replication.TableMapEvent]columnTransformers)}
+
+func transformersFor(t *replication.TableMapEvent) columnTransformers {
+	valueTransformers.Lock()
+	defer valueTransformers.Unlock()
+	if ts, ok := valueTransformers.m[t]; ok {
+		return ts
+	}
+	var ts columnTransformers
+	names := columnNames(t)
+	for i := range t.ColumnType {
+		tr := transform.Default.Lookup(string(t.Schema), string(t.Table), columnLabel(names, i), "@"+strconv.Itoa(i+1))
+		if tr == nil {
+			continue
+		}
+		if ts == nil {
+			ts = make(columnTransformers, len(t.ColumnType))
+		}
+		ts[i] = tr
+	}
+	if len(valueTransformers.m) >= 4096 {
+		clear(valueTransformers.m)
+	}
+	valueTransformers.m[t] = ts
+	return ts
+}
+
+// reloadTransforms returns the reloader of -transforms, which replaces the
+// rules of transform.Default with those of the file, beside the
+// transformers builtin registered in Go.
+func reloadTransforms(builtin *transform.Registry) func() error {
+	return func() error {
+		r := builtin.Clone()
+		if err := transform.LoadRules(r, *transformRules); err != nil {
+			return err
+		}
+		transform.Default.Replace(r)
+		valueTransformers.Lock()
+		clear(valueTransformers.m)
+		valueTransformers.Unlock()
+		return nil
+	}
+}
+
+// transformValues applies the transformers registered in transform.Default
+// to the values of a rows event, after decodeCharsets and
+// expandPartialJSON, so that everything that outputs the event sees the
+// transformed values.
+func transformValues(e *replication.BinlogEvent) {
+	if transform.Default.Empty() {
+		return
+	}
+	re, ok := e.Event.(*replication.RowsEvent)
+	if !ok || re.Table == nil || len(re.Rows) == 0 {
+		return
+	}
+	ts := transformersFor(re.Table)
+	if ts == nil {
+		return
+	}
+	unsigned := re.Table.UnsignedMap()
+	names := columnNames(re.Table)
+	for _, row := range re.Rows {
+		for i, tr := range ts {
+			if tr == nil || i >= len(row) {
+				continue
+			}
+			v, err := tr.Transform(columnValue(row[i], unsigned[i]))
+			if err != nil {
+				pos := e.Header.LogPos
+				if pos >= e.Header.EventSize {
+					pos -= e.Header.EventSize
+				}
+				runWarnings.note(warnTransform, pos, fmt.Sprintf("%s.%s: %v", tableName(re.Table), columnLabel(names, i), err))
+				continue
+			}
+			row[i] = v
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestTransformsRefused checks that -transforms changes the values of the
+// dump, and is refused by the commands that need the values as decoded.
+func TestTransformsRefused(t *testing.T) {
+	file := writeTestdataBinlog(t, "charsets")
+	rules := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(rules, []byte(`[{"column": "testdata.texts.latin", "transform": "upper"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out := runGoParse(t, "-file", file, "-offset", "4", "-transforms", rules); !strings.Contains(string(out), "CAFÉ €") {
+		t.Errorf("dump not transformed:\n%s", out)
+	}
+
+	for _, name := range commandNames() {
+		if !commands[name].decodedValues {
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], name, "-file", file, "-transforms", rules)
+			cmd.Env = append(os.Environ(), "GO_PARSE_MAIN=1")
+			out, err := cmd.CombinedOutput()
+			var exit *exec.ExitError
+			if !errors.As(err, &exit) || exit.ExitCode() != 1 {
+				t.Fatalf("exit status %v, want 1\n%s", err, out)
+			}
+			if want := name + " works on the values as decoded; drop -transforms"; !strings.Contains(string(out), want) {
+				t.Errorf("no %q in:\n%s", want, out)
+			}
+		})
+	}
+}
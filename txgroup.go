@@ -0,0 +1,172 @@
+package main
+
+import (
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// maxGroupBuffer bounds the output held back for one transaction. A larger
+// transaction gets its header when the limit is reached, marked as in
+// progress, and a closing line with the totals at its commit.
+const maxGroupBuffer = 64 << 20
+
+// txGrouper groups the dump's output by transaction in text output version
+// 7 and later. The output of a transaction's events is held back until its
+// commit, then written after a header with its GTID, positions, row counts
+// and duration. Events outside transactions pass straight through.
+type txGrouper struct {
+	tx txTracker
+	// open is set while the events of a transaction are being grouped.
+	open      bool
+	streaming bool // the header was written before the commit
+	buf       []byte
+	gtid      string
+	start     uint32
+	first     uint32 // timestamp of the first event
+	last      uint32
+	events    int
+	inserted  int
+	updated   int
+	deleted   int
+}
+
+// event advances the grouper by e, whose output is text, or nil when e is
+// not shown, writing to w what is to be written now.
+func (g *txGrouper) event(w io.Writer, e *replication.BinlogEvent, text []byte) error {
+	prev := g.tx.cur
+	done := g.tx.observe(e)
+	if g.open && g.tx.cur != nil && g.tx.cur != prev {
+		// A transaction began before the last one committed.
+		if err := g.flush(w, 0); err != nil {
+			return err
+		}
+	}
+	if !g.open && g.tx.cur != nil && g.tx.cur != prev {
+		g.begin(e)
+	}
+	if !g.open {
+		_, err := w.Write(text)
+		return err
+	}
+	if text != nil {
+		g.events++
+		g.last = e.Header.Timestamp
+		switch rowsEventKind(e.Header.EventType) {
+		case "INSERT":
+			g.inserted += rowsAffected(e)
+		case "UPDATE":
+			g.updated += rowsAffected(e)
+		case "DELETE":
+			g.deleted += rowsAffected(e)
+		}
+		if g.streaming {
+			if _, err := w.Write(text); err != nil {
+				return err
+			}
+		} else if g.buf = append(g.buf, text...); len(g.buf) > maxGroupBuffer {
+			if _, err := w.Write(g.appendHeader(nil, 0, true)); err != nil {
+				return err
+			}
+			if _, err := w.Write(g.buf); err != nil {
+				return err
+			}
+			g.buf = g.buf[:0]
+			g.streaming = true
+		}
+	}
+	if done != nil {
+		return g.flush(w, done.End)
+	}
+	return nil
+}
+
+func (g *txGrouper) begin(e *replication.BinlogEvent) {
+	g.open, g.streaming = true, false
+	g.buf = g.buf[:0]
+	g.gtid = g.tx.gtid()
+	g.start = e.Header.LogPos - e.Header.EventSize
+	g.first, g.last = e.Header.Timestamp, e.Header.Timestamp
+	g.events, g.inserted, g.updated, g.deleted = 0, 0, 0, 0
+}
+
+// flush writes the grouped transaction, which ended at end, or did not
+// commit in the parsed range when end is 0.
+func (g *txGrouper) flush(w io.Writer, end uint32) error {
+	if !g.open {
+		return nil
+	}
+	g.open = false
+	if g.events == 0 {
+		// None of its events were shown.
+		return nil
+	}
+	if g.streaming {
+		b := append([]byte(nil), "### End of transaction"...)
+		if g.gtid != "" {
+			b = append(b, ' ')
+			b = append(b, g.gtid...)
+		}
+		b = append(b, " ###\n"...)
+		_, err := w.Write(g.appendSummary(b, end))
+		return err
+	}
+	if _, err := w.Write(g.appendHeader(nil, end, false)); err != nil {
+		return err
+	}
+	_, err := w.Write(g.buf)
+	return err
+}
+
+// finish writes a transaction still grouped at the end of the parse.
+func (g *txGrouper) finish(w io.Writer) error {
+	return g.flush(w, 0)
+}
+
+// appendHeader appends the header of the grouped transaction. A header
+// written before the commit has only the start position.
+func (g *txGrouper) appendHeader(b []byte, end uint32, inProgress bool) []byte {
+	b = append(b, "### Transaction"...)
+	if g.gtid != "" {
+		b = append(b, ' ')
+		b = append(b, g.gtid...)
+	}
+	b = append(b, " ###\n"...)
+	if inProgress {
+		b = append(b, "In progress: too large to hold back, totals follow its events\n"...)
+		b = append(b, "Start position: "...)
+		b = strconv.AppendUint(b, uint64(g.start), 10)
+		return append(b, "\n\n"...)
+	}
+	return g.appendSummary(b, end)
+}
+
+func (g *txGrouper) appendSummary(b []byte, end uint32) []byte {
+	b = append(b, "Start position: "...)
+	b = strconv.AppendUint(b, uint64(g.start), 10)
+	b = append(b, "\nEnd position: "...)
+	if end == 0 {
+		b = append(b, "no commit in the parsed range"...)
+	} else {
+		b = strconv.AppendUint(b, uint64(end), 10)
+	}
+	b = append(b, "\nEvents: "...)
+	b = strconv.AppendInt(b, int64(g.events), 10)
+	b = append(b, "\nRows: "...)
+	b = strconv.AppendInt(b, int64(g.inserted+g.updated+g.deleted), 10)
+	b = append(b, " ("...)
+	b = strconv.AppendInt(b, int64(g.inserted), 10)
+	b = append(b, " inserted, "...)
+	b = strconv.AppendInt(b, int64(g.updated), 10)
+	b = append(b, " updated, "...)
+	b = strconv.AppendInt(b, int64(g.deleted), 10)
+	b = append(b, " deleted)\nDuration: "...)
+	b = append(b, (time.Duration(max(g.last, g.first)-g.first) * time.Second).String()...)
+	b = append(b, " ("...)
+	b = time.Unix(int64(g.first), 0).AppendFormat(b, timeFormat)
+	b = append(b, " to "...)
+	b = time.Unix(int64(g.last), 0).AppendFormat(b, timeFormat)
+	return append(b, ")\n\n"...)
+}
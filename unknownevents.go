@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// unknownEventPolicies are the values of -unknownEvents: what to do with an
+// event of a type missing from eventTypeSupport.
+//
+//   - dump-hex passes it on, so the dump shows its body as raw bytes, and
+//     lists it among the warnings.
+//   - warn leaves it out and lists it among the warnings.
+//   - skip leaves it out silently.
+//   - fail ends the parse with an error naming its type and position.
+var unknownEventPolicies = []string{"dump-hex", "warn", "skip", "fail"}
+
+// errUnknownEventType ends a parse with -unknownEvents fail. The dump and
+// the reports exit with status 1 after it, once their output is written.
+var errUnknownEventType = errors.New("unknown event type")
+
+var warnSkippedUnknownEvent = &warningCategory{
+	name: "unknown event types left out",
+	hint: "-unknownEvents warn left them out of the output; -unknownEvents dump-hex shows their bodies as raw bytes.",
+}
+
+// admitEvent applies -unknownEvents to event e of binlog file. It reports
+// whether e is to be passed on, or returns the error ending the parse.
+func admitEvent(file string, e *replication.BinlogEvent) (bool, error) {
+	if _, ok := e.Event.(*replication.GenericEvent); !ok {
+		return true, nil
+	}
+	return admitEventType(file, e.Header)
+}
+
+// admitEventType is admitEvent for the header scan, which has the event
+// header alone.
+func admitEventType(file string, h *replication.EventHeader) (bool, error) {
+	t := h.EventType
+	if _, known := eventTypeSupport[t]; known {
+		return true, nil
+	}
+	pos := h.LogPos
+	if pos >= h.EventSize {
+		pos -= h.EventSize
+	}
+	switch *unknownEvents {
+	case "warn":
+		runWarnings.note(warnSkippedUnknownEvent, pos, "type "+strconv.Itoa(int(t)))
+		return false, nil
+	case "skip":
+		return false, nil
+	case "fail":
+		return false, fmt.Errorf("%s:%d: %w %d (-unknownEvents fail)", binlogBase(file), pos, errUnknownEventType, t)
+	}
+	return true, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// unknownEventType is an event type no server writes.
+const unknownEventType = 200
+
+// writeUnknownEventBinlog writes the binlog of the gen-testdata case named
+// name with an event of unknownEventType appended, and returns its path.
+func writeUnknownEventBinlog(t *testing.T, name string) string {
+	t.Helper()
+	file := writeTestdataBinlog(t, name)
+	binlog, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte("unknown")
+	size := replication.EventHeaderSize + len(body) + replication.BinlogChecksumLength
+	e := binary.LittleEndian.AppendUint32(nil, 0)
+	e = append(e, unknownEventType)
+	e = binary.LittleEndian.AppendUint32(e, 1)
+	e = binary.LittleEndian.AppendUint32(e, uint32(size))
+	e = binary.LittleEndian.AppendUint32(e, uint32(len(binlog)+size))
+	e = binary.LittleEndian.AppendUint16(e, 0)
+	e = append(e, body...)
+	e = binary.LittleEndian.AppendUint32(e, crc32.ChecksumIEEE(e))
+	if err := os.WriteFile(file, append(binlog, e...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestCountEventsUnknownEvents(t *testing.T) {
+	file := writeUnknownEventBinlog(t, "charsets")
+	unknown := replication.EventType(unknownEventType).String() + ": 1\n"
+	for _, tc := range []struct {
+		policy  string
+		counted bool
+		warned  bool
+		failed  bool
+	}{
+		{"dump-hex", true, false, false},
+		{"warn", false, true, false},
+		{"skip", false, false, false},
+		{"fail", false, false, true},
+	} {
+		t.Run(tc.policy, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-file", file, "-countEvents", "-unknownEvents", tc.policy)
+			cmd.Env = append(os.Environ(), "GO_PARSE_MAIN=1")
+			var stdout, stderr strings.Builder
+			cmd.Stdout, cmd.Stderr = &stdout, &stderr
+			err := cmd.Run()
+			var exit *exec.ExitError
+			if failed := errors.As(err, &exit) && exit.ExitCode() == 1; failed != tc.failed {
+				t.Errorf("exit status %v, want failure %v\n%s%s", err, tc.failed, stdout.String(), stderr.String())
+			}
+			if counted := strings.Contains(stdout.String(), unknown); counted != tc.counted {
+				t.Errorf("unknown event counted %v, want %v:\n%s", counted, tc.counted, stdout.String())
+			}
+			if warned := strings.Contains(stderr.String(), warnSkippedUnknownEvent.name); warned != tc.warned {
+				t.Errorf("warned %v, want %v:\n%s", warned, tc.warned, stderr.String())
+			}
+			if tc.failed && !strings.Contains(stdout.String(), "unknown event type 200 (-unknownEvents fail)") {
+				t.Errorf("no error naming the unknown event:\n%s", stdout.String())
+			}
+			total := "Total events: 13\n"
+			if tc.counted {
+				total = "Total events: 14\n"
+			}
+			if !strings.Contains(stdout.String(), total) {
+				t.Errorf("want %s\n%s", total, stdout.String())
+			}
+		})
+	}
+}
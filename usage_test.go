@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// TestUsageREADME checks that the usage the README shows is what -h prints.
+func TestUsageREADME(t *testing.T) {
+	readme, err := os.ReadFile("README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const start = "./go-parse  -h\n"
+	_, block, ok := strings.Cut(string(readme), start)
+	if !ok {
+		t.Fatalf("README.md has no %q block", strings.TrimSpace(start))
+	}
+	// The examples that follow in the block are set apart by blank lines.
+	block, _, _ = strings.Cut(block, "\n\n")
+	block = strings.ReplaceAll(block, "./go-parse", "go-parse")
+
+	cmd := exec.Command(os.Args[0], "-h")
+	cmd.Env = append(os.Environ(), "GO_PARSE_MAIN=1")
+	out, _ := cmd.CombinedOutput()
+	// Leave out the flags of the test binary.
+	var lines []string
+	testFlag := false
+	for _, line := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
+		if strings.HasPrefix(line, "  -") {
+			name := strings.Fields(line)[0]
+			testFlag = strings.HasPrefix(name, "-test.") || name == "-update"
+		}
+		if !testFlag {
+			lines = append(lines, line)
+		}
+	}
+	if got := strings.Join(lines, "\n"); got != block {
+		t.Errorf("-h prints:\n%s\n\nREADME.md shows:\n%s", got, block)
+	}
+}
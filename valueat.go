@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// rowWrite is one change to the looked-up row.
+type rowWrite struct {
+	op        string
+	file      string
+	pos       uint32
+	gtid      string
+	timestamp uint32
+	row       []interface{} // nil once the row is gone
+	before    []interface{} // the last image before a delete or key change
+	note      string
+	columns   []string
+	table     *replication.TableMapEvent
+}
+
+// rowHistory replays the writes to a single row, identified by its key
+// values, committing them transaction by transaction. It stops after the
+// first transaction committed after at, unless at is zero.
+type rowHistory struct {
+	table   string
+	key     []string
+	at      time.Time
+	file    string
+	tx      txTracker
+	pending []*rowWrite
+	last    *rowWrite
+	keyCols []int
+	// writes are all the committed writes, in order, when all is set.
+	all    bool
+	writes []*rowWrite
+}
+
+// keyColumns returns the key column indexes of t: its key (see uniqueKey),
+// else the first column.
+func keyColumns(t *replication.TableMapEvent) []int {
+	if key := uniqueKey(t); key != nil {
+		return key
+	}
+	return []int{0}
+}
+
+func (h *rowHistory) matches(row []interface{}) bool {
+	for i, c := range h.keyCols {
+		if c >= len(row) || fmt.Sprint(jsonValue(row[c])) != h.key[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *rowHistory) observe(e *replication.BinlogEvent) error {
+	if re, ok := e.Event.(*replication.RowsEvent); ok && re.Table != nil && tableName(re.Table) == h.table {
+		if err := h.observeRows(e, re); err != nil {
+			return err
+		}
+	}
+	if done := h.tx.observe(e); done != nil {
+		if !h.at.IsZero() && time.Unix(int64(e.Header.Timestamp), 0).After(h.at) {
+			return errStopParsing
+		}
+		if n := len(h.pending); n > 0 {
+			h.last = h.pending[n-1]
+		}
+		if h.all {
+			h.writes = append(h.writes, h.pending...)
+		}
+		h.pending = h.pending[:0]
+	}
+	return nil
+}
+
+func (h *rowHistory) observeRows(e *replication.BinlogEvent, re *replication.RowsEvent) error {
+	h.keyCols = keyColumns(re.Table)
+	if len(h.keyCols) != len(h.key) {
+		return fmt.Errorf("%s has a %d-column key, -pk gives %d values", h.table, len(h.keyCols), len(h.key))
+	}
+	w := func(op string, row, before []interface{}, note string) {
+		h.pending = append(h.pending, &rowWrite{
+			op:        op,
+			file:      h.file,
+			pos:       e.Header.LogPos - e.Header.EventSize,
+			gtid:      h.tx.gtid(),
+			timestamp: e.Header.Timestamp,
+			row:       row,
+			before:    before,
+			note:      note,
+			columns:   columnNames(re.Table),
+			table:     re.Table,
+		})
+	}
+	switch rowsEventKind(e.Header.EventType) {
+	case "INSERT":
+		for r := range re.Rows {
+			if row := markAbsent(re, r); h.matches(row) {
+				row, err := rowImages.complete(re.Table, row)
+				if err != nil {
+					return err
+				}
+				w("INSERT", row, nil, "")
+			}
+		}
+	case "DELETE":
+		for r := range re.Rows {
+			if row := markAbsent(re, r); h.matches(row) {
+				h.carryForward(row)
+				row, err := rowImages.complete(re.Table, row)
+				if err != nil {
+					return err
+				}
+				w("DELETE", nil, row, "")
+			}
+		}
+	case "UPDATE":
+		for i := 0; i+1 < len(re.Rows); i += 2 {
+			before := markAbsent(re, i)
+			after := carryUnchanged(before, markAbsent(re, i+1))
+			switch {
+			case h.matches(after):
+				// Columns neither image carries kept their values.
+				h.carryForward(after)
+				row, err := rowImages.complete(re.Table, after)
+				if err != nil {
+					return err
+				}
+				w("UPDATE", row, nil, "")
+			case h.matches(before):
+				row, err := rowImages.complete(re.Table, before)
+				if err != nil {
+					return err
+				}
+				w("UPDATE", nil, row, "the update changed the key")
+			}
+		}
+	}
+	return nil
+}
+
+// carryForward fills the absent columns of row with their values in the
+// last image of the row seen before it.
+func (h *rowHistory) carryForward(row []interface{}) {
+	prev := h.last
+	if n := len(h.pending); n > 0 {
+		prev = h.pending[n-1]
+	}
+	if prev == nil || prev.row == nil {
+		return
+	}
+	for i, v := range row {
+		if isAbsent(v) && i < len(prev.row) {
+			row[i] = prev.row[i]
+		}
+	}
+}
+
+func (h *rowHistory) print(w io.Writer) {
+	fmt.Fprintf(w, "%s %s as of %s\n", h.table, strings.Join(h.key, ","), h.at.Format(timeFormat))
+	last := h.last
+	if last == nil {
+		fmt.Fprintln(w, "No committed write to this row at or before that time in the parsed range")
+		return
+	}
+	fmt.Fprintf(w, "Last write: %s at %s, position %d", last.op, time.Unix(int64(last.timestamp), 0).Format(timeFormat), last.pos)
+	if last.gtid != "" {
+		fmt.Fprintf(w, ", GTID %s", last.gtid)
+	}
+	fmt.Fprintln(w)
+	row := last.row
+	if row == nil {
+		if last.note != "" {
+			fmt.Fprintf(w, "Row no longer exists: %s. Values before that:\n", last.note)
+		} else {
+			fmt.Fprintln(w, "Row no longer exists. Values before the delete:")
+		}
+		row = last.before
+	}
+	for i, v := range row {
+		name := fmt.Sprintf("@%d", i+1)
+		if i < len(last.columns) {
+			name = last.columns[i]
+		}
+		fmt.Fprintf(w, "%s: %s\n", name, appendValue(nil, v))
+	}
+}
+
+func valueAtCommand(startPosition int64) {
+	if *valueTable == "" || *valuePK == "" || *valueTS == "" {
+		fmt.Fprintf(os.Stderr, "Error: value-at requires -table, -pk and -ts\n")
+		os.Exit(1)
+	}
+	at, err := parseDatetime(*valueTS)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	h := &rowHistory{table: *valueTable, key: strings.Split(*valuePK, ","), at: at}
+	err = parseBinlog(newParser(true), *binlogFile, startPosition, func(e *replication.BinlogEvent) error {
+		if beforeStart(e, startPosition) {
+			return nil
+		}
+		return h.observe(e)
+	})
+	h.print(os.Stdout)
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+var warnGrepColumns = &warningCategory{
+	name: "tables -grepColumn could not search without their column names",
+	hint: "Log them with binlog_row_metadata=FULL, give their CREATE TABLE with -schemaFile, or name the columns by position as @N.",
+}
+
+// valueGrep keeps, of the dump's events, the rows events with a row image
+// holding a value, from -grepValue: anywhere, or only in the columns of
+// -grepColumn.
+type valueGrep struct {
+	value string
+	// columns are the -grepColumn patterns, as db.table patterns and
+	// column patterns; nil searches every column.
+	columns []columnPattern
+	// searched caches the columns searched in each table map, nil for
+	// all of them.
+	searched map[*replication.TableMapEvent][]bool
+}
+
+type columnPattern struct {
+	table, column string
+}
+
+// rowsGrep is the value search of the run, nil without -grepValue.
+var rowsGrep *valueGrep
+
+// newValueGrep returns the value search set by the command line, or nil
+// when -grepValue is not set.
+func newValueGrep() (*valueGrep, error) {
+	if *grepValue == "" {
+		if *grepColumn != "" {
+			return nil, fmt.Errorf("-grepColumn needs -grepValue")
+		}
+		return nil, nil
+	}
+	g := &valueGrep{value: *grepValue}
+	for _, p := range splitPatterns(*grepColumn) {
+		// column, table.column or db.table.column
+		c := columnPattern{table: "*.*", column: p}
+		if i := strings.LastIndex(p, "."); i >= 0 {
+			c.table, c.column = p[:i], p[i+1:]
+			if !strings.Contains(c.table, ".") {
+				c.table = "*." + c.table
+			}
+		}
+		if _, err := path.Match(c.table+"."+c.column, ""); err != nil || c.column == "" {
+			return nil, fmt.Errorf("invalid -grepColumn pattern %q", p)
+		}
+		g.columns = append(g.columns, c)
+	}
+	if g.columns != nil {
+		g.searched = make(map[*replication.TableMapEvent][]bool)
+	}
+	return g, nil
+}
+
+// keep reports whether e is a rows event with the value.
+func (g *valueGrep) keep(e *replication.BinlogEvent) bool {
+	re, ok := e.Event.(*replication.RowsEvent)
+	if !ok || re.Table == nil {
+		return false
+	}
+	searched := g.searchedColumns(e, re.Table)
+	if g.columns != nil && searched == nil {
+		return false
+	}
+	unsigned := re.Table.UnsignedMap()
+	lists := columnValueLists(re.Table)
+	for _, row := range re.Rows {
+		for i, v := range row {
+			if v == nil || isAbsent(v) || searched != nil && (i >= len(searched) || !searched[i]) {
+				continue
+			}
+			v = displayTimestamp(re.Table, i, typedValue(re.Table, unsigned, i, v))
+			v = exactValue(re.Table, lists, i, v)
+			if fmt.Sprint(jsonValue(v)) == g.value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// searchedColumns returns the columns of t that -grepColumn names, nil
+// for every column without -grepColumn, and nil with it when it names
+// none of t's.
+func (g *valueGrep) searchedColumns(e *replication.BinlogEvent, t *replication.TableMapEvent) []bool {
+	if g.columns == nil {
+		return nil
+	}
+	if searched, ok := g.searched[t]; ok {
+		return searched
+	}
+	var searched []bool
+	names := columnNames(t)
+	unnamed := false
+	for _, c := range g.columns {
+		if !matchTable([]string{c.table}, tableName(t)) {
+			continue
+		}
+		for i := range t.ColumnType {
+			if ok, _ := path.Match(c.column, columnLabel(names, i)); !ok && c.column != "@"+strconv.Itoa(i+1) {
+				continue
+			}
+			if searched == nil {
+				searched = make([]bool, len(t.ColumnType))
+			}
+			searched[i] = true
+		}
+		if names == nil && !strings.HasPrefix(c.column, "@") {
+			unnamed = true
+		}
+	}
+	if unnamed && searched == nil {
+		runWarnings.note(warnGrepColumns, e.Header.LogPos-e.Header.EventSize, tableName(t))
+	}
+	if len(g.searched) >= 4096 {
+		clear(g.searched)
+	}
+	g.searched[t] = searched
+	return searched
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"os/exec"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// maxListedDiscrepancies bounds the discrepancies verify-against-mysqlbinlog
+// lists; the rest are only counted.
+const maxListedDiscrepancies = 100
+
+// decodedImage is a row image as go-parse decodes it: row r of a rows event.
+type decodedImage struct {
+	pos  int64
+	re   *replication.RowsEvent
+	row  int
+	kind string
+}
+
+// printedImage is a row image as mysqlbinlog -v prints it: the values of
+// the columns it carries, as text, by column index.
+type printedImage struct {
+	table  string
+	kind   string
+	values map[int]string
+}
+
+// imageKind names an image by its statement and, for an UPDATE, whether it
+// is the before image (WHERE) or the after image (SET).
+func imageKind(statement, section string) string {
+	switch {
+	case statement == "UPDATE" && section == "WHERE":
+		return "UPDATE before"
+	case statement == "UPDATE":
+		return "UPDATE after"
+	}
+	return statement
+}
+
+// verifyCounts are the totals verify-against-mysqlbinlog reports.
+type verifyCounts struct {
+	images, values, skipped, discrepancies int
+}
+
+// verifyAgainstMysqlbinlog runs mysqlbinlog -v on binlogFile over the same
+// range go-parse reads and compares the row images it prints, one by one,
+// with those go-parse decodes, listing each discrepancy to out. The two are
+// read side by side, so a file of any size is compared in constant memory.
+func verifyAgainstMysqlbinlog(binlogFile string, startPosition int64, out io.Writer) (verifyCounts, error) {
+	var counts verifyCounts
+	args := []string{"--base64-output=DECODE-ROWS", "-v"}
+	if startPosition > 4 {
+		args = append(args, "--start-position="+strconv.FormatInt(startPosition, 10))
+	}
+	if *stopPos > 0 {
+		args = append(args, "--stop-position="+strconv.FormatInt(*stopPos, 10))
+	}
+	cmd := exec.Command(*mysqlbinlogPath, append(args, binlogFile)...)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return counts, err
+	}
+	if err := cmd.Start(); err != nil {
+		return counts, fmt.Errorf("run %s: %v", *mysqlbinlogPath, err)
+	}
+
+	decoded := make(chan decodedImage, 256)
+	parsed := make(chan error, 1)
+	go func() {
+		defer close(decoded)
+		stop := newStopPosition([]string{binlogFile})
+		stop.next(binlogFile)
+		p := newParser(true)
+		parsed <- parseBinlog(p, binlogFile, startPosition, func(e *replication.BinlogEvent) error {
+			if beforeStart(e, startPosition) {
+				return nil
+			}
+			if stop.past(e.Header) {
+				return errStopParsing
+			}
+			re, ok := e.Event.(*replication.RowsEvent)
+			kind := rowsEventKind(e.Header.EventType)
+			if !ok || re.Table == nil || kind == "" {
+				return nil
+			}
+			pos := int64(e.Header.LogPos)
+			if !inPayload(e.Header) {
+				pos -= int64(e.Header.EventSize)
+			}
+			for r := range re.Rows {
+				section := "SET"
+				if kind == "DELETE" || kind == "UPDATE" && r%2 == 0 {
+					section = "WHERE"
+				}
+				decoded <- decodedImage{pos, re, r, imageKind(kind, section)}
+			}
+			return nil
+		})
+	}()
+
+	listed := 0
+	report := func(format string, args ...interface{}) {
+		counts.discrepancies++
+		if listed++; listed <= maxListedDiscrepancies {
+			fmt.Fprintf(out, format+"\n", args...)
+		}
+	}
+	compare := func(p *printedImage) {
+		counts.images++
+		d, ok := <-decoded
+		if !ok {
+			report("%s %s: in the mysqlbinlog output only", p.table, p.kind)
+			return
+		}
+		compareImages(d, p, &counts, report)
+	}
+
+	var cur *printedImage
+	var statement string
+	r := bufio.NewReaderSize(stdout, 64*1024)
+	for {
+		line, err := r.ReadString('\n')
+		line = strings.TrimSuffix(line, "\n")
+		rest, isRows := strings.CutPrefix(line, "### ")
+		switch {
+		case !isRows:
+			if cur != nil {
+				compare(cur)
+				cur = nil
+			}
+		case strings.HasPrefix(rest, "INSERT INTO "), strings.HasPrefix(rest, "UPDATE "), strings.HasPrefix(rest, "DELETE FROM "):
+			if cur != nil {
+				compare(cur)
+			}
+			fields := strings.Fields(rest)
+			statement = fields[0]
+			cur = &printedImage{table: unquoteTable(fields[len(fields)-1])}
+		case rest == "SET" || rest == "WHERE":
+			if cur == nil {
+				break
+			}
+			if cur.kind != "" {
+				compare(cur)
+				cur = &printedImage{table: cur.table}
+			}
+			cur.kind = imageKind(statement, rest)
+			cur.values = make(map[int]string)
+		case cur != nil && cur.values != nil:
+			col, value, ok := strings.Cut(strings.TrimSpace(rest), "=")
+			if n, err := strconv.Atoi(strings.TrimPrefix(col, "@")); ok && err == nil && n > 0 {
+				cur.values[n-1] = value
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	if cur != nil {
+		compare(cur)
+	}
+	for d := range decoded {
+		counts.images++
+		report("%d %s %s: decoded by go-parse only", d.pos, tableName(d.re.Table), d.kind)
+	}
+	if listed > maxListedDiscrepancies {
+		fmt.Fprintf(out, "... and %d more\n", listed-maxListedDiscrepancies)
+	}
+	if err := cmd.Wait(); err != nil {
+		return counts, fmt.Errorf("%s: %v", *mysqlbinlogPath, err)
+	}
+	return counts, <-parsed
+}
+
+// unquoteTable turns mysqlbinlog's `db`.`table` into db.table.
+func unquoteTable(s string) string {
+	db, table, _ := strings.Cut(s, "`.`")
+	return strings.ReplaceAll(strings.Trim(db, "`"), "``", "`") + "." + strings.ReplaceAll(strings.Trim(table, "`"), "``", "`")
+}
+
+// compareImages reports where image d, as go-parse decodes it, differs
+// from image p, as mysqlbinlog prints it.
+func compareImages(d decodedImage, p *printedImage, counts *verifyCounts, report func(string, ...interface{})) {
+	t := d.re.Table
+	where := fmt.Sprintf("%d %s %s", d.pos, tableName(t), d.kind)
+	if tableName(t) != p.table || d.kind != p.kind {
+		report("%s: mysqlbinlog shows %s %s", where, p.table, p.kind)
+		return
+	}
+	names := columnNames(t)
+	row := markAbsent(d.re, d.row)
+	for i, v := range row {
+		text, printed := p.values[i]
+		label := columnLabel(names, i)
+		switch {
+		case isAbsent(v) && printed:
+			report("%s %s: not in go-parse's row image, mysqlbinlog %s", where, label, text)
+		case isAbsent(v):
+		case !printed:
+			report("%s %s: not in mysqlbinlog's row image, go-parse %s", where, label, verifyText(v))
+		default:
+			if _, partial := v.(*partialJSON); partial {
+				counts.skipped++
+				continue
+			}
+			counts.values++
+			if !printedValueMatches(t, i, v, text) {
+				report("%s %s: go-parse %s, mysqlbinlog %s", where, label, verifyText(v), text)
+			}
+		}
+	}
+	for i, text := range p.values {
+		if i >= len(row) {
+			report("%s @%d: not in go-parse's row image, mysqlbinlog %s", where, i+1, text)
+		}
+	}
+}
+
+// verifyText is value v of a discrepancy as go-parse decodes it.
+func verifyText(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return strconv.Quote(v)
+	case []byte:
+		return "X'" + hex.EncodeToString(v) + "'"
+	}
+	return fmt.Sprint(v)
+}
+
+// printedValueMatches reports whether value v of column i of table t, as
+// go-parse decodes it, is the value mysqlbinlog -v prints as text.
+// mysqlbinlog prints a string in the bytes of its character set, which
+// are converted as go-parse converts the column's (see decodeCharsets); an
+// integer signed, followed by its unsigned value when negative; ENUM and
+// SET values by index and bitmap, and BIT values, as bits; a TIMESTAMP as
+// seconds since the epoch; a DATE with colons; and a FLOAT or DOUBLE with
+// fewer digits, to which go-parse's value is rounded.
+func printedValueMatches(t *replication.TableMapEvent, i int, v interface{}, text string) bool {
+	if text == "NULL" {
+		return v == nil
+	}
+	if v == nil {
+		return false
+	}
+	if bits, ok := strings.CutPrefix(text, "b'"); ok {
+		n, err := strconv.ParseUint(strings.TrimSuffix(bits, "'"), 2, 64)
+		if err != nil {
+			return false
+		}
+		text = strconv.FormatUint(n, 10)
+	}
+	switch t.ColumnType[i] {
+	case mysql.MYSQL_TYPE_TIMESTAMP, mysql.MYSQL_TYPE_TIMESTAMP2:
+		if text == "0" || strings.HasPrefix(text, "0.") {
+			s, ok := v.(string)
+			return ok && strings.HasPrefix(s, "0000-00-00")
+		}
+		tv, ok := v.(interface{ UnixMicro() int64 })
+		if !ok {
+			return false
+		}
+		printed, ok := new(big.Rat).SetString(text)
+		return ok && printed.Cmp(big.NewRat(tv.UnixMicro(), 1e6)) == 0
+	case mysql.MYSQL_TYPE_NEWDECIMAL:
+		a, ok := new(big.Rat).SetString(fmt.Sprint(v))
+		b, ok2 := new(big.Rat).SetString(text)
+		return ok && ok2 && a.Cmp(b) == 0
+	case mysql.MYSQL_TYPE_DATE, mysql.MYSQL_TYPE_NEWDATE:
+		text = strings.ReplaceAll(text, ":", "-")
+	case mysql.MYSQL_TYPE_JSON:
+		s, ok := unquotePrinted(text)
+		if !ok {
+			return false
+		}
+		var a, b interface{}
+		return json.Unmarshal([]byte(fmt.Sprint(v)), &a) == nil && json.Unmarshal(s, &b) == nil && reflect.DeepEqual(a, b)
+	}
+
+	switch v := v.(type) {
+	case int, int8, int16, int32, int64, uint8, uint16, uint32, uint64:
+		// The signed value, then the unsigned one in parentheses.
+		printed := strings.Fields(strings.NewReplacer("(", "", ")", "").Replace(text))
+		for _, decoded := range []interface{}{v, columnValue(v, true)} {
+			for _, p := range printed {
+				if p == fmt.Sprint(decoded) {
+					return true
+				}
+			}
+		}
+		return false
+	case float32, float64:
+		printed, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return false
+		}
+		f := reflect.ValueOf(v).Float()
+		digits := len(strings.TrimLeft(strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, strings.SplitN(strings.ToLower(text), "e", 2)[0]), "0"))
+		if digits == 0 {
+			return f == 0
+		}
+		rounded, _ := strconv.ParseFloat(strconv.FormatFloat(f, 'g', digits, 64), 64)
+		return rounded == printed || f == printed
+	case string, []byte:
+		s, ok := unquotePrinted(text)
+		if !ok {
+			return false
+		}
+		var printed interface{} = string(s)
+		if d := charsetDecoderFor(t); d != nil && d[i] != nil {
+			printed = d[i](printed)
+		}
+		return bytes.Equal(valueBytes(v), valueBytes(printed))
+	}
+	s, ok := unquotePrinted(text)
+	return ok && fmt.Sprint(v) == string(s)
+}
+
+// unquotePrinted returns the bytes of a string mysqlbinlog prints quoted,
+// with the bytes below 0x20 as \xNN and all others as they are.
+func unquotePrinted(text string) ([]byte, bool) {
+	if len(text) < 2 || text[0] != '\'' || text[len(text)-1] != '\'' {
+		return nil, false
+	}
+	text = text[1 : len(text)-1]
+	b := make([]byte, 0, len(text))
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' && i+3 < len(text) && text[i+1] == 'x' {
+			if c, err := strconv.ParseUint(text[i+2:i+4], 16, 8); err == nil && c < 0x20 {
+				b = append(b, byte(c))
+				i += 3
+				continue
+			}
+		}
+		b = append(b, text[i])
+	}
+	return b, true
+}
+
+func valueBytes(v interface{}) []byte {
+	switch v := v.(type) {
+	case string:
+		return []byte(v)
+	case []byte:
+		return v
+	}
+	return []byte(fmt.Sprint(v))
+}
+
+func verifyAgainstMysqlbinlogCommand(startPosition int64) {
+	switch {
+	case *dsn != "":
+		fmt.Fprintf(os.Stderr, "Error: verify-against-mysqlbinlog reads a local -file, not -dsn\n")
+		os.Exit(1)
+	case isS3URL(*binlogFile), binlogCompression(*binlogFile) != "":
+		fmt.Fprintf(os.Stderr, "Error: verify-against-mysqlbinlog reads a local, uncompressed -file, as mysqlbinlog does\n")
+		os.Exit(1)
+	}
+	counts, err := verifyAgainstMysqlbinlog(*binlogFile, startPosition, os.Stdout)
+	if err == nil || counts.images > 0 {
+		fmt.Printf("%d row images, %d values compared, %d partial JSON values skipped, %d discrepancies\n",
+			counts.images, counts.values, counts.skipped, counts.discrepancies)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if counts.discrepancies > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// runWarnings collects the problems met while parsing that do not stop the
+// run. They are reported together, by category, when the run ends instead
+// of being interleaved with the output.
+var runWarnings = new(warningCollector)
+
+// warningCategory is one kind of problem in the end-of-run summary.
+type warningCategory struct {
+	name string
+	hint string
+}
+
+var (
+	// warnNoTableMap is a rows event without its TableMapEvent, which
+	// happens when parsing starts after the table map of an in-flight
+	// transaction. Such events cannot be decoded.
+	warnNoTableMap = &warningCategory{
+		name: "rows events without their TableMapEvent",
+		hint: "Start from the transaction's first event to decode them.",
+	}
+	warnUnknownEvent = &warningCategory{
+		name: "unknown event types",
+		hint: "The events are newer than go-parse understands; their bodies are shown as raw bytes.",
+	}
+	warnRawEvent = &warningCategory{
+		name: "events shown as raw bytes",
+		hint: "go-parse does not decode these event types; -eventTypes lists how each type is handled.",
+	}
+	warnMalformedHeartbeat = &warningCategory{
+		name: "malformed heartbeats",
+	}
+	warnSchemaMismatch = &warningCategory{
+		name: "tables whose -schemaFile columns do not match the binlog",
+		hint: "The table changed between the binlog and the schema; its values are labelled by position.",
+	}
+	warnDuplicateGTID = &warningCategory{
+		name: "duplicate transactions skipped",
+		hint: "-dedupGTIDs skipped transactions whose GTID was already read from an earlier file or source.",
+	}
+)
+
+// warningExamples is how many positions are listed per category.
+const warningExamples = 3
+
+type warningCategoryCount struct {
+	cat      *warningCategory
+	count    int
+	examples []string
+}
+
+type warningCollector struct {
+	// mu serializes observe for runs that parse several sources at once.
+	mu   sync.Mutex
+	cats []*warningCategoryCount
+	// gapTables is the set of table ids already reported without a table
+	// map, so each appears once among the examples.
+	gapTables map[uint64]bool
+	// schemaTables is the set of tables already reported as not matching
+	// -schemaFile.
+	schemaTables map[string]bool
+}
+
+// add records one occurrence of cat at position pos.
+func (c *warningCollector) add(cat *warningCategory, pos uint32, detail string) {
+	var wc *warningCategoryCount
+	for _, x := range c.cats {
+		if x.cat == cat {
+			wc = x
+			break
+		}
+	}
+	if wc == nil {
+		wc = &warningCategoryCount{cat: cat}
+		c.cats = append(c.cats, wc)
+	}
+	wc.count++
+	if detail != "" && len(wc.examples) < warningExamples {
+		wc.examples = append(wc.examples, strconv.FormatUint(uint64(pos), 10)+" ("+detail+")")
+	}
+}
+
+// note records one occurrence of cat found outside observe.
+func (c *warningCollector) note(cat *warningCategory, pos uint32, detail string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(cat, pos, detail)
+}
+
+// observe checks e for the problems that can be seen in a decoded event.
+func (c *warningCollector) observe(e *replication.BinlogEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pos := e.Header.LogPos
+	if pos >= e.Header.EventSize {
+		pos -= e.Header.EventSize
+	}
+	switch ev := e.Event.(type) {
+	case *replication.TableMapEvent:
+		name := tableName(ev)
+		if _, ok := tableSchemas[name]; !ok || columnNames(ev) != nil || c.schemaTables[name] {
+			return
+		}
+		if c.schemaTables == nil {
+			c.schemaTables = make(map[string]bool)
+		}
+		c.schemaTables[name] = true
+		c.add(warnSchemaMismatch, pos, name)
+	case *replication.RowsEvent:
+		if ev.Table != nil {
+			return
+		}
+		detail := ""
+		if !c.gapTables[ev.TableID] {
+			if c.gapTables == nil {
+				c.gapTables = make(map[uint64]bool)
+			}
+			c.gapTables[ev.TableID] = true
+			detail = "table id " + strconv.FormatUint(ev.TableID, 10)
+		}
+		c.add(warnNoTableMap, pos, detail)
+	case *replication.GenericEvent:
+		switch t := e.Header.EventType; t {
+		case replication.STOP_EVENT:
+		case replication.HEARTBEAT_EVENT, replication.HEARTBEAT_LOG_EVENT_V2:
+			if _, ok := decodeHeartbeat(e); !ok {
+				c.add(warnMalformedHeartbeat, pos, t.String())
+			}
+		default:
+			if _, known := eventTypeSupport[t]; known {
+				c.add(warnRawEvent, pos, eventTypeName(t))
+			} else {
+				c.add(warnUnknownEvent, pos, "type "+strconv.Itoa(int(t)))
+			}
+		}
+	}
+}
+
+// summary writes the warnings collected so far, if any.
+func (c *warningCollector) summary(w io.Writer) {
+	if len(c.cats) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "=== Warnings ===")
+	for _, wc := range c.cats {
+		fmt.Fprintf(w, "%s: %d", wc.cat.name, wc.count)
+		if len(wc.examples) > 0 {
+			fmt.Fprintf(w, ", at %s", strings.Join(wc.examples, ", "))
+			if wc.count > len(wc.examples) {
+				fmt.Fprint(w, ", ...")
+			}
+		}
+		fmt.Fprintln(w)
+		if wc.cat.hint != "" {
+			fmt.Fprintf(w, "  %s\n", wc.cat.hint)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// progress records the last event successfully handed out by parseBinlog,
+// for the watchdog's diagnostics.
+var progress struct {
+	file    atomic.Value // string
+	pos     atomic.Uint32
+	events  atomic.Int64
+	updated atomic.Int64 // unix nanoseconds
+}
+
+func recordProgress(file string, pos uint32) {
+	if f, _ := progress.file.Load().(string); f != file {
+		progress.file.Store(file)
+	}
+	progress.pos.Store(pos)
+	progress.events.Add(1)
+	progress.updated.Store(time.Now().UnixNano())
+}
+
+// startWatchdog aborts the process when the whole run exceeds timeout, or
+// when no event has been parsed for stall. Either limit may be zero to
+// disable it. Parsing may be blocked inside a read that never returns, so
+// the watchdog exits the process rather than trying to unwind it.
+func startWatchdog(timeout, stall time.Duration) {
+	if timeout <= 0 && stall <= 0 {
+		return
+	}
+	start := time.Now()
+	progress.updated.Store(start.UnixNano())
+
+	interval := time.Second
+	for _, d := range []time.Duration{timeout, stall} {
+		if d > 0 && d/4 < interval {
+			interval = d / 4
+		}
+	}
+
+	go func() {
+		for range time.Tick(interval) {
+			now := time.Now()
+			if timeout > 0 && now.Sub(start) >= timeout {
+				watchdogAbort(fmt.Sprintf("timeout of %s exceeded", timeout))
+			}
+			last := time.Unix(0, progress.updated.Load())
+			if stall > 0 && now.Sub(last) >= stall {
+				watchdogAbort(fmt.Sprintf("no progress for %s", now.Sub(last).Round(time.Millisecond)))
+			}
+		}
+	}()
+}
+
+func watchdogAbort(reason string) {
+	file, _ := progress.file.Load().(string)
+	if file == "" {
+		file = *binlogFile
+	}
+	fmt.Fprintf(os.Stderr, "Error: %s; aborting\n", reason)
+	fmt.Fprintf(os.Stderr, "File: %s\n", file)
+	fmt.Fprintf(os.Stderr, "Events parsed: %d\n", progress.events.Load())
+	if progress.events.Load() > 0 {
+		fmt.Fprintf(os.Stderr, "Last good log position: %d\n", progress.pos.Load())
+	}
+	os.Exit(2)
+}
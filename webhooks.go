@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// defaultWebhookTimeout is how long a matching event's alert may take to be
+// delivered when its rule does not say.
+const defaultWebhookTimeout = 5 * time.Second
+
+// maxWebhookRequests bounds the number of alerts in flight at once.
+const maxWebhookRequests = 8
+
+// webhookRule POSTs an alert to URL for every event matching When, a WHERE
+// expression over the columns of the query command's events table:
+//
+//	{"name": "payment deletes", "when": "op = 'DELETE' AND db = 'shop' AND table = 'payments'",
+//	 "url": "https://alerts.example.com/hook", "timeout": "5s"}
+type webhookRule struct {
+	Name    string `json:"name"`
+	When    string `json:"when"`
+	URL     string `json:"url"`
+	Timeout string `json:"timeout,omitempty"`
+	// Sink selects the request body: "webhook" (the default) POSTs a
+	// webhookAlert, "slack" and "pagerduty" format it for those services
+	// (see notify.go).
+	Sink       string `json:"sink,omitempty"`
+	RoutingKey string `json:"routing_key,omitempty"`
+	Severity   string `json:"severity,omitempty"`
+
+	cond    condition
+	encode  alertEncoder
+	timeout time.Duration
+}
+
+// webhookAlert is the JSON body POSTed for a match. ID, also sent as the
+// Idempotency-Key header, is the same whenever the event is redelivered.
+type webhookAlert struct {
+	ID    string         `json:"id"`
+	Rule  string         `json:"rule"`
+	File  string         `json:"file"`
+	GTID  string         `json:"gtid,omitempty"`
+	DB    string         `json:"db,omitempty"`
+	Table string         `json:"table,omitempty"`
+	Op    string         `json:"op,omitempty"`
+	Rows  int            `json:"rows,omitempty"`
+	Event *eventDocument `json:"event"`
+
+	// done, if set, is called with the delivery result.
+	done func(error)
+}
+
+// loadWebhookRules reads a JSON array of rules from path and compiles their
+// conditions.
+func loadWebhookRules(path string) ([]*webhookRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []*webhookRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for i, r := range rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if err := r.configureSink(); err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", path, r.Name, err)
+		}
+		if r.URL == "" {
+			return nil, fmt.Errorf("%s: %s has no url", path, r.Name)
+		}
+		if r.cond, err = parseCondition(r.When); err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", path, r.Name, err)
+		}
+		r.timeout = defaultWebhookTimeout
+		if r.Timeout != "" {
+			if r.timeout, err = time.ParseDuration(r.Timeout); err != nil || r.timeout <= 0 {
+				return nil, fmt.Errorf("%s: %s: invalid timeout %q", path, r.Name, r.Timeout)
+			}
+		}
+	}
+	return rules, nil
+}
+
+// webhookDispatcher delivers alerts concurrently. Each alert's deadline
+// starts when its event matches, so time spent waiting for a free slot
+// counts against the rule's timeout.
+type webhookDispatcher struct {
+	client    *http.Client
+	slots     chan struct{}
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+	delivered int
+	failed    int
+	log       io.Writer
+}
+
+func newWebhookDispatcher(log io.Writer) *webhookDispatcher {
+	return &webhookDispatcher{
+		client: new(http.Client),
+		slots:  make(chan struct{}, maxWebhookRequests),
+		log:    log,
+	}
+}
+
+func (d *webhookDispatcher) send(r *webhookRule, alert *webhookAlert) {
+	body, err := r.encode(r, alert)
+	if err != nil {
+		d.result(r, alert, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer cancel()
+		select {
+		case d.slots <- struct{}{}:
+			defer func() { <-d.slots }()
+		case <-ctx.Done():
+			d.result(r, alert, ctx.Err())
+			return
+		}
+		d.result(r, alert, d.post(ctx, r.URL, alert.ID, body))
+	}()
+}
+
+func (d *webhookDispatcher) post(ctx context.Context, url, id string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", id)
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
+
+func (d *webhookDispatcher) result(r *webhookRule, alert *webhookAlert, err error) {
+	if alert.done != nil {
+		defer alert.done(err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err != nil {
+		d.failed++
+		fmt.Fprintf(d.log, "%s: alert for position %d failed: %v\n", r.Name, alert.Event.LogPos-alert.Event.EventSize, err)
+		return
+	}
+	d.delivered++
+}
+
+// wait blocks until every alert has been delivered or has timed out.
+func (d *webhookDispatcher) wait() {
+	d.wg.Wait()
+}
+
+// watchEvents evaluates rules against every event from startPosition and
+// POSTs an alert for each match. With a position store it records how far
+// alerts have been delivered (see deliveryLog). With -follow it goes on
+// into the files the binlog rotates to. SIGHUP reloads the rules from
+// -webhooks.
+func watchEvents(binlogFile string, startPosition int64, rules []*webhookRule, store positionStore, out io.Writer) error {
+	d := newWebhookDispatcher(os.Stderr)
+	matches := 0
+	onReload("-webhooks", func() error {
+		reloaded, err := loadWebhookRules(*webhookRules)
+		if err == nil {
+			rules = reloaded
+		}
+		return err
+	})
+
+	var deliveries *deliveryLog
+	var cur *deliveryTx
+	var tx txTracker
+	if store != nil {
+		deliveries = newDeliveryLog(store, binlogFile)
+	}
+
+	p := newParser(true)
+	gtid := ""
+	src := newEventSource(binlogFile)
+	fileStart := startPosition
+	err := parseBinlogs(p, []string{binlogFile}, startPosition, func(file string, start int64) {
+		binlogFile, fileStart = file, start
+		src.file = filepath.Base(file)
+		if deliveries != nil {
+			deliveries.rotate(file)
+		}
+	}, func(e *replication.BinlogEvent) error {
+		src.observe(e)
+		if beforeStart(e, fileStart) {
+			return nil
+		}
+		if deliveries != nil && cur == nil {
+			cur = deliveries.open()
+		}
+		if ev, ok := e.Event.(*replication.GTIDEvent); ok {
+			gtid = gtidString(ev)
+		}
+		rec := newEventRecord(e, gtid)
+		for _, r := range rules {
+			if !r.cond.match(rec) {
+				continue
+			}
+			matches++
+			fmt.Fprintf(out, "%s: %s %s at position %d\n", r.Name, rec.typ, qualifiedName(rec.db, rec.table), rec.startPos)
+			alert := &webhookAlert{
+				ID:    alertID(r.Name, binlogFile, rec.startPos, gtid),
+				Rule:  r.Name,
+				File:  binlogFile,
+				GTID:  gtid,
+				DB:    rec.db,
+				Table: rec.table,
+				Op:    rec.op,
+				Rows:  rec.rows,
+				Event: src.document(e),
+			}
+			if deliveries != nil {
+				alert.done = deliveries.sent(cur)
+			}
+			d.send(r, alert)
+		}
+		if done := tx.observe(e); done != nil && deliveries != nil {
+			deliveries.close(cur, done.End, done.GTID)
+			cur = nil
+		}
+		if _, ok := e.Event.(*replication.XIDEvent); ok {
+			gtid = ""
+		}
+		return nil
+	})
+	d.wait()
+	if deliveries != nil {
+		if ferr := deliveries.flush(); ferr != nil && err == nil {
+			err = ferr
+		}
+	}
+	fmt.Fprintf(out, "Matches: %d, delivered: %d, failed: %d\n", matches, d.delivered, d.failed)
+	return err
+}
+
+// qualifiedName joins a schema and table name for display.
+func qualifiedName(db, table string) string {
+	switch {
+	case table == "":
+		return db
+	case db == "":
+		return table
+	}
+	return db + "." + table
+}
+
+func watchCommand(startPosition int64) {
+	if *webhookRules == "" {
+		fmt.Fprintf(os.Stderr, "Error: watch requires -webhooks <rules file>\n")
+		os.Exit(1)
+	}
+	rules, err := loadWebhookRules(*webhookRules)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	// watch records delivered positions itself, not parsed ones.
+	store := positions
+	positions = nil
+	if store != nil && *offset == -1 && *logPosition == -1 {
+		files, start, err := resumeFrom(store, []string{*binlogFile})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if start != -1 {
+			*binlogFile, startPosition = files[0], start
+		}
+	}
+	if err := watchEvents(*binlogFile, startPosition, rules, store, os.Stdout); err != nil {
+		fmt.Println(err.Error())
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ChaosHour/go-parse/pkg/binlogwriter"
+)
+
+// TestWatchFollowRotation checks that watch -follow goes on into the file
+// the binlog rotates to, naming that file in its alerts and in the position
+// it records.
+func TestWatchFollowRotation(t *testing.T) {
+	dir := t.TempDir()
+	specs := make(map[string]*binlogwriter.Spec)
+	for _, c := range testdataCases() {
+		specs[c.name] = c.spec
+	}
+	// The ddl binlog rotates to ddl.000002, here the charsets binlog, which
+	// ends with a STOP event.
+	first, second := filepath.Join(dir, "ddl.000001"), filepath.Join(dir, "ddl.000002")
+	if err := binlogwriter.WriteFile(first, specs["ddl"]); err != nil {
+		t.Fatal(err)
+	}
+	if err := binlogwriter.WriteFile(second, specs["charsets"]); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var alerts []webhookAlert
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a webhookAlert
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		alerts = append(alerts, a)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	rules := filepath.Join(dir, "rules.json")
+	if err := os.WriteFile(rules, []byte(fmt.Sprintf(`[{"name": "texts", "when": "table = 'texts'", "url": %q}]`, srv.URL)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	state := filepath.Join(dir, "state.json")
+
+	out := string(runGoParse(t, "watch", "-follow", "-file", first, "-offset", "4", "-webhooks", rules, "-stateFile", state))
+	if !strings.Contains(out, "Matches: 4, delivered: 4, failed: 0") {
+		t.Fatalf("alerts of ddl.000002 not delivered:\n%s", out)
+	}
+	for _, a := range alerts {
+		if a.File != second || !strings.HasPrefix(a.ID, "texts:ddl.000002:") || a.Event.File != "ddl.000002" {
+			t.Errorf("alert %s of %s, event of %s, want them of %s", a.ID, a.File, a.Event.File, second)
+		}
+	}
+	data, err := os.ReadFile(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st parseState
+	if err := json.Unmarshal(data, &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.File != second || st.Position != 928 {
+		t.Errorf("delivered up to %s:%d, want %s:928", st.File, st.Position, second)
+	}
+
+	// Restarted as it was, it resumes in the file it followed into.
+	out = string(runGoParse(t, "watch", "-follow", "-file", first, "-webhooks", rules, "-stateFile", state))
+	if !strings.Contains(out, "Resuming from the position store at "+second+":928") || !strings.Contains(out, "Matches: 0,") {
+		t.Errorf("restart did not resume after the delivered alerts:\n%s", out)
+	}
+}